@@ -3,18 +3,39 @@ package main
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/api/auth"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/api/middleware"
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/api/router"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/logging"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/metrics"
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/ui"
 	"github.com/jessevdk/go-flags"
 )
 
 type options struct {
-	Port        int    `short:"p" long:"port" description:"Port for API to listen on" required:"true"`
-	DatabaseUrl string `short:"d" long:"database-url" description:"Database URL in which to store metadata" required:"true"`
+	Port            int           `short:"p" long:"port" description:"Port for API to listen on" required:"true"`
+	DatabaseUrl     string        `short:"d" long:"database-url" description:"Database URL in which to store metadata" required:"true"`
+	TraceExporter   string        `long:"trace-exporter" description:"Exporter for OpenTelemetry traces" choice:"none" choice:"otlp" choice:"stdout" default:"none"`
+	LogLevel        string        `long:"log-level" description:"Minimum severity of logs" choice:"debug" choice:"info" choice:"warn" choice:"error" default:"info"`
+	MaxEventAge     time.Duration `long:"max-event-age" description:"Fail readiness if the subscriber has not processed an event within this duration, measured from startup until the first event, disabled if not set"`
+	ShutdownTimeout time.Duration `long:"shutdown-timeout" description:"Time to wait for in-flight requests to complete on shutdown" default:"10s"`
+	AuthConfig      string        `long:"auth-config" description:"JSON file configuring API keys, ID token audiences and access rules, all contents are public if not set"`
+	CORSOrigins     []string      `long:"cors-origin" description:"Origin allowed to make cross-origin requests, or * for any origin, may be repeated"`
+	CORSMethods     []string      `long:"cors-method" description:"Method allowed in cross-origin requests, may be repeated" default:"GET" default:"OPTIONS"`
+	CORSHeaders     []string      `long:"cors-header" description:"Header allowed in cross-origin requests, may be repeated" default:"Authorization" default:"Content-Type" default:"X-API-Key"`
+	CORSMaxAge      time.Duration `long:"cors-max-age" description:"Time browsers may cache preflight responses" default:"1h"`
+	UI              bool          `long:"ui" description:"Serve the UI embedded in binaries built with -tags embedui"`
+	UIDir           string        `long:"ui-dir" description:"Serve the UI from a build directory instead of the embedded assets"`
 }
 
 const maxDbConnections = 5
@@ -25,28 +46,100 @@ func main() {
 		os.Exit(1)
 	}
 
+	level, err := logging.ParseLevel(opts.LogLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger := logging.New(os.Stdout, level)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Configure tracing
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Exporter(opts.TraceExporter), "gcs-metadata-api")
+	if err != nil {
+		logging.Fatal(logger, "Error configuring tracing", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	// Connect database
-	ctx := context.Background()
 	db := repo.NewDatabase(opts.DatabaseUrl, maxDbConnections)
 
 	if err := db.Connect(ctx); err != nil {
-		log.Fatalf("Error connecting to database: %v\n", err)
+		logging.Fatal(logger, "Error connecting to database", err)
 	}
 	defer db.Close()
 
 	if exists, err := db.PingTable(); !exists || err != nil {
-		log.Fatalf("Database has not been initialized: %v\n", err)
+		logging.Fatal(logger, "Database has not been initialized", err)
+	}
+
+	if err := metrics.RegisterDatabase(db.DB.DB); err != nil {
+		logging.Fatal(logger, "Error registering database metrics", err)
+	}
+
+	// Configure authentication
+	routerConfig := router.Config{
+		MaxEventAge: opts.MaxEventAge,
+		CORS: middleware.CORSConfig{
+			AllowedOrigins: opts.CORSOrigins,
+			AllowedMethods: opts.CORSMethods,
+			AllowedHeaders: opts.CORSHeaders,
+			MaxAge:         opts.CORSMaxAge,
+		},
+	}
+	if opts.AuthConfig != "" {
+		authConfig, err := auth.LoadConfig(opts.AuthConfig)
+		if err != nil {
+			logging.Fatal(logger, "Error loading auth config", err)
+		}
+
+		if routerConfig.Auth, err = auth.NewMiddlewareFromConfig(ctx, authConfig, repo.NewBucketRepository(db), logger); err != nil {
+			logging.Fatal(logger, "Error configuring auth", err)
+		}
+	} else {
+		logger.Warn("No auth config set, bucket contents are public")
+	}
+
+	// Configure UI
+	if opts.UI || opts.UIDir != "" {
+		var assets fs.FS
+		if opts.UIDir != "" {
+			assets = os.DirFS(opts.UIDir)
+		} else if assets, err = ui.Assets(); err != nil {
+			logging.Fatal(logger, "Error loading UI", err)
+		}
+
+		if routerConfig.UI, err = ui.Handler(assets); err != nil {
+			logging.Fatal(logger, "Error loading UI", err)
+		}
 	}
 
 	// Start server
-	router := router.New(db)
+	router := router.New(db, routerConfig, logger)
 	server := http.Server{
 		Addr:    fmt.Sprintf(":%d", opts.Port),
 		Handler: router,
 	}
 
-	log.Println("Starting server on port", server.Addr)
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatalf("Error in server: %v\n", err)
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Starting server", "addr", server.Addr)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		logging.Fatal(logger, "Error in server", err)
+	case <-ctx.Done():
+	}
+
+	// Drain in-flight requests before closing the database
+	logger.Info("Shutting down server", "timeout", opts.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), opts.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Error shutting down server", logging.KeyError, err)
 	}
 }
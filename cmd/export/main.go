@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/export"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/logging"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+	"github.com/jessevdk/go-flags"
+)
+
+type options struct {
+	DatabaseUrl string `short:"d" long:"database-url" description:"Database URL from which to export metadata" required:"true"`
+	Path        string `short:"p" long:"path" description:"Directory to export, such as a/b/" default:"/"`
+	Bucket      string `short:"b" long:"bucket" description:"Bucket to export, all buckets if not set"`
+	Format      string `short:"f" long:"format" description:"Output format" choice:"csv" choice:"jsonl" choice:"parquet" default:"csv"`
+	Depth       int    `long:"depth" description:"Maximum depth below path to export, unlimited if not set"`
+	Kind        string `long:"kind" description:"Entries to export" choice:"all" choice:"objects" choice:"directories" default:"all"`
+	Output      string `short:"o" long:"output" description:"File to write the export to, stdout if not set"`
+	LogLevel    string `long:"log-level" description:"Minimum severity of logs" choice:"debug" choice:"info" choice:"warn" choice:"error" default:"info"`
+}
+
+const maxDbConnections = 1
+
+func main() {
+	var opts options
+	if _, err := flags.Parse(&opts); err != nil {
+		os.Exit(1)
+	}
+
+	level, err := logging.ParseLevel(opts.LogLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Logs are written to stderr since the export may be written to stdout
+	logger := logging.New(os.Stderr, level)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, opts, logger); err != nil {
+		logging.Fatal(logger, "Error while exporting", err)
+	}
+}
+
+// run writes the export to the output and returns once it is complete.
+// A partially written output file is removed on error.
+func run(ctx context.Context, opts options, logger *slog.Logger) (err error) {
+	// Connect database
+	db := repo.NewDatabase(opts.DatabaseUrl, maxDbConnections)
+
+	if err := db.Connect(ctx); err != nil {
+		return fmt.Errorf("error connecting to database: %w", err)
+	}
+	defer db.Close()
+
+	if exists, err := db.PingTable(); !exists || err != nil {
+		return fmt.Errorf("database has not been initialized: %w", err)
+	}
+
+	// Open output
+	var out io.Writer = os.Stdout
+	if opts.Output != "" {
+		file, err := os.Create(opts.Output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(opts.Output)
+			}
+		}()
+		out = file
+	}
+
+	writer, err := export.NewWriter(export.Format(opts.Format), out)
+	if err != nil {
+		return err
+	}
+
+	// Normalize path by adding the delimiter of the bucket as suffix if missing
+	sep, err := repo.NewBucketRepository(db).Separator(ctx, opts.Bucket)
+	if err != nil {
+		return err
+	}
+	path := sep.Normalize(opts.Path)
+
+	exportOpts := repo.ExportOptions{
+		Bucket: opts.Bucket,
+		Path:   path,
+		Depth:  opts.Depth,
+		Kind:   repo.EntryKind(opts.Kind),
+	}
+
+	logger.Info("Starting export", "path", path, logging.KeyBucket, opts.Bucket, "format", opts.Format)
+	start := time.Now()
+
+	var rows int64
+	exportRepo := repo.NewExportRepository(db)
+	if err := exportRepo.Export(ctx, exportOpts, func(row *model.Metadata) error {
+		rows++
+		return writer.Write(row)
+	}); err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	logger.Info("Export completed", "rows", rows, "duration", time.Since(start).String())
+	return nil
+}
@@ -2,71 +2,362 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/logging"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/metrics"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/seeder"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/source"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
 	"github.com/jessevdk/go-flags"
+	storagev1 "google.golang.org/api/storage/v1"
 )
 
 type options struct {
-	BucketId    string `short:"b" long:"bucket-id" description:"Bucket ID to fetch metadata from" required:"true"`
-	DatabaseUrl string `short:"d" long:"database-url" description:"Database URL in which to store metadata" required:"true"`
+	Source           string        `long:"source" description:"Source of bucket objects" choice:"gcs" choice:"local" choice:"s3" default:"gcs"`
+	LocalRoot        string        `long:"local-root" description:"Directory holding a subdirectory per bucket ID, required for the local source"`
+	S3Endpoint       string        `long:"s3-endpoint" description:"URL of the S3-compatible store, required for the s3 source. Credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN"`
+	S3Region         string        `long:"s3-region" description:"Region of the S3-compatible store" default:"us-east-1"`
+	BucketIds        []string      `short:"b" long:"bucket-id" description:"Bucket ID to fetch metadata from, may be repeated"`
+	ProjectIds       []string      `short:"p" long:"project-id" description:"Project ID whose buckets are all fetched, may be repeated, only for the gcs source"`
+	Include          []string      `long:"include" description:"Glob pattern of bucket IDs to fetch, may be repeated"`
+	Exclude          []string      `long:"exclude" description:"Glob pattern of bucket IDs to skip, may be repeated"`
+	Concurrency      int           `long:"concurrency" description:"Number of buckets seeded concurrently" default:"4"`
+	Prefix           string        `long:"prefix" description:"Only fetch objects whose names start with the prefix"`
+	Delimiter        string        `long:"delimiter" description:"Character splitting object names into directories, recorded per bucket and only changed by reseeding a whole bucket" default:"/"`
+	StartOffset      string        `long:"start-offset" description:"Only fetch objects whose names are lexicographically equal to or after the offset"`
+	EndOffset        string        `long:"end-offset" description:"Only fetch objects whose names are lexicographically before the offset"`
+	MatchGlob        string        `long:"match-glob" description:"Only fetch objects whose names match the glob pattern"`
+	Reseed           bool          `long:"reseed" description:"Replace the metadata under --prefix with the fetched objects once fetching completes"`
+	DryRun           bool          `long:"dry-run" description:"List and count objects without reading or writing the database"`
+	EstimatedObjects int64         `long:"estimated-objects" description:"Number of objects expected over all buckets to estimate the remaining time, taken from a previous seeding if not set"`
+	ProgressInterval time.Duration `long:"progress-interval" description:"Interval between progress logs, disabled if 0" default:"30s"`
+	Report           string        `long:"report" description:"File to write a JSON report of the run to, not written if not set"`
+	FailFast         bool          `long:"fail-fast" description:"Stop seeding a bucket at the first object that fails to be inserted"`
+	MaxErrors        int64         `long:"max-errors" description:"Number of objects per bucket allowed to fail before seeding stops, unlimited if 0"`
+	MaxErrorRatio    float64       `long:"max-error-ratio" description:"Fraction of objects per bucket allowed to fail before seeding stops, unlimited if 0"`
+	FailedObjects    string        `long:"failed-objects" description:"File to write the objects that failed to be inserted to as JSON lines, not written if not set"`
+	DatabaseUrl      string        `short:"d" long:"database-url" description:"Database URL in which to store metadata, required unless --dry-run"`
+	MetricsPort      int           `long:"metrics-port" description:"Port for metrics listener, disabled if not set"`
+	TraceExporter    string        `long:"trace-exporter" description:"Exporter for OpenTelemetry traces" choice:"none" choice:"otlp" choice:"stdout" default:"none"`
+	LogLevel         string        `long:"log-level" description:"Minimum severity of logs" choice:"debug" choice:"info" choice:"warn" choice:"error" default:"info"`
+	Resume           bool          `long:"resume" description:"Resume an interrupted seeding from its last checkpoint, retrying the objects that failed before it"`
 }
 
 const maxDbConnections = 1
 
+// exitErrorBudgetExceeded is the exit code when more objects fail than the error policy allows
+const exitErrorBudgetExceeded = 2
+
 func main() {
 	var opts options
 	if _, err := flags.Parse(&opts); err != nil {
 		os.Exit(1)
 	}
 
-	log.Println("Starting seeding service")
-	log.Println("Bucket ID:", opts.BucketId)
-	log.Println("Database URL:", opts.DatabaseUrl)
+	level, err := logging.ParseLevel(opts.LogLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger := logging.New(os.Stdout, level)
+
+	if err := validateOptions(opts); err != nil {
+		logging.Fatal(logger, "Invalid options", err)
+	}
 
-	// Connect database
-	ctx := context.Background()
-	db := repo.NewDatabase(opts.DatabaseUrl, maxDbConnections)
+	logger.Info("Starting seeding service", "source", opts.Source, "buckets", opts.BucketIds, "projectIds", opts.ProjectIds, "databaseUrl", opts.DatabaseUrl, "dryRun", opts.DryRun)
 
-	if err := db.Connect(ctx); err != nil {
-		log.Fatalf("Error connecting to database: %v\n", err)
+	// Stop seeding on interrupt, committing the object in progress
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, opts, logger); err != nil {
+		if errors.Is(err, seeder.ErrInterrupted) {
+			logger.Warn("Seeding interrupted, rerun with --resume to continue")
+			os.Exit(1)
+		}
+		if errors.Is(err, seeder.ErrErrorBudgetExceeded) {
+			logger.Error("Seeding stopped, too many objects failed to be inserted", logging.KeyError, err)
+			os.Exit(exitErrorBudgetExceeded)
+		}
+		logging.Fatal(logger, "Error while seeding", err)
 	}
-	defer db.Close()
+}
+
+// run seeds the database and returns once seeding completes or is interrupted.
+// All resources are released before it returns.
+func run(ctx context.Context, opts options, logger *slog.Logger) error {
+	// Configure tracing
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Exporter(opts.TraceExporter), "gcs-metadata-seeder")
+	if err != nil {
+		return fmt.Errorf("error configuring tracing: %w", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// Connect database, which a dry run never accesses
+	var db *repo.Database
+	if !opts.DryRun {
+		db = repo.NewDatabase(opts.DatabaseUrl, maxDbConnections)
+
+		if err := db.Connect(ctx); err != nil {
+			return fmt.Errorf("error connecting to database: %w", err)
+		}
+		defer db.Close()
+	}
+
+	// Start metrics listener
+	if opts.MetricsPort != 0 {
+		if db != nil {
+			if err := metrics.RegisterDatabase(db.DB.DB); err != nil {
+				return fmt.Errorf("error registering database metrics: %w", err)
+			}
+		}
+
+		metricsServer := metrics.NewServer(opts.MetricsPort)
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("Error in metrics server", logging.KeyError, err)
+			}
+		}()
+		defer metricsServer.Close()
+	}
+
+	if db != nil {
+		if err := db.Setup(); err != nil {
+			return fmt.Errorf("error configuring database: %w", err)
+		}
 
-	if err := db.Setup(); err != nil {
-		log.Fatalf("Error configuring database: %v\n", err)
+		if err := db.CreateTables(); err != nil {
+			return fmt.Errorf("error creating tables: %w", err)
+		}
 	}
 
-	if err := db.CreateTables(); err != nil {
-		log.Fatalf("Error creating tables: %v\n", err)
+	// Connect to storage client, only used by the gcs source. Folders are listed
+	// with the JSON API service, since the client does not list them.
+	var client *storage.Client
+	var service *storagev1.Service
+	if source.Kind(opts.Source) == source.KindGCS {
+		if client, err = storage.NewClient(ctx); err != nil {
+			return fmt.Errorf("error creating storage client: %w", err)
+		}
+		defer client.Close()
+
+		if service, err = storagev1.NewService(ctx); err != nil {
+			return fmt.Errorf("error creating storage service: %w", err)
+		}
 	}
 
-	// Connect to storage client
-	client, err := storage.NewClient(ctx)
+	buckets, err := resolveBuckets(ctx, client, opts)
 	if err != nil {
-		log.Fatalf("Error creating storage client: %v\n", err)
+		return err
+	}
+	if len(buckets) == 0 {
+		return errors.New("no buckets match the given patterns")
 	}
+	logger.Info("Resolved buckets to seed", "count", len(buckets))
+
+	progress := seeder.NewProgress(opts.DryRun, opts.EstimatedObjects)
+	defer reportProgress(progress, opts, logger)
+
+	seedOpts := seedOptions(opts)
+	var seed func(ctx context.Context, bucket string) error
+
+	if db == nil {
+		for _, bucket := range buckets {
+			progress.Register(bucket, 0)
+		}
 
-	// Instantiate repositories
-	directoryRepo := repo.NewDirectoryRepository(db)
-	metadataRepo := repo.NewMetadataRepository(db)
+		seed = func(ctx context.Context, bucket string) error {
+			seedService := seeder.NewSeedService(newSource(opts, client, service, bucket), bucket, seedOpts, seeder.Dependencies{}, progress, logger)
+			return seedService.Start(ctx)
+		}
+	} else {
+		// Instantiate repositories
+		deps := seeder.Dependencies{
+			Repos:      repo.NewRepositories(db),
+			Transactor: repo.NewTransactor(db),
+		}
 
-	seedService := seeder.NewSeedService(client, opts.BucketId, directoryRepo, metadataRepo)
+		for _, bucket := range buckets {
+			progress.Register(bucket, estimateObjects(ctx, deps.Repos.Directory, bucket, seedOpts, logger))
+		}
+
+		if opts.FailedObjects != "" {
+			defer writeFailedObjects(deps.Repos.Failed, buckets, opts.FailedObjects, logger)
+		}
+
+		seed = func(ctx context.Context, bucket string) error {
+			seedService := seeder.NewSeedService(newSource(opts, client, service, bucket), bucket, seedOpts, deps, progress, logger)
+			return seedService.Start(ctx)
+		}
+	}
+
+	if opts.ProgressInterval > 0 {
+		progressCtx, stopProgress := context.WithCancel(ctx)
+		defer stopProgress()
+		go progress.Run(progressCtx, opts.ProgressInterval, logger)
+	}
 
 	// Begin seeding
 	start := time.Now()
 
-	if err := seedService.Start(ctx); err != nil {
-		log.Fatalf("Error while seeding: %v\n", err)
+	seedErr := seeder.SeedBuckets(ctx, buckets, opts.Concurrency, seed, logger)
+	if errors.Is(seedErr, seeder.ErrInterrupted) {
+		return seedErr
+	}
+
+	// Buckets seeded successfully are indexed even if others failed
+	if db != nil {
+		if err := db.CreateIndexes(); err != nil {
+			return fmt.Errorf("error creating indexes: %w", err)
+		}
+	}
+
+	if seedErr != nil {
+		return seedErr
+	}
+	logger.Info("Seeding completed", "buckets", len(buckets), "duration", time.Since(start).String())
+	return nil
+}
+
+// estimateObjects returns the number of objects of a bucket recorded by a previous seeding
+// under the listed directory, or 0 if unknown
+func estimateObjects(ctx context.Context, directoryRepo repo.DirectoryRepository, bucket string, opts seeder.Options, logger *slog.Logger) int64 {
+	// Offsets and globs list an unknown part of a directory
+	if opts.StartOffset != "" || opts.EndOffset != "" || opts.MatchGlob != "" {
+		return 0
 	}
 
-	if err := db.CreateIndexes(); err != nil {
-		log.Fatalf("Error creating indexes: %v\n", err)
+	sep, err := opts.Separator()
+	if err != nil {
+		return 0
+	}
+
+	dirName := opts.Prefix
+	switch {
+	case dirName == "":
+		dirName = paths.Root
+	case !sep.IsDir(dirName):
+		return 0
+	}
+
+	dir, err := directoryRepo.Get(ctx, bucket, dirName)
+	if err != nil {
+		logger.Warn("Error estimating objects", logging.KeyBucket, bucket, logging.KeyError, err)
+		return 0
+	}
+	if dir == nil {
+		return 0
+	}
+	return dir.Count
+}
+
+// reportProgress logs the summary of a run and writes its report file if set
+func reportProgress(progress *seeder.Progress, opts options, logger *slog.Logger) {
+	progress.Close()
+	progress.LogSummary(logger)
+
+	if opts.Report != "" {
+		if err := progress.WriteReport(opts.Report); err != nil {
+			logger.Error("Error writing report", "report", opts.Report, logging.KeyError, err)
+			return
+		}
+		logger.Info("Report written", "report", opts.Report)
+	}
+}
+
+// writeFailedObjects writes the objects of buckets that failed to be inserted to a file
+func writeFailedObjects(failedRepo repo.FailedObjectRepository, buckets []string, name string, logger *slog.Logger) {
+	written, err := seeder.WriteFailedObjects(context.Background(), failedRepo, buckets, name)
+	if err != nil {
+		logger.Error("Error writing failed objects", "failedObjects", name, logging.KeyError, err)
+		return
+	}
+	logger.Info("Failed objects written", "failedObjects", name, "count", written)
+}
+
+// validateOptions checks the flags that depend on each other and the seeding options
+func validateOptions(opts options) error {
+	if len(opts.BucketIds) == 0 && len(opts.ProjectIds) == 0 {
+		return errors.New("at least one of --bucket-id or --project-id is required")
+	}
+
+	switch {
+	case len(opts.ProjectIds) > 0 && source.Kind(opts.Source) != source.KindGCS:
+		return errors.New("--project-id is only supported by the gcs source")
+	case opts.LocalRoot == "" && source.Kind(opts.Source) == source.KindLocal:
+		return errors.New("--local-root is required for the local source")
+	case opts.S3Endpoint == "" && source.Kind(opts.Source) == source.KindS3:
+		return errors.New("--s3-endpoint is required for the s3 source")
+	}
+
+	if opts.DatabaseUrl == "" && !opts.DryRun {
+		return errors.New("--database-url is required unless --dry-run is set")
+	}
+
+	seedOpts := seedOptions(opts)
+	return seedOpts.Validate()
+}
+
+func seedOptions(opts options) seeder.Options {
+	return seeder.Options{
+		Resume:      opts.Resume,
+		Prefix:      opts.Prefix,
+		Delimiter:   opts.Delimiter,
+		StartOffset: opts.StartOffset,
+		EndOffset:   opts.EndOffset,
+		MatchGlob:   opts.MatchGlob,
+		Reseed:      opts.Reseed,
+		DryRun:      opts.DryRun,
+		Errors: seeder.ErrorPolicy{
+			FailFast:      opts.FailFast,
+			MaxErrors:     opts.MaxErrors,
+			MaxErrorRatio: opts.MaxErrorRatio,
+		},
 	}
-	log.Printf("Seeding completed. Duration: %v\n", time.Since(start))
+}
+
+// newSource returns the source listing the objects and folders of bucket
+func newSource(opts options, client *storage.Client, service *storagev1.Service, bucket string) source.Source {
+	switch source.Kind(opts.Source) {
+	case source.KindLocal:
+		return source.NewLocal(filepath.Join(opts.LocalRoot, bucket), bucket)
+	case source.KindS3:
+		return source.NewS3(source.S3Config{
+			Endpoint:     opts.S3Endpoint,
+			Region:       opts.S3Region,
+			AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		}, bucket)
+	default:
+		return source.NewGCS(client, service, bucket)
+	}
+}
+
+// resolveBuckets returns the buckets given by ID and those of the projects, filtered by the include and exclude patterns
+func resolveBuckets(ctx context.Context, client *storage.Client, opts options) ([]string, error) {
+	buckets := opts.BucketIds
+
+	if len(opts.ProjectIds) > 0 {
+		projectBuckets, err := seeder.ListBuckets(ctx, client, opts.ProjectIds)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, projectBuckets...)
+	}
+
+	return seeder.FilterBuckets(buckets, opts.Include, opts.Exclude)
 }
@@ -2,19 +2,33 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"cloud.google.com/go/pubsub"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/api/router"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/logging"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/metrics"
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/subscriber"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
 	"github.com/jessevdk/go-flags"
 )
 
 type options struct {
-	ProjectId      string `short:"p" long:"project-id" description:"Project ID where subscription resides" required:"true"`
-	SubscriptionId string `short:"s" long:"subscription-id" description:"Subscription ID to fetch metadata from" required:"true"`
-	DatabaseUrl    string `short:"d" long:"database-url" description:"Database URL in which to store metadata" required:"true"`
+	ProjectId      string        `short:"p" long:"project-id" description:"Project ID where subscription resides" required:"true"`
+	SubscriptionId string        `short:"s" long:"subscription-id" description:"Subscription ID to fetch metadata from" required:"true"`
+	DatabaseUrl    string        `short:"d" long:"database-url" description:"Database URL in which to store metadata" required:"true"`
+	MetricsPort    int           `long:"metrics-port" description:"Port for metrics listener, disabled if not set"`
+	TraceExporter  string        `long:"trace-exporter" description:"Exporter for OpenTelemetry traces" choice:"none" choice:"otlp" choice:"stdout" default:"none"`
+	LogLevel       string        `long:"log-level" description:"Minimum severity of logs" choice:"debug" choice:"info" choice:"warn" choice:"error" default:"info"`
+	HealthPort     int           `long:"health-port" description:"Port for health listener, disabled if not set"`
+	MaxEventAge    time.Duration `long:"max-event-age" description:"Fail readiness if no event has been processed within this duration, measured from startup until the first event, disabled if not set"`
 }
 
 const maxDbConnections = 1
@@ -25,37 +39,91 @@ func main() {
 		os.Exit(1)
 	}
 
-	log.Println("Starting subscriber service")
-	log.Println("Project ID:", opts.ProjectId)
-	log.Println("Subscription ID:", opts.SubscriptionId)
-	log.Println("Database URL:", opts.DatabaseUrl)
+	level, err := logging.ParseLevel(opts.LogLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger := logging.New(os.Stdout, level)
+
+	logger.Info("Starting subscriber service",
+		"projectId", opts.ProjectId,
+		"subscriptionId", opts.SubscriptionId,
+		"databaseUrl", opts.DatabaseUrl)
+
+	// Stop receiving on interrupt, handling outstanding messages before closing the database
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Configure tracing
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Exporter(opts.TraceExporter), "gcs-metadata-subscriber")
+	if err != nil {
+		logging.Fatal(logger, "Error configuring tracing", err)
+	}
+	defer shutdownTracing(context.Background())
 
 	// Connect database
-	ctx := context.Background()
 	db := repo.NewDatabase(opts.DatabaseUrl, maxDbConnections)
 
 	if err := db.Connect(ctx); err != nil {
-		log.Fatalf("Error connecting to database: %v\n", err)
+		logging.Fatal(logger, "Error connecting to database", err)
 	}
 	defer db.Close()
 
+	// Start metrics listener
+	if opts.MetricsPort != 0 {
+		if err := metrics.RegisterDatabase(db.DB.DB); err != nil {
+			logging.Fatal(logger, "Error registering database metrics", err)
+		}
+
+		metricsServer := metrics.NewServer(opts.MetricsPort)
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("Error in metrics server", logging.KeyError, err)
+			}
+		}()
+		defer metricsServer.Close()
+	}
+
 	if exists, err := db.PingTable(); !exists || err != nil {
-		log.Fatalf("Database has not been initialized: %v\n", err)
+		logging.Fatal(logger, "Database has not been initialized", err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		logging.Fatal(logger, "Error migrating database", err)
+	}
+
+	// Start health listener
+	if opts.HealthPort != 0 {
+		healthServer := &http.Server{
+			Addr:    fmt.Sprintf(":%d", opts.HealthPort),
+			Handler: router.NewHealth(db, router.Config{MaxEventAge: opts.MaxEventAge}, logger),
+		}
+		go func() {
+			if err := healthServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("Error in health server", logging.KeyError, err)
+			}
+		}()
+		defer healthServer.Close()
 	}
 
 	// Connect to pub/sub client
 	client, err := pubsub.NewClient(ctx, opts.ProjectId)
 	if err != nil {
-		log.Fatalf("Error creating pub/sub client: %v\n", err)
+		logging.Fatal(logger, "Error creating pub/sub client", err)
 	}
 
 	// Instantiate repositories
 	directoryRepo := repo.NewDirectoryRepository(db)
 	metadataRepo := repo.NewMetadataRepository(db)
+	statusRepo := repo.NewStatusRepository(db)
+	moveRepo := repo.NewMoveRepository(db)
+	bucketRepo := repo.NewBucketRepository(db)
+	transactor := repo.NewTransactor(db)
 
-	subService := subscriber.NewSubscriberService(client, opts.SubscriptionId, directoryRepo, metadataRepo)
+	subService := subscriber.NewSubscriberService(client, opts.SubscriptionId, directoryRepo, metadataRepo, statusRepo, moveRepo, bucketRepo, transactor, logger)
 
 	if err := subService.Start(ctx); err != nil {
-		log.Fatalf("Error while listening to subscription: %v\n", err)
+		logging.Fatal(logger, "Error while listening to subscription", err)
 	}
+	logger.Info("Subscriber service stopped")
 }
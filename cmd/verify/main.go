@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/logging"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+	"github.com/jessevdk/go-flags"
+)
+
+type options struct {
+	DatabaseUrl string `short:"d" long:"database-url" description:"Database URL of the metadata to verify" required:"true"`
+	Bucket      string `short:"b" long:"bucket" description:"Bucket to verify, all buckets if not set"`
+	LogLevel    string `long:"log-level" description:"Minimum severity of logs" choice:"debug" choice:"info" choice:"warn" choice:"error" default:"info"`
+}
+
+const maxDbConnections = 1
+
+// exitViolations is the exit code when the directory tree breaks an invariant
+const exitViolations = 1
+
+func main() {
+	var opts options
+	if _, err := flags.Parse(&opts); err != nil {
+		os.Exit(1)
+	}
+
+	level, err := logging.ParseLevel(opts.LogLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger := logging.New(os.Stdout, level)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	violations, err := run(ctx, opts, logger)
+	if err != nil {
+		logging.Fatal(logger, "Error while verifying", err)
+	}
+
+	if violations > 0 {
+		os.Exit(exitViolations)
+	}
+}
+
+// run checks the directory tree of the database and returns the number of violations found
+func run(ctx context.Context, opts options, logger *slog.Logger) (int, error) {
+	// Connect database
+	db := repo.NewDatabase(opts.DatabaseUrl, maxDbConnections)
+
+	if err := db.Connect(ctx); err != nil {
+		return 0, fmt.Errorf("error connecting to database: %w", err)
+	}
+	defer db.Close()
+
+	if exists, err := db.PingTable(); !exists || err != nil {
+		return 0, fmt.Errorf("database has not been initialized: %w", err)
+	}
+
+	logger.Info("Starting verification", logging.KeyBucket, opts.Bucket)
+	start := time.Now()
+
+	invariantRepo := repo.NewInvariantRepository(db)
+	violations, err := invariantRepo.Check(ctx, opts.Bucket)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, v := range violations {
+		logger.Error("Invariant violated",
+			"kind", v.Kind,
+			logging.KeyBucket, v.Bucket,
+			"directory", v.Name,
+			"size", v.Size,
+			"count", v.Count,
+			"childrenSize", v.ChildrenSize,
+			"childrenCount", v.ChildrenCount,
+		)
+	}
+
+	logger.Info("Verification completed", "violations", len(violations), "duration", time.Since(start).String())
+	return len(violations), nil
+}
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"net/http"
+)
+
+// APIKeyHeader is the request header carrying a static API key
+const APIKeyHeader = "X-API-Key"
+
+type apiKeyAuthenticator struct {
+	// names maps the SHA-256 digest of each key to its name so that lookups
+	// do not depend on the secret through string comparison
+	names map[[sha256.Size]byte]string
+}
+
+// NewAPIKeyAuthenticator returns an authenticator accepting static API keys.
+// keys maps each key name to its secret value.
+func NewAPIKeyAuthenticator(keys map[string]string) Authenticator {
+	names := make(map[[sha256.Size]byte]string, len(keys))
+	for name, key := range keys {
+		names[sha256.Sum256([]byte(key))] = name
+	}
+	return &apiKeyAuthenticator{names}
+}
+
+func (a *apiKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	name, ok := a.names[sha256.Sum256([]byte(key))]
+	if !ok {
+		return nil, errors.New("invalid API key")
+	}
+	return &Principal{Type: PrincipalAPIKey, Name: name}, nil
+}
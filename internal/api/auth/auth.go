@@ -0,0 +1,141 @@
+// Package auth authenticates API requests with Google-signed ID tokens or static API keys
+// and authorizes them against per-bucket and per-prefix access rules.
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/logging"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+)
+
+// ErrNoCredentials is returned by an Authenticator if a request carries none of its credentials
+var ErrNoCredentials = errors.New("no credentials")
+
+const (
+	PrincipalUser   = "user"
+	PrincipalAPIKey = "apiKey"
+)
+
+// Principal is an authenticated caller
+type Principal struct {
+	// Type is PrincipalUser for ID tokens or PrincipalAPIKey for API keys
+	Type string
+	// Name is the email of a user or the name of an API key
+	Name string
+}
+
+func (p *Principal) String() string {
+	return p.Type + ":" + p.Name
+}
+
+// Authenticator identifies the principal of a request
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+type principalKey struct{}
+
+// FromContext returns the principal of an authenticated request, or nil
+func FromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+type Middleware struct {
+	authenticators []Authenticator
+	policy         *Policy
+	resolver       paths.Resolver
+	logger         *slog.Logger
+}
+
+// NewMiddleware returns a middleware accepting the credentials of any of authenticators,
+// tried in order, and authorizing requests against policy. Requested paths are normalized
+// with the delimiters of resolver, or the default delimiter if nil.
+func NewMiddleware(authenticators []Authenticator, policy *Policy, resolver paths.Resolver, logger *slog.Logger) *Middleware {
+	if resolver == nil {
+		resolver = paths.Static(paths.Default)
+	}
+	return &Middleware{authenticators, policy, resolver, logger}
+}
+
+// Require wraps a handler of a {path...} route so that it is only served to principals
+// allowed to read the requested path in the bucket given by the bucket query param.
+// The path given by the compare query param of diffs must be allowed as well.
+// It must be registered on a route of http.ServeMux for the path to be available.
+func (m *Middleware) Require(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := m.authenticate(r)
+		if err != nil {
+			if !errors.Is(err, ErrNoCredentials) {
+				m.logger.Warn("Authentication failed", logging.KeyError, err)
+			}
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// Paths are normalized the same way as the explore handlers
+		// so that the authorized path is the one that is queried
+		bucket := r.URL.Query().Get("bucket")
+		sep, err := m.resolver.Separator(r.Context(), bucket)
+		if err != nil {
+			m.logger.Error("Error resolving bucket delimiter", logging.KeyBucket, bucket, logging.KeyError, err)
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+
+		dirs := []string{sep.Normalize(r.PathValue("path"))}
+		if compare := r.URL.Query().Get("compare"); compare != "" {
+			dirs = append(dirs, sep.Normalize(compare))
+		}
+
+		for _, path := range dirs {
+			if !m.policy.Allowed(principal, bucket, path) {
+				m.logger.Warn("Access denied", "principal", principal.String(), logging.KeyBucket, bucket, "path", path)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	}
+}
+
+// RequireAdmin wraps a handler of the admin API so that it is only served to admin principals
+func (m *Middleware) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := m.authenticate(r)
+		if err != nil {
+			if !errors.Is(err, ErrNoCredentials) {
+				m.logger.Warn("Authentication failed", logging.KeyError, err)
+			}
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !m.policy.Admin(principal) {
+			m.logger.Warn("Admin access denied", "principal", principal.String(), "path", r.URL.Path)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	}
+}
+
+// authenticate returns the principal of the first authenticator for which r carries credentials
+func (m *Middleware) authenticate(r *http.Request) (*Principal, error) {
+	for _, authenticator := range m.authenticators {
+		principal, err := authenticator.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return principal, err
+	}
+	return nil, ErrNoCredentials
+}
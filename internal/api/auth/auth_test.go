@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"google.golang.org/api/idtoken"
+)
+
+func TestRequire(t *testing.T) {
+	policy, err := NewPolicy([]Rule{
+		{Principals: []string{"user:alice@example.com"}, Bucket: "mock", Prefixes: []string{"team-a/"}},
+		{Principals: []string{"user:alice@example.com"}, Bucket: "piped", Prefixes: []string{"team-a|"}, Delimiter: "|"},
+		{Principals: []string{"apiKey:finance"}, Bucket: AllBuckets, Prefixes: []string{""}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenAuthenticator := &idTokenAuthenticator{
+		validator: &mockValidator{
+			payloads: map[string]*idtoken.Payload{
+				"alice":      {Issuer: "https://cloud.google.com/iap", Audience: "mock-aud", Claims: map[string]any{"email": "alice@example.com"}},
+				"other-aud":  {Issuer: "https://cloud.google.com/iap", Audience: "other", Claims: map[string]any{"email": "alice@example.com"}},
+				"other-iss":  {Issuer: "https://example.com", Audience: "mock-aud", Claims: map[string]any{"email": "alice@example.com"}},
+				"unverified": {Issuer: "https://accounts.google.com", Audience: "mock-aud", Claims: map[string]any{"email": "alice@example.com", "email_verified": false}},
+			},
+		},
+		audiences: []string{"mock-aud"},
+	}
+	keyAuthenticator := NewAPIKeyAuthenticator(map[string]string{"finance": "secret"})
+
+	pipe, err := paths.New("|")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := mockResolver{"piped": pipe}
+
+	middleware := NewMiddleware([]Authenticator{tokenAuthenticator, keyAuthenticator}, policy, resolver, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	testCases := []struct {
+		name       string
+		target     string
+		header     string
+		value      string
+		wantStatus int
+		wantName   string
+	}{
+		{"Denies missing credentials", "/explore/team-a/?bucket=mock", "", "", http.StatusUnauthorized, ""},
+		{"Allows IAP assertion", "/explore/team-a/?bucket=mock", IAPHeader, "alice", http.StatusOK, "alice@example.com"},
+		{"Allows bearer token", "/explore/team-a/data?bucket=mock", "Authorization", "Bearer alice", http.StatusOK, "alice@example.com"},
+		{"Denies invalid token", "/explore/team-a/?bucket=mock", IAPHeader, "invalid", http.StatusUnauthorized, ""},
+		{"Denies other audience", "/explore/team-a/?bucket=mock", IAPHeader, "other-aud", http.StatusUnauthorized, ""},
+		{"Denies other issuer", "/explore/team-a/?bucket=mock", IAPHeader, "other-iss", http.StatusUnauthorized, ""},
+		{"Denies unverified email", "/explore/team-a/?bucket=mock", "Authorization", "Bearer unverified", http.StatusUnauthorized, ""},
+		{"Forbids path outside prefix", "/explore/team-b/?bucket=mock", IAPHeader, "alice", http.StatusForbidden, ""},
+		{"Forbids root", "/explore/?bucket=mock", IAPHeader, "alice", http.StatusForbidden, ""},
+		{"Forbids without bucket", "/explore/team-a/", IAPHeader, "alice", http.StatusForbidden, ""},
+		{"Allows comparison within prefix", "/explore/team-a/?bucket=mock&compare=team-a/old", IAPHeader, "alice", http.StatusOK, "alice@example.com"},
+		{"Forbids comparison outside prefix", "/explore/team-a/?bucket=mock&compare=team-b/", IAPHeader, "alice", http.StatusForbidden, ""},
+		{"Allows API key", "/explore/", APIKeyHeader, "secret", http.StatusOK, "finance"},
+		{"Denies invalid API key", "/explore/", APIKeyHeader, "invalid", http.StatusUnauthorized, ""},
+		{"Normalizes with bucket delimiter", "/explore/team-a?bucket=piped", IAPHeader, "alice", http.StatusOK, "alice@example.com"},
+		{"Allows nested path with bucket delimiter", "/explore/team-a|data|?bucket=piped", IAPHeader, "alice", http.StatusOK, "alice@example.com"},
+		{"Forbids slash of other delimiter", "/explore/team-a/?bucket=piped", IAPHeader, "alice", http.StatusForbidden, ""},
+		{"Forbids comparison with bucket delimiter", "/explore/team-a|?bucket=piped&compare=team-b", IAPHeader, "alice", http.StatusForbidden, ""},
+		{"Fails on unresolved delimiter", "/explore/team-a/?bucket=unresolved", IAPHeader, "alice", http.StatusInternalServerError, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotName string
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /explore/{path...}", middleware.Require(func(w http.ResponseWriter, r *http.Request) {
+				gotName = FromContext(r.Context()).Name
+			}))
+
+			req := httptest.NewRequest("GET", tc.target, nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("Status code mismatch: got %d, want %d", rr.Code, tc.wantStatus)
+			}
+
+			if gotName != tc.wantName {
+				t.Errorf("Principal mismatch: got %s, want %s", gotName, tc.wantName)
+			}
+		})
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	policy, err := NewPolicy([]Rule{
+		{Principals: []string{"apiKey:finance"}, Bucket: AllBuckets, Prefixes: []string{""}},
+	}, []string{"apiKey:ops"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyAuthenticator := NewAPIKeyAuthenticator(map[string]string{"finance": "secret", "ops": "admin-secret"})
+	middleware := NewMiddleware([]Authenticator{keyAuthenticator}, policy, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	testCases := []struct {
+		name       string
+		key        string
+		wantStatus int
+		wantName   string
+	}{
+		{"Denies missing credentials", "", http.StatusUnauthorized, ""},
+		{"Denies invalid API key", "invalid", http.StatusUnauthorized, ""},
+		{"Forbids reader of all buckets", "secret", http.StatusForbidden, ""},
+		{"Allows admin", "admin-secret", http.StatusOK, "ops"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotName string
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST /admin/move", middleware.RequireAdmin(func(w http.ResponseWriter, r *http.Request) {
+				gotName = FromContext(r.Context()).Name
+			}))
+
+			req := httptest.NewRequest("POST", "/admin/move", nil)
+			if tc.key != "" {
+				req.Header.Set(APIKeyHeader, tc.key)
+			}
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("Status code mismatch: got %d, want %d", rr.Code, tc.wantStatus)
+			}
+
+			if gotName != tc.wantName {
+				t.Errorf("Principal mismatch: got %s, want %s", gotName, tc.wantName)
+			}
+		})
+	}
+}
+
+type mockValidator struct {
+	payloads map[string]*idtoken.Payload
+}
+
+func (m *mockValidator) Validate(ctx context.Context, token string, audience string) (*idtoken.Payload, error) {
+	payload, ok := m.payloads[token]
+	if !ok {
+		return nil, errors.New("invalid token")
+	}
+	return payload, nil
+}
+
+// mockResolver resolves the separators of buckets by name, the default one if missing
+type mockResolver map[string]paths.Separator
+
+func (m mockResolver) Separator(ctx context.Context, bucket string) (paths.Separator, error) {
+	if bucket == "unresolved" {
+		return paths.Separator{}, errors.New("mock error")
+	}
+	if sep, ok := m[bucket]; ok {
+		return sep, nil
+	}
+	return paths.Default, nil
+}
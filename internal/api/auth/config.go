@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+)
+
+// Config is the JSON auth configuration file
+//
+//	{
+//	  "apiKeys": [{"name": "finance", "keyEnv": "FINANCE_API_KEY"}],
+//	  "idToken": {"audiences": ["/projects/123/global/backendServices/456"]},
+//	  "rules": [{"principals": ["domain:example.com", "apiKey:finance"], "bucket": "*", "prefixes": [""]}],
+//	  "admins": ["user:ops@example.com"]
+//	}
+type Config struct {
+	APIKeys []APIKey       `json:"apiKeys"`
+	IDToken *IDTokenConfig `json:"idToken"`
+	Rules   []Rule         `json:"rules"`
+	// Admins are the principals allowed to use the admin API, in the format of Rule principals
+	Admins []string `json:"admins"`
+}
+
+type APIKey struct {
+	Name string `json:"name"`
+	// Key is the secret value, or read from the environment variable KeyEnv if empty
+	Key    string `json:"key"`
+	KeyEnv string `json:"keyEnv"`
+}
+
+type IDTokenConfig struct {
+	// Audiences are the accepted aud claims, such as the IAP backend service or the Cloud Run URL
+	Audiences []string `json:"audiences"`
+}
+
+// LoadConfig reads a Config from a JSON file
+func LoadConfig(name string) (*Config, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("error parsing auth config %s: %w", name, err)
+	}
+	return &cfg, nil
+}
+
+// NewMiddlewareFromConfig returns a middleware with the authenticators and rules of cfg,
+// normalizing requested paths with the delimiters of resolver
+func NewMiddlewareFromConfig(ctx context.Context, cfg *Config, resolver paths.Resolver, logger *slog.Logger) (*Middleware, error) {
+	var authenticators []Authenticator
+
+	if cfg.IDToken != nil {
+		authenticator, err := NewIDTokenAuthenticator(ctx, cfg.IDToken.Audiences)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, authenticator)
+	}
+
+	if len(cfg.APIKeys) > 0 {
+		keys := make(map[string]string, len(cfg.APIKeys))
+		for _, apiKey := range cfg.APIKeys {
+			key := apiKey.Key
+			if key == "" && apiKey.KeyEnv != "" {
+				key = os.Getenv(apiKey.KeyEnv)
+			}
+			if apiKey.Name == "" || key == "" {
+				return nil, fmt.Errorf("API key %q has no name or value", apiKey.Name)
+			}
+			keys[apiKey.Name] = key
+		}
+		authenticators = append(authenticators, NewAPIKeyAuthenticator(keys))
+	}
+
+	if len(authenticators) == 0 {
+		return nil, fmt.Errorf("auth config has neither API keys nor ID token audiences")
+	}
+
+	policy, err := NewPolicy(cfg.Rules, cfg.Admins)
+	if err != nil {
+		return nil, err
+	}
+	return NewMiddleware(authenticators, policy, resolver, logger), nil
+}
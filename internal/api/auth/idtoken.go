@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"google.golang.org/api/idtoken"
+)
+
+// IAPHeader is the request header carrying the signed JWT assertion added by Identity-Aware Proxy
+const IAPHeader = "X-Goog-IAP-JWT-Assertion"
+
+// Issuers of Google-signed ID tokens and IAP assertions
+var validIssuers = []string{
+	"accounts.google.com",
+	"https://accounts.google.com",
+	"https://cloud.google.com/iap",
+}
+
+// tokenValidator is implemented by *idtoken.Validator
+type tokenValidator interface {
+	Validate(ctx context.Context, token string, audience string) (*idtoken.Payload, error)
+}
+
+type idTokenAuthenticator struct {
+	validator tokenValidator
+	audiences []string
+}
+
+// NewIDTokenAuthenticator returns an authenticator accepting Google-signed ID tokens
+// from the IAP assertion header or an Authorization bearer token.
+// Tokens must be issued for one of audiences.
+func NewIDTokenAuthenticator(ctx context.Context, audiences []string) (Authenticator, error) {
+	if len(audiences) == 0 {
+		return nil, errors.New("at least one audience is required")
+	}
+
+	validator, err := idtoken.NewValidator(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating ID token validator: %w", err)
+	}
+	return &idTokenAuthenticator{validator, audiences}, nil
+}
+
+func (a *idTokenAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token := r.Header.Get(IAPHeader)
+	if token == "" {
+		var ok bool
+		if token, ok = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); !ok || token == "" {
+			return nil, ErrNoCredentials
+		}
+	}
+
+	// Audience is checked below since any of several audiences is accepted
+	payload, err := a.validator.Validate(r.Context(), token, "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	if !slices.Contains(a.audiences, payload.Audience) {
+		return nil, fmt.Errorf("invalid ID token audience %q", payload.Audience)
+	}
+
+	if !slices.Contains(validIssuers, payload.Issuer) {
+		return nil, fmt.Errorf("invalid ID token issuer %q", payload.Issuer)
+	}
+
+	email, _ := payload.Claims["email"].(string)
+	if email == "" {
+		return nil, errors.New("ID token has no email claim")
+	}
+
+	// IAP assertions omit email_verified, Google ID tokens must have it set
+	if verified, ok := payload.Claims["email_verified"].(bool); ok && !verified {
+		return nil, fmt.Errorf("ID token email %q is not verified", email)
+	}
+
+	return &Principal{Type: PrincipalUser, Name: email}, nil
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+)
+
+// AllBuckets matches every bucket in a Rule, and is required to read paths across all buckets
+const AllBuckets = "*"
+
+// Rule grants principals read access to prefixes of a bucket
+type Rule struct {
+	// Principals are matched as "*" for any authenticated principal,
+	// "user:<email>", "domain:<email domain>" or "apiKey:<name>"
+	Principals []string `json:"principals"`
+	// Bucket is a bucket name or AllBuckets
+	Bucket string `json:"bucket"`
+	// Prefixes are directory names such as "team-a/", or "" for the whole bucket
+	Prefixes []string `json:"prefixes"`
+	// Delimiter ends the directory names of Prefixes, "/" if empty.
+	// It must be the delimiter the bucket is seeded with for prefixes to match its directories.
+	Delimiter string `json:"delimiter"`
+}
+
+// Policy authorizes principals against a list of rules, denying any access not granted by a rule
+type Policy struct {
+	rules  []Rule
+	admins Rule
+}
+
+// NewPolicy returns a policy of rules, granting administration to the principals of admins
+func NewPolicy(rules []Rule, admins []string) (*Policy, error) {
+	for i, rule := range rules {
+		if len(rule.Principals) == 0 {
+			return nil, fmt.Errorf("rule %d: no principals", i)
+		}
+		if rule.Bucket == "" {
+			return nil, fmt.Errorf("rule %d: no bucket, use %q for all buckets", i, AllBuckets)
+		}
+		if len(rule.Prefixes) == 0 {
+			return nil, fmt.Errorf("rule %d: no prefixes, use \"\" for the whole bucket", i)
+		}
+		delimiter := rule.Delimiter
+		if delimiter == "" {
+			delimiter = paths.DefaultDelimiter
+		}
+		sep, err := paths.New(delimiter)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		for _, prefix := range rule.Prefixes {
+			// The root directory holds the names of the whole bucket at its top level only
+			if prefix == paths.Root {
+				return nil, fmt.Errorf("rule %d: prefix %q is the root, use \"\" for the whole bucket", i, prefix)
+			}
+			if prefix != "" && !sep.IsDir(prefix) {
+				return nil, fmt.Errorf("rule %d: prefix %q must end with %s", i, prefix, delimiter)
+			}
+		}
+		for _, principal := range rule.Principals {
+			if err := validatePrincipal(principal); err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i, err)
+			}
+		}
+	}
+	for _, principal := range admins {
+		if err := validatePrincipal(principal); err != nil {
+			return nil, fmt.Errorf("admins: %w", err)
+		}
+	}
+	return &Policy{rules, Rule{Principals: admins}}, nil
+}
+
+// Allowed reports whether principal may read path of bucket.
+// An empty bucket reads across all buckets and is only allowed by AllBuckets rules.
+func (p *Policy) Allowed(principal *Principal, bucket, path string) bool {
+	for _, rule := range p.rules {
+		if !rule.matchesPrincipal(principal) {
+			continue
+		}
+
+		if rule.Bucket != AllBuckets && rule.Bucket != bucket {
+			continue
+		}
+
+		for _, prefix := range rule.Prefixes {
+			// The root directory is named "/" so it is only covered by the whole bucket
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Admin reports whether principal may modify the metadata of any bucket
+func (p *Policy) Admin(principal *Principal) bool {
+	return p.admins.matchesPrincipal(principal)
+}
+
+func (r *Rule) matchesPrincipal(principal *Principal) bool {
+	for _, member := range r.Principals {
+		if member == "*" || member == principal.String() {
+			return true
+		}
+
+		if domain, ok := strings.CutPrefix(member, "domain:"); ok && principal.Type == PrincipalUser &&
+			strings.HasSuffix(principal.Name, "@"+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func validatePrincipal(principal string) error {
+	if principal == "*" {
+		return nil
+	}
+
+	kind, name, ok := strings.Cut(principal, ":")
+	if !ok || name == "" {
+		return fmt.Errorf("invalid principal %q", principal)
+	}
+
+	switch kind {
+	case PrincipalUser, PrincipalAPIKey, "domain":
+		return nil
+	default:
+		return errors.New("invalid principal type " + kind)
+	}
+}
@@ -0,0 +1,121 @@
+package auth
+
+import "testing"
+
+func TestPolicyAllowed(t *testing.T) {
+	policy, err := NewPolicy([]Rule{
+		{Principals: []string{"user:alice@example.com"}, Bucket: "mock", Prefixes: []string{"team-a/"}},
+		{Principals: []string{"domain:example.org"}, Bucket: "mock", Prefixes: []string{""}},
+		{Principals: []string{"apiKey:finance"}, Bucket: AllBuckets, Prefixes: []string{""}},
+	}, []string{"domain:ops.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := &Principal{Type: PrincipalUser, Name: "alice@example.com"}
+	bob := &Principal{Type: PrincipalUser, Name: "bob@example.org"}
+	finance := &Principal{Type: PrincipalAPIKey, Name: "finance"}
+	spoof := &Principal{Type: PrincipalAPIKey, Name: "bob@example.org"}
+
+	testCases := []struct {
+		name      string
+		principal *Principal
+		bucket    string
+		path      string
+		want      bool
+	}{
+		{"Allows prefix", alice, "mock", "team-a/", true},
+		{"Allows nested prefix", alice, "mock", "team-a/data/", true},
+		{"Denies sibling prefix", alice, "mock", "team-b/", false},
+		{"Denies prefix of prefix", alice, "mock", "team/", false},
+		{"Denies root", alice, "mock", "/", false},
+		{"Denies other bucket", alice, "other", "team-a/", false},
+		{"Denies all buckets", alice, "", "team-a/", false},
+		{"Allows domain root", bob, "mock", "/", true},
+		{"Denies domain other bucket", bob, "other", "/", false},
+		{"Denies domain for API key", spoof, "mock", "/", false},
+		{"Allows all buckets", finance, "", "/", true},
+		{"Allows any bucket", finance, "other", "team-b/", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := policy.Allowed(tc.principal, tc.bucket, tc.path); got != tc.want {
+				t.Errorf("Allowed mismatch: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPolicyAdmin(t *testing.T) {
+	policy, err := NewPolicy(nil, []string{"domain:ops.example.com", "apiKey:deploy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name      string
+		principal *Principal
+		want      bool
+	}{
+		{"Allows admin domain", &Principal{Type: PrincipalUser, Name: "carol@ops.example.com"}, true},
+		{"Allows admin API key", &Principal{Type: PrincipalAPIKey, Name: "deploy"}, true},
+		{"Denies other domain", &Principal{Type: PrincipalUser, Name: "alice@example.com"}, false},
+		{"Denies other API key", &Principal{Type: PrincipalAPIKey, Name: "finance"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := policy.Admin(tc.principal); got != tc.want {
+				t.Errorf("Admin mismatch: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	noAdmins, err := NewPolicy(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if noAdmins.Admin(&Principal{Type: PrincipalAPIKey, Name: "deploy"}) {
+		t.Error("Expected no admins without admin principals")
+	}
+}
+
+func TestNewPolicy(t *testing.T) {
+	testCases := []struct {
+		name    string
+		rule    Rule
+		admins  []string
+		wantErr bool
+	}{
+		{"Valid rule", Rule{Principals: []string{"*"}, Bucket: "mock", Prefixes: []string{"a/"}}, nil, false},
+		{"Fails without principals", Rule{Bucket: "mock", Prefixes: []string{""}}, nil, true},
+		{"Fails without bucket", Rule{Principals: []string{"*"}, Prefixes: []string{""}}, nil, true},
+		{"Fails without prefixes", Rule{Principals: []string{"*"}, Bucket: "mock"}, nil, true},
+		{"Fails on prefix without slash", Rule{Principals: []string{"*"}, Bucket: "mock", Prefixes: []string{"a"}}, nil, true},
+		{"Fails on root prefix", Rule{Principals: []string{"*"}, Bucket: "mock", Prefixes: []string{"/"}}, nil, true},
+		{"Valid prefix of delimiter", Rule{Principals: []string{"*"}, Bucket: "mock", Prefixes: []string{"a|"}, Delimiter: "|"}, nil, false},
+		{"Fails on prefix without delimiter", Rule{Principals: []string{"*"}, Bucket: "mock", Prefixes: []string{"a/"}, Delimiter: "|"}, nil, true},
+		{"Fails on invalid delimiter", Rule{Principals: []string{"*"}, Bucket: "mock", Prefixes: []string{""}, Delimiter: "::"}, nil, true},
+		{"Fails on unknown principal type", Rule{Principals: []string{"group:a@example.com"}, Bucket: "mock", Prefixes: []string{""}}, nil, true},
+		{"Fails on principal without name", Rule{Principals: []string{"user:"}, Bucket: "mock", Prefixes: []string{""}}, nil, true},
+		{"Valid admins", Rule{Principals: []string{"*"}, Bucket: "mock", Prefixes: []string{""}}, []string{"user:ops@example.com", "apiKey:deploy"}, false},
+		{"Fails on invalid admin", Rule{Principals: []string{"*"}, Bucket: "mock", Prefixes: []string{""}}, []string{"ops@example.com"}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewPolicy([]Rule{tc.rule}, tc.admins)
+			if err != nil {
+				if tc.wantErr {
+					return
+				}
+				t.Fatal(err)
+			}
+
+			if tc.wantErr {
+				t.Fatal("Expected error but did pass")
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/logging"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+)
+
+const defaultDiffResults = 100
+
+type diffHandler struct {
+	diffRepo repo.DiffRepository
+	resolver paths.Resolver
+	logger   *slog.Logger
+}
+
+func NewDiffHandler(diffRepo repo.DiffRepository, resolver paths.Resolver, logger *slog.Logger) *diffHandler {
+	return &diffHandler{diffRepo, resolver, logger}
+}
+
+// HandleDiff compares a path with the path of the compare query param,
+// or the path between the times of the from and to query params
+func (h *diffHandler) HandleDiff(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// Normalize path param by adding the delimiter of the bucket as suffix if missing
+	sep, path, ok := resolvePath(w, r, h.resolver, h.logger, query.Get("bucket"))
+	if !ok {
+		return
+	}
+
+	opts := repo.DiffOptions{Bucket: query.Get("bucket"), Path: path}
+
+	// Validate compare, from and to query params
+	if compare := query.Get("compare"); compare != "" {
+		opts.Compare = sep.Normalize(compare)
+	}
+
+	times := []struct {
+		param string
+		time  *time.Time
+	}{
+		{"from", &opts.From},
+		{"to", &opts.To},
+	}
+
+	for _, t := range times {
+		value := query.Get(t.param)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid %s parameter, please use an RFC 3339 timestamp", t.param), http.StatusBadRequest)
+			return
+		}
+		*t.time = parsed
+	}
+
+	switch {
+	case opts.Compare != "" && (!opts.From.IsZero() || !opts.To.IsZero()):
+		http.Error(w, "Invalid diff parameters, please use either compare or from and to", http.StatusBadRequest)
+		return
+	case opts.Compare == "" && opts.From.IsZero():
+		http.Error(w, "Missing diff parameters, please use either compare or from and to", http.StatusBadRequest)
+		return
+	case opts.Compare == "" && opts.To.IsZero():
+		opts.To = time.Now()
+	}
+
+	if opts.Compare == "" && !opts.From.Before(opts.To) {
+		http.Error(w, "Invalid from parameter, please use a time before to", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+
+	// Validate limit query param
+	opts.Limit = defaultDiffResults
+	if limitString := query.Get("limit"); limitString != "" {
+		if opts.Limit, err = strconv.Atoi(limitString); err != nil || opts.Limit < 1 || opts.Limit > repo.MaxDiffResults {
+			http.Error(w, fmt.Sprintf("Invalid limit parameter, please use an integer from 1 to %d", repo.MaxDiffResults), http.StatusBadRequest)
+			return
+		}
+	}
+
+	diff, err := h.diffRepo.GetDiff(r.Context(), opts)
+	if err != nil {
+		h.logger.Error("Error retrieving diff", "path", path, logging.KeyError, err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Path    string     `json:"path"`
+		Compare string     `json:"compare,omitempty"`
+		From    *time.Time `json:"from,omitempty"`
+		To      *time.Time `json:"to,omitempty"`
+		*model.Diff
+	}{
+		Path:    path,
+		Compare: opts.Compare,
+		Diff:    diff,
+	}
+
+	if opts.Compare == "" {
+		response.From = &opts.From
+		response.To = &opts.To
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.logger.Error("Error encoding diff response", logging.KeyError, err)
+	}
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+)
+
+func TestHandleDiff(t *testing.T) {
+	lastWeek := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	today := lastWeek.AddDate(0, 0, 7)
+
+	testCases := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantOpts   repo.DiffOptions
+	}{
+		{"Compares paths", "/diff/staging?compare=prod&bucket=mock", http.StatusOK, repo.DiffOptions{Bucket: "mock", Path: "staging/", Compare: "prod/", Limit: 100}},
+		{"Compares times", "/diff/prod/?from=2024-01-01T00:00:00Z&to=2024-01-08T00:00:00Z&limit=1000", http.StatusOK, repo.DiffOptions{Path: "prod/", From: lastWeek, To: today, Limit: 1000}},
+		{"Compares paths and times", "/diff/prod/?compare=staging/&from=2024-01-01T00:00:00Z", http.StatusBadRequest, repo.DiffOptions{}},
+		{"Compares nothing", "/diff/prod/", http.StatusBadRequest, repo.DiffOptions{}},
+		{"Compares until from", "/diff/prod/?to=2024-01-01T00:00:00Z", http.StatusBadRequest, repo.DiffOptions{}},
+		{"Compares reversed times", "/diff/prod/?from=2024-01-08T00:00:00Z&to=2024-01-01T00:00:00Z", http.StatusBadRequest, repo.DiffOptions{}},
+		{"Invalid from", "/diff/prod/?from=yesterday", http.StatusBadRequest, repo.DiffOptions{}},
+		{"Invalid limit", "/diff/prod/?compare=staging/&limit=0", http.StatusBadRequest, repo.DiffOptions{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := &mockDiffRepository{}
+			handler := NewDiffHandler(mockRepo, paths.Static(paths.Default), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /diff/{path...}", handler.HandleDiff)
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest("GET", tc.target, nil))
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("Status code mismatch: got %d, want %d", rr.Code, tc.wantStatus)
+			}
+
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			if mockRepo.opts != tc.wantOpts {
+				t.Errorf("Options mismatch: got %+v, want %+v", mockRepo.opts, tc.wantOpts)
+			}
+		})
+	}
+}
+
+func TestHandleDiffDefaultsToNow(t *testing.T) {
+	mockRepo := &mockDiffRepository{}
+	handler := NewDiffHandler(mockRepo, paths.Static(paths.Default), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /diff/{path...}", handler.HandleDiff)
+
+	before := time.Now()
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/diff/prod/?from=2024-01-01T00:00:00Z", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status code mismatch: got %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	if mockRepo.opts.To.Before(before) || mockRepo.opts.To.After(time.Now()) {
+		t.Errorf("To mismatch: got %v, want now", mockRepo.opts.To)
+	}
+}
+
+type mockDiffRepository struct {
+	opts repo.DiffOptions
+}
+
+func (m *mockDiffRepository) GetDiff(ctx context.Context, opts repo.DiffOptions) (*model.Diff, error) {
+	m.opts = opts
+	return &model.Diff{}, nil
+}
@@ -2,11 +2,18 @@ package handler
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/logging"
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
 )
 
@@ -16,33 +23,33 @@ type ExploreHandler interface {
 
 type exploreHandler struct {
 	exploreRepo repo.ExploreRepository
+	resolver    paths.Resolver
+	logger      *slog.Logger
 }
 
-func NewExploreHandler(exploreRepo repo.ExploreRepository) *exploreHandler {
-	return &exploreHandler{exploreRepo}
+func NewExploreHandler(exploreRepo repo.ExploreRepository, resolver paths.Resolver, logger *slog.Logger) *exploreHandler {
+	return &exploreHandler{exploreRepo, resolver, logger}
 }
 
 func (e *exploreHandler) HandleExplore(w http.ResponseWriter, r *http.Request) {
-	// Normalize path param by adding slash(/) suffix if missing
-	path := r.PathValue("path")
-	if !strings.HasSuffix(path, "/") {
-		path = path + "/"
+	opts, err := parseExploreOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	// Validate sort query param
-	sortString := r.URL.Query().Get("sort")
-	sortBy := repo.SortType(strings.ToLower(sortString))
+	// Optional bucket query param limits contents to a single bucket
+	bucket := r.URL.Query().Get("bucket")
 
-	if len(sortBy) == 0 {
-		sortBy = repo.SortBySize
-	} else if sortBy != repo.SortBySize && sortBy != repo.SortByCount {
-		http.Error(w, "Invalid sort parameter, please use 'size' or 'count'", http.StatusBadRequest)
+	// Normalize path param by adding the delimiter of the bucket as suffix if missing
+	_, path, ok := resolvePath(w, r, e.resolver, e.logger, bucket)
+	if !ok {
 		return
 	}
 
-	contents, err := e.exploreRepo.GetPathContents(path, sortBy)
+	contents, err := e.exploreRepo.GetPathContents(r.Context(), bucket, path, opts)
 	if err != nil {
-		log.Printf("Error retrieving path contents: %v", err)
+		e.logger.Error("Error retrieving path contents", "path", path, logging.KeyError, err)
 		http.Error(w, "Internal error", http.StatusInternalServerError)
 		return
 	}
@@ -55,7 +62,6 @@ func (e *exploreHandler) HandleExplore(w http.ResponseWriter, r *http.Request) {
 		Contents: contents,
 	}
 
-	w.Header().Set("Access-Control-Allow-Origin", "*") // TODO: remove in production
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		http.Error(w, "Internal error", http.StatusInternalServerError)
@@ -63,21 +69,108 @@ func (e *exploreHandler) HandleExplore(w http.ResponseWriter, r *http.Request) {
 }
 
 func (e *exploreHandler) HandleSummary(w http.ResponseWriter, r *http.Request) {
-	// Normalize path param by adding slash(/) suffix if missing
-	path := r.PathValue("path")
-	if !strings.HasSuffix(path, "/") {
-		path = path + "/"
+	// Optional bucket query param limits summary to a single bucket
+	bucket := r.URL.Query().Get("bucket")
+
+	// Normalize path param by adding the delimiter of the bucket as suffix if missing
+	_, path, ok := resolvePath(w, r, e.resolver, e.logger, bucket)
+	if !ok {
+		return
 	}
 
-	summary, err := e.exploreRepo.GetPathSummary(path)
+	summary, err := e.exploreRepo.GetPathSummary(r.Context(), bucket, path)
 	if err != nil {
-		log.Printf("Error retrieving path summary: %v", err)
+		e.logger.Error("Error retrieving path summary", "path", path, logging.KeyError, err)
 		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
 	}
 
-	w.Header().Set("Access-Control-Allow-Origin", "*") // TODO: remove in production
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(summary); err != nil {
 		http.Error(w, "Internal error", http.StatusInternalServerError)
 	}
 }
+
+// parseExploreOptions validates the sort and filter query params of HandleExplore
+func parseExploreOptions(query url.Values) (repo.ExploreOptions, error) {
+	var opts repo.ExploreOptions
+
+	// Validate sort query params
+	opts.Sort = repo.SortType(strings.ToLower(query.Get("sort")))
+	switch opts.Sort {
+	case "", repo.SortBySize, repo.SortByCount, repo.SortByName, repo.SortByCreated, repo.SortByUpdated, repo.SortByCost:
+	default:
+		return opts, errors.New("Invalid sort parameter, please use 'size', 'count', 'name', 'created', 'updated' or 'cost'")
+	}
+
+	opts.Order = repo.SortOrder(strings.ToLower(query.Get("order")))
+	if opts.Order != "" && opts.Order != repo.SortAscending && opts.Order != repo.SortDescending {
+		return opts, errors.New("Invalid order parameter, please use 'asc' or 'desc'")
+	}
+
+	// Validate filter query params
+	opts.Kind = repo.EntryKind(strings.ToLower(query.Get("kind")))
+	if opts.Kind != "" && opts.Kind != repo.EntryAll && opts.Kind != repo.EntryObjects && opts.Kind != repo.EntryDirectories {
+		return opts, errors.New("Invalid kind parameter, please use 'all', 'objects' or 'directories'")
+	}
+
+	opts.StorageClass = repo.StorageClass(strings.ToUpper(query.Get("class")))
+	switch opts.StorageClass {
+	case "", repo.StorageStandard, repo.StorageNearline, repo.StorageColdline, repo.StorageArchive:
+	default:
+		return opts, errors.New("Invalid class parameter, please use 'standard', 'nearline', 'coldline' or 'archive'")
+	}
+
+	sizes := []struct {
+		param string
+		size  **int64
+	}{
+		{"minSize", &opts.MinSize},
+		{"maxSize", &opts.MaxSize},
+	}
+
+	for _, s := range sizes {
+		value := query.Get(s.param)
+		if value == "" {
+			continue
+		}
+
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size < 0 {
+			return opts, fmt.Errorf("Invalid %s parameter, please use a size in bytes", s.param)
+		}
+		*s.size = &size
+	}
+
+	if opts.MinSize != nil && opts.MaxSize != nil && *opts.MinSize > *opts.MaxSize {
+		return opts, errors.New("Invalid size parameters, minSize is greater than maxSize")
+	}
+
+	times := []struct {
+		param string
+		time  *time.Time
+	}{
+		{"createdAfter", &opts.CreatedAfter},
+		{"createdBefore", &opts.CreatedBefore},
+		{"updatedAfter", &opts.UpdatedAfter},
+		{"updatedBefore", &opts.UpdatedBefore},
+	}
+
+	for _, t := range times {
+		value := query.Get(t.param)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return opts, fmt.Errorf("Invalid %s parameter, please use an RFC 3339 timestamp", t.param)
+		}
+		*t.time = parsed
+	}
+
+	opts.NamePrefix = query.Get("prefix")
+	opts.NameSuffix = query.Get("suffix")
+
+	return opts, nil
+}
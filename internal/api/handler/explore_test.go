@@ -1,11 +1,19 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
 )
 
@@ -66,7 +74,7 @@ func TestHandleExplore(t *testing.T) {
 				pathContents: []*model.Metadata{},
 			}
 
-			handler := NewExploreHandler(mockRepo)
+			handler := NewExploreHandler(mockRepo, paths.Static(paths.Default), slog.New(slog.NewTextHandler(io.Discard, nil)))
 			handler.HandleExplore(rr, req)
 
 			if status := rr.Code; status != tc.wantStatus {
@@ -85,28 +93,39 @@ func TestHandleSummary(t *testing.T) {
 	testCases := []struct {
 		name       string
 		path       string
+		summaryErr error
 		wantStatus int
 	}{
 		{
 			"Valid path with trailing slash",
 			"///mock/",
+			nil,
 			http.StatusOK,
 		},
 		{
 			"Valid path",
 			"mock/",
+			nil,
 			http.StatusOK,
 		},
 		{
 			"Root path",
 			"/",
+			nil,
 			http.StatusOK,
 		},
 		{
 			"Empty path",
 			"",
+			nil,
 			http.StatusOK,
 		},
+		{
+			"Repository error",
+			"mock/",
+			errors.New("mock error"),
+			http.StatusInternalServerError,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -117,27 +136,115 @@ func TestHandleSummary(t *testing.T) {
 			}
 
 			rr := httptest.NewRecorder()
-			mockRepo := &mockExploreRepository{}
+			mockRepo := &mockExploreRepository{summaryErr: tc.summaryErr}
 
-			handler := NewExploreHandler(mockRepo)
+			handler := NewExploreHandler(mockRepo, paths.Static(paths.Default), slog.New(slog.NewTextHandler(io.Discard, nil)))
 			handler.HandleSummary(rr, req)
 
 			if status := rr.Code; status != tc.wantStatus {
 				t.Errorf("status code mismatch: got %v want %v",
 					status, tc.wantStatus)
 			}
+
+			// Errors are not followed by an encoded summary
+			if tc.wantStatus != http.StatusOK && rr.Body.String() != "Internal error\n" {
+				t.Errorf("body mismatch: got %q want %q", rr.Body.String(), "Internal error\n")
+			}
 		})
 	}
 }
 
 type mockExploreRepository struct {
 	pathContents []*model.Metadata
+	summaryErr   error
 }
 
-func (m *mockExploreRepository) GetPathContents(path string, sort repo.SortType) ([]*model.Metadata, error) {
+func (m *mockExploreRepository) GetPathContents(ctx context.Context, bucket, path string, opts repo.ExploreOptions) ([]*model.Metadata, error) {
 	return m.pathContents, nil
 }
 
-func (m *mockExploreRepository) GetPathSummary(path string) (*model.Summary, error) {
+func (m *mockExploreRepository) GetPathSummary(ctx context.Context, bucket, path string) (*model.Summary, error) {
+	if m.summaryErr != nil {
+		return nil, m.summaryErr
+	}
 	return &model.Summary{}, nil
 }
+
+func TestParseExploreOptions(t *testing.T) {
+	size := func(s int64) *int64 { return &s }
+
+	testCases := []struct {
+		name    string
+		query   string
+		want    repo.ExploreOptions
+		wantErr bool
+	}{
+		{"Empty query", "", repo.ExploreOptions{}, false},
+		{"Sort by name ascending", "sort=NAME&order=asc", repo.ExploreOptions{Sort: repo.SortByName, Order: repo.SortAscending}, false},
+		{"Sort by cost", "sort=cost", repo.ExploreOptions{Sort: repo.SortByCost}, false},
+		{"Filter objects of class", "kind=objects&class=coldline", repo.ExploreOptions{Kind: repo.EntryObjects, StorageClass: repo.StorageColdline}, false},
+		{"Filter size range", "minSize=10&maxSize=20", repo.ExploreOptions{MinSize: size(10), MaxSize: size(20)}, false},
+		{
+			"Filter time ranges",
+			"createdAfter=2024-01-01T00:00:00Z&updatedBefore=2024-02-01T00:00:00%2B01:00",
+			repo.ExploreOptions{
+				CreatedAfter:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				UpdatedBefore: time.Date(2024, 1, 31, 23, 0, 0, 0, time.UTC),
+			},
+			false,
+		},
+		{"Filter name", "prefix=log-&suffix=.csv", repo.ExploreOptions{NamePrefix: "log-", NameSuffix: ".csv"}, false},
+		{"Invalid sort", "sort=invalid", repo.ExploreOptions{}, true},
+		{"Invalid order", "order=up", repo.ExploreOptions{}, true},
+		{"Invalid kind", "kind=files", repo.ExploreOptions{}, true},
+		{"Invalid class", "class=cold", repo.ExploreOptions{}, true},
+		{"Invalid size", "minSize=ten", repo.ExploreOptions{}, true},
+		{"Negative size", "maxSize=-1", repo.ExploreOptions{}, true},
+		{"Inverted size range", "minSize=20&maxSize=10", repo.ExploreOptions{}, true},
+		{"Invalid time", "createdAfter=2024-01-01", repo.ExploreOptions{}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := parseExploreOptions(query)
+			if err != nil {
+				if tc.wantErr {
+					return
+				}
+				t.Fatal(err)
+			}
+
+			if tc.wantErr {
+				t.Fatal("Expected error but did pass")
+			}
+
+			if got.Sort != tc.want.Sort || got.Order != tc.want.Order || got.Kind != tc.want.Kind || got.StorageClass != tc.want.StorageClass {
+				t.Errorf("Sort or kind mismatch: got %+v, want %+v", got, tc.want)
+			}
+
+			if fmt.Sprint(deref(got.MinSize), deref(got.MaxSize)) != fmt.Sprint(deref(tc.want.MinSize), deref(tc.want.MaxSize)) {
+				t.Errorf("Size mismatch: got %v-%v, want %v-%v", deref(got.MinSize), deref(got.MaxSize), deref(tc.want.MinSize), deref(tc.want.MaxSize))
+			}
+
+			if !got.CreatedAfter.Equal(tc.want.CreatedAfter) || !got.UpdatedBefore.Equal(tc.want.UpdatedBefore) {
+				t.Errorf("Time mismatch: got %v/%v, want %v/%v", got.CreatedAfter, got.UpdatedBefore, tc.want.CreatedAfter, tc.want.UpdatedBefore)
+			}
+
+			if got.NamePrefix != tc.want.NamePrefix || got.NameSuffix != tc.want.NameSuffix {
+				t.Errorf("Name mismatch: got %q/%q, want %q/%q", got.NamePrefix, got.NameSuffix, tc.want.NamePrefix, tc.want.NameSuffix)
+			}
+		})
+	}
+}
+
+func deref(size *int64) any {
+	if size == nil {
+		return nil
+	}
+	return *size
+}
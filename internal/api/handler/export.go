@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/export"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/logging"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+)
+
+type exportHandler struct {
+	exportRepo repo.ExportRepository
+	resolver   paths.Resolver
+	logger     *slog.Logger
+}
+
+func NewExportHandler(exportRepo repo.ExportRepository, resolver paths.Resolver, logger *slog.Logger) *exportHandler {
+	return &exportHandler{exportRepo, resolver, logger}
+}
+
+// HandleExport streams every object and directory under a path as an attachment
+func (e *exportHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// Normalize path param by adding the delimiter of the bucket as suffix if missing
+	sep, dir, ok := resolvePath(w, r, e.resolver, e.logger, query.Get("bucket"))
+	if !ok {
+		return
+	}
+
+	// Validate format query param
+	format := export.Format(strings.ToLower(query.Get("format")))
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if format != export.FormatCSV && format != export.FormatJSONL && format != export.FormatParquet {
+		http.Error(w, "Invalid format parameter, please use 'csv', 'jsonl' or 'parquet'", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+
+	// Validate depth query param
+	depth := 0
+	if depthString := query.Get("depth"); depthString != "" {
+		if depth, err = strconv.Atoi(depthString); err != nil || depth < 0 {
+			http.Error(w, "Invalid depth parameter, please use a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate kind query param
+	kind := repo.EntryKind(strings.ToLower(query.Get("kind")))
+	if kind == "" {
+		kind = repo.EntryAll
+	}
+	if kind != repo.EntryAll && kind != repo.EntryObjects && kind != repo.EntryDirectories {
+		http.Error(w, "Invalid kind parameter, please use 'all', 'objects' or 'directories'", http.StatusBadRequest)
+		return
+	}
+
+	writer, err := export.NewWriter(format, w)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, exportFilename(sep, dir, format)))
+
+	opts := repo.ExportOptions{
+		Bucket: query.Get("bucket"),
+		Path:   dir,
+		Depth:  depth,
+		Kind:   kind,
+	}
+
+	err = e.exportRepo.Export(r.Context(), opts, func(row *model.Metadata) error {
+		return writer.Write(row)
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+
+	if err != nil {
+		e.logger.Error("Error exporting path", "path", dir, logging.KeyError, err)
+
+		// The status has been sent with the first rows, so the response is aborted
+		// to signal the client that the export is incomplete
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// exportFilename names an export after the last non-empty segment of its directory
+func exportFilename(sep paths.Separator, dir string, format export.Format) string {
+	name := strings.TrimRight(dir, sep.Delimiter())
+	if i := strings.LastIndex(name, sep.Delimiter()); i >= 0 {
+		name = name[i+len(sep.Delimiter()):]
+	}
+	if dir == paths.Root || name == "" {
+		name = "root"
+	}
+	name = strings.Map(func(r rune) rune {
+		if r == '"' || r == '\\' || r == '/' || r < 0x20 || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, name)
+	return name + "." + string(format)
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/export"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+)
+
+func TestHandleExport(t *testing.T) {
+	testCases := []struct {
+		name            string
+		target          string
+		wantStatus      int
+		wantType        string
+		wantDisposition string
+		wantOpts        repo.ExportOptions
+	}{
+		{
+			"Exports csv by default",
+			"/export/mock-1",
+			http.StatusOK,
+			"text/csv; charset=utf-8",
+			`attachment; filename="mock-1.csv"`,
+			repo.ExportOptions{Path: "mock-1/", Kind: repo.EntryAll},
+		},
+		{
+			"Exports root as jsonl",
+			"/export/?format=jsonl&bucket=mock&depth=2&kind=objects",
+			http.StatusOK,
+			"application/jsonl; charset=utf-8",
+			`attachment; filename="root.jsonl"`,
+			repo.ExportOptions{Bucket: "mock", Path: "/", Depth: 2, Kind: repo.EntryObjects},
+		},
+		{
+			"Exports parquet",
+			"/export/mock-1/mock-2/?format=parquet",
+			http.StatusOK,
+			"application/vnd.apache.parquet",
+			`attachment; filename="mock-2.parquet"`,
+			repo.ExportOptions{Path: "mock-1/mock-2/", Kind: repo.EntryAll},
+		},
+		{"Invalid format", "/export/mock-1?format=xml", http.StatusBadRequest, "", "", repo.ExportOptions{}},
+		{"Invalid depth", "/export/mock-1?depth=-1", http.StatusBadRequest, "", "", repo.ExportOptions{}},
+		{"Invalid kind", "/export/mock-1?kind=invalid", http.StatusBadRequest, "", "", repo.ExportOptions{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := &mockExportRepository{rows: []*model.Metadata{{Bucket: "mock", Name: "mock-1/file1", StorageClass: "STANDARD"}}}
+			handler := NewExportHandler(mockRepo, paths.Static(paths.Default), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /export/{path...}", handler.HandleExport)
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest("GET", tc.target, nil))
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("Status code mismatch: got %d, want %d", rr.Code, tc.wantStatus)
+			}
+
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			if got := rr.Header().Get("Content-Type"); got != tc.wantType {
+				t.Errorf("Content-Type mismatch: got %q, want %q", got, tc.wantType)
+			}
+
+			if got := rr.Header().Get("Content-Disposition"); got != tc.wantDisposition {
+				t.Errorf("Content-Disposition mismatch: got %q, want %q", got, tc.wantDisposition)
+			}
+
+			if mockRepo.opts != tc.wantOpts {
+				t.Errorf("Export options mismatch: got %+v, want %+v", mockRepo.opts, tc.wantOpts)
+			}
+
+			if rr.Body.Len() == 0 {
+				t.Error("Expected export body but got none")
+			}
+		})
+	}
+}
+
+func TestExportFilename(t *testing.T) {
+	pipe, err := paths.New("|")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name string
+		sep  paths.Separator
+		dir  string
+		want string
+	}{
+		{"Root", paths.Default, "/", "root.csv"},
+		{"Directory", paths.Default, "a/b/", "b.csv"},
+		{"Leading delimiter", paths.Default, "/a/", "a.csv"},
+		{"Empty segment", paths.Default, "a//", "a.csv"},
+		{"Only delimiters", paths.Default, "//", "root.csv"},
+		{"Other delimiter", pipe, "a/b|c|", "c.csv"},
+		{"Slash in segment", pipe, "a/b|", "a_b.csv"},
+		{"Quotes", paths.Default, `a"b/`, "a_b.csv"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := exportFilename(tc.sep, tc.dir, export.FormatCSV); got != tc.want {
+				t.Errorf("Filename mismatch: got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHandleExportAborts(t *testing.T) {
+	mockRepo := &mockExportRepository{err: errors.New("mock error")}
+	handler := NewExportHandler(mockRepo, paths.Static(paths.Default), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("Panic mismatch: got %v, want %v", err, http.ErrAbortHandler)
+		}
+	}()
+
+	handler.HandleExport(httptest.NewRecorder(), httptest.NewRequest("GET", "/export/mock-1", nil))
+}
+
+type mockExportRepository struct {
+	rows []*model.Metadata
+	err  error
+	opts repo.ExportOptions
+}
+
+func (m *mockExportRepository) Export(ctx context.Context, opts repo.ExportOptions, fn func(*model.Metadata) error) error {
+	m.opts = opts
+	for _, row := range m.rows {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return m.err
+}
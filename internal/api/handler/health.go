@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/logging"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+)
+
+const (
+	checkOk          = "ok"
+	checkUnavailable = "unavailable"
+)
+
+// databaseChecker is implemented by *repo.Database
+type databaseChecker interface {
+	PingContext(ctx context.Context) error
+	SchemaVersion(ctx context.Context) (int, error)
+	Stats() sql.DBStats
+}
+
+type healthHandler struct {
+	db          databaseChecker
+	statusRepo  repo.StatusRepository
+	maxEventAge time.Duration
+	started     time.Time
+	logger      *slog.Logger
+}
+
+// NewHealthHandler returns handlers for liveness, readiness and version probes.
+// Readiness fails if the subscriber has not processed an event within maxEventAge, unless maxEventAge is 0.
+// Until an event is processed, the age is measured from the creation of the handler.
+func NewHealthHandler(db databaseChecker, statusRepo repo.StatusRepository, maxEventAge time.Duration, logger *slog.Logger) *healthHandler {
+	return &healthHandler{db, statusRepo, maxEventAge, time.Now(), logger}
+}
+
+// HandleHealthz reports that the process is alive
+func (h *healthHandler) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintln(w, checkOk)
+}
+
+// HandleReadyz reports whether the database is reachable and migrated,
+// and whether the subscriber has recently processed an event
+func (h *healthHandler) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	checks := map[string]string{}
+	ready := true
+
+	fail := func(check string, err error) {
+		h.logger.Warn("Readiness check failed", "check", check, logging.KeyError, err)
+		checks[check] = checkUnavailable
+		ready = false
+	}
+
+	if err := h.db.PingContext(ctx); err != nil {
+		fail("database", err)
+	} else {
+		checks["database"] = checkOk
+	}
+
+	if version, err := h.db.SchemaVersion(ctx); err != nil {
+		fail("schema", err)
+	} else if version != repo.SchemaVersion {
+		fail("schema", fmt.Errorf("schema version is %d, want %d", version, repo.SchemaVersion))
+	} else {
+		checks["schema"] = checkOk
+	}
+
+	if h.maxEventAge > 0 {
+		// A fresh deployment is given maxEventAge from startup to process its first event
+		lastEvent, err := h.statusRepo.GetLastEvent(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			lastEvent, err = h.started, nil
+		}
+
+		if err != nil {
+			fail("subscriber", err)
+		} else if age := time.Since(lastEvent); age > h.maxEventAge {
+			fail("subscriber", fmt.Errorf("last event processed %v ago, exceeds %v", age.Round(time.Second), h.maxEventAge))
+		} else {
+			checks["subscriber"] = checkOk
+		}
+	}
+
+	status := checkOk
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		status = checkUnavailable
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	response := struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}{
+		Status: status,
+		Checks: checks,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.logger.Error("Error encoding readiness response", logging.KeyError, err)
+	}
+}
+
+// HandleVersion reports build information, schema version and database connection statistics
+func (h *healthHandler) HandleVersion(w http.ResponseWriter, r *http.Request) {
+	type databaseStats struct {
+		OpenConnections int    `json:"openConnections"`
+		InUse           int    `json:"inUse"`
+		Idle            int    `json:"idle"`
+		WaitCount       int64  `json:"waitCount"`
+		WaitDuration    string `json:"waitDuration"`
+	}
+
+	response := struct {
+		Version       string        `json:"version"`
+		GoVersion     string        `json:"goVersion"`
+		Revision      string        `json:"revision,omitempty"`
+		RevisionTime  string        `json:"revisionTime,omitempty"`
+		Modified      bool          `json:"modified,omitempty"`
+		SchemaVersion int           `json:"schemaVersion"`
+		Database      databaseStats `json:"database"`
+	}{}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		response.Version = info.Main.Version
+		response.GoVersion = info.GoVersion
+
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				response.Revision = setting.Value
+			case "vcs.time":
+				response.RevisionTime = setting.Value
+			case "vcs.modified":
+				response.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	version, err := h.db.SchemaVersion(r.Context())
+	if err != nil {
+		h.logger.Error("Error retrieving schema version", logging.KeyError, err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	response.SchemaVersion = version
+
+	stats := h.db.Stats()
+	response.Database = databaseStats{
+		OpenConnections: stats.OpenConnections,
+		InUse:           stats.InUse,
+		Idle:            stats.Idle,
+		WaitCount:       stats.WaitCount,
+		WaitDuration:    stats.WaitDuration.String(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.logger.Error("Error encoding version response", logging.KeyError, err)
+	}
+}
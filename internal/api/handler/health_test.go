@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+)
+
+func TestHandleReadyz(t *testing.T) {
+	testCases := []struct {
+		name          string
+		pingErr       error
+		schemaVersion int
+		lastEvent     time.Time
+		maxEventAge   time.Duration
+		wantStatus    int
+	}{
+		{"Ready when database is migrated", nil, repo.SchemaVersion, time.Time{}, 0, http.StatusOK},
+		{"Ready when last event is recent", nil, repo.SchemaVersion, time.Now().Add(-time.Minute), time.Hour, http.StatusOK},
+		{"Unavailable when database is unreachable", errors.New("mock error"), repo.SchemaVersion, time.Time{}, 0, http.StatusServiceUnavailable},
+		{"Unavailable when schema is outdated", nil, repo.SchemaVersion - 1, time.Time{}, 0, http.StatusServiceUnavailable},
+		{"Unavailable when last event is too old", nil, repo.SchemaVersion, time.Now().Add(-2 * time.Hour), time.Hour, http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &mockDatabaseChecker{pingErr: tc.pingErr, schemaVersion: tc.schemaVersion}
+			statusRepo := &mockStatusRepository{lastEvent: tc.lastEvent}
+			handler := NewHealthHandler(db, statusRepo, tc.maxEventAge, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			rr := httptest.NewRecorder()
+			handler.HandleReadyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+			if status := rr.Code; status != tc.wantStatus {
+				t.Errorf("status code mismatch: got %v want %v", status, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandleReadyzWithoutEvents(t *testing.T) {
+	testCases := []struct {
+		name       string
+		uptime     time.Duration
+		wantStatus int
+	}{
+		{"Ready when started recently", time.Minute, http.StatusOK},
+		{"Unavailable when no event was processed since start", 2 * time.Hour, http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &mockDatabaseChecker{schemaVersion: repo.SchemaVersion}
+			handler := NewHealthHandler(db, &mockStatusRepository{}, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			handler.started = time.Now().Add(-tc.uptime)
+
+			rr := httptest.NewRecorder()
+			handler.HandleReadyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+			if status := rr.Code; status != tc.wantStatus {
+				t.Errorf("status code mismatch: got %v want %v", status, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandleVersion(t *testing.T) {
+	db := &mockDatabaseChecker{schemaVersion: repo.SchemaVersion}
+	handler := NewHealthHandler(db, &mockStatusRepository{}, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	rr := httptest.NewRecorder()
+	handler.HandleVersion(rr, httptest.NewRequest("GET", "/version", nil))
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("status code mismatch: got %v want %v", status, http.StatusOK)
+	}
+}
+
+type mockDatabaseChecker struct {
+	pingErr       error
+	schemaVersion int
+}
+
+func (m *mockDatabaseChecker) PingContext(ctx context.Context) error {
+	return m.pingErr
+}
+
+func (m *mockDatabaseChecker) SchemaVersion(ctx context.Context) (int, error) {
+	return m.schemaVersion, nil
+}
+
+func (m *mockDatabaseChecker) Stats() sql.DBStats {
+	return sql.DBStats{}
+}
+
+type mockStatusRepository struct {
+	repo.StatusRepository
+	lastEvent time.Time
+}
+
+func (m *mockStatusRepository) GetLastEvent(ctx context.Context) (time.Time, error) {
+	if m.lastEvent.IsZero() {
+		return time.Time{}, sql.ErrNoRows
+	}
+	return m.lastEvent, nil
+}
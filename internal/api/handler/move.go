@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/api/auth"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/logging"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+)
+
+// maxMoveRequestBytes limits the body of move requests, which only hold a few paths
+const maxMoveRequestBytes = 1 << 16
+
+type moveHandler struct {
+	moveRepo repo.MoveRepository
+	resolver paths.Resolver
+	logger   *slog.Logger
+}
+
+func NewMoveHandler(moveRepo repo.MoveRepository, resolver paths.Resolver, logger *slog.Logger) *moveHandler {
+	return &moveHandler{moveRepo, resolver, logger}
+}
+
+// MoveRequest is the JSON body of a move
+type MoveRequest struct {
+	Bucket      string `json:"bucket"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+// MoveResponse is the JSON response of a move
+type MoveResponse struct {
+	Moved int64 `json:"moved"`
+}
+
+// HandleMove relocates a directory with all objects and directories under it to a new path,
+// such as to repair the metadata after a rename that was not notified
+func (h *moveHandler) HandleMove(w http.ResponseWriter, r *http.Request) {
+	var req MoveRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMoveRequestBytes)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body, please send a JSON object with bucket, source and destination", http.StatusBadRequest)
+		return
+	}
+
+	if req.Bucket == "" {
+		http.Error(w, "Missing bucket", http.StatusBadRequest)
+		return
+	}
+
+	// Normalize paths by adding the delimiter of the bucket as suffix if missing
+	sep, ok := resolveSeparator(w, r, h.resolver, h.logger, req.Bucket)
+	if !ok {
+		return
+	}
+	source, destination := sep.Normalize(req.Source), sep.Normalize(req.Destination)
+
+	if source == paths.Root || destination == paths.Root {
+		http.Error(w, "Cannot move the root directory or move to it", http.StatusBadRequest)
+		return
+	}
+
+	if strings.HasPrefix(source, destination) || strings.HasPrefix(destination, source) {
+		http.Error(w, "Source and destination must not contain each other", http.StatusBadRequest)
+		return
+	}
+
+	logArgs := []any{logging.KeyBucket, req.Bucket, "source", source, "destination", destination}
+	if principal := auth.FromContext(r.Context()); principal != nil {
+		logArgs = append(logArgs, "principal", principal.String())
+	}
+
+	moved, err := h.moveRepo.Move(r.Context(), req.Bucket, source, destination)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Source directory not found", http.StatusNotFound)
+		return
+	case errors.Is(err, repo.ErrMoveConflict):
+		http.Error(w, "Destination directory is not empty", http.StatusConflict)
+		return
+	case err != nil:
+		h.logger.Error("Error moving directory", append(logArgs, logging.KeyError, err)...)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info("Moved directory", append(logArgs, "moved", moved)...)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(MoveResponse{Moved: moved}); err != nil {
+		h.logger.Error("Error encoding move response", logging.KeyError, err)
+	}
+}
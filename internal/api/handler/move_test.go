@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+)
+
+func TestHandleMove(t *testing.T) {
+	testCases := []struct {
+		name            string
+		body            string
+		err             error
+		wantStatus      int
+		wantSource      string
+		wantDestination string
+	}{
+		{"Moves directory", `{"bucket": "mock", "source": "a/b/", "destination": "c/"}`, nil, http.StatusOK, "a/b/", "c/"},
+		{"Normalizes paths", `{"bucket": "mock", "source": "a/b", "destination": "c"}`, nil, http.StatusOK, "a/b/", "c/"},
+		{"Missing source", `{"bucket": "mock", "source": "a/", "destination": "c/"}`, sql.ErrNoRows, http.StatusNotFound, "", ""},
+		{"Conflicting destination", `{"bucket": "mock", "source": "a/", "destination": "c/"}`, repo.ErrMoveConflict, http.StatusConflict, "", ""},
+		{"Invalid body", `{"bucket": "mock", "source":`, nil, http.StatusBadRequest, "", ""},
+		{"Missing bucket", `{"source": "a/", "destination": "c/"}`, nil, http.StatusBadRequest, "", ""},
+		{"Root source", `{"bucket": "mock", "source": "", "destination": "c/"}`, nil, http.StatusBadRequest, "", ""},
+		{"Root destination", `{"bucket": "mock", "source": "a/", "destination": "/"}`, nil, http.StatusBadRequest, "", ""},
+		{"Destination in source", `{"bucket": "mock", "source": "a/", "destination": "a/b/"}`, nil, http.StatusBadRequest, "", ""},
+		{"Source in destination", `{"bucket": "mock", "source": "a/b/", "destination": "a/"}`, nil, http.StatusBadRequest, "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := &mockMoveRepository{moved: 3, err: tc.err}
+			handler := NewMoveHandler(mockRepo, paths.Static(paths.Default), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST /admin/move", handler.HandleMove)
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest("POST", "/admin/move", strings.NewReader(tc.body)))
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("Status code mismatch: got %d, want %d", rr.Code, tc.wantStatus)
+			}
+
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			if mockRepo.bucket != "mock" || mockRepo.source != tc.wantSource || mockRepo.destination != tc.wantDestination {
+				t.Errorf("Move mismatch: got %s to %s in %q, want %s to %s in %q",
+					mockRepo.source, mockRepo.destination, mockRepo.bucket, tc.wantSource, tc.wantDestination, "mock")
+			}
+
+			var resp MoveResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.Moved != 3 {
+				t.Errorf("Moved mismatch: got %d, want %d", resp.Moved, 3)
+			}
+		})
+	}
+}
+
+func TestHandleMoveDelimiter(t *testing.T) {
+	pipe, err := paths.New("|")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name            string
+		resolver        paths.Resolver
+		body            string
+		wantStatus      int
+		wantSource      string
+		wantDestination string
+	}{
+		{"Normalizes with delimiter", paths.Static(pipe), `{"bucket": "mock", "source": "a|b", "destination": "c"}`, http.StatusOK, "a|b|", "c|"},
+		{"Slash is not delimiter", paths.Static(pipe), `{"bucket": "mock", "source": "a/", "destination": "a/b|"}`, http.StatusOK, "a/|", "a/b|"},
+		{"Root source", paths.Static(pipe), `{"bucket": "mock", "source": "/", "destination": "c|"}`, http.StatusBadRequest, "", ""},
+		{"Failing resolver", &mockResolver{err: errors.New("mock error")}, `{"bucket": "mock", "source": "a/", "destination": "c/"}`, http.StatusInternalServerError, "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := &mockMoveRepository{moved: 1}
+			handler := NewMoveHandler(mockRepo, tc.resolver, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			rr := httptest.NewRecorder()
+			handler.HandleMove(rr, httptest.NewRequest("POST", "/admin/move", strings.NewReader(tc.body)))
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("Status code mismatch: got %d, want %d", rr.Code, tc.wantStatus)
+			}
+
+			if mockRepo.source != tc.wantSource || mockRepo.destination != tc.wantDestination {
+				t.Errorf("Move mismatch: got %s to %s, want %s to %s",
+					mockRepo.source, mockRepo.destination, tc.wantSource, tc.wantDestination)
+			}
+		})
+	}
+}
+
+type mockMoveRepository struct {
+	bucket      string
+	source      string
+	destination string
+	moved       int64
+	err         error
+}
+
+func (m *mockMoveRepository) Move(ctx context.Context, bucket, source, destination string) (int64, error) {
+	m.bucket = bucket
+	m.source = source
+	m.destination = destination
+	if m.err != nil {
+		return 0, m.err
+	}
+	return m.moved, nil
+}
+
+type mockResolver struct {
+	err error
+}
+
+func (m *mockResolver) Separator(ctx context.Context, bucket string) (paths.Separator, error) {
+	return paths.Separator{}, m.err
+}
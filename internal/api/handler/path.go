@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/logging"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+)
+
+// resolveSeparator returns the separator of bucket. On error it responds with an
+// internal error and returns false, so the handler must return.
+func resolveSeparator(w http.ResponseWriter, r *http.Request, resolver paths.Resolver, logger *slog.Logger, bucket string) (paths.Separator, bool) {
+	sep, err := resolver.Separator(r.Context(), bucket)
+	if err != nil {
+		logger.Error("Error resolving bucket delimiter", logging.KeyBucket, bucket, logging.KeyError, err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return sep, false
+	}
+	return sep, true
+}
+
+// resolvePath returns the separator of bucket and the path param normalized by adding
+// its delimiter as suffix if missing. On error it responds like resolveSeparator.
+func resolvePath(w http.ResponseWriter, r *http.Request, resolver paths.Resolver, logger *slog.Logger, bucket string) (paths.Separator, string, bool) {
+	sep, ok := resolveSeparator(w, r, resolver, logger, bucket)
+	if !ok {
+		return sep, "", false
+	}
+	return sep, sep.Normalize(r.PathValue("path")), true
+}
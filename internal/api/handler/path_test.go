@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+)
+
+func TestResolvePath(t *testing.T) {
+	testCases := []struct {
+		name       string
+		resolver   paths.Resolver
+		path       string
+		wantPath   string
+		wantOk     bool
+		wantStatus int
+	}{
+		{"Adds delimiter to path", paths.Static(paths.Default), "a/b", "a/b/", true, http.StatusOK},
+		{"Keeps root path", paths.Static(paths.Default), "", paths.Root, true, http.StatusOK},
+		{"Failing resolver", &mockResolver{err: errors.New("mock error")}, "a/b", "", false, http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.SetPathValue("path", tc.path)
+
+			rr := httptest.NewRecorder()
+			_, path, ok := resolvePath(rr, req, tc.resolver, slog.New(slog.NewTextHandler(io.Discard, nil)), "mock")
+
+			if ok != tc.wantOk || path != tc.wantPath {
+				t.Errorf("resolvePath mismatch: got (%q, %v) want (%q, %v)", path, ok, tc.wantPath, tc.wantOk)
+			}
+
+			if status := rr.Code; status != tc.wantStatus {
+				t.Errorf("status code mismatch: got %v want %v", status, tc.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/logging"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+)
+
+const defaultTopResults = 10
+
+type topHandler struct {
+	topRepo  repo.TopRepository
+	resolver paths.Resolver
+	logger   *slog.Logger
+}
+
+func NewTopHandler(topRepo repo.TopRepository, resolver paths.Resolver, logger *slog.Logger) *topHandler {
+	return &topHandler{topRepo, resolver, logger}
+}
+
+// HandleTop returns the largest objects or directories anywhere below a path
+func (h *topHandler) HandleTop(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// Normalize path param by adding the delimiter of the bucket as suffix if missing
+	_, path, ok := resolvePath(w, r, h.resolver, h.logger, query.Get("bucket"))
+	if !ok {
+		return
+	}
+
+	// Validate kind query param
+	kind := repo.EntryKind(strings.ToLower(query.Get("kind")))
+	if kind == "" {
+		kind = repo.EntryObjects
+	}
+	if kind != repo.EntryObjects && kind != repo.EntryDirectories {
+		http.Error(w, "Invalid kind parameter, please use 'objects' or 'directories'", http.StatusBadRequest)
+		return
+	}
+
+	// Validate by query param
+	by := repo.SortType(strings.ToLower(query.Get("by")))
+	if by == "" {
+		by = repo.SortBySize
+	}
+	if by != repo.SortBySize && by != repo.SortByCount && by != repo.SortByCost {
+		http.Error(w, "Invalid by parameter, please use 'size', 'count' or 'cost'", http.StatusBadRequest)
+		return
+	}
+	if by == repo.SortByCount && kind == repo.EntryObjects {
+		http.Error(w, "Invalid by parameter, objects can only be ranked by 'size' or 'cost'", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+
+	// Validate n query param
+	n := defaultTopResults
+	if nString := query.Get("n"); nString != "" {
+		if n, err = strconv.Atoi(nString); err != nil || n < 1 || n > repo.MaxTopResults {
+			http.Error(w, fmt.Sprintf("Invalid n parameter, please use an integer from 1 to %d", repo.MaxTopResults), http.StatusBadRequest)
+			return
+		}
+	}
+
+	opts := repo.TopOptions{Kind: kind, By: by, N: n}
+	top, err := h.topRepo.GetTop(r.Context(), query.Get("bucket"), path, opts)
+	if err != nil {
+		h.logger.Error("Error retrieving top results", "path", path, logging.KeyError, err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Path    string            `json:"path"`
+		Kind    repo.EntryKind    `json:"kind"`
+		By      repo.SortType     `json:"by"`
+		Results []*model.Metadata `json:"results"`
+	}{
+		Path:    r.PathValue("path"),
+		Kind:    kind,
+		By:      by,
+		Results: top,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.logger.Error("Error encoding top response", logging.KeyError, err)
+	}
+}
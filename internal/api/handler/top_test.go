@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+)
+
+func TestHandleTop(t *testing.T) {
+	testCases := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantPath   string
+		wantOpts   repo.TopOptions
+	}{
+		{"Largest objects by default", "/top/mock-1", http.StatusOK, "mock-1/", repo.TopOptions{Kind: repo.EntryObjects, By: repo.SortBySize, N: 10}},
+		{"Root directories by count", "/top/?kind=directories&by=count&n=5", http.StatusOK, "/", repo.TopOptions{Kind: repo.EntryDirectories, By: repo.SortByCount, N: 5}},
+		{"Objects by cost", "/top/mock-1/?by=cost&n=1000", http.StatusOK, "mock-1/", repo.TopOptions{Kind: repo.EntryObjects, By: repo.SortByCost, N: 1000}},
+		{"Invalid kind", "/top/mock-1?kind=all", http.StatusBadRequest, "", repo.TopOptions{}},
+		{"Invalid by", "/top/mock-1?by=name", http.StatusBadRequest, "", repo.TopOptions{}},
+		{"Objects by count", "/top/mock-1?by=count", http.StatusBadRequest, "", repo.TopOptions{}},
+		{"Zero results", "/top/mock-1?n=0", http.StatusBadRequest, "", repo.TopOptions{}},
+		{"Too many results", "/top/mock-1?n=1001", http.StatusBadRequest, "", repo.TopOptions{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := &mockTopRepository{}
+			handler := NewTopHandler(mockRepo, paths.Static(paths.Default), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /top/{path...}", handler.HandleTop)
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest("GET", tc.target, nil))
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("Status code mismatch: got %d, want %d", rr.Code, tc.wantStatus)
+			}
+
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			if mockRepo.path != tc.wantPath {
+				t.Errorf("Path mismatch: got %s, want %s", mockRepo.path, tc.wantPath)
+			}
+
+			if mockRepo.opts != tc.wantOpts {
+				t.Errorf("Options mismatch: got %+v, want %+v", mockRepo.opts, tc.wantOpts)
+			}
+		})
+	}
+}
+
+type mockTopRepository struct {
+	path string
+	opts repo.TopOptions
+}
+
+func (m *mockTopRepository) GetTop(ctx context.Context, bucket, path string, opts repo.TopOptions) ([]*model.Metadata, error) {
+	m.path = path
+	m.opts = opts
+	return []*model.Metadata{}, nil
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/logging"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+)
+
+const (
+	defaultTreeDepth       = 2
+	defaultTreeMinFraction = 0.01
+)
+
+type treeHandler struct {
+	treeRepo repo.TreeRepository
+	resolver paths.Resolver
+	logger   *slog.Logger
+}
+
+func NewTreeHandler(treeRepo repo.TreeRepository, resolver paths.Resolver, logger *slog.Logger) *treeHandler {
+	return &treeHandler{treeRepo, resolver, logger}
+}
+
+// HandleTree returns the nested directories below a path for rendering a treemap
+func (h *treeHandler) HandleTree(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// Normalize path param by adding the delimiter of the bucket as suffix if missing
+	_, path, ok := resolvePath(w, r, h.resolver, h.logger, query.Get("bucket"))
+	if !ok {
+		return
+	}
+
+	var err error
+
+	// Validate depth query param
+	depth := defaultTreeDepth
+	if depthString := query.Get("depth"); depthString != "" {
+		if depth, err = strconv.Atoi(depthString); err != nil || depth < 1 || depth > repo.MaxTreeDepth {
+			http.Error(w, fmt.Sprintf("Invalid depth parameter, please use an integer from 1 to %d", repo.MaxTreeDepth), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate minFraction query param
+	minFraction := defaultTreeMinFraction
+	if fractionString := query.Get("minFraction"); fractionString != "" {
+		if minFraction, err = strconv.ParseFloat(fractionString, 64); err != nil || minFraction < 0 || minFraction >= 1 {
+			http.Error(w, "Invalid minFraction parameter, please use a number from 0 to less than 1", http.StatusBadRequest)
+			return
+		}
+	}
+
+	opts := repo.TreeOptions{Depth: depth, MinFraction: minFraction}
+	tree, err := h.treeRepo.GetTree(r.Context(), query.Get("bucket"), path, opts)
+	if err != nil {
+		h.logger.Error("Error retrieving tree", "path", path, logging.KeyError, err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tree); err != nil {
+		h.logger.Error("Error encoding tree response", logging.KeyError, err)
+	}
+}
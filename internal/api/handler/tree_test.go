@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+)
+
+func TestHandleTree(t *testing.T) {
+	testCases := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantPath   string
+		wantBucket string
+		wantOpts   repo.TreeOptions
+	}{
+		{"Defaults", "/tree/mock-1", http.StatusOK, "mock-1/", "", repo.TreeOptions{Depth: 2, MinFraction: 0.01}},
+		{"Root with options", "/tree/?depth=4&minFraction=0.1&bucket=mock", http.StatusOK, "/", "mock", repo.TreeOptions{Depth: 4, MinFraction: 0.1}},
+		{"No collapsing", "/tree/mock-1/?minFraction=0", http.StatusOK, "mock-1/", "", repo.TreeOptions{Depth: 2}},
+		{"Invalid depth", "/tree/mock-1?depth=a", http.StatusBadRequest, "", "", repo.TreeOptions{}},
+		{"Zero depth", "/tree/mock-1?depth=0", http.StatusBadRequest, "", "", repo.TreeOptions{}},
+		{"Depth over maximum", "/tree/mock-1?depth=11", http.StatusBadRequest, "", "", repo.TreeOptions{}},
+		{"Invalid fraction", "/tree/mock-1?minFraction=a", http.StatusBadRequest, "", "", repo.TreeOptions{}},
+		{"Negative fraction", "/tree/mock-1?minFraction=-0.1", http.StatusBadRequest, "", "", repo.TreeOptions{}},
+		{"Whole fraction", "/tree/mock-1?minFraction=1", http.StatusBadRequest, "", "", repo.TreeOptions{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := &mockTreeRepository{}
+			handler := NewTreeHandler(mockRepo, paths.Static(paths.Default), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /tree/{path...}", handler.HandleTree)
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest("GET", tc.target, nil))
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("Status code mismatch: got %d, want %d", rr.Code, tc.wantStatus)
+			}
+
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			if mockRepo.path != tc.wantPath || mockRepo.bucket != tc.wantBucket {
+				t.Errorf("Path mismatch: got %s in %q, want %s in %q", mockRepo.path, mockRepo.bucket, tc.wantPath, tc.wantBucket)
+			}
+
+			if mockRepo.opts != tc.wantOpts {
+				t.Errorf("Options mismatch: got %+v, want %+v", mockRepo.opts, tc.wantOpts)
+			}
+		})
+	}
+}
+
+type mockTreeRepository struct {
+	bucket string
+	path   string
+	opts   repo.TreeOptions
+}
+
+func (m *mockTreeRepository) GetTree(ctx context.Context, bucket, path string, opts repo.TreeOptions) (*model.TreeNode, error) {
+	m.bucket = bucket
+	m.path = path
+	m.opts = opts
+	return &model.TreeNode{Name: path, Path: path}, nil
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	cfg := CORSConfig{
+		AllowedOrigins: []string{"https://ui.example.com"},
+		AllowedMethods: []string{"GET", "OPTIONS"},
+		AllowedHeaders: []string{"Authorization"},
+		MaxAge:         time.Hour,
+	}
+
+	testCases := []struct {
+		name          string
+		cfg           CORSConfig
+		method        string
+		origin        string
+		requestMethod string
+		wantStatus    int
+		wantOrigin    string
+		wantNext      bool
+	}{
+		{"Passes same-origin request", cfg, "GET", "", "", http.StatusOK, "", true},
+		{"Allows configured origin", cfg, "GET", "https://ui.example.com", "", http.StatusOK, "https://ui.example.com", true},
+		{"Omits header for other origin", cfg, "GET", "https://evil.example.com", "", http.StatusOK, "", true},
+		{"Answers preflight", cfg, "OPTIONS", "https://ui.example.com", "GET", http.StatusNoContent, "https://ui.example.com", false},
+		{"Denies preflight of other origin", cfg, "OPTIONS", "https://evil.example.com", "GET", http.StatusForbidden, "", false},
+		{"Denies preflight of other method", cfg, "OPTIONS", "https://ui.example.com", "DELETE", http.StatusForbidden, "", false},
+		{"Denies all origins by default", CORSConfig{}, "GET", "https://ui.example.com", "", http.StatusOK, "", true},
+		{"Allows any origin", CORSConfig{AllowedOrigins: []string{"*"}}, "GET", "https://ui.example.com", "", http.StatusOK, "*", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotNext bool
+			handler := CORS(tc.cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotNext = true
+			}))
+
+			req := httptest.NewRequest(tc.method, "/explore/", nil)
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			if tc.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tc.requestMethod)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantStatus {
+				t.Errorf("Status code mismatch: got %d, want %d", rr.Code, tc.wantStatus)
+			}
+
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tc.wantOrigin {
+				t.Errorf("Allowed origin mismatch: got %q, want %q", got, tc.wantOrigin)
+			}
+
+			if gotNext != tc.wantNext {
+				t.Errorf("Next handler called mismatch: got %v, want %v", gotNext, tc.wantNext)
+			}
+
+			if tc.wantStatus == http.StatusNoContent {
+				if got := rr.Header().Get("Access-Control-Allow-Headers"); got != "Authorization" {
+					t.Errorf("Allowed headers mismatch: got %q, want %q", got, "Authorization")
+				}
+
+				if got := rr.Header().Get("Access-Control-Max-Age"); got != "3600" {
+					t.Errorf("Max age mismatch: got %q, want %q", got, "3600")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	testCases := []struct {
+		name     string
+		incoming string
+		wantSame bool
+	}{
+		{"Generates missing ID", "", false},
+		{"Keeps incoming ID", "mock-id", true},
+		{"Replaces ID with spaces", "mock id", false},
+		{"Replaces overlong ID", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotRequest string
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotRequest = GetRequestID(r)
+			}))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.incoming != "" {
+				req.Header.Set(RequestIDHeader, tc.incoming)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			gotResponse := rr.Header().Get(RequestIDHeader)
+			if gotResponse == "" || gotResponse != gotRequest {
+				t.Fatalf("Request ID mismatch: got %q in response, %q in request", gotResponse, gotRequest)
+			}
+
+			if (gotResponse == tc.incoming) != tc.wantSame {
+				t.Errorf("Incoming request ID kept mismatch: got %q, incoming %q", gotResponse, tc.incoming)
+			}
+		})
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	testCases := []struct {
+		name     string
+		proto    string
+		wantHSTS bool
+	}{
+		{"Sets headers over HTTP", "", false},
+		{"Sets HSTS behind HTTPS proxy", "https", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := SecurityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tc.proto)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if got := rr.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("X-Content-Type-Options mismatch: got %q, want %q", got, "nosniff")
+			}
+
+			if got := rr.Header().Get("Strict-Transport-Security") != ""; got != tc.wantHSTS {
+				t.Errorf("HSTS mismatch: got %v, want %v", got, tc.wantHSTS)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/logging"
+)
+
+// Recover responds with an internal error if next panics, logging the panic with its stack trace
+func Recover(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+
+				// Aborted responses are handled by the server
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
+				logger.Error("Panic serving request",
+					"requestId", GetRequestID(r),
+					"path", r.URL.Path,
+					logging.KeyError, fmt.Sprint(err),
+					"stack", string(debug.Stack()),
+				)
+				http.Error(w, "Internal error", http.StatusInternalServerError)
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AccessLog logs every request as a Cloud Logging httpRequest entry.
+// Requests to routes in quietRoutes, such as probes, are logged at debug level.
+func AccessLog(logger *slog.Logger, quietRoutes ...string) Middleware {
+	quiet := make(map[string]bool, len(quietRoutes))
+	for _, route := range quietRoutes {
+		quiet[route] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := NewResponseRecorder(w)
+
+			next.ServeHTTP(rec, r)
+
+			level := slog.LevelInfo
+			switch {
+			case rec.Status() >= http.StatusInternalServerError:
+				level = slog.LevelError
+			case quiet[r.Pattern]:
+				level = slog.LevelDebug
+			}
+
+			// See https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#httprequest
+			logger.Log(r.Context(), level, "Request served",
+				"requestId", GetRequestID(r),
+				slog.Group("httpRequest",
+					"requestMethod", r.Method,
+					"requestUrl", r.URL.String(),
+					"status", rec.Status(),
+					"responseSize", fmt.Sprint(rec.Size()),
+					"userAgent", r.UserAgent(),
+					"remoteIp", r.RemoteAddr,
+					"latency", fmt.Sprintf("%.6fs", time.Since(start).Seconds()),
+				),
+			)
+		})
+	}
+}
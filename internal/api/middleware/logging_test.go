@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/logging"
+)
+
+func TestChain(t *testing.T) {
+	testCases := []struct {
+		name         string
+		target       string
+		wantStatus   int
+		wantSeverity string
+		wantPattern  string
+	}{
+		{"Logs served request", "/explore/mock", http.StatusOK, "INFO", "GET /explore/{path...}"},
+		{"Logs quiet route at debug", "/healthz", http.StatusOK, "DEBUG", "GET /healthz"},
+		{"Recovers from panic", "/panic", http.StatusInternalServerError, "ERROR", "GET /panic"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /explore/{path...}", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			})
+			mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {})
+			mux.HandleFunc("GET /panic", func(w http.ResponseWriter, r *http.Request) {
+				panic("mock")
+			})
+
+			var buf bytes.Buffer
+			logger := logging.New(&buf, slog.LevelDebug)
+
+			// Pattern must remain visible to instrumentation wrapping the chain
+			var gotPattern string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Chain(mux, RequestID, AccessLog(logger, "GET /healthz"), Recover(logger), SecurityHeaders).ServeHTTP(w, r)
+				gotPattern = r.Pattern
+			})
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", tc.target, nil))
+
+			if rr.Code != tc.wantStatus {
+				t.Errorf("Status code mismatch: got %d, want %d", rr.Code, tc.wantStatus)
+			}
+
+			if gotPattern != tc.wantPattern {
+				t.Errorf("Pattern mismatch: got %q, want %q", gotPattern, tc.wantPattern)
+			}
+
+			// The access log is the last entry
+			lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+			var got struct {
+				Severity    string `json:"severity"`
+				RequestID   string `json:"requestId"`
+				HTTPRequest struct {
+					Status int `json:"status"`
+				} `json:"httpRequest"`
+			}
+			if err := json.Unmarshal(lines[len(lines)-1], &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Severity != tc.wantSeverity {
+				t.Errorf("Severity mismatch: got %s, want %s", got.Severity, tc.wantSeverity)
+			}
+
+			if got.HTTPRequest.Status != tc.wantStatus {
+				t.Errorf("Logged status mismatch: got %d, want %d", got.HTTPRequest.Status, tc.wantStatus)
+			}
+
+			if got.RequestID != rr.Header().Get(RequestIDHeader) {
+				t.Errorf("Logged request ID mismatch: got %s, want %s", got.RequestID, rr.Header().Get(RequestIDHeader))
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Package middleware provides the HTTP middleware applied to every route of the API.
+//
+// Middleware must not replace the request with a copy, since instrumentation
+// wrapping the chain reads the route pattern http.ServeMux sets on it.
+package middleware
+
+import "net/http"
+
+// Middleware wraps a handler with additional behavior
+type Middleware func(next http.Handler) http.Handler
+
+// Chain wraps h with middleware, the first of which is outermost
+func Chain(h http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// ResponseRecorder captures the status code and size of a response. It is shared by the
+// middleware and the instrumentation wrapping the chain, and unwraps to the writer it wraps
+// so that http.ResponseController reaches the underlying writer through every layer.
+type ResponseRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+}
+
+// NewResponseRecorder returns a recorder of the response written to w
+func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
+	return &ResponseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+// Status returns the status code of the response, http.StatusOK if none was written
+func (r *ResponseRecorder) Status() int {
+	return r.status
+}
+
+// Size returns the number of bytes written to the response body
+func (r *ResponseRecorder) Size() int64 {
+	return r.size
+}
+
+func (r *ResponseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *ResponseRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.size += int64(n)
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (r *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -1,20 +1,110 @@
 package router
 
 import (
+	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/api/auth"
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/api/handler"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/api/middleware"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/metrics"
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
 )
 
-func New(db *repo.Database) *http.ServeMux {
+type Config struct {
+	// MaxEventAge fails readiness if the subscriber has not processed an event within it, disabled if 0
+	MaxEventAge time.Duration
+	// Auth authenticates and authorizes access to bucket contents, all contents are public if nil
+	Auth *auth.Middleware
+	// CORS configures cross-origin access, denied to all origins by default
+	CORS middleware.CORSConfig
+	// UI serves the explorer on every path not matched by the API, not served if nil
+	UI http.Handler
+}
+
+func New(db *repo.Database, cfg Config, logger *slog.Logger) http.Handler {
 	mux := http.NewServeMux()
 
+	// Requested paths are normalized with the delimiter each bucket is seeded with
+	bucketRepo := repo.NewBucketRepository(db)
+
+	// http.ServeMux redirects requests for paths with empty segments, such as /explore/a//,
+	// to their cleaned path. Directories with empty segments or a leading delimiter are
+	// requested by escaping the delimiter as %2F, which {path...} values are decoded from.
+
 	exploreRepo := repo.NewExploreRepository(db)
-	exploreHandler := handler.NewExploreHandler(exploreRepo)
+	exploreHandler := handler.NewExploreHandler(exploreRepo, bucketRepo, logger)
+
+	mux.HandleFunc("GET /explore/{path...}", requireAuth(cfg, exploreHandler.HandleExplore))
+	mux.HandleFunc("GET /summary/{path...}", requireAuth(cfg, exploreHandler.HandleSummary))
+
+	exportRepo := repo.NewExportRepository(db)
+	exportHandler := handler.NewExportHandler(exportRepo, bucketRepo, logger)
+
+	mux.HandleFunc("GET /export/{path...}", requireAuth(cfg, exportHandler.HandleExport))
+
+	topRepo := repo.NewTopRepository(db)
+	topHandler := handler.NewTopHandler(topRepo, bucketRepo, logger)
+
+	mux.HandleFunc("GET /top/{path...}", requireAuth(cfg, topHandler.HandleTop))
+
+	treeRepo := repo.NewTreeRepository(db)
+	treeHandler := handler.NewTreeHandler(treeRepo, bucketRepo, logger)
+
+	mux.HandleFunc("GET /tree/{path...}", requireAuth(cfg, treeHandler.HandleTree))
+
+	diffRepo := repo.NewDiffRepository(db)
+	diffHandler := handler.NewDiffHandler(diffRepo, bucketRepo, logger)
 
-	mux.HandleFunc("GET /explore/{path...}", exploreHandler.HandleExplore)
-	mux.HandleFunc("GET /summary/{path...}", exploreHandler.HandleSummary)
+	mux.HandleFunc("GET /diff/{path...}", requireAuth(cfg, diffHandler.HandleDiff))
 
+	// Admin routes modify metadata, so they are only served with auth configured
+	if cfg.Auth != nil {
+		moveRepo := repo.NewMoveRepository(db)
+		moveHandler := handler.NewMoveHandler(moveRepo, bucketRepo, logger)
+
+		mux.HandleFunc("POST /admin/move", cfg.Auth.RequireAdmin(moveHandler.HandleMove))
+	}
+
+	mux.Handle("GET /metrics", metrics.Handler())
+	handleHealth(mux, db, cfg, logger)
+
+	if cfg.UI != nil {
+		mux.Handle("GET /", cfg.UI)
+	}
+
+	return tracing.InstrumentHandler(metrics.InstrumentHandler(middleware.Chain(mux,
+		middleware.RequestID,
+		middleware.AccessLog(logger, "GET /metrics", "GET /healthz", "GET /readyz"),
+		middleware.Recover(logger),
+		middleware.SecurityHeaders,
+		middleware.CORS(cfg.CORS),
+	)))
+}
+
+// requireAuth wraps a handler exposing bucket contents with the configured auth middleware
+func requireAuth(cfg Config, next http.HandlerFunc) http.HandlerFunc {
+	if cfg.Auth == nil {
+		return next
+	}
+	return cfg.Auth.Require(next)
+}
+
+// NewHealth returns a handler serving only health, readiness and version probes.
+// It is used as a sidecar listener by services without an HTTP API.
+func NewHealth(db *repo.Database, cfg Config, logger *slog.Logger) http.Handler {
+	mux := http.NewServeMux()
+	handleHealth(mux, db, cfg, logger)
 	return mux
 }
+
+func handleHealth(mux *http.ServeMux, db *repo.Database, cfg Config, logger *slog.Logger) {
+	statusRepo := repo.NewStatusRepository(db)
+	healthHandler := handler.NewHealthHandler(db, statusRepo, cfg.MaxEventAge, logger)
+
+	mux.HandleFunc("GET /healthz", healthHandler.HandleHealthz)
+	mux.HandleFunc("GET /readyz", healthHandler.HandleReadyz)
+	mux.HandleFunc("GET /version", healthHandler.HandleVersion)
+}
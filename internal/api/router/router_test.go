@@ -0,0 +1,129 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+)
+
+// newTestDatabase returns an empty in-memory database with all tables
+func newTestDatabase(t *testing.T) *repo.Database {
+	t.Helper()
+
+	db := repo.NewDatabase(":memory:", 1)
+	if err := db.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestFlushThroughChain(t *testing.T) {
+	var flushErr error
+	ui := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		flushErr = http.NewResponseController(w).Flush()
+	})
+
+	handler := New(newTestDatabase(t), Config{UI: ui}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/index.html", nil))
+
+	if flushErr != nil {
+		t.Fatalf("Flush through middleware and instrumentation failed: %v", flushErr)
+	}
+
+	if !rr.Flushed {
+		t.Error("Expected response to be flushed but was not")
+	}
+}
+
+func TestEmptySegmentPaths(t *testing.T) {
+	db := newTestDatabase(t)
+	metadataRepo := repo.NewMetadataRepository(db)
+	dirRepo := repo.NewDirectoryRepository(db)
+
+	for _, name := range []string{"a//b.txt", "a/c.txt", "/x/d.txt"} {
+		obj := model.Metadata{Bucket: "mock", Name: name, Size: 1, StorageClass: "STANDARD", Created: time.Now(), Updated: time.Now()}
+		if err := metadataRepo.Insert(context.Background(), paths.Default, &obj); err != nil {
+			t.Fatal(err)
+		}
+		if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, repo.StorageStandard, obj.Bucket, obj.Name, obj.Size, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler := New(db, Config{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	testCases := []struct {
+		name         string
+		target       string
+		wantStatus   int
+		wantLocation string
+		wantContents []string
+	}{
+		{"Redirects unescaped empty segment", "/explore/a//?bucket=mock", http.StatusTemporaryRedirect, "/explore/a/?bucket=mock", nil},
+		{"Explores escaped empty segment", "/explore/a%2F%2F?bucket=mock", http.StatusOK, "", []string{"a//", "a//b.txt"}},
+		{"Explores escaped nested empty segment", "/explore/a/%2F?bucket=mock", http.StatusOK, "", []string{"a//", "a//b.txt"}},
+		{"Explores escaped leading delimiter", "/explore/%2Fx%2F?bucket=mock", http.StatusOK, "", []string{"/x/", "/x/d.txt"}},
+		{"Explores directory with empty segment", "/explore/a?bucket=mock", http.StatusOK, "", []string{"a/", "a//", "a/c.txt"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", tc.target, nil))
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("Status code mismatch: got %d, want %d", rr.Code, tc.wantStatus)
+			}
+
+			if got := rr.Header().Get("Location"); got != tc.wantLocation {
+				t.Errorf("Location mismatch: got %q, want %q", got, tc.wantLocation)
+			}
+
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Contents []*model.Metadata `json:"contents"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+
+			got := map[string]bool{}
+			for _, c := range response.Contents {
+				got[c.Name] = true
+			}
+
+			if len(got) != len(tc.wantContents) {
+				t.Errorf("Contents mismatch: got %v, want %v", got, tc.wantContents)
+			}
+			for _, name := range tc.wantContents {
+				if !got[name] {
+					t.Errorf("Contents mismatch: got %v, want %s", got, name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,3 @@
+// Package e2e runs the seeder, subscriber and API together against an in-process
+// fake Cloud Storage server and Pub/Sub fake. It only contains tests.
+package e2e
@@ -0,0 +1,328 @@
+package e2e
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/seeder"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/subscriber"
+)
+
+// exploreResponse is the response of the explore endpoint
+type exploreResponse struct {
+	Path     string            `json:"path"`
+	Contents []*model.Metadata `json:"contents"`
+}
+
+// sizes returns the size of each content by name
+func (r *exploreResponse) sizes() map[string]int64 {
+	sizes := map[string]int64{}
+	for _, c := range r.Contents {
+		sizes[c.Name] = c.Size
+	}
+	return sizes
+}
+
+func TestSeedAndSubscribe(t *testing.T) {
+	seeded := time.Now().Add(-time.Hour).UTC()
+	h := newHarness(t, map[string][]*fakeObject{
+		"mock": {
+			{Name: "dir/a.txt", Size: 100, StorageClass: "STANDARD", Created: seeded, Updated: seeded},
+			{Name: "dir/b.txt", Size: 200, StorageClass: "STANDARD", Created: seeded, Updated: seeded},
+			{Name: "dir/sub/c.txt", Size: 300, StorageClass: "NEARLINE", Created: seeded, Updated: seeded},
+			{Name: "d.txt", Size: 400, StorageClass: "STANDARD", Created: seeded, Updated: seeded},
+		},
+		"other": {
+			{Name: "e.txt", Size: 1000, StorageClass: "COLDLINE", Created: seeded, Updated: seeded},
+		},
+	})
+
+	h.seed("mock", seeder.Options{})
+	h.seed("other", seeder.Options{})
+
+	t.Run("Serves seeded buckets", func(t *testing.T) {
+		var summary model.Summary
+		h.get("/summary/?bucket=mock", &summary)
+
+		want := model.Size{Standard: 700, Nearline: 300}
+		if summary.Size != want {
+			t.Errorf("Summary mismatch: got %+v, want %+v", summary.Size, want)
+		}
+
+		var all model.Summary
+		h.get("/summary/", &all)
+
+		want = model.Size{Standard: 700, Nearline: 300, Coldline: 1000}
+		if all.Size != want {
+			t.Errorf("Summary of all buckets mismatch: got %+v, want %+v", all.Size, want)
+		}
+
+		var explore exploreResponse
+		h.get("/explore/dir/?bucket=mock", &explore)
+
+		wantSizes := map[string]int64{"dir/": 600, "dir/sub/": 300, "dir/a.txt": 100, "dir/b.txt": 200}
+		if got := explore.sizes(); !maps.Equal(got, wantSizes) {
+			t.Errorf("Contents mismatch: got %v, want %v", got, wantSizes)
+		}
+	})
+
+	h.subscribe()
+	updated := time.Now().UTC()
+
+	t.Run("Applies notifications", func(t *testing.T) {
+		h.publish(storage.ObjectFinalizeEvent, "mock", &fakeObject{Name: "dir/new.txt", Size: 50, StorageClass: "STANDARD", Created: updated, Updated: updated})
+		h.publish(storage.ObjectDeleteEvent, "mock", &fakeObject{Name: "d.txt", Size: 400, StorageClass: "STANDARD", Created: seeded, Updated: updated})
+		h.publish(storage.ObjectArchiveEvent, "mock", &fakeObject{Name: "dir/a.txt", Size: 100, StorageClass: "ARCHIVE", Created: seeded, Updated: updated})
+
+		// Overwriting the object updates its size
+		h.publish(storage.ObjectFinalizeEvent, "mock", &fakeObject{Name: "dir/b.txt", Size: 250, StorageClass: "STANDARD", Created: seeded, Updated: updated})
+
+		want := model.Size{Standard: 300, Nearline: 300, Archive: 100}
+		var summary model.Summary
+		h.waitFor("notifications to be applied", func() bool {
+			h.get("/summary/?bucket=mock", &summary)
+			return summary.Size == want
+		})
+
+		var explore exploreResponse
+		h.get("/explore/?bucket=mock", &explore)
+
+		wantSizes := map[string]int64{"/": 700, "dir/": 700}
+		if got := explore.sizes(); !maps.Equal(got, wantSizes) {
+			t.Errorf("Root contents mismatch: got %v, want %v", got, wantSizes)
+		}
+
+		h.get("/explore/dir/?bucket=mock", &explore)
+
+		var classes []string
+		for _, c := range explore.Contents {
+			if c.Name == "dir/a.txt" || c.Name == "dir/new.txt" {
+				classes = append(classes, c.Name+" "+c.StorageClass)
+			}
+		}
+		slices.Sort(classes)
+
+		wantClasses := []string{"dir/a.txt ARCHIVE", "dir/new.txt STANDARD"}
+		if !slices.Equal(classes, wantClasses) {
+			t.Errorf("Storage classes mismatch: got %v, want %v", classes, wantClasses)
+		}
+
+		// Other buckets are not affected
+		var other model.Summary
+		h.get("/summary/?bucket=other", &other)
+
+		if want := (model.Size{Coldline: 1000}); other.Size != want {
+			t.Errorf("Other bucket mismatch: got %+v, want %+v", other.Size, want)
+		}
+	})
+
+	t.Run("Ignores stale notifications", func(t *testing.T) {
+		// A notification older than the stored metadata is acknowledged without changes
+		h.publish(storage.ObjectFinalizeEvent, "mock", &fakeObject{Name: "dir/b.txt", Size: 1, StorageClass: "STANDARD", Created: seeded, Updated: seeded})
+
+		// A later notification is applied once the stale one has been handled
+		later := updated.Add(time.Minute)
+		h.publish(storage.ObjectFinalizeEvent, "mock", &fakeObject{Name: "dir/last.txt", Size: 10, StorageClass: "STANDARD", Created: later, Updated: later})
+
+		var explore exploreResponse
+		h.waitFor("later notification to be applied", func() bool {
+			h.get("/explore/dir/?bucket=mock", &explore)
+			_, ok := explore.sizes()["dir/last.txt"]
+			return ok
+		})
+
+		if got := explore.sizes()["dir/b.txt"]; got != 250 {
+			t.Errorf("Size mismatch: got %d, want %d", got, 250)
+		}
+	})
+
+	t.Run("Reseeds subtree from listing", func(t *testing.T) {
+		// Objects changed without notifications are corrected by a reseed
+		h.gcs.put("mock", &fakeObject{Name: "dir/sub/c.txt", Size: 30, StorageClass: "NEARLINE", Created: seeded, Updated: updated})
+		h.seed("mock", seeder.Options{Prefix: "dir/sub/", Reseed: true})
+
+		var summary model.Summary
+		h.get("/summary/dir/sub/?bucket=mock", &summary)
+
+		if want := (model.Size{Nearline: 30}); summary.Size != want {
+			t.Errorf("Summary mismatch: got %+v, want %+v", summary.Size, want)
+		}
+	})
+
+	t.Run("Keeps directory invariants", func(t *testing.T) {
+		h.verify()
+	})
+}
+
+// folders returns whether each content is a folder by name
+func (r *exploreResponse) folders() map[string]bool {
+	folders := map[string]bool{}
+	for _, c := range r.Contents {
+		folders[c.Name] = c.Folder
+	}
+	return folders
+}
+
+func TestFolders(t *testing.T) {
+	seeded := time.Now().Add(-time.Hour).UTC()
+	h := newHarness(t, map[string][]*fakeObject{
+		"hns": {
+			{Name: "dir/a.txt", Size: 100, StorageClass: "STANDARD", Created: seeded, Updated: seeded},
+			{Name: "implicit/b.txt", Size: 200, StorageClass: "STANDARD", Created: seeded, Updated: seeded},
+		},
+	})
+	h.gcs.putFolder("hns", "dir/", false)
+	h.gcs.putFolder("hns", "empty/", false)
+	h.gcs.putFolder("hns", "managed/", true)
+
+	h.seed("hns", seeder.Options{})
+	h.subscribe()
+
+	t.Run("Seeds empty and managed folders", func(t *testing.T) {
+		var explore exploreResponse
+		h.get("/explore/?bucket=hns", &explore)
+
+		want := map[string]bool{"/": false, "dir/": true, "empty/": true, "implicit/": false, "managed/": true}
+		if got := explore.folders(); !maps.Equal(got, want) {
+			t.Errorf("Folders mismatch: got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Applies folder audit logs", func(t *testing.T) {
+		h.publishFolder(subscriber.FolderCreateMethod, "hns", "created/", "")
+
+		var explore exploreResponse
+		h.waitFor("created folder to be applied", func() bool {
+			h.get("/explore/?bucket=hns", &explore)
+			return explore.folders()["created/"]
+		})
+
+		h.publishFolder(subscriber.FolderRenameMethod, "hns", "created/", "renamed/")
+		h.waitFor("renamed folder to be applied", func() bool {
+			h.get("/explore/?bucket=hns", &explore)
+			_, created := explore.folders()["created/"]
+			return explore.folders()["renamed/"] && !created
+		})
+
+		h.publishFolder(subscriber.FolderDeleteMethod, "hns", "empty/", "")
+		h.waitFor("deleted folder to be applied", func() bool {
+			h.get("/explore/?bucket=hns", &explore)
+			_, ok := explore.folders()["empty/"]
+			return !ok
+		})
+	})
+
+	t.Run("Moves objects of renamed folders", func(t *testing.T) {
+		h.publishFolder(subscriber.FolderRenameMethod, "hns", "dir/", "archive/dir/")
+
+		var explore exploreResponse
+		h.waitFor("folder with objects to be moved", func() bool {
+			h.get("/explore/archive/?bucket=hns", &explore)
+			return explore.folders()["archive/dir/"]
+		})
+
+		var summary model.Summary
+		h.get("/summary/archive/dir/?bucket=hns", &summary)
+		if want := (model.Size{Standard: 100}); summary.Size != want {
+			t.Errorf("Summary mismatch: got %+v, want %+v", summary.Size, want)
+		}
+	})
+
+	t.Run("Keeps directory invariants", func(t *testing.T) {
+		h.verify()
+	})
+}
+
+func TestPaths(t *testing.T) {
+	seeded := time.Now().Add(-time.Hour).UTC()
+	h := newHarness(t, map[string][]*fakeObject{
+		"piped": {
+			{Name: "a|b|c.txt", Size: 100, StorageClass: "STANDARD", Created: seeded, Updated: seeded},
+			{Name: "a|b|", Size: 0, StorageClass: "STANDARD", Created: seeded, Updated: seeded},
+			{Name: "a/d.txt", Size: 200, StorageClass: "STANDARD", Created: seeded, Updated: seeded},
+			{Name: "|lead.txt", Size: 300, StorageClass: "STANDARD", Created: seeded, Updated: seeded},
+		},
+		"slashed": {
+			{Name: "a/b/", Size: 0, StorageClass: "STANDARD", Created: seeded, Updated: seeded},
+			{Name: "a//c.txt", Size: 100, StorageClass: "STANDARD", Created: seeded, Updated: seeded},
+			{Name: "/lead.txt", Size: 200, StorageClass: "STANDARD", Created: seeded, Updated: seeded},
+		},
+	})
+
+	h.seed("piped", seeder.Options{Delimiter: "|"})
+	h.seed("slashed", seeder.Options{})
+	h.subscribe()
+
+	t.Run("Splits names at the bucket delimiter", func(t *testing.T) {
+		var explore exploreResponse
+		h.get("/explore/?bucket=piped", &explore)
+
+		want := map[string]int64{"/": 600, "a|": 100, "a/d.txt": 200, "|lead.txt": 300}
+		if got := explore.sizes(); !maps.Equal(got, want) {
+			t.Errorf("Contents mismatch: got %v, want %v", got, want)
+		}
+
+		h.get("/explore/a?bucket=piped", &explore)
+		want = map[string]int64{"a|": 100, "a|b|": 100}
+		if got := explore.sizes(); !maps.Equal(got, want) {
+			t.Errorf("Contents mismatch: got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Holds placeholders in their own directory", func(t *testing.T) {
+		var explore exploreResponse
+		h.get("/explore/a%7Cb?bucket=piped", &explore)
+		if _, ok := explore.sizes()["a|b|c.txt"]; !ok {
+			t.Errorf("Contents mismatch: got %v, want a|b|c.txt", explore.sizes())
+		}
+
+		// The placeholder is counted in its own directory rather than in the parent
+		h.get("/explore/a?bucket=slashed", &explore)
+		for _, c := range explore.Contents {
+			if c.Name == "a/b/" && c.Count != 1 {
+				t.Errorf("Count mismatch: got %d, want %d", c.Count, 1)
+			}
+		}
+	})
+
+	t.Run("Keeps empty segments and leading delimiters", func(t *testing.T) {
+		var explore exploreResponse
+		h.get("/explore/?bucket=slashed", &explore)
+
+		want := map[string]int64{"/": 300, "/lead.txt": 200, "a/": 100}
+		if got := explore.sizes(); !maps.Equal(got, want) {
+			t.Errorf("Contents mismatch: got %v, want %v", got, want)
+		}
+
+		h.get("/explore/a?bucket=slashed", &explore)
+		want = map[string]int64{"a/": 100, "a//": 100, "a/b/": 0}
+		if got := explore.sizes(); !maps.Equal(got, want) {
+			t.Errorf("Contents mismatch: got %v, want %v", got, want)
+		}
+
+		// Empty segments are requested with escaped delimiters, since unescaped ones are cleaned
+		h.get("/explore/a%2F%2F?bucket=slashed", &explore)
+		want = map[string]int64{"a//": 100, "a//c.txt": 100}
+		if got := explore.sizes(); !maps.Equal(got, want) {
+			t.Errorf("Contents mismatch: got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Applies notifications at the bucket delimiter", func(t *testing.T) {
+		h.publish(storage.ObjectFinalizeEvent, "piped", &fakeObject{Name: "a|e.txt", Size: 50, StorageClass: "STANDARD", Created: seeded, Updated: seeded})
+
+		var explore exploreResponse
+		h.waitFor("object to be added", func() bool {
+			h.get("/explore/a%7C?bucket=piped", &explore)
+			return explore.sizes()["a|"] == 150
+		})
+	})
+
+	t.Run("Keeps directory invariants", func(t *testing.T) {
+		h.verify()
+	})
+}
@@ -0,0 +1,191 @@
+package e2e
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeObjectsPerPage is the page size of object listings, small so that listings span pages
+const fakeObjectsPerPage = 2
+
+// fakeObject is an object of the fake Cloud Storage server
+type fakeObject struct {
+	Name         string
+	Size         int64
+	StorageClass string
+	Created      time.Time
+	Updated      time.Time
+}
+
+// fakeGCS serves the bucket attributes, object listings and folder listings
+// of the Cloud Storage JSON API from objects and folders held in memory.
+// Buckets with folders have hierarchical namespace enabled.
+type fakeGCS struct {
+	mu             sync.Mutex
+	buckets        map[string][]*fakeObject
+	folders        map[string][]string
+	managedFolders map[string][]string
+}
+
+// newFakeGCS starts a fake Cloud Storage server closed with the test and returns its endpoint
+func newFakeGCS(t *testing.T, buckets map[string][]*fakeObject) (*fakeGCS, string) {
+	t.Helper()
+
+	fake := &fakeGCS{buckets: buckets, folders: map[string][]string{}, managedFolders: map[string][]string{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /storage/v1/b/{bucket}", fake.handleBucket)
+	mux.HandleFunc("GET /storage/v1/b/{bucket}/o", fake.handleObjects)
+	mux.HandleFunc("GET /storage/v1/b/{bucket}/folders", fake.handleFolders)
+	mux.HandleFunc("GET /storage/v1/b/{bucket}/managedFolders", fake.handleManagedFolders)
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return fake, server.URL + "/storage/v1/"
+}
+
+// put adds or replaces an object of bucket
+func (f *fakeGCS) put(bucket string, obj *fakeObject) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	objects := slices.DeleteFunc(f.buckets[bucket], func(o *fakeObject) bool { return o.Name == obj.Name })
+	f.buckets[bucket] = append(objects, obj)
+}
+
+// putFolder adds a folder to bucket, which is a managed folder if managed is set
+func (f *fakeGCS) putFolder(bucket, name string, managed bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if managed {
+		f.managedFolders[bucket] = append(f.managedFolders[bucket], name)
+	} else {
+		f.folders[bucket] = append(f.folders[bucket], name)
+	}
+}
+
+func (f *fakeGCS) handleBucket(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := r.PathValue("bucket")
+	if _, ok := f.buckets[name]; !ok {
+		writeGCSError(w, http.StatusNotFound, "The specified bucket does not exist.")
+		return
+	}
+
+	writeJSON(w, map[string]any{
+		"kind":                  "storage#bucket",
+		"name":                  name,
+		"location":              "US",
+		"storageClass":          "STANDARD",
+		"versioning":            map[string]bool{"enabled": false},
+		"hierarchicalNamespace": map[string]bool{"enabled": len(f.folders[name]) > 0},
+	})
+}
+
+func (f *fakeGCS) handleFolders(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Only buckets with hierarchical namespace have folders
+	folders, ok := f.folders[r.PathValue("bucket")]
+	if !ok {
+		writeGCSError(w, http.StatusBadRequest, "The bucket does not have hierarchical namespace enabled.")
+		return
+	}
+	f.writeFolders(w, r, "storage#folder", folders)
+}
+
+func (f *fakeGCS) handleManagedFolders(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.buckets[r.PathValue("bucket")]; !ok {
+		writeGCSError(w, http.StatusNotFound, "The specified bucket does not exist.")
+		return
+	}
+	f.writeFolders(w, r, "storage#managedFolder", f.managedFolders[r.PathValue("bucket")])
+}
+
+// writeFolders writes the listing of the folders matching the prefix of the request in one page
+func (f *fakeGCS) writeFolders(w http.ResponseWriter, r *http.Request, kind string, folders []string) {
+	items := []map[string]any{}
+	for _, name := range folders {
+		if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+			items = append(items, map[string]any{"kind": kind, "bucket": r.PathValue("bucket"), "name": name})
+		}
+	}
+	writeJSON(w, map[string]any{"kind": kind + "s", "items": items})
+}
+
+func (f *fakeGCS) handleObjects(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	objects, ok := f.buckets[r.PathValue("bucket")]
+	if !ok {
+		writeGCSError(w, http.StatusNotFound, "The specified bucket does not exist.")
+		return
+	}
+
+	query := r.URL.Query()
+	prefix, startOffset, endOffset := query.Get("prefix"), query.Get("startOffset"), query.Get("endOffset")
+
+	var names []string
+	byName := map[string]*fakeObject{}
+	for _, obj := range objects {
+		if strings.HasPrefix(obj.Name, prefix) && obj.Name >= startOffset && (endOffset == "" || obj.Name < endOffset) {
+			names = append(names, obj.Name)
+			byName[obj.Name] = obj
+		}
+	}
+	slices.Sort(names)
+
+	// Page tokens are the index of the first object of the page
+	start, _ := strconv.Atoi(query.Get("pageToken"))
+	start = min(start, len(names))
+	end := min(start+fakeObjectsPerPage, len(names))
+
+	items := make([]map[string]any, 0, end-start)
+	for _, name := range names[start:end] {
+		obj := byName[name]
+		items = append(items, map[string]any{
+			"kind":         "storage#object",
+			"bucket":       r.PathValue("bucket"),
+			"name":         obj.Name,
+			"size":         strconv.FormatInt(obj.Size, 10),
+			"storageClass": obj.StorageClass,
+			"timeCreated":  obj.Created.Format(time.RFC3339Nano),
+			"updated":      obj.Updated.Format(time.RFC3339Nano),
+		})
+	}
+
+	response := map[string]any{"kind": "storage#objects", "items": items}
+	if end < len(names) {
+		response["nextPageToken"] = strconv.Itoa(end)
+	}
+	writeJSON(w, response)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeGCSError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{"code": code, "message": message},
+	})
+}
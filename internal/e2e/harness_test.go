@@ -0,0 +1,296 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/api/router"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/seeder"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/source"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/subscriber"
+	"google.golang.org/api/option"
+	storagev1 "google.golang.org/api/storage/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	testProject      = "mock-project"
+	testTopic        = "mock-topic"
+	testSubscription = "mock-subscription"
+
+	// eventTimeout bounds the time for a published event to be visible through the API
+	eventTimeout = 10 * time.Second
+)
+
+// harness runs the seeder, subscriber and API of one database as the commands
+// do, against a fake Cloud Storage server and a Pub/Sub fake
+type harness struct {
+	t      *testing.T
+	dbUrl  string
+	logger *slog.Logger
+
+	gcs     *fakeGCS
+	storage *storage.Client
+	service *storagev1.Service
+	pubsub  *pubsub.Client
+	topic   *pubsub.Topic
+	api     *httptest.Server
+}
+
+// newHarness starts the fakes and the API for the buckets and their objects.
+// All are stopped once the test completes.
+func newHarness(t *testing.T, buckets map[string][]*fakeObject) *harness {
+	t.Helper()
+	ctx := context.Background()
+
+	h := &harness{
+		t:      t,
+		dbUrl:  filepath.Join(t.TempDir(), "metadata.db"),
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	// Cloud Storage
+	var endpoint string
+	h.gcs, endpoint = newFakeGCS(t, buckets)
+
+	var err error
+	h.storage, err = storage.NewClient(ctx, option.WithEndpoint(endpoint), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.storage.Close() })
+
+	h.service, err = storagev1.NewService(ctx, option.WithEndpoint(endpoint), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pub/Sub
+	pubsubServer := pstest.NewServer()
+	t.Cleanup(func() { pubsubServer.Close() })
+
+	conn, err := grpc.NewClient(pubsubServer.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	h.pubsub, err = pubsub.NewClient(ctx, testProject, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.pubsub.Close() })
+
+	if h.topic, err = h.pubsub.CreateTopic(ctx, testTopic); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.topic.Stop)
+
+	if _, err := h.pubsub.CreateSubscription(ctx, testSubscription, pubsub.SubscriptionConfig{Topic: h.topic}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Database, created by the seeder and migrated by every command
+	db := h.openDatabase()
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	h.api = httptest.NewServer(router.New(db, router.Config{}, h.logger))
+	t.Cleanup(h.api.Close)
+
+	return h
+}
+
+// openDatabase connects to the database of the harness, closed once the test completes
+func (h *harness) openDatabase() *repo.Database {
+	h.t.Helper()
+
+	db := repo.NewDatabase(h.dbUrl, 1)
+	if err := db.Connect(context.Background()); err != nil {
+		h.t.Fatal(err)
+	}
+	h.t.Cleanup(func() { db.Close() })
+
+	if err := db.Setup(); err != nil {
+		h.t.Fatal(err)
+	}
+	return db
+}
+
+// seed seeds bucket from the fake Cloud Storage server as cmd/seeder does
+func (h *harness) seed(bucket string, opts seeder.Options) {
+	h.t.Helper()
+
+	db := h.openDatabase()
+	if err := db.CreateTables(); err != nil {
+		h.t.Fatal(err)
+	}
+
+	deps := seeder.Dependencies{
+		Repos:      repo.NewRepositories(db),
+		Transactor: repo.NewTransactor(db),
+	}
+
+	seedService := seeder.NewSeedService(source.NewGCS(h.storage, h.service, bucket), bucket, opts, deps, nil, h.logger)
+
+	if err := seedService.Start(context.Background()); err != nil {
+		h.t.Fatal(err)
+	}
+
+	if err := db.CreateIndexes(); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+// subscribe receives events as cmd/subscriber does until the test completes
+func (h *harness) subscribe() {
+	h.t.Helper()
+
+	db := h.openDatabase()
+	subService := subscriber.NewSubscriberService(
+		h.pubsub, testSubscription,
+		repo.NewDirectoryRepository(db),
+		repo.NewMetadataRepository(db),
+		repo.NewStatusRepository(db),
+		repo.NewMoveRepository(db),
+		repo.NewBucketRepository(db),
+		repo.NewTransactor(db),
+		h.logger,
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- subService.Start(ctx)
+	}()
+
+	h.t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			h.t.Error(err)
+		}
+	})
+}
+
+// publish publishes the notification of an event on an object as Cloud Storage does
+func (h *harness) publish(eventType, bucket string, obj *fakeObject) {
+	h.t.Helper()
+
+	data, err := json.Marshal(map[string]string{
+		"kind":         "storage#object",
+		"bucket":       bucket,
+		"name":         obj.Name,
+		"size":         strconv.FormatInt(obj.Size, 10),
+		"storageClass": obj.StorageClass,
+		"timeCreated":  obj.Created.Format(time.RFC3339Nano),
+		"updated":      obj.Updated.Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	result := h.topic.Publish(context.Background(), &pubsub.Message{
+		Data: data,
+		Attributes: map[string]string{
+			"eventType": eventType,
+			"bucketId":  bucket,
+			"objectId":  obj.Name,
+		},
+	})
+	if _, err := result.Get(context.Background()); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+// publishFolder publishes the audit log entry of a call of a folder method on a folder of bucket
+// as a log sink does, renaming it to destination if set
+func (h *harness) publishFolder(method, bucket, name, destination string) {
+	h.t.Helper()
+
+	payload := map[string]any{
+		"@type":        "type.googleapis.com/google.cloud.audit.AuditLog",
+		"serviceName":  "storage.googleapis.com",
+		"methodName":   method,
+		"resourceName": "projects/_/buckets/" + bucket + "/folders/" + name,
+	}
+	if destination != "" {
+		payload["request"] = map[string]string{"destinationFolderId": destination}
+	}
+
+	data, err := json.Marshal(map[string]any{
+		"logName":      "projects/" + testProject + "/logs/cloudaudit.googleapis.com%2Factivity",
+		"timestamp":    time.Now().UTC().Format(time.RFC3339Nano),
+		"protoPayload": payload,
+	})
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	// Log entries are published without attributes
+	result := h.topic.Publish(context.Background(), &pubsub.Message{Data: data})
+	if _, err := result.Get(context.Background()); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+// get decodes the JSON response of the API to a GET request of path into v
+func (h *harness) get(path string, v any) {
+	h.t.Helper()
+
+	resp, err := http.Get(h.api.URL + path)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		h.t.Fatalf("Status mismatch for %s: got %d, want %d: %s", path, resp.StatusCode, http.StatusOK, body)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+// waitFor polls until cond holds, failing the test after eventTimeout
+func (h *harness) waitFor(description string, cond func() bool) {
+	h.t.Helper()
+
+	deadline := time.Now().Add(eventTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			h.t.Fatalf("Timed out waiting for %s", description)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// verify fails the test if the directory tree breaks an invariant, as cmd/verify does
+func (h *harness) verify() {
+	h.t.Helper()
+
+	db := h.openDatabase()
+	violations, err := repo.NewInvariantRepository(db).Check(context.Background(), "")
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	for _, v := range violations {
+		h.t.Errorf("Invariant violated: %s", v)
+	}
+}
@@ -0,0 +1,96 @@
+// Package export writes metadata rows as CSV, JSON Lines or Parquet.
+package export
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+)
+
+type Format string
+
+const (
+	FormatCSV     Format = "csv"
+	FormatJSONL   Format = "jsonl"
+	FormatParquet Format = "parquet"
+)
+
+const (
+	typeObject    = "object"
+	typeDirectory = "directory"
+)
+
+// Writer writes metadata rows in a format. Close must be called to flush buffered rows.
+type Writer interface {
+	Write(row *model.Metadata) error
+	Close() error
+}
+
+// NewWriter returns a Writer of format writing to w
+func NewWriter(format Format, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w), nil
+	case FormatJSONL:
+		return newJSONLWriter(w), nil
+	case FormatParquet:
+		return newParquetWriter(w), nil
+	default:
+		return nil, fmt.Errorf("invalid export format %q", format)
+	}
+}
+
+// ContentType returns the media type of format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatJSONL:
+		return "application/jsonl; charset=utf-8"
+	default:
+		return "application/vnd.apache.parquet"
+	}
+}
+
+// record is an exported row, shared by all formats so they have the same columns
+type record struct {
+	Bucket       string     `json:"bucket" parquet:"bucket,dict"`
+	Name         string     `json:"name" parquet:"name"`
+	Type         string     `json:"type" parquet:"type,dict"`
+	StorageClass string     `json:"storageClass,omitempty" parquet:"storage_class,dict"`
+	Size         int64      `json:"size" parquet:"size"`
+	Count        int64      `json:"count" parquet:"count"`
+	Cost         float64    `json:"cost" parquet:"cost"`
+	Created      *time.Time `json:"created,omitempty" parquet:"created,optional"`
+	Updated      *time.Time `json:"updated,omitempty" parquet:"updated,optional"`
+}
+
+// newRecord converts a row, where directories have an empty storage class and no timestamps
+func newRecord(row *model.Metadata) *record {
+	r := &record{
+		Bucket:       row.Bucket,
+		Name:         row.Name,
+		Type:         typeObject,
+		StorageClass: row.StorageClass,
+		Size:         row.Size,
+		Count:        row.Count,
+		Cost:         row.Cost,
+	}
+
+	if row.StorageClass == "" {
+		r.Type = typeDirectory
+	}
+
+	if !row.Created.IsZero() {
+		created := row.Created.UTC()
+		r.Created = &created
+	}
+
+	if !row.Updated.IsZero() {
+		updated := row.Updated.UTC()
+		r.Updated = &updated
+	}
+	return r
+}
@@ -0,0 +1,136 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/parquet-go/parquet-go"
+)
+
+var testRows = []*model.Metadata{
+	{Bucket: "mock", Name: "mock-1/", Size: 20, Count: 2, Cost: 0.5},
+	{Bucket: "mock", Name: "mock-1/file1", StorageClass: "STANDARD", Size: 10, Cost: 0.25,
+		Created: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Updated: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+}
+
+func writeRows(t *testing.T, format Format, rows []*model.Metadata) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCSVWriter(t *testing.T) {
+	testCases := []struct {
+		name string
+		rows []*model.Metadata
+		want [][]string
+	}{
+		{
+			"Writes header only for empty export",
+			nil,
+			[][]string{csvHeader},
+		},
+		{
+			"Writes objects and directories",
+			testRows,
+			[][]string{
+				csvHeader,
+				{"mock", "mock-1/", "directory", "", "20", "2", "0.5", "", ""},
+				{"mock", "mock-1/file1", "object", "STANDARD", "10", "0", "0.25", "2024-01-01T00:00:00Z", "2024-01-02T00:00:00Z"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := csv.NewReader(bytes.NewReader(writeRows(t, FormatCSV, tc.rows))).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != len(tc.want) {
+				t.Fatalf("Row count mismatch: got %d, want %d", len(got), len(tc.want))
+			}
+
+			for i := range got {
+				for j := range got[i] {
+					if got[i][j] != tc.want[i][j] {
+						t.Errorf("Row %d column %s mismatch: got %q, want %q", i, csvHeader[j], got[i][j], tc.want[i][j])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestJSONLWriter(t *testing.T) {
+	scanner := bufio.NewScanner(bytes.NewReader(writeRows(t, FormatJSONL, testRows)))
+
+	var got []map[string]any
+	for scanner.Scan() {
+		var row map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, row)
+	}
+
+	if len(got) != len(testRows) {
+		t.Fatalf("Row count mismatch: got %d, want %d", len(got), len(testRows))
+	}
+
+	if got[0]["type"] != "directory" || got[0]["created"] != nil {
+		t.Errorf("Directory mismatch: got %v", got[0])
+	}
+
+	if got[1]["type"] != "object" || got[1]["storageClass"] != "STANDARD" || got[1]["created"] != "2024-01-01T00:00:00Z" {
+		t.Errorf("Object mismatch: got %v", got[1])
+	}
+}
+
+func TestParquetWriter(t *testing.T) {
+	data := writeRows(t, FormatParquet, testRows)
+
+	got, err := parquet.Read[record](bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(testRows) {
+		t.Fatalf("Row count mismatch: got %d, want %d", len(got), len(testRows))
+	}
+
+	if got[0].Type != "directory" || got[0].Created != nil || got[0].Size != 20 {
+		t.Errorf("Directory mismatch: got %+v", got[0])
+	}
+
+	if got[1].Type != "object" || got[1].Created == nil || !got[1].Created.Equal(testRows[1].Created) || got[1].Cost != 0.25 {
+		t.Errorf("Object mismatch: got %+v", got[1])
+	}
+}
+
+func TestNewWriterInvalidFormat(t *testing.T) {
+	if _, err := NewWriter("xml", &bytes.Buffer{}); err == nil {
+		t.Error("Expected error but did pass")
+	}
+}
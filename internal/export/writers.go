@@ -0,0 +1,107 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/parquet-go/parquet-go"
+)
+
+var csvHeader = []string{"bucket", "name", "type", "storage_class", "size", "count", "cost", "created", "updated"}
+
+type csvWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(row *model.Metadata) error {
+	if !c.wroteHeader {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+		c.wroteHeader = true
+	}
+
+	r := newRecord(row)
+	return c.w.Write([]string{
+		r.Bucket,
+		r.Name,
+		r.Type,
+		r.StorageClass,
+		strconv.FormatInt(r.Size, 10),
+		strconv.FormatInt(r.Count, 10),
+		strconv.FormatFloat(r.Cost, 'f', -1, 64),
+		formatTime(r.Created),
+		formatTime(r.Updated),
+	})
+}
+
+func (c *csvWriter) Close() error {
+	// Empty exports still have a header
+	if !c.wroteHeader {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+type jsonlWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newJSONLWriter(w io.Writer) *jsonlWriter {
+	buf := bufio.NewWriter(w)
+	return &jsonlWriter{buf, json.NewEncoder(buf)}
+}
+
+func (j *jsonlWriter) Write(row *model.Metadata) error {
+	return j.enc.Encode(newRecord(row))
+}
+
+func (j *jsonlWriter) Close() error {
+	return j.buf.Flush()
+}
+
+// maxRowsPerRowGroup bounds the rows buffered in memory before a row group is flushed
+const maxRowsPerRowGroup = 100_000
+
+type parquetWriter struct {
+	w *parquet.GenericWriter[record]
+}
+
+func newParquetWriter(w io.Writer) *parquetWriter {
+	return &parquetWriter{
+		w: parquet.NewGenericWriter[record](w,
+			parquet.Compression(&parquet.Zstd),
+			parquet.MaxRowsPerRowGroup(maxRowsPerRowGroup),
+		),
+	}
+}
+
+func (p *parquetWriter) Write(row *model.Metadata) error {
+	_, err := p.w.Write([]record{*newRecord(row)})
+	return err
+}
+
+func (p *parquetWriter) Close() error {
+	return p.w.Close()
+}
@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Field keys shared by all components so logs can be filtered consistently
+const (
+	KeyBucket    = "bucket"
+	KeyObject    = "object"
+	KeyEventType = "eventType"
+	KeyMessageId = "messageId"
+	KeyError     = "error"
+)
+
+// New returns a logger writing Cloud Logging compatible JSON to w.
+// Records below level are discarded.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: replaceAttr,
+	})
+	return slog.New(handler)
+}
+
+// replaceAttr renames top-level attributes to the special fields recognized by Cloud Logging
+//
+// See https://cloud.google.com/logging/docs/structured-logging#special-payload-fields
+func replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+
+	switch a.Key {
+	case slog.LevelKey:
+		return slog.String("severity", severity(a.Value.Any().(slog.Level)))
+	case slog.MessageKey:
+		a.Key = "message"
+	}
+	return a
+}
+
+// severity maps a slog level to a Cloud Logging severity
+func severity(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return "ERROR"
+	case level >= slog.LevelWarn:
+		return "WARNING"
+	case level >= slog.LevelInfo:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+// ParseLevel parses a level name such as debug, info, warn or error
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToUpper(name))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q: %w", name, err)
+	}
+	return level, nil
+}
+
+// Fatal logs msg at error level and exits the process
+func Fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, KeyError, err)
+	os.Exit(1)
+}
@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		name         string
+		level        slog.Level
+		log          func(logger *slog.Logger)
+		wantSeverity string
+		wantMessage  string
+	}{
+		{"Logs info severity", slog.LevelInfo, func(l *slog.Logger) { l.Info("mock") }, "INFO", "mock"},
+		{"Logs warning severity", slog.LevelInfo, func(l *slog.Logger) { l.Warn("mock") }, "WARNING", "mock"},
+		{"Logs error severity", slog.LevelInfo, func(l *slog.Logger) { l.Error("mock") }, "ERROR", "mock"},
+		{"Logs debug severity", slog.LevelDebug, func(l *slog.Logger) { l.Debug("mock") }, "DEBUG", "mock"},
+		{"Discards records below level", slog.LevelWarn, func(l *slog.Logger) { l.Info("mock") }, "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tc.log(New(&buf, tc.level).With(KeyBucket, "mock-bucket"))
+
+			if tc.wantSeverity == "" {
+				if buf.Len() != 0 {
+					t.Fatalf("Expected no output but got %s", buf.String())
+				}
+				return
+			}
+
+			var got map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got["severity"] != tc.wantSeverity {
+				t.Errorf("Severity mismatch: got %v, want %v", got["severity"], tc.wantSeverity)
+			}
+
+			if got["message"] != tc.wantMessage {
+				t.Errorf("Message mismatch: got %v, want %v", got["message"], tc.wantMessage)
+			}
+
+			if got[KeyBucket] != "mock-bucket" {
+				t.Errorf("Bucket mismatch: got %v, want %v", got[KeyBucket], "mock-bucket")
+			}
+		})
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	testCases := []struct {
+		name    string
+		in      string
+		want    slog.Level
+		wantErr bool
+	}{
+		{"Parses debug", "debug", slog.LevelDebug, false},
+		{"Parses uppercase warn", "WARN", slog.LevelWarn, false},
+		{"Fails parsing unknown level", "verbose", 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseLevel(tc.in)
+			if err != nil {
+				if tc.wantErr {
+					return
+				}
+				t.Fatal(err)
+			}
+
+			if tc.wantErr {
+				t.Fatal("Expected error but did pass")
+			}
+
+			if got != tc.want {
+				t.Errorf("Level mismatch: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/api/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gcs_metadata"
+
+var (
+	// ObjectsSeeded counts objects processed by the seeder by bucket and result (inserted or failed)
+	ObjectsSeeded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "seeder",
+		Name:      "objects_total",
+		Help:      "Number of objects processed by the seeder.",
+	}, []string{"bucket", "result"})
+
+	// MessagesProcessed counts subscriber messages by event type and result (ack or nack)
+	MessagesProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "subscriber",
+		Name:      "messages_total",
+		Help:      "Number of Pub/Sub messages acknowledged or not acknowledged.",
+	}, []string{"event_type", "result"})
+
+	// HandlerDuration observes the time taken to process a subscriber message by event type
+	HandlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "subscriber",
+		Name:      "handler_duration_seconds",
+		Help:      "Time taken to process a Pub/Sub message.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"event_type"})
+
+	// EventLag observes the time between an object update and its event being processed
+	EventLag = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "subscriber",
+		Name:      "event_lag_seconds",
+		Help:      "Time between an object update and the processing of its event.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 16), // 100ms to ~55m
+	}, []string{"event_type"})
+
+	// TxDuration observes the duration of database transactions by result (commit or rollback)
+	TxDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "transaction_duration_seconds",
+		Help:      "Time taken by database transactions, from begin to commit or rollback.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16), // 0.5ms to ~16s
+	}, []string{"result"})
+
+	// LockErrors counts database operations which failed because the database was busy or locked
+	LockErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "lock_errors_total",
+		Help:      "Number of database operations failed due to a busy or locked database.",
+	})
+
+	// Retries counts operations attempted again after a transient error by operation
+	Retries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retries_total",
+		Help:      "Number of operations retried after a transient error.",
+	}, []string{"operation"})
+
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to serve HTTP requests by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+)
+
+// RegisterDatabase exports connection pool statistics of db, including
+// the number of and time spent waiting for a connection
+func RegisterDatabase(db *sql.DB) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, "metadata"))
+}
+
+// Handler returns the HTTP handler exposing all registered metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// NewServer returns a server exposing metrics at /metrics.
+// It is used as a sidecar listener by services without an HTTP API.
+func NewServer(port int) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", Handler())
+
+	return &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: mux,
+	}
+}
+
+// InstrumentHandler records request count and latency of next per matched route pattern
+func InstrumentHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := middleware.NewResponseRecorder(w)
+
+		next.ServeHTTP(rec, r)
+
+		// Pattern is set by http.ServeMux once the request is routed
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.Status())).Inc()
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrumentHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /mock/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := InstrumentHandler(mux)
+
+	testCases := []struct {
+		name      string
+		path      string
+		wantRoute string
+		wantCode  string
+	}{
+		{"Labels matched route by pattern", "/mock/a/b", "GET /mock/{path...}", "418"},
+		{"Labels unmatched route", "/fake", "unmatched", "404"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			counter := httpRequests.WithLabelValues(tc.wantRoute, http.MethodGet, tc.wantCode)
+			before := testutil.ToFloat64(counter)
+
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("Request count mismatch: got %v, want %v", got, 1)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// Bucket holds the attributes of a bucket and the status of its seeding
+type Bucket struct {
+	Name         string    `json:"name" db:"name"`
+	Location     string    `json:"location" db:"location"`
+	StorageClass string    `json:"storageClass" db:"storage_class"`
+	Versioning   bool      `json:"versioning" db:"versioning"`
+	Autoclass    bool      `json:"autoclass" db:"autoclass"`
+	Delimiter    string    `json:"delimiter" db:"delimiter"`
+	Status       string    `json:"status" db:"status"`
+	Error        string    `json:"error,omitempty" db:"error"`
+	Started      time.Time `json:"started" db:"started"`
+	Finished     time.Time `json:"finished" db:"finished"`
+}
@@ -0,0 +1,35 @@
+package model
+
+// Diff is the difference between two paths, or a path at two points in time
+type Diff struct {
+	// Total is the delta of the whole path
+	Total DirectoryDelta `json:"total"`
+	// Directories are the deltas of immediate subdirectories, largest first
+	Directories []*DirectoryDelta `json:"directories"`
+	Added       []*Metadata       `json:"added"`
+	Removed     []*Metadata       `json:"removed"`
+	Changed     []*ObjectChange   `json:"changed"`
+	// Truncated is set if any list was limited
+	Truncated bool `json:"truncated"`
+}
+
+// DirectoryDelta is the change in size, count and cost of a directory
+type DirectoryDelta struct {
+	Bucket string `json:"bucket"`
+	// Name is relative to the compared paths, such as "b/" for "a/b/"
+	Name      string  `json:"name"`
+	TotalSize int64   `json:"totalSize"`
+	Count     int64   `json:"count"`
+	Cost      float64 `json:"cost"`
+	Size      Size    `json:"size"`
+}
+
+// ObjectChange is an object present on both sides of a diff.
+// Before is nil when the previous version is unknown.
+type ObjectChange struct {
+	Bucket string `json:"bucket"`
+	// Name is relative to the compared paths
+	Name   string    `json:"name"`
+	Before *Metadata `json:"before,omitempty"`
+	After  *Metadata `json:"after"`
+}
@@ -8,4 +8,7 @@ type Directory struct {
 	SizeColdline int64  `db:"size_coldline"`
 	SizeArchive  int64  `db:"size_archive"`
 	Count        int64  `json:"count" db:"count"`
+	// Folder is set for folders of buckets with hierarchical namespace and managed folders,
+	// which exist even when empty. Other directories are implied by the names of objects.
+	Folder bool `json:"folder" db:"folder"`
 }
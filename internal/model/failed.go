@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// FailedObject is an object that could not be seeded and the error that caused it
+type FailedObject struct {
+	Bucket string    `json:"bucket" db:"bucket"`
+	Name   string    `json:"name" db:"name"`
+	Error  string    `json:"error" db:"error"`
+	Failed time.Time `json:"failed" db:"failed"`
+}
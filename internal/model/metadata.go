@@ -12,4 +12,6 @@ type Metadata struct {
 	Cost         float64   `json:"cost" db:"cost"`
 	Created      time.Time `json:"created" db:"created"`
 	Updated      time.Time `json:"updated" db:"updated"`
+	// Folder is set for directories that are folders rather than implied by object names
+	Folder bool `json:"folder,omitempty" db:"folder"`
 }
@@ -0,0 +1,28 @@
+package model
+
+// TreeNode is a directory and its subdirectories down to a depth.
+// Other nodes merge small siblings and have an empty path.
+type TreeNode struct {
+	Name      string      `json:"name"`
+	Path      string      `json:"path"`
+	Other     bool        `json:"other,omitempty"`
+	TotalSize int64       `json:"totalSize"`
+	Count     int64       `json:"count"`
+	Size      Size        `json:"size"`
+	Cost      Cost        `json:"cost"`
+	Children  []*TreeNode `json:"children,omitempty"`
+}
+
+// Add accumulates the sizes, counts and costs of another node
+func (n *TreeNode) Add(other *TreeNode) {
+	n.TotalSize += other.TotalSize
+	n.Count += other.Count
+	n.Size.Standard += other.Size.Standard
+	n.Size.Nearline += other.Size.Nearline
+	n.Size.Coldline += other.Size.Coldline
+	n.Size.Archive += other.Size.Archive
+	n.Cost.Standard += other.Cost.Standard
+	n.Cost.Nearline += other.Cost.Nearline
+	n.Cost.Coldline += other.Cost.Coldline
+	n.Cost.Archive += other.Cost.Archive
+}
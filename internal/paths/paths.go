@@ -0,0 +1,118 @@
+// Package paths splits object names into the directories holding them, at a delimiter
+// configured per bucket. Names follow the prefixes listed by Cloud Storage with a delimiter,
+// with these canonicalization rules:
+//
+//   - The root directory is named "/" whatever the delimiter, and its names have no common prefix.
+//   - Any other directory ends with the delimiter, such as "a/b/".
+//   - A name starting with the delimiter is held by the root rather than by a directory
+//     named by the delimiter alone, so "/a" is held by "/" and "/b/c" by "/b/" under "/".
+//   - Consecutive delimiters delimit empty segments, which are directories of their own,
+//     so "a//b" is held by "a//" which is held by "a/".
+//   - An object whose name ends with the delimiter is a placeholder of the directory of
+//     the same name and is held by it, so the placeholder "a/b/" is held by "a/b/".
+package paths
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// Root is the name of the root directory of every bucket
+	Root = "/"
+	// DefaultDelimiter is the delimiter of buckets that do not configure one
+	DefaultDelimiter = "/"
+)
+
+// Separator splits names at the delimiter of a bucket
+type Separator struct {
+	delimiter string
+}
+
+// Default splits names at DefaultDelimiter
+var Default = Separator{DefaultDelimiter}
+
+// New returns a separator splitting names at delimiter, which must be a single character
+func New(delimiter string) (Separator, error) {
+	if utf8.RuneCountInString(delimiter) != 1 || !utf8.ValidString(delimiter) {
+		return Separator{}, fmt.Errorf("delimiter %q must be a single character", delimiter)
+	}
+	return Separator{delimiter}, nil
+}
+
+// Delimiter returns the delimiter of names
+func (s Separator) Delimiter() string {
+	return s.delimiter
+}
+
+// IsDir reports whether name is a directory name, or for an object whether it is a placeholder
+func (s Separator) IsDir(name string) bool {
+	return name == Root || strings.HasSuffix(name, s.delimiter)
+}
+
+// Dir returns the directory holding an object, which is the object itself for placeholders
+func (s Separator) Dir(name string) string {
+	// A delimiter at the start of the name opens no directory other than the root
+	i := strings.LastIndex(name, s.delimiter)
+	if i <= 0 {
+		return Root
+	}
+	return name[:i+len(s.delimiter)]
+}
+
+// Parent returns the directory holding directory dir, which is Root for Root
+func (s Separator) Parent(dir string) string {
+	if dir == Root {
+		return Root
+	}
+	return s.Dir(strings.TrimSuffix(dir, s.delimiter))
+}
+
+// Base returns the part of a directory name below its parent, such as "b/" for "a/b/"
+func (s Separator) Base(dir string) string {
+	if dir == Root {
+		return Root
+	}
+	return strings.TrimPrefix(dir, Prefix(s.Parent(dir)))
+}
+
+// Normalize returns the directory named by a requested path, adding the delimiter if missing.
+// The empty path is the root. Empty segments are kept, since they are directories of their own.
+func (s Separator) Normalize(path string) string {
+	if path == "" || path == Root {
+		return Root
+	}
+
+	if !strings.HasSuffix(path, s.delimiter) {
+		path = path + s.delimiter
+	}
+	return path
+}
+
+// Prefix returns the common prefix of the names under directory dir, which is empty for Root
+func Prefix(dir string) string {
+	if dir == Root {
+		return ""
+	}
+	return dir
+}
+
+// Resolver returns the separator of the names of a bucket
+type Resolver interface {
+	Separator(ctx context.Context, bucket string) (Separator, error)
+}
+
+// Static returns a resolver of sep for every bucket
+func Static(sep Separator) Resolver {
+	return staticResolver{sep}
+}
+
+type staticResolver struct {
+	sep Separator
+}
+
+func (r staticResolver) Separator(ctx context.Context, bucket string) (Separator, error) {
+	return r.sep, nil
+}
@@ -0,0 +1,275 @@
+package paths
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		name      string
+		delimiter string
+		wantErr   bool
+	}{
+		{"Slash", "/", false},
+		{"Pipe", "|", false},
+		{"Multibyte character", "→", false},
+		{"Fails on empty delimiter", "", true},
+		{"Fails on several characters", "::", true},
+		{"Fails on invalid UTF-8", "\xff", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sep, err := New(tc.delimiter)
+			if err != nil {
+				if tc.wantErr {
+					return
+				}
+				t.Fatal(err)
+			}
+
+			if tc.wantErr {
+				t.Fatal("Expected error but did pass")
+			}
+
+			if sep.Delimiter() != tc.delimiter {
+				t.Errorf("Delimiter mismatch: got %q, want %q", sep.Delimiter(), tc.delimiter)
+			}
+		})
+	}
+}
+
+func TestDir(t *testing.T) {
+	pipe := mustNew(t, "|")
+	arrow := mustNew(t, "→")
+
+	testCases := []struct {
+		name       string
+		sep        Separator
+		objectName string
+		want       string
+	}{
+		{"Object in root", Default, "a", "/"},
+		{"Object in directory", Default, "a/b", "a/"},
+		{"Object in nested directory", Default, "a/b/c", "a/b/"},
+		{"Placeholder in root", Default, "a/", "a/"},
+		{"Placeholder in directory", Default, "a/b/", "a/b/"},
+		{"Placeholder of root", Default, "/", "/"},
+		{"Leading delimiter", Default, "/a", "/"},
+		{"Leading delimiter in directory", Default, "/a/b", "/a/"},
+		{"Leading delimiters", Default, "//a", "//"},
+		{"Consecutive delimiters", Default, "a//b", "a//"},
+		{"Placeholder of empty segment", Default, "a//", "a//"},
+		{"Other delimiter in root", pipe, "a/b", "/"},
+		{"Other delimiter in directory", pipe, "a|b/c", "a|"},
+		{"Other delimiter placeholder", pipe, "a|b|", "a|b|"},
+		{"Other delimiter leading", pipe, "|a", "/"},
+		{"Other delimiter slash object", pipe, "/", "/"},
+		{"Multibyte delimiter", arrow, "a→b→c", "a→b→"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.sep.Dir(tc.objectName); got != tc.want {
+				t.Errorf("Dir mismatch: got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParent(t *testing.T) {
+	pipe := mustNew(t, "|")
+	arrow := mustNew(t, "→")
+
+	testCases := []struct {
+		name string
+		sep  Separator
+		dir  string
+		want string
+	}{
+		{"Root", Default, "/", "/"},
+		{"Empty string", Default, "", "/"},
+		{"Blank string", Default, " ", "/"},
+		{"Directory in root", Default, "a/", "/"},
+		{"Nested directory", Default, "a/b/", "a/"},
+		{"Deeply nested directory", Default, "a/b/c/", "a/b/"},
+		{"Leading delimiter", Default, "/a/", "/"},
+		{"Nested in leading delimiter", Default, "/a/b/", "/a/"},
+		{"Leading delimiters", Default, "//", "/"},
+		{"Nested in leading delimiters", Default, "//a/", "//"},
+		{"Empty segment", Default, "a//", "a/"},
+		{"Nested in empty segment", Default, "a//b/", "a//"},
+		{"Empty nested directory", Default, "///", "//"},
+		{"Dirty directory", Default, "///a//b///", "///a//b//"},
+		{"Other delimiter root", pipe, "/", "/"},
+		{"Other delimiter in root", pipe, "a|", "/"},
+		{"Other delimiter nested", pipe, "a/b|c|", "a/b|"},
+		{"Other delimiter leading", pipe, "|a|", "/"},
+		{"Multibyte delimiter", arrow, "a→b→", "a→"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.sep.Parent(tc.dir); got != tc.want {
+				t.Errorf("Parent mismatch: got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAncestorsReachRoot(t *testing.T) {
+	names := []string{"a", "a/b/c", "a/b/", "/", "/a", "//a/b", "a//b", "a///", "///"}
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			dir := Default.Dir(name)
+			for depth := 0; dir != Root; depth++ {
+				if depth > len(name) {
+					t.Fatalf("Directories of %q do not reach the root", name)
+				}
+
+				parent := Default.Parent(dir)
+				if len(parent) >= len(dir) && parent != Root {
+					t.Fatalf("Parent %q of %q is not shorter", parent, dir)
+				}
+
+				// Every directory is in the range of names of its parent
+				if len(Prefix(parent)) > len(dir) || dir[:len(Prefix(parent))] != Prefix(parent) {
+					t.Fatalf("Directory %q is not under parent %q", dir, parent)
+				}
+				dir = parent
+			}
+		})
+	}
+}
+
+func TestIsDir(t *testing.T) {
+	pipe := mustNew(t, "|")
+
+	testCases := []struct {
+		name string
+		sep  Separator
+		path string
+		want bool
+	}{
+		{"Root", Default, "/", true},
+		{"Directory", Default, "a/b/", true},
+		{"Object", Default, "a/b", false},
+		{"Empty", Default, "", false},
+		{"Other delimiter root", pipe, "/", true},
+		{"Other delimiter directory", pipe, "a|", true},
+		{"Other delimiter slash suffix", pipe, "a/", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.sep.IsDir(tc.path); got != tc.want {
+				t.Errorf("IsDir mismatch: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBase(t *testing.T) {
+	pipe := mustNew(t, "|")
+
+	testCases := []struct {
+		name string
+		sep  Separator
+		dir  string
+		want string
+	}{
+		{"Root", Default, "/", "/"},
+		{"Directory in root", Default, "a/", "a/"},
+		{"Nested directory", Default, "a/b/", "b/"},
+		{"Leading delimiter", Default, "/a/", "/a/"},
+		{"Leading delimiters", Default, "//", "//"},
+		{"Empty segment", Default, "a//", "/"},
+		{"Other delimiter", pipe, "a/b|c|", "c|"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.sep.Base(tc.dir); got != tc.want {
+				t.Errorf("Base mismatch: got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	pipe := mustNew(t, "|")
+
+	testCases := []struct {
+		name string
+		sep  Separator
+		path string
+		want string
+	}{
+		{"Empty path", Default, "", "/"},
+		{"Root", Default, "/", "/"},
+		{"Missing delimiter", Default, "a", "a/"},
+		{"Nested missing delimiter", Default, "a/b", "a/b/"},
+		{"Directory", Default, "a/b/", "a/b/"},
+		{"Leading delimiter", Default, "/a", "/a/"},
+		{"Keeps empty segments", Default, "a//b", "a//b/"},
+		{"Keeps empty segment directory", Default, "a//", "a//"},
+		{"Other delimiter empty path", pipe, "", "/"},
+		{"Other delimiter root", pipe, "/", "/"},
+		{"Other delimiter missing", pipe, "a|b", "a|b|"},
+		{"Other delimiter slash suffix", pipe, "a/", "a/|"},
+		{"Other delimiter directory", pipe, "a|", "a|"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.sep.Normalize(tc.path); got != tc.want {
+				t.Errorf("Normalize mismatch: got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	testCases := []struct {
+		dir  string
+		want string
+	}{
+		{"/", ""},
+		{"a/", "a/"},
+		{"/a/", "/a/"},
+		{"a|", "a|"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.dir, func(t *testing.T) {
+			if got := Prefix(tc.dir); got != tc.want {
+				t.Errorf("Prefix mismatch: got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStatic(t *testing.T) {
+	pipe := mustNew(t, "|")
+
+	sep, err := Static(pipe).Separator(context.Background(), "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sep != pipe {
+		t.Errorf("Separator mismatch: got %q, want %q", sep.Delimiter(), pipe.Delimiter())
+	}
+}
+
+func mustNew(t *testing.T, delimiter string) Separator {
+	t.Helper()
+
+	sep, err := New(delimiter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sep
+}
@@ -0,0 +1,181 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// BucketStatus is the seeding status of a bucket
+type BucketStatus string
+
+const (
+	BucketPending     BucketStatus = "pending"
+	BucketSeeding     BucketStatus = "seeding"
+	BucketCompleted   BucketStatus = "completed"
+	BucketFailed      BucketStatus = "failed"
+	BucketInterrupted BucketStatus = "interrupted"
+)
+
+type Bucket struct {
+	*Database
+	tx *sqlx.Tx
+}
+
+type BucketRepository interface {
+	Upsert(ctx context.Context, bucket *model.Bucket) error
+	SetStatus(ctx context.Context, name string, status BucketStatus, seedErr error) error
+	Get(ctx context.Context, name string) (*model.Bucket, error)
+	List(ctx context.Context) ([]*model.Bucket, error)
+	Separator(ctx context.Context, name string) (paths.Separator, error)
+}
+
+func NewBucketRepository(db *Database) BucketRepository {
+	return &Bucket{Database: db}
+}
+
+// bucketRow is a bucket whose seeding may not have started or finished
+type bucketRow struct {
+	model.Bucket
+	Started  sql.NullTime `db:"started"`
+	Finished sql.NullTime `db:"finished"`
+}
+
+func (r *bucketRow) bucket() *model.Bucket {
+	bucket := r.Bucket
+	bucket.Started = r.Started.Time
+	bucket.Finished = r.Finished.Time
+	return &bucket
+}
+
+// Upsert records the attributes of a bucket, keeping the status of an existing bucket.
+// An empty delimiter records paths.DefaultDelimiter.
+func (b *Bucket) Upsert(ctx context.Context, bucket *model.Bucket) (err error) {
+	ctx, span := tracing.Start(ctx, "Bucket.Upsert", attribute.String("gcs.bucket", bucket.Name))
+	defer tracing.End(span, &err)
+
+	query := `
+		INSERT INTO bucket (name, location, storage_class, versioning, autoclass, delimiter)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT(name)
+		DO UPDATE
+		SET location = $2,
+			storage_class = $3,
+			versioning = $4,
+			autoclass = $5,
+			delimiter = $6;
+	`
+
+	delimiter := bucket.Delimiter
+	if delimiter == "" {
+		delimiter = paths.DefaultDelimiter
+	}
+
+	if _, err := paths.New(delimiter); err != nil {
+		return err
+	}
+
+	_, err = conn(b.Database, b.tx).ExecContext(ctx, query, bucket.Name, bucket.Location, bucket.StorageClass, bucket.Versioning, bucket.Autoclass, delimiter)
+	return err
+}
+
+// SetStatus records the seeding status of a bucket. BucketSeeding marks the start of seeding,
+// any other status its end along with the error that stopped it, if any.
+func (b *Bucket) SetStatus(ctx context.Context, name string, status BucketStatus, seedErr error) (err error) {
+	ctx, span := tracing.Start(ctx, "Bucket.SetStatus",
+		attribute.String("gcs.bucket", name),
+		attribute.String("status", string(status)))
+	defer tracing.End(span, &err)
+
+	var errMessage string
+	if seedErr != nil {
+		errMessage = seedErr.Error()
+	}
+
+	query := `
+		UPDATE bucket
+		SET status = $1,
+			error = $2,
+			started = CASE WHEN $1 = 'seeding' THEN $3 ELSE started END,
+			finished = CASE WHEN $1 = 'seeding' THEN NULL ELSE $3 END
+		WHERE name = $4;
+	`
+
+	_, err = conn(b.Database, b.tx).ExecContext(ctx, query, status, errMessage, time.Now().UTC(), name)
+	return err
+}
+
+// Get returns a bucket by name, or nil if it has not been recorded
+func (b *Bucket) Get(ctx context.Context, name string) (_ *model.Bucket, err error) {
+	ctx, span := tracing.Start(ctx, "Bucket.Get", attribute.String("gcs.bucket", name))
+	defer tracing.End(span, &err)
+
+	query := `
+		SELECT name, location, storage_class, versioning, autoclass, delimiter, status, error, started, finished
+		FROM bucket
+		WHERE name = ?;
+	`
+
+	var row bucketRow
+	if err := sqlx.GetContext(ctx, conn(b.Database, b.tx), &row, query, name); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return row.bucket(), nil
+}
+
+// List returns all recorded buckets ordered by name
+func (b *Bucket) List(ctx context.Context) (_ []*model.Bucket, err error) {
+	ctx, span := tracing.Start(ctx, "Bucket.List")
+	defer tracing.End(span, &err)
+
+	query := `
+		SELECT name, location, storage_class, versioning, autoclass, delimiter, status, error, started, finished
+		FROM bucket
+		ORDER BY name;
+	`
+
+	var rows []bucketRow
+	if err := sqlx.SelectContext(ctx, conn(b.Database, b.tx), &rows, query); err != nil {
+		return nil, err
+	}
+
+	buckets := make([]*model.Bucket, len(rows))
+	for i := range rows {
+		buckets[i] = rows[i].bucket()
+	}
+	return buckets, nil
+}
+
+// Separator returns the separator of the names of a bucket, or paths.Default
+// if the bucket has not been recorded or is empty for all buckets
+func (b *Bucket) Separator(ctx context.Context, name string) (_ paths.Separator, err error) {
+	ctx, span := tracing.Start(ctx, "Bucket.Separator", attribute.String("gcs.bucket", name))
+	defer tracing.End(span, &err)
+
+	return separator(ctx, conn(b.Database, b.tx), name)
+}
+
+// separator returns the separator of bucket within a query or transaction
+func separator(ctx context.Context, q queryer, bucket string) (paths.Separator, error) {
+	if bucket == "" {
+		return paths.Default, nil
+	}
+
+	var delimiter string
+	if err := sqlx.GetContext(ctx, q, &delimiter, `SELECT delimiter FROM bucket WHERE name = $1;`, bucket); err != nil {
+		if err == sql.ErrNoRows {
+			return paths.Default, nil
+		}
+		return paths.Separator{}, err
+	}
+	return paths.New(delimiter)
+}
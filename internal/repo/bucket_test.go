@@ -0,0 +1,115 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+)
+
+func TestBucket(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	bucketRepo := NewBucketRepository(db)
+
+	got, err := bucketRepo.Get(context.Background(), "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Fatalf("Bucket mismatch: got %+v, want nil", got)
+	}
+
+	testCases := []struct {
+		name         string
+		upsert       *model.Bucket
+		status       BucketStatus
+		seedErr      error
+		want         model.Bucket
+		wantStarted  bool
+		wantFinished bool
+	}{
+		{"Records attributes as pending", &model.Bucket{Name: "mock", Location: "US", StorageClass: "STANDARD", Versioning: true}, "", nil,
+			model.Bucket{Name: "mock", Location: "US", StorageClass: "STANDARD", Versioning: true, Delimiter: "/", Status: "pending"}, false, false},
+		{"Starts seeding", nil, BucketSeeding, nil,
+			model.Bucket{Name: "mock", Location: "US", StorageClass: "STANDARD", Versioning: true, Delimiter: "/", Status: "seeding"}, true, false},
+		{"Updates attributes keeping status", &model.Bucket{Name: "mock", Location: "EU", StorageClass: "NEARLINE", Autoclass: true, Delimiter: "|"}, "", nil,
+			model.Bucket{Name: "mock", Location: "EU", StorageClass: "NEARLINE", Autoclass: true, Delimiter: "|", Status: "seeding"}, true, false},
+		{"Fails seeding", nil, BucketFailed, errors.New("mock error"),
+			model.Bucket{Name: "mock", Location: "EU", StorageClass: "NEARLINE", Autoclass: true, Delimiter: "|", Status: "failed", Error: "mock error"}, true, true},
+		{"Restarts seeding", nil, BucketSeeding, nil,
+			model.Bucket{Name: "mock", Location: "EU", StorageClass: "NEARLINE", Autoclass: true, Delimiter: "|", Status: "seeding"}, true, false},
+		{"Completes seeding", nil, BucketCompleted, nil,
+			model.Bucket{Name: "mock", Location: "EU", StorageClass: "NEARLINE", Autoclass: true, Delimiter: "|", Status: "completed"}, true, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.upsert != nil {
+				if err := bucketRepo.Upsert(context.Background(), tc.upsert); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if tc.status != "" {
+				if err := bucketRepo.SetStatus(context.Background(), "mock", tc.status, tc.seedErr); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := bucketRepo.Get(context.Background(), "mock")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Started.IsZero() == tc.wantStarted || got.Finished.IsZero() == tc.wantFinished {
+				t.Errorf("Times mismatch: got started %v and finished %v", got.Started, got.Finished)
+			}
+
+			got.Started, got.Finished = tc.want.Started, tc.want.Finished
+			if *got != tc.want {
+				t.Errorf("Bucket mismatch: got %+v, want %+v", *got, tc.want)
+			}
+		})
+	}
+
+	if err := bucketRepo.Upsert(context.Background(), &model.Bucket{Name: "a-mock", Location: "US", StorageClass: "STANDARD"}); err != nil {
+		t.Fatal(err)
+	}
+
+	buckets, err := bucketRepo.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(buckets) != 2 || buckets[0].Name != "a-mock" || buckets[1].Name != "mock" {
+		t.Errorf("Buckets mismatch: got %+v", buckets)
+	}
+
+	if err := bucketRepo.Upsert(context.Background(), &model.Bucket{Name: "mock", Delimiter: "::"}); err == nil {
+		t.Error("Expected error for invalid delimiter but did pass")
+	}
+
+	separators := map[string]string{"mock": "|", "a-mock": "/", "unknown": "/", "": "/"}
+	for bucket, want := range separators {
+		sep, err := bucketRepo.Separator(context.Background(), bucket)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sep.Delimiter() != want {
+			t.Errorf("Delimiter mismatch for %q: got %q, want %q", bucket, sep.Delimiter(), want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type Checkpoint struct {
+	*Database
+	tx *sqlx.Tx
+}
+
+type CheckpointRepository interface {
+	Get(ctx context.Context, bucket string) (string, error)
+	Set(ctx context.Context, bucket, lastObject string) error
+	Delete(ctx context.Context, bucket string) error
+}
+
+func NewCheckpointRepository(db *Database) CheckpointRepository {
+	return &Checkpoint{Database: db}
+}
+
+// Get returns the name of the last object seeded from bucket.
+// It returns an empty string if bucket has no checkpoint.
+func (c *Checkpoint) Get(ctx context.Context, bucket string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "Checkpoint.Get", attribute.String("gcs.bucket", bucket))
+	defer tracing.End(span, &err)
+
+	query := `
+		SELECT last_object
+		FROM seed_checkpoint
+		WHERE bucket = ?;
+	`
+
+	var lastObject string
+	if err := sqlx.GetContext(ctx, conn(c.Database, c.tx), &lastObject, query, bucket); err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	return lastObject, nil
+}
+
+// Set records lastObject as the last object seeded from bucket
+func (c *Checkpoint) Set(ctx context.Context, bucket, lastObject string) (err error) {
+	ctx, span := tracing.Start(ctx, "Checkpoint.Set", tracing.Object(bucket, lastObject)...)
+	defer tracing.End(span, &err)
+
+	query := `
+		INSERT INTO seed_checkpoint (bucket, last_object, updated)
+		VALUES ($1, $2, $3)
+		ON CONFLICT(bucket)
+		DO UPDATE
+		SET last_object = $2,
+			updated = $3;
+	`
+
+	_, err = conn(c.Database, c.tx).ExecContext(ctx, query, bucket, lastObject, time.Now().UTC())
+	return err
+}
+
+// Delete removes the checkpoint of bucket once seeding has completed
+func (c *Checkpoint) Delete(ctx context.Context, bucket string) (err error) {
+	ctx, span := tracing.Start(ctx, "Checkpoint.Delete", attribute.String("gcs.bucket", bucket))
+	defer tracing.End(span, &err)
+
+	query := `
+		DELETE FROM seed_checkpoint
+		WHERE bucket = ?;
+	`
+
+	_, err = conn(c.Database, c.tx).ExecContext(ctx, query, bucket)
+	return err
+}
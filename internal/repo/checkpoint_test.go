@@ -0,0 +1,59 @@
+package repo
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpointRepo := NewCheckpointRepository(db)
+
+	testCases := []struct {
+		name   string
+		set    string
+		delete bool
+		want   string
+	}{
+		{"Returns empty without checkpoint", "", false, ""},
+		{"Returns last object", "mock-1/file1", false, "mock-1/file1"},
+		{"Overwrites last object", "mock-1/file2", false, "mock-1/file2"},
+		{"Returns empty after delete", "", true, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.set != "" {
+				if err := checkpointRepo.Set(context.Background(), "mock", tc.set); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if tc.delete {
+				if err := checkpointRepo.Delete(context.Background(), "mock"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := checkpointRepo.Get(context.Background(), "mock")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tc.want {
+				t.Errorf("Checkpoint mismatch: got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
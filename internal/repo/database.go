@@ -2,6 +2,7 @@ package repo
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -18,7 +19,7 @@ const pragma = `
 `
 
 const schema = `
-	CREATE TABLE metadata (
+	CREATE TABLE IF NOT EXISTS metadata (
 		bucket 		TEXT NOT NULL,
 		name 		TEXT NOT NULL,
 		size		INTEGER NOT NULL,
@@ -30,7 +31,7 @@ const schema = `
 		PRIMARY KEY (bucket, name)
 	);
 	
-	CREATE TABLE directory (
+	CREATE TABLE IF NOT EXISTS directory (
 		bucket			TEXT NOT NULL,
 		name			TEXT NOT NULL,
 		count			INTEGER DEFAULT 0,
@@ -44,6 +45,91 @@ const schema = `
 	);
 `
 
+// SchemaVersion is the database schema version expected by this build
+const SchemaVersion = 8
+
+// migrations upgrade the database schema, where migrations[i] upgrades version i to i+1.
+// Migrations must be appended and never modified once released.
+var migrations = []string{
+	schema,
+	`
+	CREATE TABLE IF NOT EXISTS subscriber_status (
+		id			INTEGER PRIMARY KEY CHECK (id = 1),
+		last_event	TIMESTAMP NOT NULL
+	);
+	`,
+	`
+	CREATE TABLE IF NOT EXISTS seed_checkpoint (
+		bucket		TEXT PRIMARY KEY,
+		last_object	TEXT NOT NULL,
+		updated		TIMESTAMP NOT NULL
+	);
+	`,
+	`
+	CREATE TABLE IF NOT EXISTS bucket (
+		name			TEXT PRIMARY KEY,
+		location		TEXT NOT NULL,
+		storage_class	TEXT NOT NULL,
+		versioning		BOOLEAN NOT NULL DEFAULT 0,
+		autoclass		BOOLEAN NOT NULL DEFAULT 0,
+		status			TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'seeding', 'completed', 'failed', 'interrupted')),
+		error			TEXT NOT NULL DEFAULT '',
+		started			TIMESTAMP,
+		finished		TIMESTAMP
+	);
+	`,
+	`
+	CREATE TABLE IF NOT EXISTS reseed_object (
+		bucket			TEXT NOT NULL,
+		name			TEXT NOT NULL,
+		size			INTEGER NOT NULL,
+		storage_class	TEXT NOT NULL,
+		created			TIMESTAMP NOT NULL,
+		updated			TIMESTAMP NOT NULL,
+		PRIMARY KEY (bucket, name)
+	);
+	`,
+	`
+	CREATE TABLE IF NOT EXISTS failed_object (
+		bucket		TEXT NOT NULL,
+		name		TEXT NOT NULL,
+		error		TEXT NOT NULL,
+		failed		TIMESTAMP NOT NULL,
+		PRIMARY KEY (bucket, name)
+	);
+	`,
+	`
+	ALTER TABLE directory ADD COLUMN folder BOOLEAN NOT NULL DEFAULT 0;
+	`,
+	// Placeholder objects such as "a/b/" are moved from the parent of the directory
+	// they name into that directory, whose ancestors already count them
+	`
+	ALTER TABLE bucket ADD COLUMN delimiter TEXT NOT NULL DEFAULT '/';
+
+	INSERT INTO directory (bucket, name, parent, count, size_standard, size_nearline, size_coldline, size_archive)
+	SELECT
+		bucket,
+		name,
+		parent,
+		1,
+		CASE storage_class WHEN 'STANDARD' THEN size ELSE 0 END,
+		CASE storage_class WHEN 'NEARLINE' THEN size ELSE 0 END,
+		CASE storage_class WHEN 'COLDLINE' THEN size ELSE 0 END,
+		CASE storage_class WHEN 'ARCHIVE' THEN size ELSE 0 END
+	FROM metadata
+	WHERE name LIKE '%/' AND name != parent
+	ON CONFLICT(bucket, name)
+	DO UPDATE
+	SET count = count + excluded.count,
+		size_standard = size_standard + excluded.size_standard,
+		size_nearline = size_nearline + excluded.size_nearline,
+		size_coldline = size_coldline + excluded.size_coldline,
+		size_archive = size_archive + excluded.size_archive;
+
+	UPDATE metadata SET parent = name WHERE name LIKE '%/';
+	`,
+}
+
 type Database struct {
 	*sqlx.DB
 	url                string
@@ -84,14 +170,47 @@ func (db *Database) Setup() error {
 	return nil
 }
 
-// CreateTables creates and executes database schema defined
+// CreateTables creates the database schema or upgrades it to SchemaVersion by
+// applying all pending migrations. Each migration is applied in its own transaction.
 func (db *Database) CreateTables() error {
-	if _, err := db.Exec(schema); err != nil {
+	version, err := db.SchemaVersion(context.Background())
+	if err != nil {
 		return err
 	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error migrating schema to version %d: %w", version+1, err)
+		}
+
+		// PRAGMA statements do not support bound parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d;", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// SchemaVersion returns the version of the current database schema, 0 if it has not been created
+func (db *Database) SchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	if err := db.QueryRowContext(ctx, `PRAGMA user_version;`).Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
 // PingTable checks if database schema has been created by pinging metadata table
 func (db *Database) PingTable() (bool, error) {
 	var tableExists bool
@@ -103,11 +222,18 @@ func (db *Database) PingTable() (bool, error) {
 }
 
 // CreateIndexes creates relevant indexes to improve query performance
+// Indexes are created after seeding since they slow down bulk inserts, and may be created again on reseeding
 func (db *Database) CreateIndexes() error {
 	query := `
-		CREATE INDEX idx_metadata_parent    ON metadata(parent);
-		CREATE INDEX idx_directory_parent   ON directory(parent);
-		CREATE INDEX idx_directory_name		ON directory(name);
+		CREATE INDEX IF NOT EXISTS idx_metadata_parent    ON metadata(parent);
+		CREATE INDEX IF NOT EXISTS idx_directory_parent   ON directory(parent);
+		CREATE INDEX IF NOT EXISTS idx_directory_name     ON directory(name);
+
+		-- Largest objects and directories of a subtree
+		CREATE INDEX IF NOT EXISTS idx_metadata_size        ON metadata(size);
+		CREATE INDEX IF NOT EXISTS idx_metadata_bucket_size ON metadata(bucket, size);
+		CREATE INDEX IF NOT EXISTS idx_directory_size       ON directory(` + directorySizeSQL + `);
+		CREATE INDEX IF NOT EXISTS idx_directory_count      ON directory(count);
 		VACUUM; -- Repackage database to clean empty space
 	`
 
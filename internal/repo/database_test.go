@@ -0,0 +1,118 @@
+package repo
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCreateTables(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a database created before schema versioning
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+
+	// Migrating twice must be a no-op
+	for i := 0; i < 2; i++ {
+		if err := db.CreateTables(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	version, err := db.SchemaVersion(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != SchemaVersion {
+		t.Errorf("Schema version mismatch: got %d, want %d", version, SchemaVersion)
+	}
+
+	if exists, err := db.PingTable(); !exists || err != nil {
+		t.Errorf("Metadata table does not exist: %v", err)
+	}
+}
+
+func TestMigratePlaceholders(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a database of version 7, which recorded placeholders in the parent
+	// of the directory they name
+	for _, migration := range migrations[:7] {
+		if _, err := db.Exec(migration); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seed := []string{
+		`PRAGMA user_version = 7;`,
+		`INSERT INTO directory (bucket, name, parent, count, size_standard, size_archive) VALUES
+			('mock', '/', '/', 4, 3, 4),
+			('mock', 'a/', '/', 4, 3, 4),
+			('mock', 'a/c/', 'a/', 1, 0, 4)`,
+		`INSERT INTO metadata (bucket, name, size, parent, storage_class, created, updated) VALUES
+			('mock', 'a/b/', 1, 'a/', 'STANDARD', 0, 0),
+			('mock', 'a/c/', 2, 'a/', 'STANDARD', 0, 0),
+			('mock', 'a/c/file', 4, 'a/c/', 'ARCHIVE', 0, 0),
+			('mock', 'a/file', 0, 'a/', 'STANDARD', 0, 0)`,
+	}
+	for _, query := range seed {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	violations, err := NewInvariantRepository(db).Check(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range violations {
+		t.Errorf("Invariant violation: %s", v)
+	}
+
+	dir, err := NewDirectoryRepository(db).Get(context.Background(), "mock", "a/c/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir.Count != 2 || dir.SizeStandard != 2 || dir.SizeArchive != 4 {
+		t.Errorf("Directory mismatch: got %+v", dir)
+	}
+}
+
+func TestCreateIndexes(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reseeding creates indexes again
+	for i := 0; i < 2; i++ {
+		if err := db.CreateIndexes(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
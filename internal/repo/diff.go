@@ -0,0 +1,533 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// MaxDiffResults bounds the number of results of each list of a diff
+const MaxDiffResults = 1000
+
+// DiffOptions compare Path with Compare, or Path between From and To.
+//
+// Points in time are compared using the created and updated times of current objects.
+// Objects deleted since then are not recorded, so removals are never listed and changed
+// objects have no previous version.
+type DiffOptions struct {
+	// Bucket limits the diff to a single bucket, objects are matched within each bucket if empty
+	Bucket string
+	// Path is the base of the diff, such as "a/b/" or "/" for the root
+	Path string
+	// Compare is the path compared to Path, objects are matched by their name relative to each path
+	Compare string
+	From    time.Time
+	To      time.Time
+	// Limit bounds each list of results, from 1 to MaxDiffResults
+	Limit int
+}
+
+type Diff struct {
+	*Database
+}
+
+type DiffRepository interface {
+	GetDiff(ctx context.Context, opts DiffOptions) (*model.Diff, error)
+}
+
+func NewDiffRepository(db *Database) DiffRepository {
+	return &Diff{db}
+}
+
+// diffObjectRow is an object of either side of a diff
+type diffObjectRow struct {
+	Bucket       string    `db:"bucket"`
+	Name         string    `db:"name"`
+	Parent       string    `db:"parent"`
+	Size         int64     `db:"size"`
+	StorageClass string    `db:"storage_class"`
+	Created      time.Time `db:"created"`
+	Updated      time.Time `db:"updated"`
+	// Location prices the object at the location of its bucket
+	Location Location `db:"location"`
+}
+
+// diffDirectoryRow is a delta of a subdirectory, or of the path itself if the name is empty
+type diffDirectoryRow struct {
+	Bucket       string  `db:"bucket"`
+	Name         string  `db:"name"`
+	Count        int64   `db:"count"`
+	SizeStandard int64   `db:"size_standard"`
+	SizeNearline int64   `db:"size_nearline"`
+	SizeColdline int64   `db:"size_coldline"`
+	SizeArchive  int64   `db:"size_archive"`
+	Cost         float64 `db:"cost"`
+}
+
+// GetDiff returns the objects added, removed or changed and the deltas of subdirectories
+// from Path to Compare, or from Path at From to Path at To
+func (d *Diff) GetDiff(ctx context.Context, opts DiffOptions) (_ *model.Diff, err error) {
+	ctx, span := tracing.Start(ctx, "Diff.GetDiff",
+		attribute.String("bucket", opts.Bucket),
+		attribute.String("path", opts.Path),
+		attribute.String("compare", opts.Compare),
+		attribute.Int("limit", opts.Limit))
+	defer tracing.End(span, &err)
+
+	if opts.Limit < 1 || opts.Limit > MaxDiffResults {
+		return nil, fmt.Errorf("invalid diff limit %d", opts.Limit)
+	}
+
+	if opts.Path == "" {
+		opts.Path = paths.Root
+	}
+
+	byTime := !opts.From.IsZero() || !opts.To.IsZero()
+	switch {
+	case opts.Compare != "" && byTime:
+		return nil, errors.New("diff of both paths and times")
+	case opts.Compare == "" && !byTime:
+		return nil, errors.New("diff of neither paths nor times")
+	case byTime && (opts.From.IsZero() || opts.To.IsZero() || !opts.From.Before(opts.To)):
+		return nil, fmt.Errorf("invalid diff times from %v to %v", opts.From, opts.To)
+	}
+
+	sep, err := separator(ctx, d.DB, opts.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	// A delimiter starting a name under the root opens no subdirectory, so it is skipped
+	// when grouping names by subdirectory
+	prefix := paths.Prefix(opts.Path)
+	skip := 0
+	if prefix == "" {
+		skip = 1
+	}
+
+	args := map[string]any{
+		"path":      opts.Path,
+		"prefix":    prefix,
+		"upper":     prefix + prefixUpperBound,
+		"bucket":    opts.Bucket,
+		"delimiter": sep.Delimiter(),
+		"skip":      skip,
+		"limit":     opts.Limit + 1,
+	}
+
+	var queries diffQueries
+	if byTime {
+		args["from"] = opts.From.UTC()
+		args["to"] = opts.To.UTC()
+		queries = timeDiffQueries()
+	} else {
+		comparePrefix := paths.Prefix(opts.Compare)
+		args["compare"] = opts.Compare
+		args["comparePrefix"] = comparePrefix
+		args["compareUpper"] = comparePrefix + prefixUpperBound
+		queries = pathDiffQueries()
+	}
+
+	diff := &model.Diff{
+		Directories: []*model.DirectoryDelta{},
+		Added:       []*model.Metadata{},
+		Removed:     []*model.Metadata{},
+		Changed:     []*model.ObjectChange{},
+	}
+
+	if err := d.diffDirectories(ctx, queries.directories, args, byTime, opts.Limit, diff); err != nil {
+		return nil, err
+	}
+
+	objectLists := []struct {
+		query string
+		list  *[]*model.Metadata
+	}{
+		{queries.added, &diff.Added},
+		{queries.removed, &diff.Removed},
+	}
+
+	for _, l := range objectLists {
+		if l.query == "" {
+			continue
+		}
+		if err := d.diffObjects(ctx, l.query, args, opts.Limit, l.list, &diff.Truncated); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := d.diffChanges(ctx, queries.changed, args, byTime, opts.Limit, diff); err != nil {
+		return nil, err
+	}
+
+	return diff, nil
+}
+
+// diffQueries select the rows of each part of a diff, an empty query selects none
+type diffQueries struct {
+	directories string
+	added       string
+	removed     string
+	changed     string
+}
+
+// pathDiffQueries compare objects of path and compare by their relative names within the same bucket
+func pathDiffQueries() diffQueries {
+	// Deltas subtract the immediate subdirectories of path from those of compare,
+	// where both paths themselves are named '' and make up the total
+	directories := fmt.Sprintf(`
+		SELECT
+			bucket,
+			name,
+			SUM(count) AS count,
+			SUM(size_standard) AS size_standard,
+			SUM(size_nearline) AS size_nearline,
+			SUM(size_coldline) AS size_coldline,
+			SUM(size_archive) AS size_archive,
+			SUM(cost) AS cost
+		FROM (
+			SELECT
+				bucket,
+				CASE WHEN name = :path THEN '' ELSE SUBSTR(name, LENGTH(:prefix) + 1) END AS name,
+				-count AS count,
+				-size_standard AS size_standard,
+				-size_nearline AS size_nearline,
+				-size_coldline AS size_coldline,
+				-size_archive AS size_archive,
+				-(%[1]s) AS cost
+			FROM directory
+			WHERE
+				(name = :path OR (parent = :path AND name != '/')) AND
+				(:bucket = '' OR bucket = :bucket)
+			UNION ALL
+			SELECT
+				bucket,
+				CASE WHEN name = :compare THEN '' ELSE SUBSTR(name, LENGTH(:comparePrefix) + 1) END AS name,
+				count,
+				size_standard,
+				size_nearline,
+				size_coldline,
+				size_archive,
+				%[1]s AS cost
+			FROM directory
+			WHERE
+				(name = :compare OR (parent = :compare AND name != '/')) AND
+				(:bucket = '' OR bucket = :bucket)
+		)
+		GROUP BY bucket, name;
+	`, bucketCostSQL("directory", directoryCostSQL))
+
+	return diffQueries{
+		directories: directories,
+		added: fmt.Sprintf(`
+			SELECT bucket, name, parent, size, storage_class, created, updated, %s AS location
+			FROM metadata AS b
+			WHERE
+				name >= :comparePrefix AND name < :compareUpper AND
+				(:bucket = '' OR bucket = :bucket) AND
+				NOT EXISTS (
+					SELECT 1 FROM metadata AS a
+					WHERE a.bucket = b.bucket AND a.name = :prefix || SUBSTR(b.name, LENGTH(:comparePrefix) + 1)
+				)
+			ORDER BY bucket, name
+			LIMIT :limit;
+		`, bucketLocationSQL("b")),
+		removed: fmt.Sprintf(`
+			SELECT bucket, name, parent, size, storage_class, created, updated, %s AS location
+			FROM metadata AS a
+			WHERE
+				name >= :prefix AND name < :upper AND
+				(:bucket = '' OR bucket = :bucket) AND
+				NOT EXISTS (
+					SELECT 1 FROM metadata AS b
+					WHERE b.bucket = a.bucket AND b.name = :comparePrefix || SUBSTR(a.name, LENGTH(:prefix) + 1)
+				)
+			ORDER BY bucket, name
+			LIMIT :limit;
+		`, bucketLocationSQL("a")),
+		changed: fmt.Sprintf(`
+			SELECT
+				a.bucket AS bucket,
+				a.name AS name,
+				a.parent AS parent,
+				a.size AS size,
+				a.storage_class AS storage_class,
+				a.created AS created,
+				a.updated AS updated,
+				b.name AS after_name,
+				b.parent AS after_parent,
+				b.size AS after_size,
+				b.storage_class AS after_storage_class,
+				b.created AS after_created,
+				b.updated AS after_updated,
+				%s AS location
+			FROM metadata AS a
+			JOIN metadata AS b ON b.bucket = a.bucket AND b.name = :comparePrefix || SUBSTR(a.name, LENGTH(:prefix) + 1)
+			WHERE
+				a.name >= :prefix AND a.name < :upper AND
+				(:bucket = '' OR a.bucket = :bucket) AND
+				(a.size != b.size OR a.storage_class != b.storage_class)
+			ORDER BY a.bucket, a.name
+			LIMIT :limit;
+		`, bucketLocationSQL("a")),
+	}
+}
+
+// timeDiffQueries compare objects of path by their created and updated times
+func timeDiffQueries() diffQueries {
+	// Objects created in the period are summed by the immediate subdirectory containing them,
+	// where objects directly under path are named ''
+	directories := fmt.Sprintf(`
+		SELECT
+			bucket,
+			CASE
+				WHEN INSTR(SUBSTR(name, LENGTH(:prefix) + 1 + :skip), :delimiter) = 0 THEN ''
+				ELSE SUBSTR(name, LENGTH(:prefix) + 1, :skip + INSTR(SUBSTR(name, LENGTH(:prefix) + 1 + :skip), :delimiter))
+			END AS name,
+			COUNT(*) AS count,
+			SUM(CASE storage_class WHEN 'STANDARD' THEN size ELSE 0 END) AS size_standard,
+			SUM(CASE storage_class WHEN 'NEARLINE' THEN size ELSE 0 END) AS size_nearline,
+			SUM(CASE storage_class WHEN 'COLDLINE' THEN size ELSE 0 END) AS size_coldline,
+			SUM(CASE storage_class WHEN 'ARCHIVE' THEN size ELSE 0 END) AS size_archive,
+			SUM(%s) AS cost
+		FROM metadata
+		WHERE
+			name >= :prefix AND name < :upper AND
+			(:bucket = '' OR bucket = :bucket) AND
+			created >= :from AND created < :to
+		GROUP BY 1, 2;
+	`, bucketCostSQL("metadata", objectCostSQL))
+	location := bucketLocationSQL("metadata")
+
+	return diffQueries{
+		directories: directories,
+		added: fmt.Sprintf(`
+			SELECT bucket, name, parent, size, storage_class, created, updated, %s AS location
+			FROM metadata
+			WHERE
+				name >= :prefix AND name < :upper AND
+				(:bucket = '' OR bucket = :bucket) AND
+				created >= :from AND created < :to
+			ORDER BY bucket, name
+			LIMIT :limit;
+		`, location),
+		changed: fmt.Sprintf(`
+			SELECT bucket, name, parent, size, storage_class, created, updated, %s AS location
+			FROM metadata
+			WHERE
+				name >= :prefix AND name < :upper AND
+				(:bucket = '' OR bucket = :bucket) AND
+				created < :from AND updated >= :from AND updated < :to
+			ORDER BY bucket, name
+			LIMIT :limit;
+		`, location),
+	}
+}
+
+// diffDirectories sets the total and the largest subdirectory deltas of a diff
+func (d *Diff) diffDirectories(ctx context.Context, query string, args map[string]any, byTime bool, limit int, diff *model.Diff) error {
+	query, queryArgs, err := sqlx.Named(query, args)
+	if err != nil {
+		return err
+	}
+
+	rows, err := d.DB.QueryxContext(ctx, query, queryArgs...)
+	if err != nil {
+		return fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row diffDirectoryRow
+		if err := rows.StructScan(&row); err != nil {
+			return fmt.Errorf("scan error: %w", err)
+		}
+
+		delta := &model.DirectoryDelta{
+			Bucket:    row.Bucket,
+			Name:      row.Name,
+			TotalSize: row.SizeStandard + row.SizeNearline + row.SizeColdline + row.SizeArchive,
+			Count:     row.Count,
+			Cost:      row.Cost,
+			Size: model.Size{
+				Standard: row.SizeStandard,
+				Nearline: row.SizeNearline,
+				Coldline: row.SizeColdline,
+				Archive:  row.SizeArchive,
+			},
+		}
+
+		// Points in time have no directory totals, so the total sums every subdirectory
+		if byTime || row.Name == "" {
+			addDelta(&diff.Total, delta)
+		}
+
+		if row.Name != "" && (delta.Count != 0 || delta.Size != model.Size{}) {
+			diff.Directories = append(diff.Directories, delta)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	diff.Total.Bucket = ""
+	diff.Total.Name = ""
+
+	sort.Slice(diff.Directories, func(i, j int) bool {
+		a, b := diff.Directories[i], diff.Directories[j]
+		if abs(a.TotalSize) != abs(b.TotalSize) {
+			return abs(a.TotalSize) > abs(b.TotalSize)
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Bucket < b.Bucket
+	})
+
+	if len(diff.Directories) > limit {
+		diff.Directories = diff.Directories[:limit]
+		diff.Truncated = true
+	}
+	return nil
+}
+
+// diffObjects appends the objects of a query to list, up to limit
+func (d *Diff) diffObjects(ctx context.Context, query string, args map[string]any, limit int, list *[]*model.Metadata, truncated *bool) error {
+	query, queryArgs, err := sqlx.Named(query, args)
+	if err != nil {
+		return err
+	}
+
+	rows, err := d.DB.QueryxContext(ctx, query, queryArgs...)
+	if err != nil {
+		return fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row diffObjectRow
+		if err := rows.StructScan(&row); err != nil {
+			return fmt.Errorf("scan error: %w", err)
+		}
+
+		// Queries select one row over the limit to detect truncation
+		if len(*list) == limit {
+			*truncated = true
+			break
+		}
+
+		object, err := row.metadata()
+		if err != nil {
+			return err
+		}
+		*list = append(*list, object)
+	}
+	return rows.Err()
+}
+
+// diffChanges sets the objects changed on both sides of a diff, up to limit
+func (d *Diff) diffChanges(ctx context.Context, query string, args map[string]any, byTime bool, limit int, diff *model.Diff) error {
+	query, queryArgs, err := sqlx.Named(query, args)
+	if err != nil {
+		return err
+	}
+
+	rows, err := d.DB.QueryxContext(ctx, query, queryArgs...)
+	if err != nil {
+		return fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	prefix := args["prefix"].(string)
+	for rows.Next() {
+		if len(diff.Changed) == limit {
+			diff.Truncated = true
+			break
+		}
+
+		var row struct {
+			diffObjectRow
+			AfterName         string    `db:"after_name"`
+			AfterParent       string    `db:"after_parent"`
+			AfterSize         int64     `db:"after_size"`
+			AfterStorageClass string    `db:"after_storage_class"`
+			AfterCreated      time.Time `db:"after_created"`
+			AfterUpdated      time.Time `db:"after_updated"`
+		}
+
+		var dest any = &row
+		if byTime {
+			dest = &row.diffObjectRow
+		}
+		if err := rows.StructScan(dest); err != nil {
+			return fmt.Errorf("scan error: %w", err)
+		}
+
+		object, err := row.metadata()
+		if err != nil {
+			return err
+		}
+
+		change := &model.ObjectChange{
+			Bucket: row.Bucket,
+			Name:   row.Name[len(prefix):],
+			After:  object,
+		}
+
+		// Paths are compared from path to compare, so the object of path is the one before
+		if !byTime {
+			after := diffObjectRow{row.Bucket, row.AfterName, row.AfterParent, row.AfterSize, row.AfterStorageClass, row.AfterCreated, row.AfterUpdated, row.Location}
+			if change.After, err = after.metadata(); err != nil {
+				return err
+			}
+			change.Before = object
+		}
+		diff.Changed = append(diff.Changed, change)
+	}
+	return rows.Err()
+}
+
+// metadata returns the object of a row with its cost at the location of its bucket
+func (r *diffObjectRow) metadata() (*model.Metadata, error) {
+	cost, err := getObjectCost(r.Location, StorageClass(r.StorageClass), r.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Metadata{
+		Bucket:       r.Bucket,
+		Name:         r.Name,
+		Parent:       r.Parent,
+		StorageClass: r.StorageClass,
+		Size:         r.Size,
+		Cost:         cost,
+		Created:      r.Created,
+		Updated:      r.Updated,
+	}, nil
+}
+
+// addDelta accumulates the sizes, counts and costs of a delta into total
+func addDelta(total, delta *model.DirectoryDelta) {
+	total.TotalSize += delta.TotalSize
+	total.Count += delta.Count
+	total.Cost += delta.Cost
+	total.Size.Standard += delta.Size.Standard
+	total.Size.Nearline += delta.Size.Nearline
+	total.Size.Coldline += delta.Size.Coldline
+	total.Size.Archive += delta.Size.Archive
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
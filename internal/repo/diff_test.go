@@ -0,0 +1,200 @@
+package repo
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+)
+
+func TestGetDiff(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	diffRepo := NewDiffRepository(db)
+	metadataRepo := NewMetadataRepository(db)
+	dirRepo := NewDirectoryRepository(db)
+
+	lastWeek := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	yesterday := lastWeek.AddDate(0, 0, 6)
+	today := lastWeek.AddDate(0, 0, 7)
+
+	// Insert mock data
+	metadata := []model.Metadata{
+		{Bucket: "mock", Name: "prod/same", Size: 1 * bytesPerGB, StorageClass: "STANDARD", Created: lastWeek, Updated: lastWeek},
+		{Bucket: "mock", Name: "prod/resized", Size: 2 * bytesPerGB, StorageClass: "STANDARD", Created: lastWeek, Updated: yesterday},
+		{Bucket: "mock", Name: "prod/data/archived", Size: 4 * bytesPerGB, StorageClass: "ARCHIVE", Created: lastWeek, Updated: yesterday},
+		{Bucket: "mock", Name: "prod/data/new", Size: 8 * bytesPerGB, StorageClass: "STANDARD", Created: yesterday, Updated: yesterday},
+		{Bucket: "mock", Name: "prod/logs/new", Size: 3 * bytesPerGB, StorageClass: "NEARLINE", Created: yesterday, Updated: yesterday},
+		{Bucket: "mock", Name: "staging/same", Size: 1 * bytesPerGB, StorageClass: "STANDARD", Created: lastWeek, Updated: lastWeek},
+		{Bucket: "mock", Name: "staging/resized", Size: 5 * bytesPerGB, StorageClass: "STANDARD", Created: lastWeek, Updated: lastWeek},
+		{Bucket: "mock", Name: "staging/data/archived", Size: 4 * bytesPerGB, StorageClass: "STANDARD", Created: lastWeek, Updated: lastWeek},
+		{Bucket: "mock", Name: "staging/tmp/removed", Size: 6 * bytesPerGB, StorageClass: "STANDARD", Created: lastWeek, Updated: lastWeek},
+		{Bucket: "other", Name: "prod/data/new", Size: 10 * bytesPerGB, StorageClass: "STANDARD", Created: today, Updated: today},
+	}
+
+	for _, m := range metadata {
+		if err := metadataRepo.Insert(context.Background(), paths.Default, &m); err != nil {
+			t.Fatal(err)
+		}
+		if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, StorageClass(m.StorageClass), m.Bucket, m.Name, m.Size, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// delta is a directory delta in gigabytes
+	type delta struct {
+		name  string
+		size  int64
+		count int64
+	}
+
+	// diff is a diff by object names and directory deltas
+	type diff struct {
+		total       delta
+		directories []delta
+		added       []string
+		removed     []string
+		changed     []string
+		truncated   bool
+	}
+
+	toDelta := func(d *model.DirectoryDelta) delta {
+		return delta{d.Name, d.TotalSize / bytesPerGB, d.Count}
+	}
+
+	toDiff := func(d *model.Diff) diff {
+		got := diff{total: toDelta(&d.Total), truncated: d.Truncated}
+		for _, dir := range d.Directories {
+			got.directories = append(got.directories, toDelta(dir))
+		}
+		for _, m := range d.Added {
+			got.added = append(got.added, m.Name)
+		}
+		for _, m := range d.Removed {
+			got.removed = append(got.removed, m.Name)
+		}
+		for _, c := range d.Changed {
+			got.changed = append(got.changed, c.Name)
+		}
+		return got
+	}
+
+	testCases := []struct {
+		name    string
+		opts    DiffOptions
+		want    diff
+		wantErr bool
+	}{
+		{"Compares paths", DiffOptions{Bucket: "mock", Path: "staging/", Compare: "prod/", Limit: 10}, diff{
+			total:       delta{"", 18 - 16, 5 - 4},
+			directories: []delta{{"data/", 8, 1}, {"tmp/", -6, -1}, {"logs/", 3, 1}},
+			added:       []string{"prod/data/new", "prod/logs/new"},
+			removed:     []string{"staging/tmp/removed"},
+			changed:     []string{"data/archived", "resized"},
+		}, false},
+		{"Compares paths of all buckets", DiffOptions{Path: "staging/", Compare: "prod/", Limit: 10}, diff{
+			total:       delta{"", 28 - 16, 6 - 4},
+			directories: []delta{{"data/", 10, 1}, {"data/", 8, 1}, {"tmp/", -6, -1}, {"logs/", 3, 1}},
+			added:       []string{"prod/data/new", "prod/logs/new", "prod/data/new"},
+			removed:     []string{"staging/tmp/removed"},
+			changed:     []string{"data/archived", "resized"},
+		}, false},
+		{"Limits results", DiffOptions{Bucket: "mock", Path: "staging/", Compare: "prod/", Limit: 1}, diff{
+			total:       delta{"", 2, 1},
+			directories: []delta{{"data/", 8, 1}},
+			added:       []string{"prod/data/new"},
+			removed:     []string{"staging/tmp/removed"},
+			changed:     []string{"data/archived"},
+			truncated:   true,
+		}, false},
+		{"Compares times", DiffOptions{Bucket: "mock", Path: "prod/", From: yesterday, To: today, Limit: 10}, diff{
+			total:       delta{"", 11, 2},
+			directories: []delta{{"data/", 8, 1}, {"logs/", 3, 1}},
+			added:       []string{"prod/data/new", "prod/logs/new"},
+			changed:     []string{"data/archived", "resized"},
+		}, false},
+		{"Compares times of root", DiffOptions{Path: "/", From: yesterday, To: today.Add(time.Hour), Limit: 10}, diff{
+			total:       delta{"", 21, 3},
+			directories: []delta{{"prod/", 11, 2}, {"prod/", 10, 1}},
+			added:       []string{"prod/data/new", "prod/logs/new", "prod/data/new"},
+			changed:     []string{"prod/data/archived", "prod/resized"},
+		}, false},
+		{"Returns error for both paths and times", DiffOptions{Path: "prod/", Compare: "staging/", From: lastWeek, To: today, Limit: 10}, diff{}, true},
+		{"Returns error for neither paths nor times", DiffOptions{Path: "prod/", Limit: 10}, diff{}, true},
+		{"Returns error for reversed times", DiffOptions{Path: "prod/", From: today, To: lastWeek, Limit: 10}, diff{}, true},
+		{"Returns error for invalid limit", DiffOptions{Path: "prod/", Compare: "staging/", Limit: MaxDiffResults + 1}, diff{}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := diffRepo.GetDiff(context.Background(), tc.opts)
+			if err != nil {
+				if tc.wantErr {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.wantErr {
+				t.Fatal("Expected error, got nil")
+			}
+
+			if gotDiff := toDiff(got); !reflect.DeepEqual(gotDiff, tc.want) {
+				t.Errorf("Diff mismatch:\ngot  %+v\nwant %+v", gotDiff, tc.want)
+			}
+		})
+	}
+}
+
+func TestGetDiffChange(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	metadataRepo := NewMetadataRepository(db)
+	for _, m := range []model.Metadata{
+		{Bucket: "mock", Name: "a/file", Parent: "a/", Size: 2 * bytesPerGB, StorageClass: "STANDARD", Created: now, Updated: now},
+		{Bucket: "mock", Name: "b/file", Parent: "b/", Size: 2 * bytesPerGB, StorageClass: "ARCHIVE", Created: now, Updated: now},
+	} {
+		if err := metadataRepo.Insert(context.Background(), paths.Default, &m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := NewDiffRepository(db).GetDiff(context.Background(), DiffOptions{Path: "a/", Compare: "b/", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*model.ObjectChange{{
+		Bucket: "mock",
+		Name:   "file",
+		Before: &model.Metadata{Bucket: "mock", Name: "a/file", Parent: "a/", Size: 2 * bytesPerGB, StorageClass: "STANDARD", Cost: 0.046, Created: now, Updated: now},
+		After:  &model.Metadata{Bucket: "mock", Name: "b/file", Parent: "b/", Size: 2 * bytesPerGB, StorageClass: "ARCHIVE", Cost: 0.005, Created: now, Updated: now},
+	}}
+
+	if !reflect.DeepEqual(got.Changed, want) {
+		t.Errorf("Changed mismatch: got %+v, want %+v", got.Changed, want)
+	}
+}
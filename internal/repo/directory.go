@@ -1,51 +1,46 @@
 package repo
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
+	"github.com/jmoiron/sqlx"
 )
 
 type Directory struct {
 	*Database
+	tx *sqlx.Tx
 }
 
 type DirectoryRepository interface {
-	Insert(dir model.Directory) error
-	Delete(bucket string, name string) error
-	UpsertParentDirs(storageClass StorageClass, bucket string, objName string, newSize int64, newCount int64) error
-	UpsertArchiveParentDirs(oldStorageClass StorageClass, newStorageClass StorageClass, bucket, objName string, size int64) error
+	Get(ctx context.Context, bucket string, name string) (*model.Directory, error)
+	Insert(ctx context.Context, sep paths.Separator, dir model.Directory) error
+	Delete(ctx context.Context, bucket string, name string) error
+	UpsertParentDirs(ctx context.Context, sep paths.Separator, storageClass StorageClass, bucket string, objName string, newSize int64, newCount int64) error
+	UpsertArchiveParentDirs(ctx context.Context, sep paths.Separator, oldStorageClass StorageClass, newStorageClass StorageClass, bucket, objName string, size int64) error
+	UpsertFolder(ctx context.Context, sep paths.Separator, bucket string, name string) error
+	DeleteFolder(ctx context.Context, bucket string, name string) error
 }
 
 func NewDirectoryRepository(db *Database) DirectoryRepository {
-	return &Directory{db}
-}
-
-// getParentDir returns the parent directory of dir
-func getParentDir(dir string) string {
-	trimmedDir := strings.TrimSuffix(dir, "/")
-
-	// Handle root
-	if trimmedDir == "" {
-		return "/"
-	}
-
-	lastIndex := strings.LastIndex(trimmedDir, "/")
-	if lastIndex == -1 {
-		return "/" // File in root directory
-	}
-
-	// Remove remaining portion of last directory
-	return trimmedDir[:lastIndex+1]
+	return &Directory{Database: db}
 }
 
 // UpsertArchiveParentDirs reallocates storage class size on all parent directories for an object update by object versioning.
+// Directories are named by sep, the separator of the bucket.
 //
 // If directories do not exist, they will be created using newStorageClass and a default count of 1
 // as a safeguard for dirty reads during seeding process.
-func (d *Directory) UpsertArchiveParentDirs(oldStorageClass StorageClass, newStorageClass StorageClass, bucket, objName string, size int64) error {
+func (d *Directory) UpsertArchiveParentDirs(ctx context.Context, sep paths.Separator, oldStorageClass StorageClass, newStorageClass StorageClass, bucket, objName string, size int64) (err error) {
+	ctx, span := tracing.Start(ctx, "Directory.UpsertArchiveParentDirs", tracing.Object(bucket, objName)...)
+	defer tracing.End(span, &err)
+
 	oldStorageColumn := "size_" + strings.ToLower(string(oldStorageClass))
 	newStorageColumn := "size_" + strings.ToLower(string(newStorageClass))
 
@@ -62,31 +57,28 @@ func (d *Directory) UpsertArchiveParentDirs(oldStorageClass StorageClass, newSto
 		return errors.New("bucket or name argument is empty")
 	}
 
-	dirName := getParentDir(objName)
-
-	tx, err := d.DB.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback() // no-op if commit succeeds
-
-	for {
-		if _, err = tx.Exec(query, bucket, dirName, size, getParentDir(dirName)); err != nil {
-			return err
+	return runInTx(ctx, d.Database, d.tx, func(q queryer) error {
+		dirName := sep.Dir(objName)
+		for {
+			if _, err := q.ExecContext(ctx, query, bucket, dirName, size, sep.Parent(dirName)); err != nil {
+				return err
+			}
+
+			// Last directory to update is root
+			if dirName == paths.Root {
+				return nil
+			}
+			dirName = sep.Parent(dirName)
 		}
-
-		// Last directory to update is root
-		if dirName == "/" {
-			break
-		}
-		dirName = getParentDir(dirName)
-	}
-
-	return tx.Commit()
+	})
 }
 
-// UpsertParentDirs updates all parent directories of an object name in one transaction
-func (d *Directory) UpsertParentDirs(storageClass StorageClass, bucket string, objName string, newSize int64, newCount int64) error {
+// UpsertParentDirs updates all parent directories of an object name, separated by sep, in one transaction.
+// The directory named by a placeholder object such as "a/b/" is its first parent.
+func (d *Directory) UpsertParentDirs(ctx context.Context, sep paths.Separator, storageClass StorageClass, bucket string, objName string, newSize int64, newCount int64) (err error) {
+	ctx, span := tracing.Start(ctx, "Directory.UpsertParentDirs", tracing.Object(bucket, objName)...)
+	defer tracing.End(span, &err)
+
 	storageColumn := "size_" + strings.ToLower(string(storageClass))
 	query := fmt.Sprintf(`
 			INSERT INTO directory (bucket, name, %[1]s, count, parent)
@@ -101,34 +93,130 @@ func (d *Directory) UpsertParentDirs(storageClass StorageClass, bucket string, o
 		return errors.New("bucket or name argument is empty")
 	}
 
-	dirName := getParentDir(objName)
+	return runInTx(ctx, d.Database, d.tx, func(q queryer) error {
+		dirName := sep.Dir(objName)
+		for {
+			if _, err := q.ExecContext(ctx, query, bucket, dirName, newSize, newCount, sep.Parent(dirName)); err != nil {
+				return err
+			}
+
+			// Last directory to update is root
+			if dirName == paths.Root {
+				return nil
+			}
+			dirName = sep.Parent(dirName)
+		}
+	})
+}
 
-	tx, err := d.DB.Begin()
-	if err != nil {
+// UpsertFolder records directory name as a folder, creating it and its parent directories
+// if they do not exist. Folders are directories that exist even when they hold nothing.
+func (d *Directory) UpsertFolder(ctx context.Context, sep paths.Separator, bucket string, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "Directory.UpsertFolder", tracing.Object(bucket, name)...)
+	defer tracing.End(span, &err)
+
+	query := `
+		INSERT INTO directory (bucket, name, parent, folder)
+		VALUES ($1, $2, $3, 1)
+		ON CONFLICT(bucket, name)
+		DO UPDATE
+		SET folder = 1;
+	`
+
+	if len(bucket) == 0 || len(name) == 0 {
+		return errors.New("bucket or name argument is empty")
+	}
+
+	return runInTx(ctx, d.Database, d.tx, func(q queryer) error {
+		tx, ok := q.(*sqlx.Tx)
+		if !ok {
+			return errors.New("folder requires a transaction")
+		}
+
+		if name == paths.Root || !sep.IsDir(name) {
+			return fmt.Errorf("folder name %q is not a directory", name)
+		}
+
+		// The folder and its parent directories are created holding no objects
+		parents := &Directory{Database: d.Database, tx: tx}
+		if err := parents.UpsertParentDirs(ctx, sep, StorageStandard, bucket, name, 0, 0); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, query, bucket, name, sep.Parent(name))
 		return err
+	})
+}
+
+// DeleteFolder records that directory name is no longer a folder. The directory is deleted
+// if it holds no objects or directories, and is otherwise kept as implied by its objects.
+// Returns sql.ErrNoRows if the directory is not a folder.
+func (d *Directory) DeleteFolder(ctx context.Context, bucket string, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "Directory.DeleteFolder", tracing.Object(bucket, name)...)
+	defer tracing.End(span, &err)
+
+	queries := []string{`
+		UPDATE directory
+		SET folder = 0
+		WHERE bucket = $1 AND name = $2 AND folder = 1;
+	`, `
+		DELETE FROM directory
+		WHERE bucket = $1 AND name = $2 AND count = 0 AND NOT EXISTS (
+			SELECT 1 FROM directory AS child
+			WHERE child.bucket = $1 AND child.parent = $2 AND child.name != $2
+		);
+	`}
+
+	if len(bucket) == 0 || len(name) == 0 {
+		return errors.New("bucket or name argument is empty")
 	}
-	defer tx.Rollback() // no-op if commit succeeds
 
-	for {
-		if _, err = tx.Exec(query, bucket, dirName, newSize, newCount, getParentDir(dirName)); err != nil {
+	return runInTx(ctx, d.Database, d.tx, func(q queryer) error {
+		res, err := q.ExecContext(ctx, queries[0], bucket, name)
+		if err != nil {
 			return err
 		}
 
-		// Last directory to update is root
-		if dirName == "/" {
-			break
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return sql.ErrNoRows
 		}
-		dirName = getParentDir(dirName)
-	}
 
-	if err := tx.Commit(); err != nil {
+		_, err = q.ExecContext(ctx, queries[1], bucket, name)
 		return err
+	})
+}
+
+// Get returns a single directory, or nil if it does not exist
+func (d *Directory) Get(ctx context.Context, bucket string, name string) (_ *model.Directory, err error) {
+	ctx, span := tracing.Start(ctx, "Directory.Get", tracing.Object(bucket, name)...)
+	defer tracing.End(span, &err)
+
+	query := `
+		SELECT bucket, name, size_standard, size_nearline, size_coldline, size_archive, count, folder
+		FROM directory
+		WHERE bucket = ? AND name = ?;
+	`
+
+	var dir model.Directory
+	if err := sqlx.GetContext(ctx, conn(d.Database, d.tx), &dir, query, bucket, name); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
 	}
-	return nil
+	return &dir, nil
 }
 
-// Insert a single directory
-func (d *Directory) Insert(dir model.Directory) error {
+// Insert a single directory whose parent is named by sep
+func (d *Directory) Insert(ctx context.Context, sep paths.Separator, dir model.Directory) (err error) {
+	ctx, span := tracing.Start(ctx, "Directory.Insert", tracing.Object(dir.Bucket, dir.Name)...)
+	defer tracing.End(span, &err)
+
 	query := `
 		INSERT INTO directory (bucket, name, parent)		
 		VALUES (?, ?, ?)	
@@ -138,25 +226,26 @@ func (d *Directory) Insert(dir model.Directory) error {
 		return errors.New("bucket or name argument is empty")
 	}
 
-	parentDir := getParentDir(dir.Name)
-
-	if _, err := d.DB.Exec(query,
+	if _, err := conn(d.Database, d.tx).ExecContext(ctx, query,
 		dir.Bucket,
 		dir.Name,
-		parentDir); err != nil {
+		sep.Parent(dir.Name)); err != nil {
 		return err
 	}
 	return nil
 }
 
 // Delete a single directory
-func (d *Directory) Delete(bucket string, name string) error {
+func (d *Directory) Delete(ctx context.Context, bucket string, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "Directory.Delete", tracing.Object(bucket, name)...)
+	defer tracing.End(span, &err)
+
 	query := `
 		DELETE FROM directory
 		WHERE bucket = ? AND name = ?;	
 	`
 
-	res, err := d.DB.Exec(query, bucket, name)
+	res, err := conn(d.Database, d.tx).ExecContext(ctx, query, bucket, name)
 
 	if err != nil {
 		return err
@@ -3,40 +3,13 @@ package repo
 import (
 	"context"
 	"log"
+	"maps"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
 )
 
-func TestGetParentDir(t *testing.T) {
-	testCases := []struct {
-		name string
-		in   string
-		want string
-	}{
-		{"Empty string", "", "/"},
-		{"Blank string", " ", "/"},
-		{"Root file", "mock", "/"},
-		{"Root directory", "/", "/"},
-		{"Root level directory", "mock/", "/"},
-		{"Root level file", "mock", "/"},
-		{"Root level directory with trailing slash", "//mock/", "//"},
-		{"Dirty directory", "///mock-1//mock-2///", "///mock-1//mock-2//"},
-		{"Empty nested directory", "///", "//"},
-		{"Nested directory", "mock-1/mock", "mock-1/"},
-		{"Deeply nested directory", "mock-1/mock-2/mock-3", "mock-1/mock-2/"},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			got := getParentDir(tc.in)
-			if got != tc.want {
-				log.Fatalf("Parent dir return mismatch: got %s, want %s", got, tc.want)
-			}
-		})
-	}
-}
-
 func TestUpsertArchiveParentDirs(t *testing.T) {
 	testCases := []struct {
 		name            string
@@ -107,12 +80,12 @@ func TestUpsertArchiveParentDirs(t *testing.T) {
 			dirRepo := NewDirectoryRepository(db)
 
 			for _, m := range tc.metadataInDB {
-				if err := dirRepo.UpsertParentDirs(StorageClass(m.StorageClass), m.Bucket, m.Name, m.Size, 1); err != nil {
+				if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, StorageClass(m.StorageClass), m.Bucket, m.Name, m.Size, 1); err != nil {
 					t.Fatal(err)
 				}
 			}
 
-			if err := dirRepo.UpsertArchiveParentDirs(tc.oldStorageClass, tc.newStorageClass, tc.bucket, tc.objName, tc.size); err != nil {
+			if err := dirRepo.UpsertArchiveParentDirs(context.Background(), paths.Default, tc.oldStorageClass, tc.newStorageClass, tc.bucket, tc.objName, tc.size); err != nil {
 				if tc.wantErr {
 					return
 				}
@@ -235,12 +208,12 @@ func TestUpsertParentDirs(t *testing.T) {
 			dirRepo := NewDirectoryRepository(db)
 
 			for _, m := range tc.metadataInDB {
-				if err := dirRepo.UpsertParentDirs(StorageClass(m.StorageClass), m.Bucket, m.Name, m.Size, 1); err != nil {
+				if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, StorageClass(m.StorageClass), m.Bucket, m.Name, m.Size, 1); err != nil {
 					log.Fatal(err)
 				}
 			}
 
-			if err := dirRepo.UpsertParentDirs(StorageClass(tc.in.StorageClass), tc.in.Bucket, tc.in.Name, tc.in.Size, 1); err != nil {
+			if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, StorageClass(tc.in.StorageClass), tc.in.Bucket, tc.in.Name, tc.in.Size, 1); err != nil {
 				if tc.wantErr {
 					return
 				}
@@ -284,6 +257,168 @@ func TestUpsertParentDirs(t *testing.T) {
 	}
 }
 
+func TestUpsertParentDirsPaths(t *testing.T) {
+	testCases := []struct {
+		name      string
+		delimiter string
+		objects   []string
+		// wantDirs and wantObjects map every directory and object to its parent
+		wantDirs    map[string]string
+		wantObjects map[string]string
+	}{
+		{
+			name:        "Records placeholders in the directory they name",
+			objects:     []string{"a/b/", "a/b/c", "d/"},
+			wantDirs:    map[string]string{"/": "/", "a/": "/", "a/b/": "a/", "d/": "/"},
+			wantObjects: map[string]string{"a/b/": "a/b/", "a/b/c": "a/b/", "d/": "d/"},
+		},
+		{
+			name:        "Holds leading delimiters in root",
+			objects:     []string{"/a", "/x/b", "/"},
+			wantDirs:    map[string]string{"/": "/", "/x/": "/"},
+			wantObjects: map[string]string{"/a": "/", "/x/b": "/x/", "/": "/"},
+		},
+		{
+			name:        "Keeps empty segments",
+			objects:     []string{"a//b", "a/c"},
+			wantDirs:    map[string]string{"/": "/", "a/": "/", "a//": "a/"},
+			wantObjects: map[string]string{"a//b": "a//", "a/c": "a/"},
+		},
+		{
+			name:        "Splits at bucket delimiter",
+			delimiter:   "|",
+			objects:     []string{"a|b|c", "a/b", "a|"},
+			wantDirs:    map[string]string{"/": "/", "a|": "/", "a|b|": "a|"},
+			wantObjects: map[string]string{"a|b|c": "a|b|", "a/b": "/", "a|": "a|"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := NewDatabase(":memory:", 1)
+			db.Connect(context.Background())
+			defer db.Close()
+
+			if err := db.Setup(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := db.CreateTables(); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			bucketRepo := NewBucketRepository(db)
+			if err := bucketRepo.Upsert(ctx, &model.Bucket{Name: "mock", Delimiter: tc.delimiter}); err != nil {
+				t.Fatal(err)
+			}
+
+			sep, err := bucketRepo.Separator(ctx, "mock")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			metadataRepo := NewMetadataRepository(db)
+			dirRepo := NewDirectoryRepository(db)
+			for _, name := range tc.objects {
+				if err := metadataRepo.Insert(ctx, sep, &model.Metadata{Bucket: "mock", Name: name, Size: 1, StorageClass: "STANDARD"}); err != nil {
+					t.Fatal(err)
+				}
+				if err := dirRepo.UpsertParentDirs(ctx, sep, StorageStandard, "mock", name, 1, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			gotDirs := map[string]string{}
+			if err := parentsOf(db, "directory", gotDirs); err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(gotDirs, tc.wantDirs) {
+				t.Errorf("Directories mismatch: got %v, want %v", gotDirs, tc.wantDirs)
+			}
+
+			gotObjects := map[string]string{}
+			if err := parentsOf(db, "metadata", gotObjects); err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(gotObjects, tc.wantObjects) {
+				t.Errorf("Objects mismatch: got %v, want %v", gotObjects, tc.wantObjects)
+			}
+
+			violations, err := NewInvariantRepository(db).Check(ctx, "mock")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range violations {
+				t.Errorf("Invariant violation: %s", v)
+			}
+		})
+	}
+}
+
+// parentsOf adds the name and parent of every row of table to parents
+func parentsOf(db *Database, table string, parents map[string]string) error {
+	rows, err := db.Query("SELECT name, parent FROM " + table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, parent string
+		if err := rows.Scan(&name, &parent); err != nil {
+			return err
+		}
+		parents[name] = parent
+	}
+	return rows.Err()
+}
+
+func TestGetDirectory(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	dirRepo := NewDirectoryRepository(db)
+
+	if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, StorageNearline, "mock", "mock-1/file1", 3, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		bucket  string
+		dirName string
+		want    *model.Directory
+	}{
+		{"Gets root directory", "mock", "/", &model.Directory{Bucket: "mock", Name: "/", SizeNearline: 3, Count: 1}},
+		{"Gets nested directory", "mock", "mock-1/", &model.Directory{Bucket: "mock", Name: "mock-1/", SizeNearline: 3, Count: 1}},
+		{"Returns nil for non existent directory", "mock", "mock-2/", nil},
+		{"Returns nil for other bucket", "other", "/", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := dirRepo.Get(context.Background(), tc.bucket, tc.dirName)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if (got == nil) != (tc.want == nil) || (got != nil && *got != *tc.want) {
+				t.Errorf("Directory mismatch: got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
 func TestInsertDirectory(t *testing.T) {
 	testCases := []struct {
 		name    string
@@ -312,7 +447,7 @@ func TestInsertDirectory(t *testing.T) {
 
 			dirRepo := NewDirectoryRepository(db)
 
-			if err := dirRepo.Insert(tc.dir); err != nil {
+			if err := dirRepo.Insert(context.Background(), paths.Default, tc.dir); err != nil {
 				if tc.wantErr {
 					return
 				}
@@ -358,7 +493,7 @@ func TestDeleteDirectory(t *testing.T) {
 	}
 
 	for _, dir := range dirs {
-		if err := dirRepo.Insert(dir); err != nil {
+		if err := dirRepo.Insert(context.Background(), paths.Default, dir); err != nil {
 			log.Fatal(err)
 		}
 	}
@@ -377,7 +512,7 @@ func TestDeleteDirectory(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			if err := dirRepo.Delete(tc.bucket, tc.dirName); err != nil {
+			if err := dirRepo.Delete(context.Background(), tc.bucket, tc.dirName); err != nil {
 				if tc.wantError {
 					return
 				}
@@ -399,3 +534,143 @@ func TestDeleteDirectory(t *testing.T) {
 		})
 	}
 }
+
+func TestFolder(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	dirRepo := NewDirectoryRepository(db)
+
+	if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, StorageNearline, "mock", "full/file1", 3, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each step applies to the directories left by the previous ones
+	testCases := []struct {
+		name     string
+		delete   bool
+		dirName  string
+		wantErr  bool
+		wantDirs []*model.Directory
+	}{
+		{
+			"Creates empty folder and its parents",
+			false,
+			"empty/nested/",
+			false,
+			[]*model.Directory{
+				{Bucket: "mock", Name: "/", SizeNearline: 3, Count: 1},
+				{Bucket: "mock", Name: "empty/"},
+				{Bucket: "mock", Name: "empty/nested/", Folder: true},
+			},
+		},
+		{
+			"Flags existing directory as folder",
+			false,
+			"full/",
+			false,
+			[]*model.Directory{
+				{Bucket: "mock", Name: "/", SizeNearline: 3, Count: 1},
+				{Bucket: "mock", Name: "full/", SizeNearline: 3, Count: 1, Folder: true},
+			},
+		},
+		{
+			"Upserting folder twice is a no-op",
+			false,
+			"full/",
+			false,
+			[]*model.Directory{
+				{Bucket: "mock", Name: "/", SizeNearline: 3, Count: 1},
+				{Bucket: "mock", Name: "full/", SizeNearline: 3, Count: 1, Folder: true},
+			},
+		},
+		{"Fails upserting object name", false, "full/file1", true, nil},
+		{"Fails upserting root", false, "/", true, nil},
+		{"Fails deleting directory that is not a folder", true, "empty/", true, nil},
+		{
+			"Flags parent of folder as folder",
+			false,
+			"empty/",
+			false,
+			[]*model.Directory{
+				{Bucket: "mock", Name: "empty/", Folder: true},
+				{Bucket: "mock", Name: "empty/nested/", Folder: true},
+			},
+		},
+		{
+			"Keeps deleted folder holding folders",
+			true,
+			"empty/",
+			false,
+			[]*model.Directory{
+				{Bucket: "mock", Name: "empty/"},
+				{Bucket: "mock", Name: "empty/nested/", Folder: true},
+			},
+		},
+		{
+			"Keeps deleted folder holding objects",
+			true,
+			"full/",
+			false,
+			[]*model.Directory{
+				{Bucket: "mock", Name: "full/", SizeNearline: 3, Count: 1},
+			},
+		},
+		{"Fails deleting folder twice", true, "full/", true, nil},
+		{
+			"Deletes empty folder",
+			true,
+			"empty/nested/",
+			false,
+			[]*model.Directory{
+				{Bucket: "mock", Name: "/", SizeNearline: 3, Count: 1},
+				{Bucket: "mock", Name: "empty/"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var err error
+			if tc.delete {
+				err = dirRepo.DeleteFolder(context.Background(), "mock", tc.dirName)
+			} else {
+				err = dirRepo.UpsertFolder(context.Background(), paths.Default, "mock", tc.dirName)
+			}
+
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Error mismatch: got %v, want error %t", err, tc.wantErr)
+			}
+
+			for _, want := range tc.wantDirs {
+				got, err := dirRepo.Get(context.Background(), want.Bucket, want.Name)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got == nil || *got != *want {
+					t.Errorf("Directory mismatch: got %+v, want %+v", got, want)
+				}
+			}
+		})
+	}
+
+	// Deleted folders leave no directory behind
+	got, err := dirRepo.Get(context.Background(), "mock", "empty/nested/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != nil {
+		t.Errorf("Directory not deleted: got %+v", got)
+	}
+}
@@ -1,28 +1,80 @@
 package repo
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type SortType string
+type SortOrder string
+
+// EntryKind selects objects, directories or both
+type EntryKind string
 
 const (
-	SortBySize      SortType = "size"
-	SortByCount     SortType = "count"
-	defaultLocation          = LocationUS
+	SortBySize    SortType = "size"
+	SortByCount   SortType = "count"
+	SortByName    SortType = "name"
+	SortByCreated SortType = "created"
+	SortByUpdated SortType = "updated"
+	SortByCost    SortType = "cost"
+
+	SortAscending  SortOrder = "asc"
+	SortDescending SortOrder = "desc"
+
+	EntryAll         EntryKind = "all"
+	EntryObjects     EntryKind = "objects"
+	EntryDirectories EntryKind = "directories"
 )
 
+// ExploreOptions sort and filter the contents of a path.
+// Filters on timestamps exclude directories, which have none.
+type ExploreOptions struct {
+	Sort SortType
+	// Order defaults to ascending for names and descending otherwise
+	Order SortOrder
+	Kind  EntryKind
+	// StorageClass matches objects of the class and directories with any size in it
+	StorageClass  StorageClass
+	MinSize       *int64
+	MaxSize       *int64
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	// NamePrefix and NameSuffix match names relative to the path, without a trailing delimiter
+	NamePrefix string
+	NameSuffix string
+}
+
+// directorySizeSQL is the total size of a directory
+const directorySizeSQL = "(size_standard + size_nearline + size_coldline + size_archive)"
+
+// sizeColumns are the directory size columns of each storage class
+var sizeColumns = map[StorageClass]string{
+	StorageStandard: "size_standard",
+	StorageNearline: "size_nearline",
+	StorageColdline: "size_coldline",
+	StorageArchive:  "size_archive",
+}
+
 type Explore struct {
 	*Database
 }
 
 type ExploreRepository interface {
-	GetPathContents(path string, sort SortType) ([]*model.Metadata, error)
-	GetPathSummary(path string) (*model.Summary, error)
+	GetPathContents(ctx context.Context, bucket, path string, opts ExploreOptions) ([]*model.Metadata, error)
+	GetPathSummary(ctx context.Context, bucket, path string) (*model.Summary, error)
 }
 
 func NewExploreRepository(db *Database) ExploreRepository {
@@ -30,68 +82,110 @@ func NewExploreRepository(db *Database) ExploreRepository {
 }
 
 // GetPath retrieves all directory contents of a given path including itself
-// It excludes directories whose size is 0
-func (e *Explore) GetPathContents(path string, sortBy SortType) ([]*model.Metadata, error) {
+// The path itself is always returned first and is not filtered
+// Contents are limited to bucket unless it is empty
+func (e *Explore) GetPathContents(ctx context.Context, bucket, path string, opts ExploreOptions) (_ []*model.Metadata, err error) {
+	ctx, span := tracing.Start(ctx, "Explore.GetPathContents",
+		attribute.String("bucket", bucket),
+		attribute.String("path", path),
+		attribute.String("sort", string(opts.Sort)),
+		attribute.String("order", string(opts.Order)))
+	defer tracing.End(span, &err)
+
 	if path == "" {
-		path = "/"
+		path = paths.Root
+	}
+
+	sep, err := separator(ctx, e.DB, bucket)
+	if err != nil {
+		return nil, err
 	}
 
-	queryContent := `
+	// Names of root contents have no common prefix
+	args := map[string]any{"path": path, "bucket": bucket, "base": paths.Prefix(path), "delimiter": sep.Delimiter()}
+
+	objectFilter, directoryFilter, err := opts.filter(args)
+	if err != nil {
+		return nil, err
+	}
+
+	orderBy, err := opts.orderBy()
+	if err != nil {
+		return nil, err
+	}
+
+	// Objects are selected first so that timestamp columns keep their declared type
+	queryContent := fmt.Sprintf(`
 		SELECT
-			name, 
-			LENGTH(name) AS name_length,
-			size_standard, 
-			size_nearline, 
-			size_coldline, 
-			size_archive, 
-			(size_standard + 
-			size_nearline  + 
-			size_coldline  + 
-			size_archive) AS size, 
-			count,
-			'' as storage_class,
-			parent
-		FROM directory
-		WHERE
-			parent = $1 OR
-			name = $1
-		UNION ALL
-		SELECT 
-			name, 
+			name,
 			LENGTH(name) AS name_length,
-			0 as size_standard, 
-			0 as size_nearline, 
-			0 as size_coldline, 
-			0 as size_archive, 
-			size, 
+			0 as size_standard,
+			0 as size_nearline,
+			0 as size_coldline,
+			0 as size_archive,
+			size,
 			0 as count,
 			storage_class,
-			parent 
+			parent,
+			created,
+			updated,
+			%[1]s AS cost,
+			0 AS folder,
+			0 AS is_self
 		FROM metadata
 		WHERE
-			parent = $1
-	`
+			parent = :path AND
+			(:bucket = '' OR bucket = :bucket) AND
+			%[3]s
+		UNION ALL
+		SELECT
+			name,
+			LENGTH(name) AS name_length,
+			size_standard,
+			size_nearline,
+			size_coldline,
+			size_archive,
+			%[5]s AS size,
+			count,
+			'' as storage_class,
+			parent,
+			NULL AS created,
+			NULL AS updated,
+			%[2]s AS cost,
+			folder,
+			name = :path AS is_self
+		FROM directory
+		WHERE
+			((parent = :path AND %[4]s) OR name = :path) AND
+			(:bucket = '' OR bucket = :bucket)
+		ORDER BY is_self DESC, %[6]s, name_length, name
+		LIMIT 100;
+	`, bucketCostSQL("metadata", objectCostSQL), bucketCostSQL("directory", directoryCostSQL), objectFilter, directoryFilter, directorySizeSQL, orderBy)
 
-	if sortBy != SortByCount && sortBy != SortBySize {
-		return nil, errors.New("invalid sort parameter")
+	query, queryArgs, err := sqlx.Named(queryContent, args)
+	if err != nil {
+		return nil, err
 	}
-	queryContent += fmt.Sprintf(" ORDER BY %s DESC, name_length", sortBy)
-	queryContent += " LIMIT 100;"
 
 	type contentRow struct {
-		Name         string `db:"name"`
-		NameLength   int    `db:"name_length"`
-		StorageClass string `db:"storage_class"`
-		SizeStandard int64  `db:"size_standard"`
-		SizeNearline int64  `db:"size_nearline"`
-		SizeColdline int64  `db:"size_coldline"`
-		SizeArchive  int64  `db:"size_archive"`
-		Size         int64  `db:"size"`
-		Count        int64  `db:"count"`
-		Parent       string `db:"parent"`
-	}
-
-	rows, err := e.DB.Queryx(queryContent, path)
+		Name         string       `db:"name"`
+		NameLength   int          `db:"name_length"`
+		StorageClass string       `db:"storage_class"`
+		SizeStandard int64        `db:"size_standard"`
+		SizeNearline int64        `db:"size_nearline"`
+		SizeColdline int64        `db:"size_coldline"`
+		SizeArchive  int64        `db:"size_archive"`
+		Size         int64        `db:"size"`
+		Count        int64        `db:"count"`
+		Parent       string       `db:"parent"`
+		Created      sql.NullTime `db:"created"`
+		Updated      sql.NullTime `db:"updated"`
+		Cost         float64      `db:"cost"`
+		Folder       bool         `db:"folder"`
+		IsSelf       bool         `db:"is_self"`
+	}
+
+	rows, err := e.DB.QueryxContext(ctx, query, queryArgs...)
 	if err != nil {
 		return nil, fmt.Errorf("query error: %w", err)
 	}
@@ -104,74 +198,194 @@ func (e *Explore) GetPathContents(path string, sortBy SortType) ([]*model.Metada
 			return nil, fmt.Errorf("scan error: %w", err)
 		}
 
-		metadata := &model.Metadata{
+		// Costs are computed in SQL for sorting, at the location of the bucket of each result
+		pathContents = append(pathContents, &model.Metadata{
 			Name:         row.Name,
 			Size:         row.Size,
 			Count:        row.Count,
+			Cost:         row.Cost,
 			StorageClass: row.StorageClass,
 			Parent:       row.Parent,
+			Created:      row.Created.Time,
+			Updated:      row.Updated.Time,
+			Folder:       row.Folder,
+		})
+	}
+	return pathContents, rows.Err()
+}
+
+// filter returns SQL conditions on the objects and directories in a path, adding their arguments to args
+func (o *ExploreOptions) filter(args map[string]any) (objectFilter, directoryFilter string, err error) {
+	objects := []string{"1"}
+	directories := []string{"1"}
+
+	switch o.Kind {
+	case "", EntryAll:
+	case EntryObjects:
+		directories = append(directories, "0")
+	case EntryDirectories:
+		objects = append(objects, "0")
+	default:
+		return "", "", fmt.Errorf("invalid entry kind %q", o.Kind)
+	}
+
+	if o.StorageClass != "" {
+		column, ok := sizeColumns[o.StorageClass]
+		if !ok {
+			return "", "", fmt.Errorf("invalid storage class %q", o.StorageClass)
 		}
+		objects = append(objects, "storage_class = :storageClass")
+		directories = append(directories, column+" > 0")
+		args["storageClass"] = o.StorageClass
+	}
 
-		// Calculate costs of every object and directory
-		// defaultLocation is used for all results until storing location from bucket is implemented
-		if len(metadata.StorageClass) > 0 { // object
-			cost, err := getObjectCost(defaultLocation, StorageClass(metadata.StorageClass), metadata.Size)
-			if err != nil {
-				return nil, err
-			}
-			metadata.Cost = cost
-		} else { // directory
-			totalCost, err := getDirectoryCost(defaultLocation, row.SizeStandard, row.SizeNearline, row.SizeColdline, row.SizeArchive)
-			if err != nil {
-				return nil, err
-			}
-			metadata.Cost = totalCost
+	if o.MinSize != nil {
+		objects = append(objects, "size >= :minSize")
+		directories = append(directories, directorySizeSQL+" >= :minSize")
+		args["minSize"] = *o.MinSize
+	}
+
+	if o.MaxSize != nil {
+		objects = append(objects, "size <= :maxSize")
+		directories = append(directories, directorySizeSQL+" <= :maxSize")
+		args["maxSize"] = *o.MaxSize
+	}
+
+	// Timestamps are stored in UTC and compared as text
+	timeFilters := []struct {
+		value     time.Time
+		condition string
+		arg       string
+	}{
+		{o.CreatedAfter, "created >= :createdAfter", "createdAfter"},
+		{o.CreatedBefore, "created < :createdBefore", "createdBefore"},
+		{o.UpdatedAfter, "updated >= :updatedAfter", "updatedAfter"},
+		{o.UpdatedBefore, "updated < :updatedBefore", "updatedBefore"},
+	}
+
+	for _, f := range timeFilters {
+		if !f.value.IsZero() {
+			objects = append(objects, f.condition)
+			directories = append(directories, "0")
+			args[f.arg] = f.value.UTC()
 		}
+	}
 
-		pathContents = append(pathContents, metadata)
+	if o.NamePrefix != "" {
+		condition := "SUBSTR(name, LENGTH(:base) + 1, LENGTH(:namePrefix)) = :namePrefix"
+		objects = append(objects, condition)
+		directories = append(directories, condition)
+		args["namePrefix"] = o.NamePrefix
 	}
-	return pathContents, nil
+
+	if o.NameSuffix != "" {
+		// The delimiter ending directory and placeholder names is not part of the suffix
+		condition := `SUBSTR(
+			CASE WHEN SUBSTR(name, -1) = :delimiter THEN SUBSTR(name, 1, LENGTH(name) - 1) ELSE name END,
+			-LENGTH(:nameSuffix)) = :nameSuffix`
+		objects = append(objects, condition)
+		directories = append(directories, condition)
+		args["nameSuffix"] = o.NameSuffix
+	}
+
+	return strings.Join(objects, " AND "), strings.Join(directories, " AND "), nil
 }
 
-func (e *Explore) GetPathSummary(path string) (*model.Summary, error) {
+// orderBy returns the SQL sort expression of the sort key and order
+func (o *ExploreOptions) orderBy() (string, error) {
+	sortBy := o.Sort
+	if sortBy == "" {
+		sortBy = SortBySize
+	}
+
+	switch sortBy {
+	case SortBySize, SortByCount, SortByName, SortByCreated, SortByUpdated, SortByCost:
+	default:
+		return "", errors.New("invalid sort parameter")
+	}
+
+	order := o.Order
+	if order == "" {
+		order = SortDescending
+		if sortBy == SortByName {
+			order = SortAscending
+		}
+	}
+
+	if order != SortAscending && order != SortDescending {
+		return "", errors.New("invalid sort order")
+	}
+
+	// Directories have no timestamps and are sorted last in either order
+	return fmt.Sprintf("%s %s NULLS LAST", sortBy, strings.ToUpper(string(order))), nil
+}
+
+// GetPathSummary retrieves the size and cost per storage class of a given path
+// The summary is limited to bucket unless it is empty
+func (e *Explore) GetPathSummary(ctx context.Context, bucket, path string) (_ *model.Summary, err error) {
+	ctx, span := tracing.Start(ctx, "Explore.GetPathSummary", attribute.String("bucket", bucket), attribute.String("path", path))
+	defer tracing.End(span, &err)
+
 	var summary model.Summary
 
-	query := `
+	// Directories of the same name are summed over all buckets unless bucket is set,
+	// each priced at the location of its bucket
+	query := fmt.Sprintf(`
 		SELECT
-			name,
 			size_standard,
 			size_nearline,
 			size_coldline,
-			size_archive	
+			size_archive,
+			%s AS location
 		FROM
 			directory
 		WHERE
-			name = $1;
-	`
+			name = $1 AND
+			($2 = '' OR bucket = $2);
+	`, bucketLocationSQL("directory"))
 
-	row := e.DB.QueryRowx(query, path)
-	if err := row.StructScan(&summary); err != nil && err != sql.ErrNoRows {
-		return nil, err
+	type summaryRow struct {
+		model.Size
+		Location Location `db:"location"`
 	}
 
-	// Compute pricing
-	storageClasses := []struct {
-		class StorageClass
-		size  *int64
-		cost  *float64
-	}{
-		{StorageStandard, &summary.Size.Standard, &summary.Cost.Standard},
-		{StorageNearline, &summary.Size.Nearline, &summary.Cost.Nearline},
-		{StorageColdline, &summary.Size.Coldline, &summary.Cost.Coldline},
-		{StorageArchive, &summary.Size.Archive, &summary.Cost.Archive},
+	rows, err := e.DB.QueryxContext(ctx, query, path, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
 	}
+	defer rows.Close()
 
-	for _, sc := range storageClasses {
-		cost, err := getObjectCost(defaultLocation, sc.class, *sc.size)
-		if err != nil {
-			return nil, err
+	for rows.Next() {
+		var row summaryRow
+		if err := rows.StructScan(&row); err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		summary.Path = path
+
+		// Compute pricing
+		storageClasses := []struct {
+			class StorageClass
+			size  int64
+			total *int64
+			cost  *float64
+		}{
+			{StorageStandard, row.Standard, &summary.Size.Standard, &summary.Cost.Standard},
+			{StorageNearline, row.Nearline, &summary.Size.Nearline, &summary.Cost.Nearline},
+			{StorageColdline, row.Coldline, &summary.Size.Coldline, &summary.Cost.Coldline},
+			{StorageArchive, row.Archive, &summary.Size.Archive, &summary.Cost.Archive},
+		}
+
+		for _, sc := range storageClasses {
+			cost, err := getObjectCost(row.Location, sc.class, sc.size)
+			if err != nil {
+				return nil, err
+			}
+			*sc.total += sc.size
+			*sc.cost += cost
 		}
-		*sc.cost = cost
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
 	return &summary, nil
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
 )
 
 func TestGetPathContents(t *testing.T) {
@@ -35,10 +36,10 @@ func TestGetPathContents(t *testing.T) {
 	}
 
 	for _, m := range metadata {
-		if err := metadataRepo.Insert(&m); err != nil {
+		if err := metadataRepo.Insert(context.Background(), paths.Default, &m); err != nil {
 			t.Fatal(err)
 		}
-		if err := dirRepo.UpsertParentDirs(StorageClass(m.StorageClass), m.Bucket, m.Name, m.Size, 1); err != nil {
+		if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, StorageClass(m.StorageClass), m.Bucket, m.Name, m.Size, 1); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -113,7 +114,7 @@ func TestGetPathContents(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			got, err := exploreRepo.GetPathContents(tc.path, SortType(tc.sort))
+			got, err := exploreRepo.GetPathContents(context.Background(), "", tc.path, ExploreOptions{Sort: SortType(tc.sort)})
 			if err != nil {
 				if tc.wantErr {
 					return
@@ -176,10 +177,10 @@ func TestGetPathSummary(t *testing.T) {
 	}
 
 	for _, m := range metadata {
-		if err := metadataRepo.Insert(&m); err != nil {
+		if err := metadataRepo.Insert(context.Background(), paths.Default, &m); err != nil {
 			t.Fatal(err)
 		}
-		if err := dirRepo.UpsertParentDirs(StorageClass(m.StorageClass), m.Bucket, m.Name, m.Size, 1); err != nil {
+		if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, StorageClass(m.StorageClass), m.Bucket, m.Name, m.Size, 1); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -260,7 +261,7 @@ func TestGetPathSummary(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			got, err := exploreRepo.GetPathSummary(tc.path)
+			got, err := exploreRepo.GetPathSummary(context.Background(), "", tc.path)
 			if err != nil {
 				if tc.wantErr {
 					return
@@ -326,3 +327,394 @@ func TestGetPathSummary(t *testing.T) {
 		})
 	}
 }
+
+func TestGetPathSummaryBuckets(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	exploreRepo := NewExploreRepository(db)
+	dirRepo := NewDirectoryRepository(db)
+
+	objects := []struct {
+		bucket, name string
+		class        StorageClass
+		size         int64
+	}{
+		{"mock-1", "dir/file1", StorageStandard, 10},
+		{"mock-2", "dir/file1", StorageStandard, 20},
+		{"mock-2", "dir/file2", StorageArchive, 5},
+	}
+
+	for _, o := range objects {
+		if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, o.class, o.bucket, o.name, o.size, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name   string
+		bucket string
+		want   model.Size
+	}{
+		{"Sums directories of all buckets", "", model.Size{Standard: 30, Archive: 5}},
+		{"Returns directory of bucket", "mock-1", model.Size{Standard: 10}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := exploreRepo.GetPathSummary(context.Background(), tc.bucket, "dir/")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Path != "dir/" || got.Size != tc.want {
+				t.Errorf("Summary mismatch: got %s %+v, want dir/ %+v", got.Path, got.Size, tc.want)
+			}
+		})
+	}
+}
+func TestGetPathContentsBucket(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	exploreRepo := NewExploreRepository(db)
+	metadataRepo := NewMetadataRepository(db)
+	dirRepo := NewDirectoryRepository(db)
+
+	// Insert mock data into two buckets
+	metadata := []model.Metadata{
+		{Bucket: "mock", Name: "mock-1/file1", Size: 1 * bytesPerGB, StorageClass: "STANDARD", Created: time.Now(), Updated: time.Now()},
+		{Bucket: "other", Name: "mock-1/file2", Size: 2 * bytesPerGB, StorageClass: "STANDARD", Created: time.Now(), Updated: time.Now()},
+	}
+
+	for _, m := range metadata {
+		if err := metadataRepo.Insert(context.Background(), paths.Default, &m); err != nil {
+			t.Fatal(err)
+		}
+		if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, StorageClass(m.StorageClass), m.Bucket, m.Name, m.Size, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name        string
+		bucket      string
+		wantNames   []string
+		wantSummary int64
+	}{
+		{"Limits contents to bucket", "mock", []string{"mock-1/", "mock-1/file1"}, 1 * bytesPerGB},
+		{"Limits contents to other bucket", "other", []string{"mock-1/", "mock-1/file2"}, 2 * bytesPerGB},
+		{"Returns empty for unknown bucket", "unknown", nil, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := exploreRepo.GetPathContents(context.Background(), tc.bucket, "mock-1/", ExploreOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != len(tc.wantNames) {
+				t.Fatalf("Return count mismatch: got %d, want %d", len(got), len(tc.wantNames))
+			}
+
+			for i := range got {
+				if got[i].Name != tc.wantNames[i] {
+					t.Errorf("Return name mismatch: got %s, want %s", got[i].Name, tc.wantNames[i])
+				}
+			}
+
+			summary, err := exploreRepo.GetPathSummary(context.Background(), tc.bucket, "mock-1/")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if summary.Size.Standard != tc.wantSummary {
+				t.Errorf("Summary size mismatch: got %d, want %d", summary.Size.Standard, tc.wantSummary)
+			}
+		})
+	}
+}
+
+func TestGetPathContentsFolders(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	exploreRepo := NewExploreRepository(db)
+	dirRepo := NewDirectoryRepository(db)
+
+	if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, StorageStandard, "mock", "implicit/file1", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dirRepo.UpsertFolder(context.Background(), paths.Default, "mock", "empty/"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := exploreRepo.GetPathContents(context.Background(), "mock", "/", ExploreOptions{Sort: SortByName})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Empty folders are listed and flagged, directories implied by objects are not flagged
+	want := map[string]bool{"/": false, "empty/": true, "implicit/": false}
+	if len(got) != len(want) {
+		t.Fatalf("Return count mismatch: got %d, want %d", len(got), len(want))
+	}
+
+	for _, entry := range got {
+		if folder, ok := want[entry.Name]; !ok || entry.Folder != folder {
+			t.Errorf("Folder mismatch for %s: got %t, want %t", entry.Name, entry.Folder, folder)
+		}
+	}
+}
+
+func TestGetPathContentsOptions(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	exploreRepo := NewExploreRepository(db)
+	metadataRepo := NewMetadataRepository(db)
+	dirRepo := NewDirectoryRepository(db)
+
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	mar := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	// Insert mock data
+	metadata := []model.Metadata{
+		{Bucket: "mock", Name: "mock-1/a.csv", Size: 10 * bytesPerGB, StorageClass: "STANDARD", Created: jan, Updated: mar},
+		{Bucket: "mock", Name: "mock-1/b.log", Size: 20 * bytesPerGB, StorageClass: "ARCHIVE", Created: feb, Updated: feb},
+		{Bucket: "mock", Name: "mock-1/c.csv", Size: 5 * bytesPerGB, StorageClass: "COLDLINE", Created: mar, Updated: mar},
+		{Bucket: "mock", Name: "mock-1/logs/d.log", Size: 1 * bytesPerGB, StorageClass: "STANDARD", Created: jan, Updated: jan},
+	}
+
+	for _, m := range metadata {
+		if err := metadataRepo.Insert(context.Background(), paths.Default, &m); err != nil {
+			t.Fatal(err)
+		}
+		if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, StorageClass(m.StorageClass), m.Bucket, m.Name, m.Size, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	size := func(s int64) *int64 { return &s }
+
+	testCases := []struct {
+		name    string
+		opts    ExploreOptions
+		want    []string
+		wantErr bool
+	}{
+		{"Sorts by size descending by default", ExploreOptions{}, []string{"mock-1/", "mock-1/b.log", "mock-1/a.csv", "mock-1/c.csv", "mock-1/logs/"}, false},
+		{"Sorts by size ascending", ExploreOptions{Order: SortAscending}, []string{"mock-1/", "mock-1/logs/", "mock-1/c.csv", "mock-1/a.csv", "mock-1/b.log"}, false},
+		{"Sorts by name ascending by default", ExploreOptions{Sort: SortByName}, []string{"mock-1/", "mock-1/a.csv", "mock-1/b.log", "mock-1/c.csv", "mock-1/logs/"}, false},
+		{"Sorts by cost", ExploreOptions{Sort: SortByCost}, []string{"mock-1/", "mock-1/a.csv", "mock-1/b.log", "mock-1/c.csv", "mock-1/logs/"}, false},
+		{"Sorts directories last by created", ExploreOptions{Sort: SortByCreated, Order: SortAscending}, []string{"mock-1/", "mock-1/a.csv", "mock-1/b.log", "mock-1/c.csv", "mock-1/logs/"}, false},
+		{"Sorts by updated", ExploreOptions{Sort: SortByUpdated}, []string{"mock-1/", "mock-1/a.csv", "mock-1/c.csv", "mock-1/b.log", "mock-1/logs/"}, false},
+		{"Filters objects", ExploreOptions{Kind: EntryObjects, Sort: SortByName}, []string{"mock-1/", "mock-1/a.csv", "mock-1/b.log", "mock-1/c.csv"}, false},
+		{"Filters directories", ExploreOptions{Kind: EntryDirectories}, []string{"mock-1/", "mock-1/logs/"}, false},
+		{"Filters storage class", ExploreOptions{StorageClass: StorageStandard}, []string{"mock-1/", "mock-1/a.csv", "mock-1/logs/"}, false},
+		{"Filters size range", ExploreOptions{MinSize: size(5 * bytesPerGB), MaxSize: size(10 * bytesPerGB)}, []string{"mock-1/", "mock-1/a.csv", "mock-1/c.csv"}, false},
+		{"Filters created range", ExploreOptions{CreatedAfter: feb, CreatedBefore: mar}, []string{"mock-1/", "mock-1/b.log"}, false},
+		{"Filters updated after", ExploreOptions{UpdatedAfter: mar, Sort: SortByName}, []string{"mock-1/", "mock-1/a.csv", "mock-1/c.csv"}, false},
+		{"Filters name prefix", ExploreOptions{NamePrefix: "log"}, []string{"mock-1/", "mock-1/logs/"}, false},
+		{"Filters name suffix", ExploreOptions{NameSuffix: ".csv", Sort: SortByName}, []string{"mock-1/", "mock-1/a.csv", "mock-1/c.csv"}, false},
+		{"Returns error for invalid order", ExploreOptions{Order: "up"}, nil, true},
+		{"Returns error for invalid kind", ExploreOptions{Kind: "files"}, nil, true},
+		{"Returns error for invalid storage class", ExploreOptions{StorageClass: "COLD"}, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := exploreRepo.GetPathContents(context.Background(), "", "mock-1/", tc.opts)
+			if err != nil {
+				if tc.wantErr {
+					return
+				}
+				t.Fatal(err)
+			}
+
+			if tc.wantErr {
+				t.Fatal("Expected error but did pass")
+			}
+
+			var gotNames []string
+			for _, m := range got {
+				gotNames = append(gotNames, m.Name)
+			}
+
+			if fmt.Sprint(gotNames) != fmt.Sprint(tc.want) {
+				t.Errorf("Contents mismatch: got %v, want %v", gotNames, tc.want)
+			}
+		})
+	}
+}
+
+func TestBucketLocationCosts(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	exploreRepo := NewExploreRepository(db)
+	metadataRepo := NewMetadataRepository(db)
+	dirRepo := NewDirectoryRepository(db)
+	bucketRepo := NewBucketRepository(db)
+
+	// Buckets without a recorded location, such as those only seen by the subscriber, use the default
+	for _, bucket := range []model.Bucket{{Name: "eu", Location: "EUROPE-WEST1"}, {Name: "asia", Location: "ASIA-SOUTH1"}} {
+		if err := bucketRepo.Upsert(context.Background(), &bucket); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, bucket := range []string{"eu", "asia", "unrecorded"} {
+		m := model.Metadata{Bucket: bucket, Name: "dir/file", Size: 10 * bytesPerGB, StorageClass: "NEARLINE", Created: time.Now(), Updated: time.Now()}
+		if err := metadataRepo.Insert(context.Background(), paths.Default, &m); err != nil {
+			t.Fatal(err)
+		}
+		if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, StorageNearline, m.Bucket, m.Name, m.Size, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		bucket string
+		want   float64
+	}{
+		{"eu", 0.10},
+		{"asia", 0.16},
+		{"unrecorded", 0.16},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.bucket, func(t *testing.T) {
+			got, err := exploreRepo.GetPathContents(context.Background(), tc.bucket, "dir/", ExploreOptions{Sort: SortByCost})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The directory itself and its object
+			if len(got) != 2 {
+				t.Fatalf("Return count mismatch: got %d, want %d", len(got), 2)
+			}
+
+			for _, content := range got {
+				if fmt.Sprintf("%.3f", content.Cost) != fmt.Sprintf("%.3f", tc.want) {
+					t.Errorf("Cost mismatch of %s: got %f, want %f", content.Name, content.Cost, tc.want)
+				}
+			}
+		})
+	}
+
+	t.Run("Sums summaries at each location", func(t *testing.T) {
+		got, err := exploreRepo.GetPathSummary(context.Background(), "", "dir/")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.Size.Nearline != 30*bytesPerGB {
+			t.Errorf("Size mismatch: got %d, want %d", got.Size.Nearline, 30*bytesPerGB)
+		}
+
+		if fmt.Sprintf("%.3f", got.Cost.Nearline) != "0.420" {
+			t.Errorf("Cost mismatch: got %f, want %f", got.Cost.Nearline, 0.42)
+		}
+	})
+
+	t.Run("Sums tree costs at each location", func(t *testing.T) {
+		for bucket, want := range map[string]string{"": "0.420", "eu": "0.100"} {
+			got, err := NewTreeRepository(db).GetTree(context.Background(), bucket, "dir/", TreeOptions{Depth: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if fmt.Sprintf("%.3f", got.Cost.Nearline) != want {
+				t.Errorf("Cost mismatch of bucket %q: got %f, want %s", bucket, got.Cost.Nearline, want)
+			}
+		}
+	})
+
+	t.Run("Prices diffs at each location", func(t *testing.T) {
+		for bucket, want := range map[string]string{"": "0.420", "eu": "0.100"} {
+			opts := DiffOptions{Bucket: bucket, Path: "dir/", From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour), Limit: 10}
+			got, err := NewDiffRepository(db).GetDiff(context.Background(), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if fmt.Sprintf("%.3f", got.Total.Cost) != want {
+				t.Errorf("Total cost mismatch of bucket %q: got %f, want %s", bucket, got.Total.Cost, want)
+			}
+
+			var added float64
+			for _, object := range got.Added {
+				added += object.Cost
+			}
+			if fmt.Sprintf("%.3f", added) != want {
+				t.Errorf("Added cost mismatch of bucket %q: got %f, want %s", bucket, added, want)
+			}
+		}
+	})
+
+	t.Run("Prices exports at each location", func(t *testing.T) {
+		for bucket, want := range map[string]string{"": "0.420", "eu": "0.100"} {
+			var got float64
+			err := NewExportRepository(db).Export(context.Background(), ExportOptions{Bucket: bucket, Path: "dir/"}, func(m *model.Metadata) error {
+				got += m.Cost
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if fmt.Sprintf("%.3f", got) != want {
+				t.Errorf("Cost mismatch of bucket %q: got %f, want %s", bucket, got, want)
+			}
+		}
+	})
+}
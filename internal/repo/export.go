@@ -0,0 +1,215 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// prefixUpperBound sorts after every UTF-8 name starting with a prefix
+const prefixUpperBound = "\xff"
+
+type ExportOptions struct {
+	// Bucket limits the export to a single bucket, all buckets are exported if empty
+	Bucket string
+	// Path is the directory to export, such as "a/b/" or "/" for the root
+	Path string
+	// Depth limits the export to entries at most Depth levels below Path, unlimited if 0
+	Depth int
+	Kind  EntryKind
+}
+
+type Export struct {
+	*Database
+}
+
+type ExportRepository interface {
+	Export(ctx context.Context, opts ExportOptions, fn func(*model.Metadata) error) error
+}
+
+func NewExportRepository(db *Database) ExportRepository {
+	return &Export{db}
+}
+
+// Export calls fn for every directory and then every object under a path, ordered by bucket and name.
+// Rows are streamed from the database so that exports of any size use constant memory.
+// Directories are identified by an empty storage class.
+func (e *Export) Export(ctx context.Context, opts ExportOptions, fn func(*model.Metadata) error) (err error) {
+	ctx, span := tracing.Start(ctx, "Export.Export",
+		attribute.String("bucket", opts.Bucket),
+		attribute.String("path", opts.Path),
+		attribute.Int("depth", opts.Depth),
+		attribute.String("kind", string(opts.Kind)))
+	defer tracing.End(span, &err)
+
+	if opts.Kind == "" {
+		opts.Kind = EntryAll
+	}
+
+	if opts.Kind != EntryAll && opts.Kind != EntryObjects && opts.Kind != EntryDirectories {
+		return fmt.Errorf("invalid entry kind %q", opts.Kind)
+	}
+
+	if opts.Depth < 0 {
+		return fmt.Errorf("invalid export depth %d", opts.Depth)
+	}
+
+	sep, err := separator(ctx, e.DB, opts.Bucket)
+	if err != nil {
+		return err
+	}
+
+	prefix := paths.Prefix(opts.Path)
+
+	if opts.Kind != EntryObjects {
+		if err := e.exportDirectories(ctx, opts, prefix, sep, fn); err != nil {
+			return err
+		}
+	}
+
+	if opts.Kind != EntryDirectories {
+		if err := e.exportObjects(ctx, opts, prefix, sep, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Export) exportDirectories(ctx context.Context, opts ExportOptions, prefix string, sep paths.Separator, fn func(*model.Metadata) error) error {
+	// Depth of a directory is the number of delimiters after the prefix
+	query := fmt.Sprintf(`
+		SELECT
+			bucket,
+			name,
+			parent,
+			count,
+			size_standard,
+			size_nearline,
+			size_coldline,
+			size_archive,
+			%s AS location
+		FROM directory
+		WHERE
+			name >= $1 AND name < $2 AND name != $3 AND
+			($4 = '' OR bucket = $4) AND
+			($5 = 0 OR
+				LENGTH(SUBSTR(name, LENGTH($1) + 1)) -
+				LENGTH(REPLACE(SUBSTR(name, LENGTH($1) + 1), $6, '')) <= $5)
+		ORDER BY bucket, name;
+	`, bucketLocationSQL("directory"))
+
+	type directoryRow struct {
+		Bucket       string `db:"bucket"`
+		Name         string `db:"name"`
+		Parent       string `db:"parent"`
+		Count        int64  `db:"count"`
+		SizeStandard int64  `db:"size_standard"`
+		SizeNearline int64  `db:"size_nearline"`
+		SizeColdline int64  `db:"size_coldline"`
+		SizeArchive  int64  `db:"size_archive"`
+		// Location prices the directory at the location of its bucket
+		Location Location `db:"location"`
+	}
+
+	rows, err := e.DB.QueryxContext(ctx, query, prefix, prefix+prefixUpperBound, opts.Path, opts.Bucket, opts.Depth, sep.Delimiter())
+	if err != nil {
+		return fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row directoryRow
+		if err := rows.StructScan(&row); err != nil {
+			return fmt.Errorf("scan error: %w", err)
+		}
+
+		cost, err := getDirectoryCost(row.Location, row.SizeStandard, row.SizeNearline, row.SizeColdline, row.SizeArchive)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(&model.Metadata{
+			Bucket: row.Bucket,
+			Name:   row.Name,
+			Parent: row.Parent,
+			Size:   row.SizeStandard + row.SizeNearline + row.SizeColdline + row.SizeArchive,
+			Count:  row.Count,
+			Cost:   cost,
+		}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (e *Export) exportObjects(ctx context.Context, opts ExportOptions, prefix string, sep paths.Separator, fn func(*model.Metadata) error) error {
+	// Depth of an object is one more than the number of delimiters after the prefix
+	query := fmt.Sprintf(`
+		SELECT
+			bucket,
+			name,
+			parent,
+			size,
+			storage_class,
+			created,
+			updated,
+			%s AS location
+		FROM metadata
+		WHERE
+			name >= $1 AND name < $2 AND
+			($3 = '' OR bucket = $3) AND
+			($4 = 0 OR
+				LENGTH(SUBSTR(name, LENGTH($1) + 1)) -
+				LENGTH(REPLACE(SUBSTR(name, LENGTH($1) + 1), $5, '')) < $4)
+		ORDER BY bucket, name;
+	`, bucketLocationSQL("metadata"))
+
+	type objectRow struct {
+		Bucket       string    `db:"bucket"`
+		Name         string    `db:"name"`
+		Parent       string    `db:"parent"`
+		Size         int64     `db:"size"`
+		StorageClass string    `db:"storage_class"`
+		Created      time.Time `db:"created"`
+		Updated      time.Time `db:"updated"`
+		// Location prices the object at the location of its bucket
+		Location Location `db:"location"`
+	}
+
+	rows, err := e.DB.QueryxContext(ctx, query, prefix, prefix+prefixUpperBound, opts.Bucket, opts.Depth, sep.Delimiter())
+	if err != nil {
+		return fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row objectRow
+		if err := rows.StructScan(&row); err != nil {
+			return fmt.Errorf("scan error: %w", err)
+		}
+
+		cost, err := getObjectCost(row.Location, StorageClass(row.StorageClass), row.Size)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(&model.Metadata{
+			Bucket:       row.Bucket,
+			Name:         row.Name,
+			Parent:       row.Parent,
+			StorageClass: row.StorageClass,
+			Size:         row.Size,
+			Cost:         cost,
+			Created:      row.Created,
+			Updated:      row.Updated,
+		}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
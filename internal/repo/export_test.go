@@ -0,0 +1,165 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+)
+
+func TestExport(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	exportRepo := NewExportRepository(db)
+	metadataRepo := NewMetadataRepository(db)
+	dirRepo := NewDirectoryRepository(db)
+
+	// Insert mock data
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	metadata := []model.Metadata{
+		{Bucket: "mock", Name: "file1", Size: 10 * bytesPerGB, StorageClass: "STANDARD", Created: created, Updated: created},
+		{Bucket: "mock", Name: "mock-1/file2", Size: 1 * bytesPerGB, StorageClass: "COLDLINE", Created: created, Updated: created},
+		{Bucket: "mock", Name: "mock-1/mock-2/file3", Size: 2 * bytesPerGB, StorageClass: "ARCHIVE", Created: created, Updated: created},
+		{Bucket: "mock-10", Name: "mock-1/file4", Size: 1 * bytesPerGB, StorageClass: "STANDARD", Created: created, Updated: created},
+	}
+
+	for _, m := range metadata {
+		if err := metadataRepo.Insert(context.Background(), paths.Default, &m); err != nil {
+			t.Fatal(err)
+		}
+		if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, StorageClass(m.StorageClass), m.Bucket, m.Name, m.Size, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name    string
+		opts    ExportOptions
+		want    []string
+		wantErr bool
+	}{
+		{
+			"Exports whole root",
+			ExportOptions{Path: "/"},
+			[]string{"mock:mock-1/", "mock:mock-1/mock-2/", "mock-10:mock-1/", "mock:file1", "mock:mock-1/file2", "mock:mock-1/mock-2/file3", "mock-10:mock-1/file4"},
+			false,
+		},
+		{
+			"Exports single bucket",
+			ExportOptions{Bucket: "mock", Path: "/"},
+			[]string{"mock:mock-1/", "mock:mock-1/mock-2/", "mock:file1", "mock:mock-1/file2", "mock:mock-1/mock-2/file3"},
+			false,
+		},
+		{
+			"Exports root children only",
+			ExportOptions{Bucket: "mock", Path: "/", Depth: 1},
+			[]string{"mock:mock-1/", "mock:file1"},
+			false,
+		},
+		{
+			"Exports nested directory",
+			ExportOptions{Bucket: "mock", Path: "mock-1/"},
+			[]string{"mock:mock-1/mock-2/", "mock:mock-1/file2", "mock:mock-1/mock-2/file3"},
+			false,
+		},
+		{
+			"Exports objects only",
+			ExportOptions{Bucket: "mock", Path: "mock-1/", Kind: EntryObjects, Depth: 1},
+			[]string{"mock:mock-1/file2"},
+			false,
+		},
+		{
+			"Exports directories only",
+			ExportOptions{Bucket: "mock", Path: "/", Kind: EntryDirectories},
+			[]string{"mock:mock-1/", "mock:mock-1/mock-2/"},
+			false,
+		},
+		{
+			"Exports nothing for non-existent directory",
+			ExportOptions{Path: "non-existent/"},
+			nil,
+			false,
+		},
+		{
+			"Returns error for invalid kind",
+			ExportOptions{Path: "/", Kind: "invalid"},
+			nil,
+			true,
+		},
+		{
+			"Returns error for negative depth",
+			ExportOptions{Path: "/", Depth: -1},
+			nil,
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			err := exportRepo.Export(context.Background(), tc.opts, func(row *model.Metadata) error {
+				got = append(got, row.Bucket+":"+row.Name)
+				return nil
+			})
+			if err != nil {
+				if tc.wantErr {
+					return
+				}
+				t.Fatal(err)
+			}
+
+			if tc.wantErr {
+				t.Fatal("Expected error but did pass")
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("Export mismatch: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("Exports costs and timestamps", func(t *testing.T) {
+		rows := map[string]*model.Metadata{}
+		if err := exportRepo.Export(context.Background(), ExportOptions{Bucket: "mock", Path: "mock-1/"}, func(row *model.Metadata) error {
+			rows[row.Name] = row
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := rows["mock-1/mock-2/"]; got.Size != 2*bytesPerGB || got.Count != 1 || fmt.Sprintf("%.3f", got.Cost) != "0.005" {
+			t.Errorf("Directory mismatch: got %+v", got)
+		}
+
+		if got := rows["mock-1/file2"]; !got.Created.Equal(created) || got.StorageClass != "COLDLINE" || fmt.Sprintf("%.3f", got.Cost) != "0.007" {
+			t.Errorf("Object mismatch: got %+v", got)
+		}
+	})
+
+	t.Run("Stops on callback error", func(t *testing.T) {
+		errStop := errors.New("stop")
+		calls := 0
+		err := exportRepo.Export(context.Background(), ExportOptions{Path: "/"}, func(row *model.Metadata) error {
+			calls++
+			return errStop
+		})
+
+		if !errors.Is(err, errStop) || calls != 1 {
+			t.Errorf("Callback error mismatch: got %v after %d calls", err, calls)
+		}
+	})
+}
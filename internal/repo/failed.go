@@ -0,0 +1,92 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type FailedObject struct {
+	*Database
+	tx *sqlx.Tx
+}
+
+type FailedObjectRepository interface {
+	Record(ctx context.Context, bucket, name string, seedErr error) error
+	Delete(ctx context.Context, bucket, name string) error
+	Clear(ctx context.Context, bucket string) error
+	List(ctx context.Context, bucket string) ([]*model.FailedObject, error)
+}
+
+func NewFailedObjectRepository(db *Database) FailedObjectRepository {
+	return &FailedObject{Database: db}
+}
+
+// Record records an object of bucket that could not be seeded, replacing its previous error
+func (f *FailedObject) Record(ctx context.Context, bucket, name string, seedErr error) (err error) {
+	ctx, span := tracing.Start(ctx, "FailedObject.Record", tracing.Object(bucket, name)...)
+	defer tracing.End(span, &err)
+
+	query := `
+		INSERT INTO failed_object (bucket, name, error, failed)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT(bucket, name)
+		DO UPDATE
+		SET error = $3,
+			failed = $4;
+	`
+
+	_, err = conn(f.Database, f.tx).ExecContext(ctx, query, bucket, name, seedErr.Error(), time.Now().UTC())
+	return err
+}
+
+// Delete removes the record of an object once it has been seeded
+func (f *FailedObject) Delete(ctx context.Context, bucket, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "FailedObject.Delete", tracing.Object(bucket, name)...)
+	defer tracing.End(span, &err)
+
+	query := `
+		DELETE FROM failed_object
+		WHERE bucket = ? AND name = ?;
+	`
+
+	_, err = conn(f.Database, f.tx).ExecContext(ctx, query, bucket, name)
+	return err
+}
+
+// Clear removes the records of all objects of bucket, before it is seeded again
+func (f *FailedObject) Clear(ctx context.Context, bucket string) (err error) {
+	ctx, span := tracing.Start(ctx, "FailedObject.Clear", attribute.String("gcs.bucket", bucket))
+	defer tracing.End(span, &err)
+
+	query := `
+		DELETE FROM failed_object
+		WHERE bucket = ?;
+	`
+
+	_, err = conn(f.Database, f.tx).ExecContext(ctx, query, bucket)
+	return err
+}
+
+// List returns the objects of bucket that could not be seeded, ordered by name
+func (f *FailedObject) List(ctx context.Context, bucket string) (_ []*model.FailedObject, err error) {
+	ctx, span := tracing.Start(ctx, "FailedObject.List", attribute.String("gcs.bucket", bucket))
+	defer tracing.End(span, &err)
+
+	query := `
+		SELECT bucket, name, error, failed
+		FROM failed_object
+		WHERE bucket = ?
+		ORDER BY name;
+	`
+
+	var failed []*model.FailedObject
+	if err := sqlx.SelectContext(ctx, conn(f.Database, f.tx), &failed, query, bucket); err != nil {
+		return nil, err
+	}
+	return failed, nil
+}
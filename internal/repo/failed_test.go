@@ -0,0 +1,109 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFailedObject(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	failedRepo := NewFailedObjectRepository(db)
+	ctx := context.Background()
+
+	testCases := []struct {
+		name   string
+		action func() error
+		want   []string
+	}{
+		{
+			name:   "Returns empty without failures",
+			action: func() error { return nil },
+			want:   []string{},
+		},
+		{
+			name: "Records failures",
+			action: func() error {
+				for _, name := range []string{"dir/file2", "file1"} {
+					if err := failedRepo.Record(ctx, "mock", name, errors.New("mock error")); err != nil {
+						return err
+					}
+				}
+				return failedRepo.Record(ctx, "other", "file1", errors.New("mock error"))
+			},
+			want: []string{"dir/file2: mock error", "file1: mock error"},
+		},
+		{
+			name: "Replaces error of a failed object",
+			action: func() error {
+				return failedRepo.Record(ctx, "mock", "file1", errors.New("other error"))
+			},
+			want: []string{"dir/file2: mock error", "file1: other error"},
+		},
+		{
+			name: "Deletes seeded object",
+			action: func() error {
+				return failedRepo.Delete(ctx, "mock", "dir/file2")
+			},
+			want: []string{"file1: other error"},
+		},
+		{
+			name: "Clears bucket",
+			action: func() error {
+				return failedRepo.Clear(ctx, "mock")
+			},
+			want: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.action(); err != nil {
+				t.Fatal(err)
+			}
+
+			failed, err := failedRepo.List(ctx, "mock")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]string, len(failed))
+			for i, f := range failed {
+				got[i] = f.Name + ": " + f.Error
+				if f.Bucket != "mock" || f.Failed.IsZero() {
+					t.Errorf("Failed object mismatch: got bucket %s failed at %v", f.Bucket, f.Failed)
+				}
+			}
+
+			if len(got) != len(tc.want) {
+				t.Fatalf("Failed objects mismatch: got %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("Failed objects mismatch: got %v, want %v", got, tc.want)
+					break
+				}
+			}
+		})
+	}
+
+	// Other buckets are kept
+	other, err := failedRepo.List(ctx, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other) != 1 {
+		t.Errorf("Other bucket mismatch: got %d failures, want 1", len(other))
+	}
+}
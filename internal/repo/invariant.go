@@ -0,0 +1,174 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ViolationKind names an invariant of the directory tree
+type ViolationKind string
+
+const (
+	// ViolationTotals is a directory whose size per class or count differs from the sum over its children
+	ViolationTotals ViolationKind = "totals"
+	// ViolationNegative is a directory with a negative size or count
+	ViolationNegative ViolationKind = "negative"
+	// ViolationMissingParent is a directory holding objects or directories that does not exist
+	ViolationMissingParent ViolationKind = "missing_parent"
+)
+
+// Violation is a directory breaking an invariant of the directory tree
+type Violation struct {
+	Kind   ViolationKind `json:"kind"`
+	Bucket string        `json:"bucket" db:"bucket"`
+	Name   string        `json:"name" db:"name"`
+	// Size and Count are recorded for the directory, zero if it is missing
+	Size  model.Size `json:"size"`
+	Count int64      `json:"count" db:"count"`
+	// ChildrenSize and ChildrenCount are the sums over the objects and directories it holds
+	ChildrenSize  model.Size `json:"childrenSize"`
+	ChildrenCount int64      `json:"childrenCount"`
+}
+
+func (v *Violation) String() string {
+	return fmt.Sprintf("%s %s/%s: size %+v count %d, children size %+v count %d",
+		v.Kind, v.Bucket, v.Name, v.Size, v.Count, v.ChildrenSize, v.ChildrenCount)
+}
+
+type Invariant struct {
+	*Database
+}
+
+type InvariantRepository interface {
+	Check(ctx context.Context, bucket string) ([]*Violation, error)
+}
+
+func NewInvariantRepository(db *Database) InvariantRepository {
+	return &Invariant{db}
+}
+
+// childrenSQL sums the objects and directories held by each directory of bucket $1,
+// or of all buckets if empty. The root directory is its own parent and is not its own child.
+const childrenSQL = `
+	WITH children AS (
+		SELECT
+			bucket,
+			parent,
+			CASE storage_class WHEN 'STANDARD' THEN size ELSE 0 END AS size_standard,
+			CASE storage_class WHEN 'NEARLINE' THEN size ELSE 0 END AS size_nearline,
+			CASE storage_class WHEN 'COLDLINE' THEN size ELSE 0 END AS size_coldline,
+			CASE storage_class WHEN 'ARCHIVE' THEN size ELSE 0 END AS size_archive,
+			1 AS count
+		FROM metadata
+		WHERE $1 = '' OR bucket = $1
+		UNION ALL
+		SELECT bucket, parent, size_standard, size_nearline, size_coldline, size_archive, count
+		FROM directory
+		WHERE name != '/' AND ($1 = '' OR bucket = $1)
+	)
+	SELECT
+		bucket,
+		parent AS name,
+		SUM(size_standard) AS size_standard,
+		SUM(size_nearline) AS size_nearline,
+		SUM(size_coldline) AS size_coldline,
+		SUM(size_archive) AS size_archive,
+		SUM(count) AS count
+	FROM children
+	GROUP BY bucket, parent
+`
+
+// invariantRow is a directory joined with the sums over its children
+type invariantRow struct {
+	Bucket string `db:"bucket"`
+	Name   string `db:"name"`
+	Exists bool   `db:"exists"`
+	model.Size
+	Count         int64 `db:"count"`
+	ChildStandard int64 `db:"child_standard"`
+	ChildNearline int64 `db:"child_nearline"`
+	ChildColdline int64 `db:"child_coldline"`
+	ChildArchive  int64 `db:"child_archive"`
+	ChildCount    int64 `db:"child_count"`
+}
+
+// Check returns the directories of bucket, or of all buckets if empty, whose size per
+// class and count are negative or differ from the sum over the objects and directories
+// they hold, and the missing directories that hold any
+func (i *Invariant) Check(ctx context.Context, bucket string) (_ []*Violation, err error) {
+	ctx, span := tracing.Start(ctx, "Invariant.Check", attribute.String("gcs.bucket", bucket))
+	defer tracing.End(span, &err)
+
+	// Directories are matched with the sums of their children in both directions,
+	// since SQLite does not support full outer joins
+	query := `
+		WITH sums AS (` + childrenSQL + `)
+		SELECT
+			d.bucket,
+			d.name,
+			1 AS "exists",
+			d.size_standard,
+			d.size_nearline,
+			d.size_coldline,
+			d.size_archive,
+			d.count,
+			COALESCE(s.size_standard, 0) AS child_standard,
+			COALESCE(s.size_nearline, 0) AS child_nearline,
+			COALESCE(s.size_coldline, 0) AS child_coldline,
+			COALESCE(s.size_archive, 0) AS child_archive,
+			COALESCE(s.count, 0) AS child_count
+		FROM directory d
+		LEFT JOIN sums s ON s.bucket = d.bucket AND s.name = d.name
+		WHERE $1 = '' OR d.bucket = $1
+		UNION ALL
+		SELECT
+			s.bucket,
+			s.name,
+			0,
+			0, 0, 0, 0, 0,
+			s.size_standard,
+			s.size_nearline,
+			s.size_coldline,
+			s.size_archive,
+			s.count
+		FROM sums s
+		LEFT JOIN directory d ON d.bucket = s.bucket AND d.name = s.name
+		WHERE d.name IS NULL
+		ORDER BY 1, 2;
+	`
+
+	var rows []invariantRow
+	if err := sqlx.SelectContext(ctx, i.DB, &rows, query, bucket); err != nil {
+		return nil, err
+	}
+
+	violations := []*Violation{}
+	for _, r := range rows {
+		v := &Violation{
+			Bucket:        r.Bucket,
+			Name:          r.Name,
+			Size:          r.Size,
+			Count:         r.Count,
+			ChildrenSize:  model.Size{Standard: r.ChildStandard, Nearline: r.ChildNearline, Coldline: r.ChildColdline, Archive: r.ChildArchive},
+			ChildrenCount: r.ChildCount,
+		}
+
+		switch {
+		case !r.Exists:
+			v.Kind = ViolationMissingParent
+		case v.Size.Standard < 0 || v.Size.Nearline < 0 || v.Size.Coldline < 0 || v.Size.Archive < 0 || v.Count < 0:
+			v.Kind = ViolationNegative
+		case v.Size != v.ChildrenSize || v.Count != v.ChildrenCount:
+			v.Kind = ViolationTotals
+		default:
+			continue
+		}
+		violations = append(violations, v)
+	}
+	return violations, nil
+}
@@ -0,0 +1,155 @@
+package repo
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+)
+
+func TestInvariantCheck(t *testing.T) {
+	testCases := []struct {
+		name    string
+		bucket  string
+		corrupt string
+		want    []string
+	}{
+		{
+			name: "Holds for consistent tree",
+			want: []string{},
+		},
+		{
+			name:    "Finds directory with wrong size",
+			corrupt: `UPDATE directory SET size_nearline = size_nearline + 1 WHERE bucket = 'mock-1' AND name = 'dir/sub/'`,
+			// The parent sums the wrong size of its child
+			want: []string{"totals mock-1/dir/", "totals mock-1/dir/sub/"},
+		},
+		{
+			name:    "Finds directory with wrong count",
+			corrupt: `UPDATE directory SET count = count - 1 WHERE bucket = 'mock-1' AND name = '/'`,
+			want:    []string{"totals mock-1//"},
+		},
+		{
+			name:    "Finds negative directory",
+			corrupt: `UPDATE directory SET size_archive = -1 WHERE bucket = 'mock-2' AND name = 'dir/'`,
+			want:    []string{"totals mock-2//", "negative mock-2/dir/"},
+		},
+		{
+			name:    "Finds missing directory",
+			corrupt: `DELETE FROM directory WHERE bucket = 'mock-1' AND name = 'dir/sub/'`,
+			want:    []string{"totals mock-1/dir/", "missing_parent mock-1/dir/sub/"},
+		},
+		{
+			name:    "Finds object without directories",
+			corrupt: `INSERT INTO metadata (bucket, name, size, parent, storage_class, created, updated) VALUES ('mock-1', 'other/file', 1, 'other/', 'STANDARD', 0, 0)`,
+			want:    []string{"missing_parent mock-1/other/"},
+		},
+		{
+			name:    "Checks single bucket",
+			bucket:  "mock-2",
+			corrupt: `UPDATE directory SET count = 0 WHERE bucket = 'mock-1' AND name = 'dir/sub/'`,
+			want:    []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newInvariantTestDatabase(t)
+
+			if tc.corrupt != "" {
+				if _, err := db.Exec(tc.corrupt); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			violations, err := NewInvariantRepository(db).Check(context.Background(), tc.bucket)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]string, len(violations))
+			for i, v := range violations {
+				got[i] = string(v.Kind) + " " + v.Bucket + "/" + v.Name
+			}
+
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("Violations mismatch: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInvariantViolation(t *testing.T) {
+	db := newInvariantTestDatabase(t)
+
+	if _, err := db.Exec(`UPDATE directory SET size_standard = 5, count = 7 WHERE bucket = 'mock-1' AND name = 'dir/sub/'`); err != nil {
+		t.Fatal(err)
+	}
+
+	violations, err := NewInvariantRepository(db).Check(context.Background(), "mock-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := slices.IndexFunc(violations, func(v *Violation) bool { return v.Name == "dir/sub/" })
+	if i < 0 {
+		t.Fatalf("Violation missing: got %v", violations)
+	}
+
+	want := Violation{
+		Kind:          ViolationTotals,
+		Bucket:        "mock-1",
+		Name:          "dir/sub/",
+		Size:          model.Size{Standard: 5, Nearline: 4},
+		Count:         7,
+		ChildrenSize:  model.Size{Nearline: 4},
+		ChildrenCount: 1,
+	}
+	if *violations[i] != want {
+		t.Errorf("Violation mismatch: got %s, want %s", violations[i], &want)
+	}
+}
+
+// newInvariantTestDatabase returns a database of objects in two buckets with consistent directories
+func newInvariantTestDatabase(t *testing.T) *Database {
+	t.Helper()
+
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	metadataRepo := NewMetadataRepository(db)
+	dirRepo := NewDirectoryRepository(db)
+
+	objects := []*model.Metadata{
+		{Bucket: "mock-1", Name: "file1", Size: 1, StorageClass: "STANDARD"},
+		{Bucket: "mock-1", Name: "dir/file2", Size: 2, StorageClass: "STANDARD"},
+		{Bucket: "mock-1", Name: "dir/file3", Size: 3, StorageClass: "ARCHIVE"},
+		{Bucket: "mock-1", Name: "dir/sub/file4", Size: 4, StorageClass: "NEARLINE"},
+		{Bucket: "mock-1", Name: "dir//file5", Size: 5, StorageClass: "COLDLINE"},
+		{Bucket: "mock-2", Name: "dir/file1", Size: 6, StorageClass: "STANDARD"},
+		{Bucket: "mock-2", Name: "dir/sub/file2", Size: 7, StorageClass: "STANDARD"},
+	}
+
+	for _, obj := range objects {
+		obj.Created, obj.Updated = time.Now(), time.Now()
+		if err := metadataRepo.Insert(context.Background(), paths.Default, obj); err != nil {
+			t.Fatal(err)
+		}
+		if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, StorageClass(obj.StorageClass), obj.Bucket, obj.Name, obj.Size, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
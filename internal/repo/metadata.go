@@ -1,29 +1,37 @@
 package repo
 
 import (
+	"context"
 	"errors"
 	"time"
 
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
+	"github.com/jmoiron/sqlx"
 )
 
 type Metadata struct {
 	*Database
+	tx *sqlx.Tx
 }
 
 type MetadataRepository interface {
-	Get(bucket string, name string) (*model.Metadata, error)
-	Insert(*model.Metadata) error
-	Update(bucket, name, storageClass string, size int64, updated time.Time) error
-	Delete(bucket, name string) error
+	Get(ctx context.Context, bucket string, name string) (*model.Metadata, error)
+	Insert(ctx context.Context, sep paths.Separator, obj *model.Metadata) error
+	Update(ctx context.Context, bucket, name, storageClass string, size int64, updated time.Time) error
+	Delete(ctx context.Context, bucket, name string) error
 }
 
 func NewMetadataRepository(db *Database) MetadataRepository {
-	return &Metadata{db}
+	return &Metadata{Database: db}
 }
 
 // Get returns metadata object information. It returns an empty struct if metadata does not exist.
-func (m *Metadata) Get(bucket, name string) (*model.Metadata, error) {
+func (m *Metadata) Get(ctx context.Context, bucket, name string) (_ *model.Metadata, err error) {
+	ctx, span := tracing.Start(ctx, "Metadata.Get", tracing.Object(bucket, name)...)
+	defer tracing.End(span, &err)
+
 	query := `
 		SELECT name, parent, size, storage_class, created, updated
 		FROM metadata
@@ -32,13 +40,17 @@ func (m *Metadata) Get(bucket, name string) (*model.Metadata, error) {
 
 	// Select record and ignore empty results for services not to depend on database errors
 	var metadata model.Metadata
-	if err := m.DB.Get(&metadata, query, bucket, name); err != nil {
+	if err := sqlx.GetContext(ctx, conn(m.Database, m.tx), &metadata, query, bucket, name); err != nil {
 		return nil, err
 	}
 	return &metadata, nil
 }
 
-func (m *Metadata) Insert(obj *model.Metadata) error {
+// Insert records an object, whose parent directory is named by sep
+func (m *Metadata) Insert(ctx context.Context, sep paths.Separator, obj *model.Metadata) (err error) {
+	ctx, span := tracing.Start(ctx, "Metadata.Insert", tracing.Object(obj.Bucket, obj.Name)...)
+	defer tracing.End(span, &err)
+
 	query := `
 		INSERT INTO metadata 
 		(bucket, name, size, parent, storage_class, created, updated)	
@@ -49,11 +61,11 @@ func (m *Metadata) Insert(obj *model.Metadata) error {
 		return errors.New("bucket or name argument is empty")
 	}
 
-	if _, err := m.DB.Exec(query,
+	if _, err := conn(m.Database, m.tx).ExecContext(ctx, query,
 		obj.Bucket,
 		obj.Name,
 		obj.Size,
-		getParentDir(obj.Name),
+		sep.Dir(obj.Name),
 		obj.StorageClass,
 		obj.Created,
 		obj.Updated); err != nil {
@@ -62,7 +74,10 @@ func (m *Metadata) Insert(obj *model.Metadata) error {
 	return nil
 }
 
-func (m *Metadata) Update(bucket, name, storageClass string, size int64, updated time.Time) error {
+func (m *Metadata) Update(ctx context.Context, bucket, name, storageClass string, size int64, updated time.Time) (err error) {
+	ctx, span := tracing.Start(ctx, "Metadata.Update", tracing.Object(bucket, name)...)
+	defer tracing.End(span, &err)
+
 	query := `
 		UPDATE metadata
 		SET storage_class = $1,
@@ -71,7 +86,7 @@ func (m *Metadata) Update(bucket, name, storageClass string, size int64, updated
 		WHERE bucket = $4 AND name = $5;
 	`
 
-	res, err := m.DB.Exec(query, storageClass, size, updated, bucket, name)
+	res, err := conn(m.Database, m.tx).ExecContext(ctx, query, storageClass, size, updated, bucket, name)
 	if err != nil {
 		return err
 	}
@@ -88,13 +103,16 @@ func (m *Metadata) Update(bucket, name, storageClass string, size int64, updated
 	return nil
 }
 
-func (m *Metadata) Delete(bucket string, name string) error {
+func (m *Metadata) Delete(ctx context.Context, bucket string, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "Metadata.Delete", tracing.Object(bucket, name)...)
+	defer tracing.End(span, &err)
+
 	query := `
 		DELETE FROM metadata
 		WHERE bucket = ? AND name = ?;	
 	`
 
-	res, err := m.DB.Exec(query, bucket, name)
+	res, err := conn(m.Database, m.tx).ExecContext(ctx, query, bucket, name)
 	if err != nil {
 		return err
 	}
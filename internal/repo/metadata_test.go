@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
 )
 
 func TestGetMetadata(t *testing.T) {
@@ -30,7 +31,7 @@ func TestGetMetadata(t *testing.T) {
 		Name:         "mock-object",
 		StorageClass: "STANDARD",
 	}
-	if err := metadataRepo.Insert(mockMetadata); err != nil {
+	if err := metadataRepo.Insert(context.Background(), paths.Default, mockMetadata); err != nil {
 		t.Fatal(err)
 	}
 
@@ -56,7 +57,7 @@ func TestGetMetadata(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			got, err := metadataRepo.Get(tc.bucket, tc.objName)
+			got, err := metadataRepo.Get(context.Background(), tc.bucket, tc.objName)
 			if err != nil {
 				if tc.wantErr {
 					return
@@ -136,7 +137,7 @@ func TestInsertMetadata(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			if err := metadataRepo.Insert(tc.metadata); err != nil {
+			if err := metadataRepo.Insert(context.Background(), paths.Default, tc.metadata); err != nil {
 				if tc.wantErr {
 					return
 				}
@@ -183,7 +184,7 @@ func TestUpdateMetadata(t *testing.T) {
 	}
 
 	// Insert initial metadata
-	if err := metadataRepo.Insert(mockMetadata); err != nil {
+	if err := metadataRepo.Insert(context.Background(), paths.Default, mockMetadata); err != nil {
 		t.Fatal(err)
 	}
 
@@ -211,7 +212,7 @@ func TestUpdateMetadata(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.testName, func(t *testing.T) {
-			if err := metadataRepo.Update(tc.metadata.Bucket, tc.metadata.Name, tc.metadata.StorageClass, tc.metadata.Size, tc.metadata.Updated); err != nil {
+			if err := metadataRepo.Update(context.Background(), tc.metadata.Bucket, tc.metadata.Name, tc.metadata.StorageClass, tc.metadata.Size, tc.metadata.Updated); err != nil {
 				if tc.wantErr {
 					return
 				}
@@ -272,7 +273,7 @@ func TestDeleteMetadata(t *testing.T) {
 	}
 
 	metadataRepo := NewMetadataRepository(db)
-	metadataRepo.Insert(mockMetadata)
+	metadataRepo.Insert(context.Background(), paths.Default, mockMetadata)
 
 	testCases := []struct {
 		name     string
@@ -286,7 +287,7 @@ func TestDeleteMetadata(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			if err := metadataRepo.Delete(tc.metadata.Bucket, tc.metadata.Name); err != nil {
+			if err := metadataRepo.Delete(context.Background(), tc.metadata.Bucket, tc.metadata.Name); err != nil {
 				if tc.wantErr {
 					return
 				}
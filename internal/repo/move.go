@@ -0,0 +1,155 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrMoveConflict is returned when the destination of a move holds objects or folders
+var ErrMoveConflict = errors.New("destination of move is not empty")
+
+type Move struct {
+	*Database
+	tx *sqlx.Tx
+}
+
+// MoveRepository relocates subtrees of objects and directories, as renaming a folder does
+type MoveRepository interface {
+	Move(ctx context.Context, bucket, source, destination string) (int64, error)
+}
+
+func NewMoveRepository(db *Database) MoveRepository {
+	return &Move{Database: db}
+}
+
+// Move relocates directory source with all objects and directories under it to destination
+// in one transaction, and returns the number of objects moved. The totals of the subtree are
+// subtracted from the ancestors of source and added to the ancestors of destination,
+// which are created if they do not exist.
+//
+// Source and destination must be directories such as "a/b/" other than the root, and neither
+// may contain the other. Returns sql.ErrNoRows if source does not exist, and ErrMoveConflict
+// if destination holds objects or folders.
+func (m *Move) Move(ctx context.Context, bucket, source, destination string) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "Move.Move",
+		attribute.String("gcs.bucket", bucket),
+		attribute.String("source", source),
+		attribute.String("destination", destination))
+	defer tracing.End(span, &err)
+
+	if len(bucket) == 0 {
+		return 0, errors.New("bucket argument is empty")
+	}
+
+	if strings.HasPrefix(source, destination) || strings.HasPrefix(destination, source) {
+		return 0, fmt.Errorf("cannot move %q to %q, since one contains the other", source, destination)
+	}
+
+	var moved int64
+	err = runInTx(ctx, m.Database, m.tx, func(q queryer) error {
+		tx, ok := q.(*sqlx.Tx)
+		if !ok {
+			return errors.New("move requires a transaction")
+		}
+
+		sep, err := separator(ctx, tx, bucket)
+		if err != nil {
+			return err
+		}
+
+		for _, dir := range []string{source, destination} {
+			if dir == "" || dir == paths.Root || !sep.IsDir(dir) {
+				return fmt.Errorf("move path %q is not a directory", dir)
+			}
+		}
+
+		dirRepo := &Directory{Database: m.Database, tx: tx}
+		sourceUpper := source + prefixUpperBound
+		destinationUpper := destination + prefixUpperBound
+
+		var exists bool
+		if err := sqlx.GetContext(ctx, tx, &exists, `
+			SELECT EXISTS(SELECT 1 FROM directory WHERE bucket = $1 AND name = $2);
+		`, bucket, source); err != nil {
+			return err
+		}
+
+		if !exists {
+			return sql.ErrNoRows
+		}
+
+		// Directories left empty under destination by deleted objects are replaced
+		var conflict bool
+		if err := sqlx.GetContext(ctx, tx, &conflict, `
+			SELECT
+				EXISTS(SELECT 1 FROM metadata WHERE bucket = $1 AND name >= $2 AND name < $3) OR
+				EXISTS(SELECT 1 FROM directory WHERE bucket = $1 AND name >= $2 AND name < $3 AND (folder = 1 OR count != 0));
+		`, bucket, destination, destinationUpper); err != nil {
+			return err
+		}
+
+		if conflict {
+			return ErrMoveConflict
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM directory
+			WHERE bucket = $1 AND name >= $2 AND name < $3;
+		`, bucket, destination, destinationUpper); err != nil {
+			return fmt.Errorf("error deleting empty directories: %w", err)
+		}
+
+		// Remove the totals of the subtree from the ancestors of source
+		totals, err := subtreeTotals(ctx, tx, bucket, source, sourceUpper)
+		if err != nil {
+			return err
+		}
+
+		if err := adjustAncestors(ctx, dirRepo, sep, bucket, sep.Parent(source), totals, -1); err != nil {
+			return err
+		}
+
+		// Names and parents are rewritten from source to destination, except the parent
+		// of source itself which is outside the subtree
+		res, err := tx.ExecContext(ctx, `
+			UPDATE metadata
+			SET name = $1 || substr(name, length($2) + 1),
+				parent = $1 || substr(parent, length($2) + 1)
+			WHERE bucket = $3 AND name >= $2 AND name < $4;
+		`, destination, source, bucket, sourceUpper)
+		if err != nil {
+			return fmt.Errorf("error moving metadata: %w", err)
+		}
+
+		if moved, err = res.RowsAffected(); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE directory
+			SET name = $1 || substr(name, length($2) + 1),
+				parent = CASE WHEN name = $2 THEN $3 ELSE $1 || substr(parent, length($2) + 1) END
+			WHERE bucket = $4 AND name >= $2 AND name < $5;
+		`, destination, source, sep.Parent(destination), bucket, sourceUpper); err != nil {
+			return fmt.Errorf("error moving directories: %w", err)
+		}
+
+		// Ancestors of destination are created even if the subtree holds no objects
+		if err := dirRepo.UpsertParentDirs(ctx, sep, StorageStandard, bucket, sep.Parent(destination), 0, 0); err != nil {
+			return fmt.Errorf("error upserting directories: %w", err)
+		}
+		return adjustAncestors(ctx, dirRepo, sep, bucket, sep.Parent(destination), totals, 1)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return moved, nil
+}
@@ -0,0 +1,213 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+)
+
+func TestMove(t *testing.T) {
+	// directory is the count, sizes and folder flag of a directory
+	type directory struct {
+		count    int64
+		standard int64
+		archive  int64
+		folder   bool
+	}
+
+	testCases := []struct {
+		name            string
+		source          string
+		destination     string
+		wantMoved       int64
+		wantObjects     []string
+		wantDirectories map[string]directory
+		wantErr         bool
+		// wantErrIs is the error expected to be wrapped, if set
+		wantErrIs error
+	}{
+		{
+			name:        "Moves subtree and adjusts ancestors",
+			source:      "a/b/",
+			destination: "d/e/",
+			wantMoved:   2,
+			wantObjects: []string{"a/file1", "d/e/c/file3", "d/e/file2", "other/file4"},
+			wantDirectories: map[string]directory{
+				"/":          {4, 1 + 2 + 4, 3, false},
+				"a/":         {1, 1, 0, false},
+				"d/":         {2, 2, 3, false},
+				"d/e/":       {2, 2, 3, true},
+				"d/e/c/":     {1, 0, 3, false},
+				"d/e/empty/": {0, 0, 0, true},
+				"other/":     {1, 4, 0, false},
+			},
+		},
+		{
+			name:        "Moves subtree into existing directory",
+			source:      "a/b/c/",
+			destination: "other/c/",
+			wantMoved:   1,
+			wantObjects: []string{"a/b/file2", "a/file1", "other/c/file3", "other/file4"},
+			wantDirectories: map[string]directory{
+				"/":          {4, 1 + 2 + 4, 3, false},
+				"a/":         {2, 1 + 2, 0, false},
+				"a/b/":       {1, 2, 0, true},
+				"a/b/empty/": {0, 0, 0, true},
+				"other/":     {2, 4, 3, false},
+				"other/c/":   {1, 0, 3, false},
+			},
+		},
+		{
+			name:        "Moves empty folder",
+			source:      "a/b/empty/",
+			destination: "f/",
+			wantObjects: []string{"a/b/c/file3", "a/b/file2", "a/file1", "other/file4"},
+			wantDirectories: map[string]directory{
+				"/":      {4, 1 + 2 + 4, 3, false},
+				"a/":     {3, 1 + 2, 3, false},
+				"a/b/":   {2, 2, 3, true},
+				"a/b/c/": {1, 0, 3, false},
+				"f/":     {0, 0, 0, true},
+				"other/": {1, 4, 0, false},
+			},
+		},
+		{
+			name:        "Returns conflict for destination holding objects",
+			source:      "a/b/",
+			destination: "other/",
+			wantErr:     true,
+			wantErrIs:   ErrMoveConflict,
+		},
+		{
+			name:        "Returns no rows for missing source",
+			source:      "missing/",
+			destination: "f/",
+			wantErr:     true,
+			wantErrIs:   sql.ErrNoRows,
+		},
+		{
+			name:        "Returns error for destination in source",
+			source:      "a/",
+			destination: "a/b/f/",
+			wantErr:     true,
+		},
+		{
+			name:        "Returns error for root",
+			source:      "/",
+			destination: "f/",
+			wantErr:     true,
+		},
+		{
+			name:        "Returns error for object name",
+			source:      "a/file1",
+			destination: "f/file1",
+			wantErr:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := NewDatabase(":memory:", 1)
+			db.Connect(context.Background())
+			defer db.Close()
+
+			if err := db.Setup(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := db.CreateTables(); err != nil {
+				t.Fatal(err)
+			}
+
+			metadataRepo := NewMetadataRepository(db)
+			dirRepo := NewDirectoryRepository(db)
+			moveRepo := NewMoveRepository(db)
+
+			// Insert mock data
+			metadata := []model.Metadata{
+				{Bucket: "mock", Name: "a/file1", Size: 1, StorageClass: "STANDARD"},
+				{Bucket: "mock", Name: "a/b/file2", Size: 2, StorageClass: "STANDARD"},
+				{Bucket: "mock", Name: "a/b/c/file3", Size: 3, StorageClass: "ARCHIVE"},
+				{Bucket: "mock", Name: "other/file4", Size: 4, StorageClass: "STANDARD"},
+				{Bucket: "other", Name: "a/b/file2", Size: 2, StorageClass: "STANDARD"},
+			}
+
+			for _, m := range metadata {
+				m.Created, m.Updated = time.Now(), time.Now()
+				if err := metadataRepo.Insert(context.Background(), paths.Default, &m); err != nil {
+					t.Fatal(err)
+				}
+				if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, StorageClass(m.StorageClass), m.Bucket, m.Name, m.Size, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, folder := range []string{"a/b/", "a/b/empty/"} {
+				if err := dirRepo.UpsertFolder(context.Background(), paths.Default, "mock", folder); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			moved, err := moveRepo.Move(context.Background(), "mock", tc.source, tc.destination)
+			if (err != nil) != tc.wantErr || tc.wantErrIs != nil && !errors.Is(err, tc.wantErrIs) {
+				t.Fatalf("Error mismatch: got %v, want %v", err, tc.wantErrIs)
+			}
+			if tc.wantErr {
+				return
+			}
+
+			if moved != tc.wantMoved {
+				t.Errorf("Moved objects mismatch: got %d, want %d", moved, tc.wantMoved)
+			}
+
+			var gotObjects []string
+			if err := db.Select(&gotObjects, `SELECT name FROM metadata WHERE bucket = 'mock' ORDER BY name`); err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(gotObjects, tc.wantObjects) {
+				t.Errorf("Objects mismatch: got %v, want %v", gotObjects, tc.wantObjects)
+			}
+
+			var rows []struct {
+				Name     string `db:"name"`
+				Count    int64  `db:"count"`
+				Standard int64  `db:"size_standard"`
+				Archive  int64  `db:"size_archive"`
+				Folder   bool   `db:"folder"`
+			}
+			if err := db.Select(&rows, `SELECT name, count, size_standard, size_archive, folder FROM directory WHERE bucket = 'mock' AND (count != 0 OR folder = 1 OR name = '/')`); err != nil {
+				t.Fatal(err)
+			}
+
+			gotDirectories := map[string]directory{}
+			for _, row := range rows {
+				gotDirectories[row.Name] = directory{row.Count, row.Standard, row.Archive, row.Folder}
+			}
+
+			if len(gotDirectories) != len(tc.wantDirectories) {
+				t.Errorf("Directories mismatch: got %v, want %v", gotDirectories, tc.wantDirectories)
+			}
+			for name, want := range tc.wantDirectories {
+				if gotDirectories[name] != want {
+					t.Errorf("Directory %s mismatch: got %+v, want %+v", name, gotDirectories[name], want)
+				}
+			}
+
+			// Parents of moved objects and directories are consistent with their names
+			violations, err := NewInvariantRepository(db).Check(context.Background(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range violations {
+				t.Errorf("Invariant violated: %s", v)
+			}
+		})
+	}
+}
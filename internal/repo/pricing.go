@@ -1,6 +1,10 @@
 package repo
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 type StorageClass string
 type Location string
@@ -21,6 +25,25 @@ const (
 
 const bytesPerGB = 1024 * 1024 * 1024
 
+// defaultLocation prices buckets whose location is not recorded or has no pricing,
+// and totals merged across buckets
+const defaultLocation = LocationUS
+
+// locationPrefixes map bucket locations, including regions and dual-regions such as
+// "EUROPE-WEST1" or "EUR4", to the pricing location of their prefix in order of precedence
+var locationPrefixes = []struct {
+	prefix   string
+	location Location
+}{
+	{"NORTHAMERICA-", LocationCA},
+	{"AUSTRALIA-", LocationAU},
+	{"ASIA-SOUTH1", LocationIN},
+	{"ASIA-SOUTH2", LocationIN},
+	{"ASIA", LocationASIA},
+	{"EU", LocationEU},
+	{"US", LocationUS},
+}
+
 // LocationPricing holds a general pricing per location
 // based on the most expensive region for each location
 //
@@ -110,3 +133,64 @@ func getDirectoryCost(location Location, sizeStandard, sizeNearline, sizeColdlin
 	}
 	return totalCost, nil
 }
+
+// pricingLocation returns the pricing location of a bucket location
+func pricingLocation(location string) Location {
+	for _, p := range locationPrefixes {
+		if strings.HasPrefix(strings.ToUpper(location), p.prefix) {
+			return p.location
+		}
+	}
+	return defaultLocation
+}
+
+// bucketLocationSQL returns a SQL expression of pricingLocation for the bucket of the rows of table,
+// which is defaultLocation if the bucket is not recorded
+func bucketLocationSQL(table string) string {
+	var cases strings.Builder
+	for _, p := range locationPrefixes {
+		// LIKE is case-insensitive for ASCII like the prefix match of pricingLocation
+		fmt.Fprintf(&cases, " WHEN location LIKE '%s%%' THEN '%s'", p.prefix, p.location)
+	}
+	return fmt.Sprintf("COALESCE((SELECT CASE%s ELSE '%[2]s' END FROM bucket WHERE bucket.name = %[3]s.bucket), '%[2]s')", cases.String(), defaultLocation, table)
+}
+
+// bucketCostSQL returns a SQL expression of costSQL for the rows of table at the pricing location of their bucket
+func bucketCostSQL(table string, costSQL func(Location) string) string {
+	var cases strings.Builder
+	for _, p := range locationPrefixes {
+		if p.location != defaultLocation {
+			fmt.Fprintf(&cases, " WHEN '%s' THEN %s", p.location, costSQL(p.location))
+		}
+	}
+	return fmt.Sprintf("(CASE %s%s ELSE %s END)", bucketLocationSQL(table), cases.String(), costSQL(defaultLocation))
+}
+
+// objectCostSQL returns a SQL expression of getObjectCost for the size and storage_class columns
+func objectCostSQL(location Location) string {
+	costMap := locationPricing[location]
+
+	var cases strings.Builder
+	for _, class := range []StorageClass{StorageStandard, StorageNearline, StorageColdline, StorageArchive} {
+		fmt.Fprintf(&cases, " WHEN '%s' THEN %v", class, costMap[class])
+	}
+
+	// Integer division matches getPrice, which prices whole gigabytes
+	return fmt.Sprintf("(size / %d) * (CASE storage_class%s ELSE 0 END)", bytesPerGB, cases.String())
+}
+
+// classCostSQL returns a function of the SQL expression of getPrice for the size column of a storage class
+func classCostSQL(class StorageClass) func(Location) string {
+	column := "size_" + strings.ToLower(string(class))
+	return func(location Location) string {
+		return fmt.Sprintf("(%s / %d) * %v", column, bytesPerGB, locationPricing[location][class])
+	}
+}
+
+// directoryCostSQL returns a SQL expression of getDirectoryCost for the size columns of each storage class
+func directoryCostSQL(location Location) string {
+	costMap := locationPricing[location]
+
+	return fmt.Sprintf("(size_standard / %[1]d) * %[2]v + (size_nearline / %[1]d) * %[3]v + (size_coldline / %[1]d) * %[4]v + (size_archive / %[1]d) * %[5]v",
+		bytesPerGB, costMap[StorageStandard], costMap[StorageNearline], costMap[StorageColdline], costMap[StorageArchive])
+}
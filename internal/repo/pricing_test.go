@@ -0,0 +1,36 @@
+package repo
+
+import "testing"
+
+func TestPricingLocation(t *testing.T) {
+	testCases := []struct {
+		location string
+		want     Location
+	}{
+		{"US", LocationUS},
+		{"US-CENTRAL1", LocationUS},
+		{"NAM4", LocationUS},
+		{"EU", LocationEU},
+		{"EUR4", LocationEU},
+		{"EUROPE-WEST1", LocationEU},
+		{"europe-west6", LocationEU},
+		{"ASIA", LocationASIA},
+		{"ASIA-EAST2", LocationASIA},
+		{"ASIA-SOUTH1", LocationIN},
+		{"ASIA-SOUTH2", LocationIN},
+		{"ASIA-SOUTHEAST1", LocationASIA},
+		{"ASIA-SOUTHEAST2", LocationASIA},
+		{"NORTHAMERICA-NORTHEAST1", LocationCA},
+		{"AUSTRALIA-SOUTHEAST1", LocationAU},
+		{"ME-WEST1", defaultLocation},
+		{"", defaultLocation},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.location, func(t *testing.T) {
+			if got := pricingLocation(tc.location); got != tc.want {
+				t.Errorf("Location mismatch: got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// reseedBatchSize is the number of staged objects read at a time while replacing a subtree
+const reseedBatchSize = 1000
+
+type Reseed struct {
+	*Database
+	tx *sqlx.Tx
+}
+
+// ReseedRepository stages the objects listed under a prefix and then replaces
+// the metadata of that subtree with them at once
+type ReseedRepository interface {
+	Stage(ctx context.Context, obj *model.Metadata) error
+	Clear(ctx context.Context, bucket string) error
+	Replace(ctx context.Context, bucket, prefix string) error
+}
+
+func NewReseedRepository(db *Database) ReseedRepository {
+	return &Reseed{Database: db}
+}
+
+// Stage records an object listed for a reseed of its bucket
+func (r *Reseed) Stage(ctx context.Context, obj *model.Metadata) (err error) {
+	ctx, span := tracing.Start(ctx, "Reseed.Stage", tracing.Object(obj.Bucket, obj.Name)...)
+	defer tracing.End(span, &err)
+
+	query := `
+		INSERT OR REPLACE INTO reseed_object
+		(bucket, name, size, storage_class, created, updated)
+		VALUES (?, ?, ?, ?, ?, ?);
+	`
+
+	if len(obj.Bucket) == 0 || len(obj.Name) == 0 {
+		return errors.New("bucket or name argument is empty")
+	}
+
+	_, err = conn(r.Database, r.tx).ExecContext(ctx, query, obj.Bucket, obj.Name, obj.Size, obj.StorageClass, obj.Created, obj.Updated)
+	return err
+}
+
+// Clear removes all objects staged for a reseed of bucket
+func (r *Reseed) Clear(ctx context.Context, bucket string) (err error) {
+	ctx, span := tracing.Start(ctx, "Reseed.Clear", attribute.String("gcs.bucket", bucket))
+	defer tracing.End(span, &err)
+
+	query := `
+		DELETE FROM reseed_object
+		WHERE bucket = ?;
+	`
+
+	_, err = conn(r.Database, r.tx).ExecContext(ctx, query, bucket)
+	return err
+}
+
+// Replace swaps the metadata and directories under prefix with the objects staged for bucket
+// in one transaction, and clears them. Ancestors of prefix are adjusted by the difference
+// between the old and new totals of the subtree.
+//
+// Prefix must be a directory such as "a/b/", or empty for the whole bucket.
+func (r *Reseed) Replace(ctx context.Context, bucket, prefix string) (err error) {
+	ctx, span := tracing.Start(ctx, "Reseed.Replace", attribute.String("gcs.bucket", bucket), attribute.String("prefix", prefix))
+	defer tracing.End(span, &err)
+
+	if len(bucket) == 0 {
+		return errors.New("bucket argument is empty")
+	}
+
+	return runInTx(ctx, r.Database, r.tx, func(q queryer) error {
+		tx, ok := q.(*sqlx.Tx)
+		if !ok {
+			return errors.New("reseed requires a transaction")
+		}
+
+		sep, err := separator(ctx, tx, bucket)
+		if err != nil {
+			return err
+		}
+
+		if prefix != "" && (prefix == paths.Root || !sep.IsDir(prefix)) {
+			return fmt.Errorf("reseed prefix %q is not a directory", prefix)
+		}
+
+		metadataRepo := &Metadata{Database: r.Database, tx: tx}
+		dirRepo := &Directory{Database: r.Database, tx: tx}
+		upper := prefix + prefixUpperBound
+
+		// Remove the old totals of the subtree from its ancestors. The root has none.
+		if prefix != "" {
+			if err := subtractSubtree(ctx, tx, dirRepo, sep, bucket, prefix, sep.Parent(prefix)); err != nil {
+				return err
+			}
+		}
+
+		// The range of the whole bucket includes the root directory "/"
+		deleteSubtree := []string{`
+			DELETE FROM metadata
+			WHERE bucket = $1 AND name >= $2 AND name < $3;
+		`, `
+			DELETE FROM directory
+			WHERE bucket = $1 AND name >= $2 AND name < $3;
+		`}
+
+		for _, query := range deleteSubtree {
+			if _, err := tx.ExecContext(ctx, query, bucket, prefix, upper); err != nil {
+				return fmt.Errorf("error deleting subtree: %w", err)
+			}
+		}
+
+		// Staged objects are read in batches since the transaction cannot be written
+		// while a query is open. Parent directories of each object are created and
+		// all ancestors, including those of prefix, get the new totals.
+		selectStaged := `
+			SELECT bucket, name, size, storage_class, created, updated
+			FROM reseed_object
+			WHERE bucket = $1 AND name >= $2 AND name < $3 AND name > $4
+			ORDER BY name
+			LIMIT $5;
+		`
+
+		var lastName string
+		for {
+			var staged []model.Metadata
+			if err := sqlx.SelectContext(ctx, tx, &staged, selectStaged, bucket, prefix, upper, lastName, reseedBatchSize); err != nil {
+				return fmt.Errorf("error reading staged objects: %w", err)
+			}
+
+			for i := range staged {
+				obj := &staged[i]
+				if err := metadataRepo.Insert(ctx, sep, obj); err != nil {
+					return fmt.Errorf("error inserting metadata: %w", err)
+				}
+
+				if err := dirRepo.UpsertParentDirs(ctx, sep, StorageClass(obj.StorageClass), obj.Bucket, obj.Name, obj.Size, 1); err != nil {
+					return fmt.Errorf("error upserting directories: %w", err)
+				}
+			}
+
+			if len(staged) < reseedBatchSize {
+				break
+			}
+			lastName = staged[len(staged)-1].Name
+		}
+
+		staging := &Reseed{Database: r.Database, tx: tx}
+		return staging.Clear(ctx, bucket)
+	})
+}
+
+// subtractSubtree subtracts the sizes and count recorded by directory prefix from parent,
+// the directory holding prefix, and all its ancestors. The recorded totals are used rather
+// than those of the objects under prefix, so ancestors drop any drift of the subtree.
+func subtractSubtree(ctx context.Context, tx *sqlx.Tx, dirRepo *Directory, sep paths.Separator, bucket, prefix, parent string) error {
+	query := `
+		SELECT count, size_standard, size_nearline, size_coldline, size_archive
+		FROM directory
+		WHERE bucket = $1 AND name = $2;
+	`
+
+	var dir struct {
+		Count        int64 `db:"count"`
+		SizeStandard int64 `db:"size_standard"`
+		SizeNearline int64 `db:"size_nearline"`
+		SizeColdline int64 `db:"size_coldline"`
+		SizeArchive  int64 `db:"size_archive"`
+	}
+	if err := sqlx.GetContext(ctx, tx, &dir, query, bucket, prefix); err != nil {
+		// Nothing is recorded under prefix
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("error reading subtree directory: %w", err)
+	}
+
+	// The count is not kept per storage class, so it is subtracted once with the first
+	totals := []subtreeTotal{
+		{StorageClass: string(StorageStandard), Size: dir.SizeStandard, Count: dir.Count},
+		{StorageClass: string(StorageNearline), Size: dir.SizeNearline},
+		{StorageClass: string(StorageColdline), Size: dir.SizeColdline},
+		{StorageClass: string(StorageArchive), Size: dir.SizeArchive},
+	}
+	return adjustAncestors(ctx, dirRepo, sep, bucket, parent, totals, -1)
+}
+
+// subtreeTotal is the size and count of the objects of a storage class in a subtree
+type subtreeTotal struct {
+	StorageClass string `db:"storage_class"`
+	Size         int64  `db:"size"`
+	Count        int64  `db:"count"`
+}
+
+// subtreeTotals sums the objects under prefix per storage class
+func subtreeTotals(ctx context.Context, tx *sqlx.Tx, bucket, prefix, upper string) ([]subtreeTotal, error) {
+	query := `
+		SELECT storage_class, SUM(size) AS size, COUNT(*) AS count
+		FROM metadata
+		WHERE bucket = $1 AND name >= $2 AND name < $3
+		GROUP BY storage_class;
+	`
+
+	var totals []subtreeTotal
+	if err := sqlx.SelectContext(ctx, tx, &totals, query, bucket, prefix, upper); err != nil {
+		return nil, fmt.Errorf("error summing subtree: %w", err)
+	}
+	return totals, nil
+}
+
+// adjustAncestors adds totals, multiplied by sign, to directory parent and all its ancestors
+func adjustAncestors(ctx context.Context, dirRepo *Directory, sep paths.Separator, bucket, parent string, totals []subtreeTotal, sign int64) error {
+	// UpsertParentDirs starts from the directory named by a placeholder, which parent is
+	for _, total := range totals {
+		if err := dirRepo.UpsertParentDirs(ctx, sep, StorageClass(total.StorageClass), bucket, parent, sign*total.Size, sign*total.Count); err != nil {
+			return fmt.Errorf("error adjusting ancestors: %w", err)
+		}
+	}
+	return nil
+}
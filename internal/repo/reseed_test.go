@@ -0,0 +1,204 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+)
+
+func TestReseedReplace(t *testing.T) {
+	// directory is the count and sizes of a directory
+	type directory struct {
+		count    int64
+		standard int64
+		archive  int64
+	}
+
+	testCases := []struct {
+		name   string
+		prefix string
+		staged []model.Metadata
+		// drifted are counted by directories but missing from metadata, such as after a lost delete
+		drifted         []model.Metadata
+		wantObjects     []string
+		wantDirectories map[string]directory
+		wantErr         bool
+	}{
+		{
+			name:   "Replaces subtree and adjusts ancestors",
+			prefix: "a/b/",
+			staged: []model.Metadata{
+				{Bucket: "mock", Name: "a/b/file2", Size: 5, StorageClass: "STANDARD"},
+				{Bucket: "mock", Name: "a/b/d/file5", Size: 7, StorageClass: "ARCHIVE"},
+			},
+			wantObjects: []string{"a/b/d/file5", "a/b/file2", "a/file1", "other/file4"},
+			wantDirectories: map[string]directory{
+				"/":      {4, 1 + 5 + 4, 7},
+				"a/":     {3, 1 + 5, 7},
+				"a/b/":   {2, 5, 7},
+				"a/b/d/": {1, 0, 7},
+				"other/": {1, 4, 0},
+			},
+		},
+		{
+			name:   "Removes drift of subtree from ancestors",
+			prefix: "a/b/",
+			staged: []model.Metadata{
+				{Bucket: "mock", Name: "a/b/file2", Size: 5, StorageClass: "STANDARD"},
+			},
+			drifted: []model.Metadata{
+				{Bucket: "mock", Name: "a/b/lost", Size: 100, StorageClass: "NEARLINE"},
+			},
+			wantObjects: []string{"a/b/file2", "a/file1", "other/file4"},
+			wantDirectories: map[string]directory{
+				"/":      {3, 1 + 5 + 4, 0},
+				"a/":     {2, 1 + 5, 0},
+				"a/b/":   {1, 5, 0},
+				"other/": {1, 4, 0},
+			},
+		},
+		{
+			name:        "Replaces subtree with nothing",
+			prefix:      "a/b/",
+			wantObjects: []string{"a/file1", "other/file4"},
+			wantDirectories: map[string]directory{
+				"/":      {2, 1 + 4, 0},
+				"a/":     {1, 1, 0},
+				"other/": {1, 4, 0},
+			},
+		},
+		{
+			name:   "Replaces whole bucket",
+			prefix: "",
+			staged: []model.Metadata{
+				{Bucket: "mock", Name: "file6", Size: 9, StorageClass: "STANDARD"},
+			},
+			wantObjects: []string{"file6"},
+			wantDirectories: map[string]directory{
+				"/": {1, 9, 0},
+			},
+		},
+		{
+			name:    "Returns error for prefix of names",
+			prefix:  "a/b",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := NewDatabase(":memory:", 1)
+			db.Connect(context.Background())
+			defer db.Close()
+
+			if err := db.Setup(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := db.CreateTables(); err != nil {
+				t.Fatal(err)
+			}
+
+			metadataRepo := NewMetadataRepository(db)
+			dirRepo := NewDirectoryRepository(db)
+			reseedRepo := NewReseedRepository(db)
+
+			// Insert mock data
+			metadata := []model.Metadata{
+				{Bucket: "mock", Name: "a/file1", Size: 1, StorageClass: "STANDARD"},
+				{Bucket: "mock", Name: "a/b/file2", Size: 2, StorageClass: "STANDARD"},
+				{Bucket: "mock", Name: "a/b/c/file3", Size: 3, StorageClass: "ARCHIVE"},
+				{Bucket: "mock", Name: "other/file4", Size: 4, StorageClass: "STANDARD"},
+				{Bucket: "other", Name: "a/b/file2", Size: 2, StorageClass: "STANDARD"},
+			}
+
+			for _, m := range metadata {
+				m.Created, m.Updated = time.Now(), time.Now()
+				if err := metadataRepo.Insert(context.Background(), paths.Default, &m); err != nil {
+					t.Fatal(err)
+				}
+				if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, StorageClass(m.StorageClass), m.Bucket, m.Name, m.Size, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, m := range tc.drifted {
+				if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, StorageClass(m.StorageClass), m.Bucket, m.Name, m.Size, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, m := range tc.staged {
+				m.Created, m.Updated = time.Now(), time.Now()
+				if err := reseedRepo.Stage(context.Background(), &m); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := reseedRepo.Replace(context.Background(), "mock", tc.prefix)
+			if err != nil {
+				if tc.wantErr {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.wantErr {
+				t.Fatal("Expected error, got nil")
+			}
+
+			var gotObjects []string
+			if err := db.Select(&gotObjects, `SELECT name FROM metadata WHERE bucket = 'mock' ORDER BY name`); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(gotObjects) != len(tc.wantObjects) {
+				t.Fatalf("Objects mismatch: got %v, want %v", gotObjects, tc.wantObjects)
+			}
+			for i := range gotObjects {
+				if gotObjects[i] != tc.wantObjects[i] {
+					t.Fatalf("Objects mismatch: got %v, want %v", gotObjects, tc.wantObjects)
+				}
+			}
+
+			var rows []struct {
+				Name     string `db:"name"`
+				Count    int64  `db:"count"`
+				Standard int64  `db:"size_standard"`
+				Archive  int64  `db:"size_archive"`
+			}
+			if err := db.Select(&rows, `SELECT name, count, size_standard, size_archive FROM directory WHERE bucket = 'mock' AND count != 0`); err != nil {
+				t.Fatal(err)
+			}
+
+			gotDirectories := map[string]directory{}
+			for _, row := range rows {
+				gotDirectories[row.Name] = directory{row.Count, row.Standard, row.Archive}
+			}
+
+			if len(gotDirectories) != len(tc.wantDirectories) {
+				t.Errorf("Directories mismatch: got %v, want %v", gotDirectories, tc.wantDirectories)
+			}
+			for name, want := range tc.wantDirectories {
+				if gotDirectories[name] != want {
+					t.Errorf("Directory %s mismatch: got %+v, want %+v", name, gotDirectories[name], want)
+				}
+			}
+
+			// Staged objects are cleared and other buckets are untouched
+			var staged, other int
+			if err := db.Get(&staged, `SELECT COUNT(*) FROM reseed_object`); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Get(&other, `SELECT count FROM directory WHERE bucket = 'other' AND name = '/'`); err != nil {
+				t.Fatal(err)
+			}
+
+			if staged != 0 || other != 1 {
+				t.Errorf("Staged or other bucket mismatch: got %d staged and %d in other bucket, want 0 and 1", staged, other)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
+	"github.com/jmoiron/sqlx"
+)
+
+type Status struct {
+	*Database
+	tx *sqlx.Tx
+}
+
+type StatusRepository interface {
+	SetLastEvent(ctx context.Context, processed time.Time) error
+	GetLastEvent(ctx context.Context) (time.Time, error)
+}
+
+func NewStatusRepository(db *Database) StatusRepository {
+	return &Status{Database: db}
+}
+
+// SetLastEvent records the time at which the subscriber last processed an event
+func (s *Status) SetLastEvent(ctx context.Context, processed time.Time) (err error) {
+	ctx, span := tracing.Start(ctx, "Status.SetLastEvent")
+	defer tracing.End(span, &err)
+
+	query := `
+		INSERT INTO subscriber_status (id, last_event)
+		VALUES (1, $1)
+		ON CONFLICT(id)
+		DO UPDATE
+		SET last_event = $1;
+	`
+
+	_, err = conn(s.Database, s.tx).ExecContext(ctx, query, processed.UTC())
+	return err
+}
+
+// GetLastEvent returns the time at which the subscriber last processed an event.
+// It returns sql.ErrNoRows if no event has been processed.
+func (s *Status) GetLastEvent(ctx context.Context) (_ time.Time, err error) {
+	ctx, span := tracing.Start(ctx, "Status.GetLastEvent")
+	defer tracing.End(span, &err)
+
+	query := `
+		SELECT last_event
+		FROM subscriber_status
+		WHERE id = 1;
+	`
+
+	var lastEvent time.Time
+	if err := sqlx.GetContext(ctx, conn(s.Database, s.tx), &lastEvent, query); err != nil {
+		return time.Time{}, err
+	}
+	return lastEvent, nil
+}
@@ -0,0 +1,44 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLastEvent(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	statusRepo := NewStatusRepository(db)
+
+	if _, err := statusRepo.GetLastEvent(context.Background()); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("Error mismatch before any event: got %v, want %v", err, sql.ErrNoRows)
+	}
+
+	for _, processed := range []time.Time{time.Now().Add(-time.Hour), time.Now()} {
+		if err := statusRepo.SetLastEvent(context.Background(), processed); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := statusRepo.GetLastEvent(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !got.Equal(processed) {
+			t.Errorf("Last event mismatch: got %v, want %v", got, processed)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// MaxTopResults bounds the number of results of GetTop
+const MaxTopResults = 1000
+
+type TopOptions struct {
+	// Kind is EntryObjects or EntryDirectories
+	Kind EntryKind
+	// By is SortBySize, SortByCount or SortByCost, where objects have no count
+	By SortType
+	N  int
+}
+
+type Top struct {
+	*Database
+}
+
+type TopRepository interface {
+	GetTop(ctx context.Context, bucket, path string, opts TopOptions) ([]*model.Metadata, error)
+}
+
+func NewTopRepository(db *Database) TopRepository {
+	return &Top{db}
+}
+
+// GetTop returns the largest objects or directories anywhere below a path, excluding the path itself
+// Results are limited to bucket unless it is empty
+func (t *Top) GetTop(ctx context.Context, bucket, path string, opts TopOptions) (_ []*model.Metadata, err error) {
+	ctx, span := tracing.Start(ctx, "Top.GetTop",
+		attribute.String("bucket", bucket),
+		attribute.String("path", path),
+		attribute.String("kind", string(opts.Kind)),
+		attribute.String("by", string(opts.By)),
+		attribute.Int("n", opts.N))
+	defer tracing.End(span, &err)
+
+	query, queryArgs, err := topQuery(bucket, path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	type topRow struct {
+		Bucket       string       `db:"bucket"`
+		Name         string       `db:"name"`
+		Parent       string       `db:"parent"`
+		Size         int64        `db:"size"`
+		Count        int64        `db:"count"`
+		StorageClass string       `db:"storage_class"`
+		Created      sql.NullTime `db:"created"`
+		Updated      sql.NullTime `db:"updated"`
+		Cost         float64      `db:"cost"`
+	}
+
+	rows, err := t.DB.QueryxContext(ctx, query, queryArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	var top []*model.Metadata
+	for rows.Next() {
+		var row topRow
+		if err := rows.StructScan(&row); err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+
+		top = append(top, &model.Metadata{
+			Bucket:       row.Bucket,
+			Name:         row.Name,
+			Parent:       row.Parent,
+			Size:         row.Size,
+			Count:        row.Count,
+			StorageClass: row.StorageClass,
+			Created:      row.Created.Time,
+			Updated:      row.Updated.Time,
+			Cost:         row.Cost,
+		})
+	}
+	return top, rows.Err()
+}
+
+// topQuery returns the query of GetTop and its arguments
+func topQuery(bucket, path string, opts TopOptions) (string, []any, error) {
+	if opts.N <= 0 || opts.N > MaxTopResults {
+		return "", nil, fmt.Errorf("invalid number of results %d", opts.N)
+	}
+
+	switch {
+	case opts.By == SortBySize || opts.By == SortByCost:
+	case opts.By == SortByCount && opts.Kind == EntryDirectories:
+	default:
+		return "", nil, fmt.Errorf("invalid sort %q for %s", opts.By, opts.Kind)
+	}
+
+	if path == "" {
+		path = paths.Root
+	}
+
+	prefix := paths.Prefix(path)
+
+	args := map[string]any{
+		"path":   path,
+		"prefix": prefix,
+		"upper":  prefix + prefixUpperBound,
+		"bucket": bucket,
+		"n":      opts.N,
+	}
+
+	// Conditions are omitted when they match all rows so that the whole table
+	// or bucket can be ordered by an index
+	nameRange := "1"
+	if prefix != "" {
+		nameRange = "name >= :prefix AND name < :upper"
+	}
+
+	bucketFilter := "1"
+	if bucket != "" {
+		bucketFilter = "bucket = :bucket"
+	}
+
+	// Sizes and counts of the root are ordered by idx_metadata_size, idx_metadata_bucket_size,
+	// idx_directory_size and idx_directory_count. Subtrees and costs are sorted after a range scan.
+	var queryTop string
+	switch opts.Kind {
+	case EntryObjects:
+		queryTop = fmt.Sprintf(`
+			SELECT
+				bucket,
+				name,
+				parent,
+				size,
+				0 AS count,
+				storage_class,
+				created,
+				updated,
+				%[1]s AS cost
+			FROM metadata
+			WHERE
+				%[3]s AND %[4]s
+			ORDER BY %[2]s DESC, name
+			LIMIT :n;
+		`, bucketCostSQL("metadata", objectCostSQL), opts.By, nameRange, bucketFilter)
+	case EntryDirectories:
+		queryTop = fmt.Sprintf(`
+			SELECT
+				bucket,
+				name,
+				parent,
+				%[1]s AS size,
+				count,
+				'' AS storage_class,
+				NULL AS created,
+				NULL AS updated,
+				%[2]s AS cost
+			FROM directory
+			WHERE
+				%[4]s AND %[5]s AND name != :path
+			ORDER BY %[3]s DESC, name
+			LIMIT :n;
+		`, directorySizeSQL, bucketCostSQL("directory", directoryCostSQL), opts.By, nameRange, bucketFilter)
+	default:
+		return "", nil, fmt.Errorf("invalid entry kind %q", opts.Kind)
+	}
+
+	return sqlx.Named(queryTop, args)
+}
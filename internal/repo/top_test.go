@@ -0,0 +1,154 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+)
+
+func TestGetTop(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateIndexes(); err != nil {
+		t.Fatal(err)
+	}
+
+	topRepo := NewTopRepository(db)
+	metadataRepo := NewMetadataRepository(db)
+	dirRepo := NewDirectoryRepository(db)
+
+	// Insert mock data
+	metadata := []model.Metadata{
+		{Bucket: "mock", Name: "file1", Size: 4 * bytesPerGB, StorageClass: "STANDARD", Created: time.Now(), Updated: time.Now()},
+		{Bucket: "mock", Name: "mock-1/file2", Size: 1 * bytesPerGB, StorageClass: "STANDARD", Created: time.Now(), Updated: time.Now()},
+		{Bucket: "mock", Name: "mock-1/mock-2/mock-3/file3", Size: 10 * bytesPerGB, StorageClass: "ARCHIVE", Created: time.Now(), Updated: time.Now()},
+		{Bucket: "mock", Name: "mock-1/mock-2/file4", Size: 2 * bytesPerGB, StorageClass: "STANDARD", Created: time.Now(), Updated: time.Now()},
+		{Bucket: "mock", Name: "mock-1/mock-2/file5", Size: 3 * bytesPerGB, StorageClass: "NEARLINE", Created: time.Now(), Updated: time.Now()},
+		{Bucket: "other", Name: "mock-1/file6", Size: 20 * bytesPerGB, StorageClass: "STANDARD", Created: time.Now(), Updated: time.Now()},
+	}
+
+	for _, m := range metadata {
+		if err := metadataRepo.Insert(context.Background(), paths.Default, &m); err != nil {
+			t.Fatal(err)
+		}
+		if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, StorageClass(m.StorageClass), m.Bucket, m.Name, m.Size, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name    string
+		bucket  string
+		path    string
+		opts    TopOptions
+		want    []string
+		wantErr bool
+	}{
+		{"Largest objects of all buckets", "", "/", TopOptions{Kind: EntryObjects, By: SortBySize, N: 3}, []string{"mock-1/file6", "mock-1/mock-2/mock-3/file3", "file1"}, false},
+		{"Largest objects of subtree", "mock", "mock-1/", TopOptions{Kind: EntryObjects, By: SortBySize, N: 10}, []string{"mock-1/mock-2/mock-3/file3", "mock-1/mock-2/file5", "mock-1/mock-2/file4", "mock-1/file2"}, false},
+		{"Most expensive objects", "mock", "mock-1/", TopOptions{Kind: EntryObjects, By: SortByCost, N: 2}, []string{"mock-1/mock-2/file5", "mock-1/mock-2/file4"}, false},
+		{"Largest directories excluding path", "mock", "mock-1/", TopOptions{Kind: EntryDirectories, By: SortBySize, N: 10}, []string{"mock-1/mock-2/", "mock-1/mock-2/mock-3/"}, false},
+		{"Directories with most objects", "mock", "/", TopOptions{Kind: EntryDirectories, By: SortByCount, N: 2}, []string{"mock-1/", "mock-1/mock-2/"}, false},
+		{"Most expensive directories", "mock", "/", TopOptions{Kind: EntryDirectories, By: SortByCost, N: 2}, []string{"mock-1/", "mock-1/mock-2/"}, false},
+		{"Returns empty for non-existent directory", "", "non-existent/", TopOptions{Kind: EntryObjects, By: SortBySize, N: 10}, nil, false},
+		{"Returns error for objects by count", "", "/", TopOptions{Kind: EntryObjects, By: SortByCount, N: 10}, nil, true},
+		{"Returns error for too many results", "", "/", TopOptions{Kind: EntryObjects, By: SortBySize, N: MaxTopResults + 1}, nil, true},
+		{"Returns error for invalid kind", "", "/", TopOptions{Kind: EntryAll, By: SortBySize, N: 10}, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := topRepo.GetTop(context.Background(), tc.bucket, tc.path, tc.opts)
+			if err != nil {
+				if tc.wantErr {
+					return
+				}
+				t.Fatal(err)
+			}
+
+			if tc.wantErr {
+				t.Fatal("Expected error but did pass")
+			}
+
+			var gotNames []string
+			for _, m := range got {
+				gotNames = append(gotNames, m.Name)
+			}
+
+			if fmt.Sprint(gotNames) != fmt.Sprint(tc.want) {
+				t.Errorf("Top mismatch: got %v, want %v", gotNames, tc.want)
+			}
+		})
+	}
+}
+
+func TestGetTopQueryPlan(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateIndexes(); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name      string
+		bucket    string
+		opts      TopOptions
+		wantIndex string
+	}{
+		{"Largest objects of all buckets", "", TopOptions{Kind: EntryObjects, By: SortBySize, N: 10}, "idx_metadata_size"},
+		{"Largest objects of bucket", "mock", TopOptions{Kind: EntryObjects, By: SortBySize, N: 10}, "idx_metadata_bucket_size"},
+		{"Largest directories", "", TopOptions{Kind: EntryDirectories, By: SortBySize, N: 10}, "idx_directory_size"},
+		{"Directories with most objects", "", TopOptions{Kind: EntryDirectories, By: SortByCount, N: 10}, "idx_directory_count"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, args, err := topQuery(tc.bucket, "/", tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rows, err := db.Query("EXPLAIN QUERY PLAN "+query, args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+
+			// Ties may be sorted by name, but not the whole table
+			var plan []string
+			for rows.Next() {
+				var id, parent, notUsed int
+				var detail string
+				if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+					t.Fatal(err)
+				}
+				plan = append(plan, detail)
+			}
+
+			if !strings.Contains(strings.Join(plan, "\n"), tc.wantIndex) || strings.Contains(strings.Join(plan, "\n"), "TEMP B-TREE FOR ORDER BY") {
+				t.Errorf("Query plan does not order by %s: %v", tc.wantIndex, plan)
+			}
+		})
+	}
+}
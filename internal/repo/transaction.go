@@ -0,0 +1,153 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/metrics"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/retry"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
+	"github.com/jmoiron/sqlx"
+)
+
+// queryer is implemented by both *sqlx.DB and *sqlx.Tx so repositories
+// can run standalone or as part of a unit of work
+type queryer interface {
+	sqlx.QueryerContext
+	sqlx.ExecerContext
+}
+
+// Repositories groups the repositories bound to a single unit of work
+type Repositories struct {
+	Metadata   MetadataRepository
+	Directory  DirectoryRepository
+	Status     StatusRepository
+	Checkpoint CheckpointRepository
+	Reseed     ReseedRepository
+	Failed     FailedObjectRepository
+	Move       MoveRepository
+	Bucket     BucketRepository
+}
+
+// NewRepositories returns repositories that each apply their operations on their own
+func NewRepositories(db *Database) Repositories {
+	return Repositories{
+		Metadata:   NewMetadataRepository(db),
+		Directory:  NewDirectoryRepository(db),
+		Status:     NewStatusRepository(db),
+		Checkpoint: NewCheckpointRepository(db),
+		Reseed:     NewReseedRepository(db),
+		Failed:     NewFailedObjectRepository(db),
+		Move:       NewMoveRepository(db),
+		Bucket:     NewBucketRepository(db),
+	}
+}
+
+// Transactor applies a set of repository operations all-or-nothing
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context, repos Repositories) error) error
+}
+
+type transactor struct {
+	*Database
+}
+
+func NewTransactor(db *Database) Transactor {
+	return &transactor{db}
+}
+
+// WithinTx runs fn with repositories sharing one transaction.
+// The transaction is committed if fn succeeds and rolled back otherwise.
+// It is attempted again while the database is busy or locked.
+func (t *transactor) WithinTx(ctx context.Context, fn func(ctx context.Context, repos Repositories) error) (err error) {
+	ctx, span := tracing.Start(ctx, "Transactor.WithinTx")
+	defer tracing.End(span, &err)
+
+	return retry.Do(ctx, retry.DefaultPolicy, "transaction", func(ctx context.Context) error {
+		return t.withinTx(ctx, fn)
+	})
+}
+
+// withinTx runs fn once in a new transaction
+func (t *transactor) withinTx(ctx context.Context, fn func(ctx context.Context, repos Repositories) error) (err error) {
+	start := time.Now()
+	defer func() {
+		observeTx(start, err)
+	}()
+
+	tx, err := t.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op if commit succeeds
+
+	repos := Repositories{
+		Metadata:   &Metadata{Database: t.Database, tx: tx},
+		Directory:  &Directory{Database: t.Database, tx: tx},
+		Status:     &Status{Database: t.Database, tx: tx},
+		Checkpoint: &Checkpoint{Database: t.Database, tx: tx},
+		Reseed:     &Reseed{Database: t.Database, tx: tx},
+		Failed:     &FailedObject{Database: t.Database, tx: tx},
+		Move:       &Move{Database: t.Database, tx: tx},
+		Bucket:     &Bucket{Database: t.Database, tx: tx},
+	}
+
+	if err := fn(ctx, repos); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// observeTx records the duration and result of a transaction started at start
+func observeTx(start time.Time, err error) {
+	result := "commit"
+	if err != nil {
+		result = "rollback"
+	}
+	metrics.TxDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+
+	if retry.IsLockError(err) {
+		metrics.LockErrors.Inc()
+	}
+}
+
+// conn returns the transaction tx if set, otherwise the underlying database
+func conn(db *Database, tx *sqlx.Tx) queryer {
+	if tx != nil {
+		return tx
+	}
+	return db.DB
+}
+
+// runInTx runs fn in transaction tx if set. Otherwise, fn runs in a new
+// transaction which is committed once fn succeeds, attempted again while
+// the database is busy or locked.
+func runInTx(ctx context.Context, db *Database, tx *sqlx.Tx, fn func(q queryer) error) error {
+	if tx != nil {
+		return fn(tx)
+	}
+
+	return retry.Do(ctx, retry.DefaultPolicy, "transaction", func(ctx context.Context) error {
+		return runInNewTx(ctx, db, fn)
+	})
+}
+
+// runInNewTx runs fn once in a new transaction
+func runInNewTx(ctx context.Context, db *Database, fn func(q queryer) error) (err error) {
+
+	start := time.Now()
+	defer func() {
+		observeTx(start, err)
+	}()
+
+	newTx, err := db.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer newTx.Rollback() // no-op if commit succeeds
+
+	if err := fn(newTx); err != nil {
+		return err
+	}
+	return newTx.Commit()
+}
@@ -0,0 +1,128 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestWithinTx(t *testing.T) {
+	testCases := []struct {
+		name       string
+		fnErr      error
+		wantExists bool
+		wantCount  int64
+	}{
+		{"Commits metadata and directories", nil, true, 1},
+		{"Rolls back metadata and directories on error", errors.New("mock error"), false, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := NewDatabase(":memory:", 1)
+			db.Connect(context.Background())
+			defer db.Close()
+
+			if err := db.Setup(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := db.CreateTables(); err != nil {
+				t.Fatal(err)
+			}
+
+			transactor := NewTransactor(db)
+			obj := &model.Metadata{Bucket: "mock", Name: "mock-1/file1", Size: 1, StorageClass: "STANDARD", Created: time.Now(), Updated: time.Now()}
+
+			err := transactor.WithinTx(context.Background(), func(ctx context.Context, repos Repositories) error {
+				if err := repos.Metadata.Insert(ctx, paths.Default, obj); err != nil {
+					return err
+				}
+				if err := repos.Directory.UpsertParentDirs(ctx, paths.Default, StorageStandard, obj.Bucket, obj.Name, obj.Size, 1); err != nil {
+					return err
+				}
+				return tc.fnErr
+			})
+			if err != tc.fnErr {
+				t.Fatalf("WithinTx error mismatch: got %v, want %v", err, tc.fnErr)
+			}
+
+			_, err = NewMetadataRepository(db).Get(context.Background(), obj.Bucket, obj.Name)
+			if exists := err == nil; exists != tc.wantExists {
+				t.Errorf("Metadata existence mismatch: got %t, want %t (%v)", exists, tc.wantExists, err)
+			}
+
+			var gotCount int64
+			if err := db.QueryRow(`SELECT count FROM directory WHERE name = '/'`).Scan(&gotCount); err != nil && err != sql.ErrNoRows {
+				t.Fatal(err)
+			}
+
+			if gotCount != tc.wantCount {
+				t.Errorf("Root directory count mismatch: got %d, want %d", gotCount, tc.wantCount)
+			}
+		})
+	}
+}
+
+func TestWithinTxRetry(t *testing.T) {
+	testCases := []struct {
+		name         string
+		errs         []error
+		wantErr      bool
+		wantAttempts int
+	}{
+		{"Retries busy database", []error{sqlite3.Error{Code: sqlite3.ErrBusy}, nil}, false, 2},
+		{"Retries locked database", []error{sqlite3.Error{Code: sqlite3.ErrLocked}, sqlite3.Error{Code: sqlite3.ErrBusy}, nil}, false, 3},
+		{"Surfaces other errors", []error{sqlite3.Error{Code: sqlite3.ErrConstraint}, nil}, true, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := NewDatabase(":memory:", 1)
+			db.Connect(context.Background())
+			defer db.Close()
+
+			if err := db.Setup(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := db.CreateTables(); err != nil {
+				t.Fatal(err)
+			}
+
+			var attempts int
+			err := NewTransactor(db).WithinTx(context.Background(), func(ctx context.Context, repos Repositories) error {
+				if err := repos.Checkpoint.Set(ctx, "mock", "file1"); err != nil {
+					return err
+				}
+
+				err := tc.errs[attempts]
+				attempts++
+				return err
+			})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("WithinTx error mismatch: got %v, want error %t", err, tc.wantErr)
+			}
+
+			if attempts != tc.wantAttempts {
+				t.Errorf("Attempts mismatch: got %d, want %d", attempts, tc.wantAttempts)
+			}
+
+			// Only the successful attempt is committed
+			lastObject, err := NewCheckpointRepository(db).Get(context.Background(), "mock")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := map[bool]string{false: "file1", true: ""}[tc.wantErr]; lastObject != want {
+				t.Errorf("Checkpoint mismatch: got %q, want %q", lastObject, want)
+			}
+		})
+	}
+}
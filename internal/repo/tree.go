@@ -0,0 +1,210 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// MaxTreeDepth bounds the depth of GetTree
+const MaxTreeDepth = 10
+
+// otherNodeName names the node merging small siblings
+const otherNodeName = "other"
+
+type TreeOptions struct {
+	// Depth is the number of directory levels below the path, from 1 to MaxTreeDepth
+	Depth int
+	// MinFraction merges siblings smaller than this fraction of the path's size into an "other" node
+	MinFraction float64
+}
+
+type Tree struct {
+	*Database
+}
+
+type TreeRepository interface {
+	GetTree(ctx context.Context, bucket, path string, opts TreeOptions) (*model.TreeNode, error)
+}
+
+func NewTreeRepository(db *Database) TreeRepository {
+	return &Tree{db}
+}
+
+// GetTree returns the directories below a path down to a depth, largest first.
+// Directories of the same name are merged across buckets if bucket is empty.
+// A path that does not exist returns an empty node.
+func (t *Tree) GetTree(ctx context.Context, bucket, path string, opts TreeOptions) (_ *model.TreeNode, err error) {
+	ctx, span := tracing.Start(ctx, "Tree.GetTree",
+		attribute.String("bucket", bucket),
+		attribute.String("path", path),
+		attribute.Int("depth", opts.Depth),
+		attribute.Float64("minFraction", opts.MinFraction))
+	defer tracing.End(span, &err)
+
+	if opts.Depth < 1 || opts.Depth > MaxTreeDepth {
+		return nil, fmt.Errorf("invalid tree depth %d", opts.Depth)
+	}
+
+	if opts.MinFraction < 0 || opts.MinFraction >= 1 {
+		return nil, fmt.Errorf("invalid tree fraction %v", opts.MinFraction)
+	}
+
+	if path == "" {
+		path = paths.Root
+	}
+
+	sep, err := separator(ctx, t.DB, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	// Depth of a directory is the number of delimiters after the prefix, plus one for
+	// names under the root starting with the delimiter. It is checked exactly once
+	// parents are known. Names are ordered so that every parent is read before its children.
+	prefix := paths.Prefix(path)
+	maxDelimiters := opts.Depth
+	if prefix == "" {
+		maxDelimiters++
+	}
+
+	// Directories are priced at the location of their bucket before being merged
+	query, args, err := sqlx.Named(fmt.Sprintf(`
+		SELECT
+			name,
+			SUM(count) AS count,
+			SUM(size_standard) AS size_standard,
+			SUM(size_nearline) AS size_nearline,
+			SUM(size_coldline) AS size_coldline,
+			SUM(size_archive) AS size_archive,
+			SUM(%s) AS cost_standard,
+			SUM(%s) AS cost_nearline,
+			SUM(%s) AS cost_coldline,
+			SUM(%s) AS cost_archive
+		FROM directory
+		WHERE
+			name >= :prefix AND name < :upper AND
+			(:bucket = '' OR bucket = :bucket) AND
+			(name = :path OR
+				LENGTH(SUBSTR(name, LENGTH(:prefix) + 1)) -
+				LENGTH(REPLACE(SUBSTR(name, LENGTH(:prefix) + 1), :delimiter, '')) <= :maxDelimiters)
+		GROUP BY name
+		ORDER BY name;
+	`,
+		bucketCostSQL("directory", classCostSQL(StorageStandard)),
+		bucketCostSQL("directory", classCostSQL(StorageNearline)),
+		bucketCostSQL("directory", classCostSQL(StorageColdline)),
+		bucketCostSQL("directory", classCostSQL(StorageArchive))), map[string]any{
+		"path":          path,
+		"prefix":        prefix,
+		"upper":         prefix + prefixUpperBound,
+		"bucket":        bucket,
+		"delimiter":     sep.Delimiter(),
+		"maxDelimiters": maxDelimiters,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type treeRow struct {
+		Name         string  `db:"name"`
+		Count        int64   `db:"count"`
+		SizeStandard int64   `db:"size_standard"`
+		SizeNearline int64   `db:"size_nearline"`
+		SizeColdline int64   `db:"size_coldline"`
+		SizeArchive  int64   `db:"size_archive"`
+		CostStandard float64 `db:"cost_standard"`
+		CostNearline float64 `db:"cost_nearline"`
+		CostColdline float64 `db:"cost_coldline"`
+		CostArchive  float64 `db:"cost_archive"`
+	}
+
+	rows, err := t.DB.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	root := &model.TreeNode{Name: sep.Base(path), Path: path}
+	nodes := map[string]*model.TreeNode{path: root}
+	depths := map[string]int{path: 0}
+
+	for rows.Next() {
+		var row treeRow
+		if err := rows.StructScan(&row); err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+
+		node := nodes[row.Name]
+		if node == nil {
+			parentName := sep.Parent(row.Name)
+			parent, ok := nodes[parentName]
+			if !ok {
+				// Ancestors are always upserted together, skip orphans of an inconsistent tree
+				continue
+			}
+
+			if depths[parentName] == opts.Depth {
+				continue
+			}
+
+			node = &model.TreeNode{Name: sep.Base(row.Name), Path: row.Name}
+			parent.Children = append(parent.Children, node)
+			nodes[row.Name] = node
+			depths[row.Name] = depths[parentName] + 1
+		}
+
+		node.Count = row.Count
+		node.Size = model.Size{
+			Standard: row.SizeStandard,
+			Nearline: row.SizeNearline,
+			Coldline: row.SizeColdline,
+			Archive:  row.SizeArchive,
+		}
+		node.TotalSize = row.SizeStandard + row.SizeNearline + row.SizeColdline + row.SizeArchive
+		node.Cost = model.Cost{
+			Standard: row.CostStandard,
+			Nearline: row.CostNearline,
+			Coldline: row.CostColdline,
+			Archive:  row.CostArchive,
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	collapseTree(root, int64(opts.MinFraction*float64(root.TotalSize)))
+	return root, nil
+}
+
+// collapseTree orders children by size and merges those smaller than minSize into an "other" node.
+// A single small child is kept as is since merging it would hide its name for no gain.
+func collapseTree(node *model.TreeNode, minSize int64) {
+	sort.SliceStable(node.Children, func(i, j int) bool {
+		return node.Children[i].TotalSize > node.Children[j].TotalSize
+	})
+
+	// Children are ordered by size, so small children are the last ones
+	keep := len(node.Children)
+	for keep > 0 && node.Children[keep-1].TotalSize < minSize {
+		keep--
+	}
+
+	if len(node.Children)-keep > 1 {
+		other := &model.TreeNode{Name: otherNodeName, Other: true}
+		for _, child := range node.Children[keep:] {
+			other.Add(child)
+		}
+		node.Children = append(node.Children[:keep], other)
+	}
+
+	for _, child := range node.Children {
+		collapseTree(child, minSize)
+	}
+}
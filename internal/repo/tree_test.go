@@ -0,0 +1,175 @@
+package repo
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
+)
+
+func TestGetTree(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	treeRepo := NewTreeRepository(db)
+	metadataRepo := NewMetadataRepository(db)
+	dirRepo := NewDirectoryRepository(db)
+
+	// Insert mock data
+	metadata := []model.Metadata{
+		{Bucket: "mock", Name: "big/file1", Size: 80 * bytesPerGB, StorageClass: "STANDARD"},
+		{Bucket: "mock", Name: "big/sub/file2", Size: 40 * bytesPerGB, StorageClass: "ARCHIVE"},
+		{Bucket: "mock", Name: "big/sub/deep/file3", Size: 10 * bytesPerGB, StorageClass: "ARCHIVE"},
+		{Bucket: "mock", Name: "small-1/file4", Size: 1 * bytesPerGB, StorageClass: "NEARLINE"},
+		{Bucket: "mock", Name: "small-2/file5", Size: 2 * bytesPerGB, StorageClass: "COLDLINE"},
+		{Bucket: "mock", Name: "medium/file6", Size: 17 * bytesPerGB, StorageClass: "STANDARD"},
+		{Bucket: "other", Name: "big/file7", Size: 50 * bytesPerGB, StorageClass: "STANDARD"},
+	}
+
+	for _, m := range metadata {
+		m.Created, m.Updated = time.Now(), time.Now()
+		if err := metadataRepo.Insert(context.Background(), paths.Default, &m); err != nil {
+			t.Fatal(err)
+		}
+		if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, StorageClass(m.StorageClass), m.Bucket, m.Name, m.Size, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// tree is a node and its children, by path or by name for other nodes
+	type tree struct {
+		name      string
+		totalSize int64
+		children  []tree
+	}
+
+	var toTree func(node *model.TreeNode) tree
+	toTree = func(node *model.TreeNode) tree {
+		name := node.Path
+		if node.Other {
+			name = node.Name
+		}
+
+		got := tree{name: name, totalSize: node.TotalSize / bytesPerGB}
+		for _, child := range node.Children {
+			got.children = append(got.children, toTree(child))
+		}
+		return got
+	}
+
+	testCases := []struct {
+		name    string
+		bucket  string
+		path    string
+		opts    TreeOptions
+		want    tree
+		wantErr bool
+	}{
+		{"Root of one level", "mock", "/", TreeOptions{Depth: 1}, tree{"/", 150, []tree{
+			{"big/", 130, nil}, {"medium/", 17, nil}, {"small-2/", 2, nil}, {"small-1/", 1, nil},
+		}}, false},
+		{"Collapses small siblings", "mock", "/", TreeOptions{Depth: 1, MinFraction: 0.05}, tree{"/", 150, []tree{
+			{"big/", 130, nil}, {"medium/", 17, nil}, {"other", 3, nil},
+		}}, false},
+		{"Keeps single small sibling", "mock", "/", TreeOptions{Depth: 1, MinFraction: 0.01}, tree{"/", 150, []tree{
+			{"big/", 130, nil}, {"medium/", 17, nil}, {"small-2/", 2, nil}, {"small-1/", 1, nil},
+		}}, false},
+		{"Nested subtree", "mock", "big/", TreeOptions{Depth: 2}, tree{"big/", 130, []tree{
+			{"big/sub/", 50, []tree{{"big/sub/deep/", 10, nil}}},
+		}}, false},
+		{"Limits depth of subtree", "mock", "big/", TreeOptions{Depth: 1}, tree{"big/", 130, []tree{
+			{"big/sub/", 50, nil},
+		}}, false},
+		{"Merges buckets", "", "big/", TreeOptions{Depth: 1}, tree{"big/", 180, []tree{
+			{"big/sub/", 50, nil},
+		}}, false},
+		{"Returns empty node for non-existent directory", "", "non-existent/", TreeOptions{Depth: 1}, tree{"non-existent/", 0, nil}, false},
+		{"Returns error for zero depth", "", "/", TreeOptions{Depth: 0}, tree{}, true},
+		{"Returns error for depth over maximum", "", "/", TreeOptions{Depth: MaxTreeDepth + 1}, tree{}, true},
+		{"Returns error for invalid fraction", "", "/", TreeOptions{Depth: 1, MinFraction: 1}, tree{}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := treeRepo.GetTree(context.Background(), tc.bucket, tc.path, tc.opts)
+			if err != nil {
+				if tc.wantErr {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.wantErr {
+				t.Fatal("Expected error, got nil")
+			}
+
+			if gotTree := toTree(got); !reflect.DeepEqual(gotTree, tc.want) {
+				t.Errorf("Tree mismatch: got %+v, want %+v", gotTree, tc.want)
+			}
+		})
+	}
+}
+
+func TestGetTreeOther(t *testing.T) {
+	db := NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	dirRepo := NewDirectoryRepository(db)
+	for _, m := range []struct {
+		class StorageClass
+		name  string
+		size  int64
+	}{
+		{StorageStandard, "a/b/file1", 10 * bytesPerGB},
+		{StorageArchive, "a/c/file2", 4 * bytesPerGB},
+		{StorageNearline, "a/d/file3", 1 * bytesPerGB},
+	} {
+		if err := dirRepo.UpsertParentDirs(context.Background(), paths.Default, m.class, "mock", m.name, m.size, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := NewTreeRepository(db).GetTree(context.Background(), "mock", "a/", TreeOptions{Depth: 1, MinFraction: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &model.TreeNode{
+		Name:      "other",
+		Other:     true,
+		TotalSize: 5 * bytesPerGB,
+		Count:     2,
+		Size:      model.Size{Nearline: 1 * bytesPerGB, Archive: 4 * bytesPerGB},
+		Cost:      model.Cost{Nearline: 0.016, Archive: 0.01},
+	}
+
+	if len(got.Children) != 2 {
+		t.Fatalf("Children mismatch: got %d, want 2", len(got.Children))
+	}
+	if !reflect.DeepEqual(got.Children[1], want) {
+		t.Errorf("Other node mismatch: got %+v, want %+v", got.Children[1], want)
+	}
+	if got.Count != 3 || got.TotalSize != 15*bytesPerGB {
+		t.Errorf("Total mismatch: got count %d and size %d, want 3 and %d", got.Count, got.TotalSize, 15*bytesPerGB)
+	}
+}
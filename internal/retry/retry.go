@@ -0,0 +1,104 @@
+// Package retry retries operations failing with transient errors of
+// Cloud Storage or the database, using exponential backoff with jitter.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/metrics"
+	"github.com/mattn/go-sqlite3"
+	"google.golang.org/api/googleapi"
+)
+
+// Policy configures how many times and how long apart an operation is attempted
+type Policy struct {
+	// MaxAttempts is the number of attempts including the first, at least 1
+	MaxAttempts int
+	// InitialDelay is the delay before the first retry
+	InitialDelay time.Duration
+	// MaxDelay caps the delay between attempts
+	MaxDelay time.Duration
+	// Multiplier grows the delay after each retry
+	Multiplier float64
+}
+
+// DefaultPolicy attempts an operation up to 5 times over about 3 seconds
+var DefaultPolicy = Policy{
+	MaxAttempts:  5,
+	InitialDelay: 200 * time.Millisecond,
+	MaxDelay:     5 * time.Second,
+	Multiplier:   2,
+}
+
+// delay returns the delay before retry n, starting at 0. Each delay is picked at random
+// between half and all of the exponential delay so that concurrent callers spread out.
+func (p Policy) delay(n int) time.Duration {
+	d := float64(p.InitialDelay)
+	for i := 0; i < n && d < float64(p.MaxDelay); i++ {
+		d *= p.Multiplier
+	}
+	d = min(d, float64(p.MaxDelay))
+
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(d/2 + rand.Float64()*d/2)
+}
+
+// Do runs fn until it succeeds, fails with an error that is not retryable or has been
+// attempted policy.MaxAttempts times. It returns the last error of fn, also if ctx is
+// done while waiting for the next attempt. Retries are counted by operation.
+func Do(ctx context.Context, policy Policy, operation string, fn func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || !IsRetryable(err) || attempt+1 >= policy.MaxAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(policy.delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		metrics.Retries.WithLabelValues(operation).Inc()
+	}
+}
+
+// statusError is implemented by errors of other HTTP APIs reporting their status code
+type statusError interface {
+	HTTPStatus() int
+}
+
+// IsRetryable reports whether err is transient: an error of Cloud Storage or
+// another HTTP API with status 429 or 5xx, or a busy or locked database
+func IsRetryable(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return isRetryableStatus(apiErr.Code)
+	}
+
+	var statusErr statusError
+	if errors.As(err, &statusErr) {
+		return isRetryableStatus(statusErr.HTTPStatus())
+	}
+	return IsLockError(err)
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// IsLockError reports whether err is caused by a busy or locked database
+func IsLockError(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
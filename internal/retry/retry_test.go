@@ -0,0 +1,145 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"google.golang.org/api/googleapi"
+)
+
+var testPolicy = Policy{
+	MaxAttempts:  3,
+	InitialDelay: time.Millisecond,
+	MaxDelay:     2 * time.Millisecond,
+	Multiplier:   2,
+}
+
+func TestDo(t *testing.T) {
+	retryable := &googleapi.Error{Code: http.StatusServiceUnavailable}
+	permanent := &googleapi.Error{Code: http.StatusNotFound}
+
+	testCases := []struct {
+		name         string
+		errs         []error
+		wantErr      error
+		wantAttempts int
+	}{
+		{"Succeeds at first attempt", []error{nil}, nil, 1},
+		{"Succeeds after retries", []error{retryable, retryable, nil}, nil, 3},
+		{"Fails after max attempts", []error{retryable, retryable, retryable, nil}, retryable, 3},
+		{"Fails immediately on permanent error", []error{permanent, nil}, permanent, 1},
+		{"Fails on permanent error after retry", []error{retryable, permanent, nil}, permanent, 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var attempts int
+			err := Do(context.Background(), testPolicy, "mock", func(ctx context.Context) error {
+				err := tc.errs[attempts]
+				attempts++
+				return err
+			})
+
+			if err != tc.wantErr {
+				t.Errorf("Error mismatch: got %v, want %v", err, tc.wantErr)
+			}
+
+			if attempts != tc.wantAttempts {
+				t.Errorf("Attempts mismatch: got %d, want %d", attempts, tc.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestDoCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	retryable := &googleapi.Error{Code: http.StatusTooManyRequests}
+
+	// Waiting for the next attempt stops once ctx is cancelled
+	policy := Policy{MaxAttempts: 3, InitialDelay: time.Hour, MaxDelay: time.Hour, Multiplier: 2}
+
+	var attempts int
+	err := Do(ctx, policy, "mock", func(ctx context.Context) error {
+		attempts++
+		cancel()
+		return retryable
+	})
+
+	if err != retryable || attempts != 1 {
+		t.Errorf("Result mismatch: got %v after %d attempts, want %v after 1", err, attempts, retryable)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"Retries too many requests", &googleapi.Error{Code: http.StatusTooManyRequests}, true},
+		{"Retries internal error", &googleapi.Error{Code: http.StatusInternalServerError}, true},
+		{"Retries bad gateway", &googleapi.Error{Code: http.StatusBadGateway}, true},
+		{"Retries wrapped error", fmt.Errorf("mock: %w", &googleapi.Error{Code: http.StatusServiceUnavailable}), true},
+		{"Retries unavailable HTTP API", &mockStatusError{http.StatusServiceUnavailable}, true},
+		{"Surfaces missing HTTP resource", &mockStatusError{http.StatusNotFound}, false},
+		{"Retries busy database", sqlite3.Error{Code: sqlite3.ErrBusy}, true},
+		{"Retries locked database", fmt.Errorf("mock: %w", sqlite3.Error{Code: sqlite3.ErrLocked}), true},
+		{"Surfaces not found", &googleapi.Error{Code: http.StatusNotFound}, false},
+		{"Surfaces forbidden", &googleapi.Error{Code: http.StatusForbidden}, false},
+		{"Surfaces constraint violation", sqlite3.Error{Code: sqlite3.ErrConstraint}, false},
+		{"Surfaces other errors", errors.New("mock error"), false},
+		{"Surfaces cancellation", context.Canceled, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IsRetryable(tc.err); got != tc.want {
+				t.Errorf("IsRetryable mismatch: got %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+type mockStatusError struct {
+	status int
+}
+
+func (e *mockStatusError) Error() string {
+	return http.StatusText(e.status)
+}
+
+func (e *mockStatusError) HTTPStatus() int {
+	return e.status
+}
+
+func TestPolicyDelay(t *testing.T) {
+	policy := Policy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second, Multiplier: 2}
+
+	testCases := []struct {
+		retry int
+		want  time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{3, 800 * time.Millisecond},
+		{4, time.Second},
+		{100, time.Second},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.want.String(), func(t *testing.T) {
+			// Jitter keeps delays between half and all of the exponential delay
+			for i := 0; i < 100; i++ {
+				got := policy.delay(tc.retry)
+				if got < tc.want/2 || got > tc.want {
+					t.Fatalf("Delay mismatch: got %v, want between %v and %v", got, tc.want/2, tc.want)
+				}
+			}
+		})
+	}
+}
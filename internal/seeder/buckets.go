@@ -0,0 +1,154 @@
+package seeder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/logging"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/retry"
+	"google.golang.org/api/iterator"
+)
+
+// ListBuckets returns the sorted unique names of all buckets of the projects.
+// Listing a project starts over if it fails with a transient error.
+func ListBuckets(ctx context.Context, client *storage.Client, projectIds []string) ([]string, error) {
+	var names []string
+	for _, projectId := range projectIds {
+		projectNames, err := listProjectBuckets(ctx, client, projectId)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, projectNames...)
+	}
+
+	slices.Sort(names)
+	return slices.Compact(names), nil
+}
+
+// listProjectBuckets returns the names of all buckets of a project
+func listProjectBuckets(ctx context.Context, client *storage.Client, projectId string) ([]string, error) {
+	var names []string
+
+	err := retry.Do(ctx, retry.DefaultPolicy, "list_buckets", func(ctx context.Context) error {
+		names = nil
+
+		it := client.Buckets(ctx, projectId)
+		for {
+			attrs, err := it.Next()
+			if err == iterator.Done {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			names = append(names, attrs.Name)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing buckets of project %s: %w", projectId, err)
+	}
+	return names, nil
+}
+
+// FilterBuckets returns the sorted unique names matching any include pattern and no exclude pattern.
+// All names are included if there are no include patterns. Patterns use the syntax of path.Match.
+func FilterBuckets(names, include, exclude []string) ([]string, error) {
+	for _, pattern := range slices.Concat(include, exclude) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid bucket pattern %q: %w", pattern, err)
+		}
+	}
+
+	matchAny := func(patterns []string, name string) bool {
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, name); matched {
+				return true
+			}
+		}
+		return false
+	}
+
+	var filtered []string
+	for _, name := range names {
+		if len(include) > 0 && !matchAny(include, name) {
+			continue
+		}
+		if matchAny(exclude, name) {
+			continue
+		}
+		filtered = append(filtered, name)
+	}
+
+	slices.Sort(filtered)
+	return slices.Compact(filtered), nil
+}
+
+// SeedBuckets calls seed for every bucket, running at most concurrency calls at a time.
+//
+// A failed bucket does not stop the others, all failures are returned together once every
+// bucket has been seeded. Once ctx is cancelled no more buckets are started and ErrInterrupted
+// is returned along with any failures.
+func SeedBuckets(ctx context.Context, buckets []string, concurrency int, seed func(ctx context.Context, bucket string) error, logger *slog.Logger) error {
+	if concurrency < 1 {
+		return fmt.Errorf("invalid concurrency %d", concurrency)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failures []error
+	)
+
+	sem := make(chan struct{}, concurrency)
+	for _, bucket := range buckets {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			logger.Info("Seeding bucket", logging.KeyBucket, bucket)
+			if err := seed(ctx, bucket); err != nil {
+				if errors.Is(err, ErrInterrupted) {
+					logger.Warn("Seeding bucket interrupted", logging.KeyBucket, bucket)
+					return
+				}
+
+				logger.Error("Error seeding bucket", logging.KeyBucket, bucket, logging.KeyError, err)
+				mu.Lock()
+				failures = append(failures, fmt.Errorf("bucket %s: %w", bucket, err))
+				mu.Unlock()
+				return
+			}
+			logger.Info("Seeded bucket", logging.KeyBucket, bucket)
+		}()
+	}
+	wg.Wait()
+
+	var err error
+	if len(failures) > 0 {
+		slices.SortFunc(failures, func(a, b error) int {
+			return strings.Compare(a.Error(), b.Error())
+		})
+		err = fmt.Errorf("seeding failed for %d of %d buckets: %w", len(failures), len(buckets), errors.Join(failures...))
+	}
+
+	if ctx.Err() != nil {
+		return errors.Join(ErrInterrupted, err)
+	}
+	return err
+}
@@ -0,0 +1,201 @@
+package seeder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+func TestListBuckets(t *testing.T) {
+	projects := map[string][]string{
+		"project-1": {"prod-logs", "prod-data"},
+		"project-2": {"staging-data"},
+	}
+
+	// Serves the bucket listing of the Cloud Storage JSON API
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var items []map[string]string
+		for _, name := range projects[r.URL.Query().Get("project")] {
+			items = append(items, map[string]string{"name": name})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"kind": "storage#buckets", "items": items})
+	}))
+	defer server.Close()
+
+	client, err := storage.NewClient(context.Background(), option.WithEndpoint(server.URL+"/storage/v1/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	testCases := []struct {
+		name       string
+		projectIds []string
+		want       []string
+	}{
+		{"Lists buckets of a project", []string{"project-2"}, []string{"staging-data"}},
+		{"Lists sorted buckets of all projects", []string{"project-1", "project-2"}, []string{"prod-data", "prod-logs", "staging-data"}},
+		{"Deduplicates repeated projects", []string{"project-2", "project-2"}, []string{"staging-data"}},
+		{"Lists nothing for projects without buckets", []string{"project-3"}, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ListBuckets(context.Background(), client, tc.projectIds)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("Buckets mismatch: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFilterBuckets(t *testing.T) {
+	names := []string{"prod-logs", "prod-data", "staging-data", "prod-data", "tmp"}
+
+	testCases := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    []string
+		wantErr bool
+	}{
+		{"Sorts and deduplicates all names", nil, nil, []string{"prod-data", "prod-logs", "staging-data", "tmp"}, false},
+		{"Includes matching names", []string{"prod-*"}, nil, []string{"prod-data", "prod-logs"}, false},
+		{"Includes names matching any pattern", []string{"prod-*", "tmp"}, nil, []string{"prod-data", "prod-logs", "tmp"}, false},
+		{"Excludes matching names", nil, []string{"*-data"}, []string{"prod-logs", "tmp"}, false},
+		{"Excludes after including", []string{"prod-*"}, []string{"*-logs"}, []string{"prod-data"}, false},
+		{"Returns nothing without matches", []string{"dev-*"}, nil, nil, false},
+		{"Returns error for invalid pattern", []string{"prod-["}, nil, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := FilterBuckets(names, tc.include, tc.exclude)
+			if err != nil {
+				if tc.wantErr {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.wantErr {
+				t.Fatal("Expected error, got nil")
+			}
+
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("Buckets mismatch: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSeedBuckets(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	buckets := []string{"mock-1", "mock-2", "mock-3", "mock-4", "mock-5"}
+
+	t.Run("Seeds all buckets within concurrency", func(t *testing.T) {
+		var (
+			mu            sync.Mutex
+			seeded        []string
+			running, peak atomic.Int32
+		)
+
+		seed := func(ctx context.Context, bucket string) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+
+			mu.Lock()
+			seeded = append(seeded, bucket)
+			mu.Unlock()
+			return nil
+		}
+
+		if err := SeedBuckets(context.Background(), buckets, 2, seed, logger); err != nil {
+			t.Fatal(err)
+		}
+
+		slices.Sort(seeded)
+		if !slices.Equal(seeded, buckets) {
+			t.Errorf("Seeded buckets mismatch: got %v, want %v", seeded, buckets)
+		}
+
+		if peak.Load() > 2 {
+			t.Errorf("Concurrency mismatch: got %d, want at most 2", peak.Load())
+		}
+	})
+
+	t.Run("Seeds remaining buckets after failures", func(t *testing.T) {
+		var seeded atomic.Int32
+		seed := func(ctx context.Context, bucket string) error {
+			seeded.Add(1)
+			if bucket == "mock-2" || bucket == "mock-4" {
+				return errors.New("mock error")
+			}
+			return nil
+		}
+
+		err := SeedBuckets(context.Background(), buckets, 3, seed, logger)
+		if err == nil {
+			t.Fatal("Expected error, got nil")
+		}
+
+		want := "seeding failed for 2 of 5 buckets: bucket mock-2: mock error\nbucket mock-4: mock error"
+		if err.Error() != want {
+			t.Errorf("Error mismatch: got %q, want %q", err, want)
+		}
+
+		if errors.Is(err, ErrInterrupted) {
+			t.Error("Error mismatch: got interrupted")
+		}
+
+		if seeded.Load() != int32(len(buckets)) {
+			t.Errorf("Seeded buckets mismatch: got %d, want %d", seeded.Load(), len(buckets))
+		}
+	})
+
+	t.Run("Stops starting buckets once interrupted", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var seeded atomic.Int32
+		seed := func(ctx context.Context, bucket string) error {
+			seeded.Add(1)
+			cancel()
+			return ErrInterrupted
+		}
+
+		err := SeedBuckets(ctx, buckets, 1, seed, logger)
+		if !errors.Is(err, ErrInterrupted) {
+			t.Fatalf("Error mismatch: got %v, want %v", err, ErrInterrupted)
+		}
+
+		if seeded.Load() != 1 {
+			t.Errorf("Seeded buckets mismatch: got %d, want 1", seeded.Load())
+		}
+	})
+
+	t.Run("Returns error for invalid concurrency", func(t *testing.T) {
+		if err := SeedBuckets(context.Background(), buckets, 0, nil, logger); err == nil {
+			t.Fatal("Expected error, got nil")
+		}
+	})
+}
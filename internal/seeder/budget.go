@@ -0,0 +1,83 @@
+package seeder
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrErrorBudgetExceeded is returned when more objects fail to be seeded than the error policy allows
+var ErrErrorBudgetExceeded = errors.New("error budget exceeded")
+
+// minErrorRatioObjects is the number of objects processed before the error ratio is
+// checked during listing, so that a few early failures do not stop seeding
+const minErrorRatioObjects = 1000
+
+// ErrorPolicy limits the objects that may fail to be seeded from a bucket.
+// A zero ErrorPolicy allows any number of failures.
+type ErrorPolicy struct {
+	// FailFast stops seeding at the first failure
+	FailFast bool
+	// MaxErrors is the number of failures allowed, unlimited if 0
+	MaxErrors int64
+	// MaxErrorRatio is the fraction of processed objects allowed to fail, unlimited if 0
+	MaxErrorRatio float64
+}
+
+// Validate returns an error if the limits of the policy are out of range
+func (p ErrorPolicy) Validate() error {
+	if p.MaxErrors < 0 {
+		return fmt.Errorf("max errors %d must not be negative", p.MaxErrors)
+	}
+
+	if p.MaxErrorRatio < 0 || p.MaxErrorRatio >= 1 {
+		return fmt.Errorf("max error ratio %g must be in [0, 1)", p.MaxErrorRatio)
+	}
+	return nil
+}
+
+// errorBudget counts the objects processed during a seeding against its error policy
+type errorBudget struct {
+	policy    ErrorPolicy
+	processed int64
+	failed    int64
+}
+
+// add counts an object, failed by err if not nil, and returns
+// ErrErrorBudgetExceeded once the policy no longer allows failures
+func (b *errorBudget) add(name string, err error) error {
+	b.processed++
+	if err == nil {
+		return b.checkRatio(minErrorRatioObjects)
+	}
+	b.failed++
+
+	switch {
+	case b.policy.FailFast:
+		return b.exceeded(fmt.Sprintf("failing fast on %s: %v", name, err))
+	case b.policy.MaxErrors > 0 && b.failed > b.policy.MaxErrors:
+		return b.exceeded(fmt.Sprintf("more than %d allowed, last on %s: %v", b.policy.MaxErrors, name, err))
+	}
+	return b.checkRatio(minErrorRatioObjects)
+}
+
+// done checks the error ratio over all objects once listing completes
+func (b *errorBudget) done() error {
+	return b.checkRatio(0)
+}
+
+// checkRatio returns ErrErrorBudgetExceeded if at least minObjects have been processed
+// and the ratio of failures is above the policy
+func (b *errorBudget) checkRatio(minObjects int64) error {
+	if b.policy.MaxErrorRatio == 0 || b.failed == 0 || b.processed < minObjects {
+		return nil
+	}
+
+	if ratio := float64(b.failed) / float64(b.processed); ratio > b.policy.MaxErrorRatio {
+		return b.exceeded(fmt.Sprintf("ratio %.4f above %g", ratio, b.policy.MaxErrorRatio))
+	}
+	return nil
+}
+
+func (b *errorBudget) exceeded(reason string) error {
+	return fmt.Errorf("%w: %d of %d objects failed, %s", ErrErrorBudgetExceeded, b.failed, b.processed, reason)
+}
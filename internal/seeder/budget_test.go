@@ -0,0 +1,101 @@
+package seeder
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestErrorBudget(t *testing.T) {
+	testCases := []struct {
+		name   string
+		policy ErrorPolicy
+		// results lists the objects processed in order, where true is a failure
+		results []bool
+		// wantAt is the index of the object at which the budget is exceeded, -1 if never
+		wantAt int
+		// wantDone is whether the budget is exceeded once listing completes
+		wantDone bool
+	}{
+		{"Allows any failure by default", ErrorPolicy{}, []bool{true, true, true}, -1, false},
+		{"Fails fast", ErrorPolicy{FailFast: true}, []bool{false, true, false}, 1, false},
+		{"Fails fast without failures", ErrorPolicy{FailFast: true}, []bool{false, false}, -1, false},
+		{"Allows max errors", ErrorPolicy{MaxErrors: 2}, []bool{true, false, true}, -1, false},
+		{"Exceeds max errors", ErrorPolicy{MaxErrors: 2}, []bool{true, true, false, true, true}, 3, false},
+		{"Checks ratio once listing completes", ErrorPolicy{MaxErrorRatio: 0.5}, []bool{true, true, false}, -1, true},
+		{"Allows ratio once listing completes", ErrorPolicy{MaxErrorRatio: 0.5}, []bool{true, false, false}, -1, false},
+		{"Allows ratio without failures", ErrorPolicy{MaxErrorRatio: 0.1}, []bool{false}, -1, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &errorBudget{policy: tc.policy}
+
+			gotAt := -1
+			for i, failed := range tc.results {
+				var err error
+				if failed {
+					err = errors.New("mock error")
+				}
+
+				if err := b.add("mock", err); err != nil {
+					if !errors.Is(err, ErrErrorBudgetExceeded) {
+						t.Fatalf("Error mismatch: got %v, want %v", err, ErrErrorBudgetExceeded)
+					}
+					gotAt = i
+					break
+				}
+			}
+
+			if gotAt != tc.wantAt {
+				t.Fatalf("Exceeded mismatch: got at object %d, want %d", gotAt, tc.wantAt)
+			}
+
+			if gotAt == -1 {
+				if err := b.done(); (err != nil) != tc.wantDone {
+					t.Errorf("Done mismatch: got %v, want exceeded %t", err, tc.wantDone)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorBudgetRatioDuringListing(t *testing.T) {
+	b := &errorBudget{policy: ErrorPolicy{MaxErrorRatio: 0.1}}
+
+	// Failures are tolerated until enough objects have been processed
+	for i := 0; i < minErrorRatioObjects-1; i++ {
+		var err error
+		if i%2 == 0 {
+			err = errors.New("mock error")
+		}
+		if err := b.add("mock", err); err != nil {
+			t.Fatalf("Exceeded at object %d before minimum: %v", i, err)
+		}
+	}
+
+	if err := b.add("mock", nil); !errors.Is(err, ErrErrorBudgetExceeded) {
+		t.Errorf("Error mismatch: got %v, want %v", err, ErrErrorBudgetExceeded)
+	}
+}
+
+func TestErrorPolicyValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		policy  ErrorPolicy
+		wantErr bool
+	}{
+		{"Accepts zero policy", ErrorPolicy{}, false},
+		{"Accepts limits", ErrorPolicy{FailFast: true, MaxErrors: 10, MaxErrorRatio: 0.01}, false},
+		{"Rejects negative max errors", ErrorPolicy{MaxErrors: -1}, true},
+		{"Rejects negative ratio", ErrorPolicy{MaxErrorRatio: -0.1}, true},
+		{"Rejects ratio of 1", ErrorPolicy{MaxErrorRatio: 1}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.policy.Validate(); (err != nil) != tc.wantErr {
+				t.Errorf("Error mismatch: got %v, want error %t", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package seeder
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+)
+
+// WriteFailedObjects writes the objects of buckets that failed to be seeded to a file,
+// one JSON object per line, and returns the number written
+func WriteFailedObjects(ctx context.Context, failedRepo repo.FailedObjectRepository, buckets []string, name string) (_ int, err error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	var written int
+	for _, bucket := range buckets {
+		failed, err := failedRepo.List(ctx, bucket)
+		if err != nil {
+			return written, fmt.Errorf("error listing failed objects of %s: %w", bucket, err)
+		}
+
+		for _, obj := range failed {
+			if err := enc.Encode(obj); err != nil {
+				return written, err
+			}
+			written++
+		}
+	}
+	return written, w.Flush()
+}
@@ -0,0 +1,85 @@
+package seeder
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+)
+
+type listFailedObjectRepository struct {
+	repo.FailedObjectRepository
+	failed map[string][]*model.FailedObject
+}
+
+func (f *listFailedObjectRepository) List(ctx context.Context, bucket string) ([]*model.FailedObject, error) {
+	return f.failed[bucket], nil
+}
+
+func TestWriteFailedObjects(t *testing.T) {
+	now := time.Now().UTC()
+	failedRepo := &listFailedObjectRepository{
+		failed: map[string][]*model.FailedObject{
+			"mock-1": {
+				{Bucket: "mock-1", Name: "dir/file1", Error: "mock error", Failed: now},
+				{Bucket: "mock-1", Name: "file2", Error: "mock error", Failed: now},
+			},
+			"mock-2": {
+				{Bucket: "mock-2", Name: "file1", Error: "other error", Failed: now},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name    string
+		buckets []string
+		want    []string
+	}{
+		{"Writes failures of all buckets", []string{"mock-1", "mock-2"}, []string{"mock-1/dir/file1", "mock-1/file2", "mock-2/file1"}},
+		{"Writes failures of given buckets", []string{"mock-2"}, []string{"mock-2/file1"}},
+		{"Writes empty file without failures", []string{"mock-3"}, []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "failed.jsonl")
+
+			written, err := WriteFailedObjects(context.Background(), failedRepo, tc.buckets, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if written != len(tc.want) {
+				t.Errorf("Written mismatch: got %d, want %d", written, len(tc.want))
+			}
+
+			data, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []string{}
+			for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+				if line == "" {
+					continue
+				}
+
+				var obj model.FailedObject
+				if err := json.Unmarshal([]byte(line), &obj); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, obj.Bucket+"/"+obj.Name)
+			}
+
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("Failed objects mismatch: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
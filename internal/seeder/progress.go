@@ -0,0 +1,317 @@
+package seeder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+)
+
+// ClassTotals counts the objects and bytes of a storage class
+type ClassTotals struct {
+	Objects int64 `json:"objects"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// BucketReport is the progress of seeding one bucket
+type BucketReport struct {
+	Bucket string            `json:"bucket"`
+	Status repo.BucketStatus `json:"status"`
+	Error  string            `json:"error,omitempty"`
+	// EstimatedObjects is the number of objects expected to be listed, 0 if unknown
+	EstimatedObjects int64                  `json:"estimatedObjects,omitempty"`
+	Objects          int64                  `json:"objects"`
+	Bytes            int64                  `json:"bytes"`
+	Failed           int64                  `json:"failed"`
+	Classes          map[string]ClassTotals `json:"classes"`
+	Started          *time.Time             `json:"started,omitempty"`
+	Finished         *time.Time             `json:"finished,omitempty"`
+}
+
+// Report is the progress of a seeding run over all its buckets
+type Report struct {
+	DryRun          bool                   `json:"dryRun"`
+	Started         time.Time              `json:"started"`
+	Finished        *time.Time             `json:"finished,omitempty"`
+	DurationSeconds float64                `json:"durationSeconds"`
+	Objects         int64                  `json:"objects"`
+	Bytes           int64                  `json:"bytes"`
+	Failed          int64                  `json:"failed"`
+	Classes         map[string]ClassTotals `json:"classes"`
+	Buckets         []*BucketReport        `json:"buckets"`
+}
+
+// completed returns the number of buckets seeded successfully
+func (r *Report) completed() int {
+	var completed int
+	for _, b := range r.Buckets {
+		if b.Status == repo.BucketCompleted {
+			completed++
+		}
+	}
+	return completed
+}
+
+// Progress accumulates the objects listed from every bucket of a run.
+// It is safe for concurrent use, and a nil Progress discards everything.
+type Progress struct {
+	mu        sync.Mutex
+	dryRun    bool
+	started   time.Time
+	finished  time.Time
+	estimated int64
+	buckets   map[string]*BucketReport
+	order     []string
+}
+
+// NewProgress returns the progress of a run starting now.
+// A positive estimatedObjects overrides the estimates of individual buckets.
+func NewProgress(dryRun bool, estimatedObjects int64) *Progress {
+	return &Progress{
+		dryRun:    dryRun,
+		started:   time.Now(),
+		estimated: estimatedObjects,
+		buckets:   map[string]*BucketReport{},
+	}
+}
+
+// bucket returns the report of a bucket, adding a pending one if missing. p.mu must be held.
+func (p *Progress) bucket(name string) *BucketReport {
+	b, ok := p.buckets[name]
+	if !ok {
+		b = &BucketReport{Bucket: name, Status: repo.BucketPending, Classes: map[string]ClassTotals{}}
+		p.buckets[name] = b
+		p.order = append(p.order, name)
+	}
+	return b
+}
+
+// Register adds a bucket pending seeding with its estimated number of objects, 0 if unknown
+func (p *Progress) Register(bucket string, estimatedObjects int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.bucket(bucket).EstimatedObjects = estimatedObjects
+}
+
+// Start marks a bucket as being seeded
+func (p *Progress) Start(bucket string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	b := p.bucket(bucket)
+	b.Status = repo.BucketSeeding
+	b.Started = &now
+}
+
+// Add counts an object listed from a bucket
+func (p *Progress) Add(bucket, storageClass string, size int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b := p.bucket(bucket)
+	b.Objects++
+	b.Bytes += size
+
+	class := b.Classes[storageClass]
+	class.Objects++
+	class.Bytes += size
+	b.Classes[storageClass] = class
+}
+
+// Fail counts an object of a bucket that could not be seeded
+func (p *Progress) Fail(bucket string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.bucket(bucket).Failed++
+}
+
+// Finish marks a bucket as seeded, failed by err or interrupted
+func (p *Progress) Finish(bucket string, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	b := p.bucket(bucket)
+	b.Finished = &now
+
+	switch {
+	case errors.Is(err, ErrInterrupted):
+		b.Status = repo.BucketInterrupted
+	case err != nil:
+		b.Status = repo.BucketFailed
+		b.Error = err.Error()
+	default:
+		b.Status = repo.BucketCompleted
+	}
+}
+
+// Close marks the end of the run
+func (p *Progress) Close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.finished = time.Now()
+}
+
+// Report returns a snapshot of the progress of all buckets in the order they were added
+func (p *Progress) Report() *Report {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	end := time.Now()
+	report := &Report{
+		DryRun:  p.dryRun,
+		Started: p.started,
+		Classes: map[string]ClassTotals{},
+		Buckets: make([]*BucketReport, 0, len(p.order)),
+	}
+
+	if !p.finished.IsZero() {
+		end = p.finished
+		report.Finished = &end
+	}
+	report.DurationSeconds = end.Sub(p.started).Seconds()
+
+	for _, name := range p.order {
+		b := *p.buckets[name]
+		b.Classes = map[string]ClassTotals{}
+		for class, totals := range p.buckets[name].Classes {
+			b.Classes[class] = totals
+
+			sum := report.Classes[class]
+			sum.Objects += totals.Objects
+			sum.Bytes += totals.Bytes
+			report.Classes[class] = sum
+		}
+
+		report.Objects += b.Objects
+		report.Bytes += b.Bytes
+		report.Failed += b.Failed
+		report.Buckets = append(report.Buckets, &b)
+	}
+	return report
+}
+
+// estimatedObjects returns the number of objects expected over all buckets, 0 if unknown
+func (p *Progress) estimatedObjects(report *Report) int64 {
+	if p.estimated > 0 {
+		return p.estimated
+	}
+
+	var estimated int64
+	for _, b := range report.Buckets {
+		if b.EstimatedObjects <= 0 {
+			return 0
+		}
+		estimated += b.EstimatedObjects
+	}
+	return estimated
+}
+
+// logAttrs returns the attributes of a progress log of report, including
+// an estimate of the remaining time if the number of objects is known
+func (p *Progress) logAttrs(report *Report) []any {
+	completed := report.completed()
+
+	processed := report.Objects + report.Failed
+	var rate, byteRate float64
+	if report.DurationSeconds > 0 {
+		rate = float64(processed) / report.DurationSeconds
+		byteRate = float64(report.Bytes) / report.DurationSeconds
+	}
+
+	attrs := []any{
+		"objects", report.Objects,
+		"bytes", report.Bytes,
+		"failed", report.Failed,
+		"objectsPerSecond", int64(rate),
+		"bytesPerSecond", int64(byteRate),
+		"bucketsCompleted", completed,
+		"buckets", len(report.Buckets),
+	}
+
+	if estimated := p.estimatedObjects(report); estimated > 0 && rate > 0 {
+		remaining := max(estimated-processed, 0)
+		eta := time.Duration(float64(remaining) / rate * float64(time.Second)).Round(time.Second)
+		attrs = append(attrs,
+			"estimatedObjects", estimated,
+			"percent", min(100*processed/estimated, 100),
+			"eta", eta.String())
+	}
+	return attrs
+}
+
+// Run logs the progress every interval until ctx is done
+func (p *Progress) Run(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			logger.Info("Seeding progress", p.logAttrs(p.Report())...)
+		}
+	}
+}
+
+// LogSummary logs the totals of each storage class and of the whole run
+func (p *Progress) LogSummary(logger *slog.Logger) {
+	report := p.Report()
+
+	classes := make([]string, 0, len(report.Classes))
+	for class := range report.Classes {
+		classes = append(classes, class)
+	}
+	slices.Sort(classes)
+
+	for _, class := range classes {
+		totals := report.Classes[class]
+		logger.Info("Seeding summary", "storageClass", class, "objects", totals.Objects, "bytes", totals.Bytes)
+	}
+
+	logger.Info("Seeding summary",
+		"objects", report.Objects,
+		"bytes", report.Bytes,
+		"failed", report.Failed,
+		"bucketsCompleted", report.completed(),
+		"buckets", len(report.Buckets),
+		"duration", time.Duration(report.DurationSeconds*float64(time.Second)).Round(time.Second).String())
+}
+
+// WriteReport writes the report of the run as JSON to a file
+func (p *Progress) WriteReport(name string) error {
+	data, err := json.MarshalIndent(p.Report(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,174 @@
+package seeder
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+)
+
+func TestProgressReport(t *testing.T) {
+	progress := NewProgress(false, 0)
+	progress.Register("mock-1", 10)
+	progress.Register("mock-2", 0)
+	progress.Register("mock-3", 5)
+
+	// Buckets are seeded concurrently
+	var wg sync.WaitGroup
+	for _, bucket := range []string{"mock-1", "mock-2"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			progress.Start(bucket)
+			progress.Add(bucket, "STANDARD", 10)
+			progress.Add(bucket, "ARCHIVE", 5)
+			progress.Fail(bucket)
+		}()
+	}
+	wg.Wait()
+
+	progress.Finish("mock-1", nil)
+	progress.Finish("mock-2", errors.New("mock error"))
+	progress.Close()
+
+	report := progress.Report()
+
+	if report.Objects != 4 || report.Bytes != 30 || report.Failed != 2 {
+		t.Errorf("Totals mismatch: got %d objects, %d bytes and %d failed, want 4, 30 and 2", report.Objects, report.Bytes, report.Failed)
+	}
+
+	wantClasses := map[string]ClassTotals{"STANDARD": {2, 20}, "ARCHIVE": {2, 10}}
+	if len(report.Classes) != len(wantClasses) || report.Classes["STANDARD"] != wantClasses["STANDARD"] || report.Classes["ARCHIVE"] != wantClasses["ARCHIVE"] {
+		t.Errorf("Classes mismatch: got %v, want %v", report.Classes, wantClasses)
+	}
+
+	wantBuckets := []struct {
+		bucket string
+		status repo.BucketStatus
+		err    string
+	}{
+		{"mock-1", repo.BucketCompleted, ""},
+		{"mock-2", repo.BucketFailed, "mock error"},
+		{"mock-3", repo.BucketPending, ""},
+	}
+
+	if len(report.Buckets) != len(wantBuckets) {
+		t.Fatalf("Buckets mismatch: got %d, want %d", len(report.Buckets), len(wantBuckets))
+	}
+
+	for i, want := range wantBuckets {
+		got := report.Buckets[i]
+		if got.Bucket != want.bucket || got.Status != want.status || got.Error != want.err {
+			t.Errorf("Bucket mismatch: got %s %s %q, want %s %s %q", got.Bucket, got.Status, got.Error, want.bucket, want.status, want.err)
+		}
+	}
+
+	if report.Finished == nil || report.Buckets[2].Started != nil {
+		t.Errorf("Times mismatch: got run finished %v and pending bucket started %v", report.Finished, report.Buckets[2].Started)
+	}
+}
+
+func TestProgressLogAttrs(t *testing.T) {
+	testCases := []struct {
+		name       string
+		estimated  int64
+		buckets    map[string]int64
+		report     *Report
+		wantETA    string
+		wantExists bool
+	}{
+		{
+			name:       "Estimates remaining time from buckets",
+			buckets:    map[string]int64{"mock-1": 300, "mock-2": 100},
+			report:     &Report{Objects: 90, Failed: 10, DurationSeconds: 10, Buckets: []*BucketReport{{EstimatedObjects: 300}, {EstimatedObjects: 100}}},
+			wantETA:    "30s",
+			wantExists: true,
+		},
+		{
+			name:       "Estimates remaining time from override",
+			estimated:  1000,
+			report:     &Report{Objects: 100, DurationSeconds: 10, Buckets: []*BucketReport{{}}},
+			wantETA:    "1m30s",
+			wantExists: true,
+		},
+		{
+			name:       "Estimates no time beyond estimate",
+			estimated:  50,
+			report:     &Report{Objects: 100, DurationSeconds: 10},
+			wantETA:    "0s",
+			wantExists: true,
+		},
+		{
+			name:   "Omits estimate if a bucket is unknown",
+			report: &Report{Objects: 100, DurationSeconds: 10, Buckets: []*BucketReport{{EstimatedObjects: 300}, {}}},
+		},
+		{
+			name:      "Omits estimate without progress",
+			estimated: 1000,
+			report:    &Report{DurationSeconds: 10},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			progress := NewProgress(false, tc.estimated)
+
+			attrs := progress.logAttrs(tc.report)
+
+			var gotETA string
+			var exists bool
+			for i := 0; i < len(attrs); i += 2 {
+				if attrs[i] == "eta" {
+					gotETA, exists = attrs[i+1].(string), true
+				}
+			}
+
+			if exists != tc.wantExists || gotETA != tc.wantETA {
+				t.Errorf("ETA mismatch: got %q (%t), want %q (%t)", gotETA, exists, tc.wantETA, tc.wantExists)
+			}
+		})
+	}
+}
+
+func TestProgressWriteReport(t *testing.T) {
+	progress := NewProgress(true, 0)
+	progress.Start("mock")
+	progress.Add("mock", "STANDARD", 10)
+	progress.Finish("mock", ErrInterrupted)
+	progress.Close()
+
+	name := filepath.Join(t.TempDir(), "report.json")
+	if err := progress.WriteReport(name); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Report
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if !got.DryRun || got.Objects != 1 || len(got.Buckets) != 1 || got.Buckets[0].Status != repo.BucketInterrupted {
+		t.Errorf("Report mismatch: got %s", data)
+	}
+}
+
+func TestProgressNil(t *testing.T) {
+	var progress *Progress
+
+	// A nil progress discards everything
+	progress.Register("mock", 1)
+	progress.Start("mock")
+	progress.Add("mock", "STANDARD", 1)
+	progress.Fail("mock")
+	progress.Finish("mock", nil)
+	progress.Close()
+}
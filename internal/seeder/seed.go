@@ -2,81 +2,510 @@ package seeder
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 
-	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/logging"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/metrics"
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/retry"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/source"
 	"google.golang.org/api/iterator"
 )
 
+// ErrInterrupted is returned when seeding stops before the whole bucket has been listed
+var ErrInterrupted = errors.New("seeding interrupted")
+
+type Options struct {
+	// Resume continues seeding after the last object recorded in the bucket checkpoint,
+	// retrying the objects before it that failed to be inserted
+	Resume bool
+	// Prefix, StartOffset, EndOffset and MatchGlob limit the objects listed as in source.Query
+	Prefix      string
+	StartOffset string
+	EndOffset   string
+	MatchGlob   string
+	// Delimiter splits object names into directories, paths.DefaultDelimiter if empty.
+	// It is recorded for the bucket and may only change when reseeding the whole bucket.
+	Delimiter string
+	// Reseed replaces the metadata and directories under Prefix with the objects listed
+	// once listing completes, instead of inserting each object as it is listed
+	Reseed bool
+	// DryRun lists and counts objects without reading or writing the database
+	DryRun bool
+	// Errors limits the objects that may fail to be seeded before seeding stops
+	Errors ErrorPolicy
+}
+
+// Validate returns an error if the options cannot be combined
+func (o *Options) Validate() error {
+	if err := o.Errors.Validate(); err != nil {
+		return err
+	}
+
+	if o.DryRun && o.Resume {
+		return errors.New("dry run cannot resume from a checkpoint")
+	}
+
+	sep, err := o.Separator()
+	if err != nil {
+		return err
+	}
+
+	if !o.Reseed {
+		return nil
+	}
+
+	// Directory totals are replaced as a whole, so a reseed must list every object of a directory
+	if o.Prefix != "" && !sep.IsDir(o.Prefix) {
+		return fmt.Errorf("reseed prefix %q must be a directory ending with %s", o.Prefix, sep.Delimiter())
+	}
+
+	if o.StartOffset != "" || o.EndOffset != "" || o.MatchGlob != "" {
+		return errors.New("reseed cannot be combined with offsets or globs")
+	}
+	return nil
+}
+
+// Separator returns the separator of Delimiter
+func (o *Options) Separator() (paths.Separator, error) {
+	if o.Delimiter == "" {
+		return paths.Default, nil
+	}
+	return paths.New(o.Delimiter)
+}
+
 type SeedService struct {
-	client        *storage.Client
-	bucketId      string
-	directoryRepo repo.DirectoryRepository
-	metadataRepo  repo.MetadataRepository
+	source         source.Source
+	bucketId       string
+	opts           Options
+	directoryRepo  repo.DirectoryRepository
+	metadataRepo   repo.MetadataRepository
+	checkpointRepo repo.CheckpointRepository
+	bucketRepo     repo.BucketRepository
+	reseedRepo     repo.ReseedRepository
+	failedRepo     repo.FailedObjectRepository
+	transactor     repo.Transactor
+	progress       *Progress
+	logger         *slog.Logger
 }
 
-func NewSeedService(client *storage.Client, bucketId string, directoryRepo repo.DirectoryRepository, metadataRepo repo.MetadataRepository) *SeedService {
+// Dependencies are the database access of a seeding. A dry run has none.
+type Dependencies struct {
+	Repos      repo.Repositories
+	Transactor repo.Transactor
+}
+
+func NewSeedService(src source.Source, bucketId string, opts Options, deps Dependencies, progress *Progress, logger *slog.Logger) *SeedService {
 	return &SeedService{
-		client:        client,
-		bucketId:      bucketId,
-		directoryRepo: directoryRepo,
-		metadataRepo:  metadataRepo,
+		source:         src,
+		bucketId:       bucketId,
+		opts:           opts,
+		directoryRepo:  deps.Repos.Directory,
+		metadataRepo:   deps.Repos.Metadata,
+		checkpointRepo: deps.Repos.Checkpoint,
+		bucketRepo:     deps.Repos.Bucket,
+		reseedRepo:     deps.Repos.Reseed,
+		failedRepo:     deps.Repos.Failed,
+		transactor:     deps.Transactor,
+		progress:       progress,
+		logger:         logger.With(logging.KeyBucket, bucketId),
+	}
+}
+
+// startAfterIterator skips all objects up to and including startAfter,
+// since source.Query.StartOffset is inclusive
+type startAfterIterator struct {
+	source.ObjectIterator
+	startAfter string
+}
+
+func (it *startAfterIterator) Next() (*model.Metadata, error) {
+	for {
+		obj, err := it.ObjectIterator.Next()
+		if err != nil || obj.Name > it.startAfter {
+			return obj, err
+		}
 	}
 }
 
-func newMetadata(obj *storage.ObjectAttrs) *model.Metadata {
-	return &model.Metadata{
-		Bucket:       obj.Bucket,
-		Name:         obj.Name,
-		Size:         obj.Size,
-		StorageClass: obj.StorageClass,
-		Created:      obj.Created,
-		Updated:      obj.Updated,
+// resumeIterator skips all objects up to and including the checkpoint, except those
+// that failed to be inserted before seeding was resumed
+type resumeIterator struct {
+	source.ObjectIterator
+	checkpoint string
+	failed     map[string]bool
+}
+
+func (it *resumeIterator) Next() (*model.Metadata, error) {
+	for {
+		obj, err := it.ObjectIterator.Next()
+		if err != nil || obj.Name > it.checkpoint || it.failed[obj.Name] {
+			return obj, err
+		}
 	}
 }
 
-type objectIterator interface {
-	Next() (*storage.ObjectAttrs, error)
+// retryIterator lists objects again after the last object returned once listing fails
+// with a transient error, since an iterator returns the same error after failing once
+type retryIterator struct {
+	ctx    context.Context
+	policy retry.Policy
+	// list returns an iterator over the objects after startAfter, or all objects if empty
+	list func(startAfter string) source.ObjectIterator
+	it   source.ObjectIterator
+	last string
+}
+
+func (it *retryIterator) Next() (*model.Metadata, error) {
+	var obj *model.Metadata
+	err := retry.Do(it.ctx, it.policy, "list_objects", func(ctx context.Context) error {
+		if it.it == nil {
+			it.it = it.list(it.last)
+		}
+
+		var err error
+		if obj, err = it.it.Next(); err != nil && err != iterator.Done {
+			it.it = nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	it.last = obj.Name
+	return obj, nil
 }
 
 // Seed initiates the seeding process by traversing bucket and inserting into db
-func (s *SeedService) Start(ctx context.Context) error {
-	b := s.client.Bucket(s.bucketId)
-	if _, err := b.Attrs(ctx); err != nil {
+//
+// Seeding stops with ErrInterrupted once ctx is cancelled. The object being inserted
+// is committed and recorded in the bucket checkpoint, from which seeding can resume.
+// The attributes of the bucket and the status of its seeding are recorded in the bucket table.
+// Objects that fail to be seeded are recorded in the failed object table, and seeding stops
+// with ErrErrorBudgetExceeded once more of them fail than the error policy allows.
+// Resuming retries them along with the objects after the checkpoint.
+// A dry run only lists and counts objects without accessing the database.
+func (s *SeedService) Start(ctx context.Context) (err error) {
+	s.progress.Start(s.bucketId)
+	defer func() {
+		s.progress.Finish(s.bucketId, err)
+	}()
+
+	var bucket *model.Bucket
+	err = retry.Do(ctx, retry.DefaultPolicy, "bucket_attrs", func(ctx context.Context) (err error) {
+		bucket, err = s.source.Attrs(ctx)
+		return err
+	})
+	if err != nil {
 		return err
 	}
 
-	it := b.Objects(ctx, nil)
-	if err := s.insertFromIterator(it); err != nil {
+	query := source.Query{
+		Prefix:      s.opts.Prefix,
+		StartOffset: s.opts.StartOffset,
+		EndOffset:   s.opts.EndOffset,
+		MatchGlob:   s.opts.MatchGlob,
+	}
+
+	// Listing starts at the first object failed before the checkpoint when resuming
+	listQuery := query
+	it := &retryIterator{
+		ctx:    ctx,
+		policy: retry.DefaultPolicy,
+		list: func(startAfter string) source.ObjectIterator {
+			if startAfter == "" {
+				return s.source.Objects(ctx, listQuery)
+			}
+
+			q := listQuery
+			q.StartOffset = startAfter
+			return &startAfterIterator{s.source.Objects(ctx, q), startAfter}
+		},
+	}
+
+	sep, err := s.opts.Separator()
+	if err != nil {
 		return err
 	}
+
+	if s.opts.DryRun {
+		return s.insertFromIterator(ctx, sep, it)
+	}
+
+	// Database writes must complete even if seeding is interrupted
+	dbCtx := context.WithoutCancel(ctx)
+
+	// Recorded names are split at the delimiter of the bucket, which only a reseed of
+	// the whole bucket replaces
+	recorded, err := s.bucketRepo.Get(dbCtx, s.bucketId)
+	if err != nil {
+		return fmt.Errorf("error getting bucket: %w", err)
+	}
+
+	if recorded != nil && recorded.Delimiter != sep.Delimiter() && !(s.opts.Reseed && s.opts.Prefix == "") {
+		return fmt.Errorf("bucket delimiter %q differs from recorded delimiter %q, reseed the whole bucket to change it", sep.Delimiter(), recorded.Delimiter)
+	}
+
+	bucket.Delimiter = sep.Delimiter()
+	if err := s.bucketRepo.Upsert(dbCtx, bucket); err != nil {
+		return fmt.Errorf("error recording bucket: %w", err)
+	}
+
+	if err := s.bucketRepo.SetStatus(dbCtx, s.bucketId, repo.BucketSeeding, nil); err != nil {
+		return fmt.Errorf("error recording bucket status: %w", err)
+	}
+
+	defer func() {
+		status := repo.BucketCompleted
+		switch {
+		case errors.Is(err, ErrInterrupted):
+			status = repo.BucketInterrupted
+		case err != nil:
+			status = repo.BucketFailed
+		}
+
+		if statusErr := s.bucketRepo.SetStatus(dbCtx, s.bucketId, status, err); statusErr != nil {
+			s.logger.Error("Error recording bucket status", "status", status, logging.KeyError, statusErr)
+		}
+	}()
+
+	var lastObject string
+	if s.opts.Resume {
+		if lastObject, err = s.checkpointRepo.Get(dbCtx, s.bucketId); err != nil {
+			return fmt.Errorf("error getting checkpoint: %w", err)
+		}
+		s.logger.Info("Resuming seeding from checkpoint", logging.KeyObject, lastObject)
+	}
+
+	var objects source.ObjectIterator = it
+	if lastObject != "" && lastObject >= query.StartOffset {
+		it.last = lastObject
+
+		// Objects that failed before the checkpoint are listed again to be retried
+		failed, err := s.failedRepo.List(dbCtx, s.bucketId)
+		if err != nil {
+			return fmt.Errorf("error listing failed objects: %w", err)
+		}
+
+		retried := map[string]bool{}
+		for _, obj := range failed {
+			if obj.Name < lastObject && obj.Name >= query.StartOffset {
+				retried[obj.Name] = true
+				if len(retried) == 1 {
+					listQuery.StartOffset = obj.Name
+				}
+			}
+		}
+
+		if len(retried) > 0 {
+			s.logger.Info("Retrying objects failed before checkpoint", "failed", len(retried))
+			it.last = ""
+			objects = &resumeIterator{it, lastObject, retried}
+		}
+	}
+
+	// Failures of an earlier seeding of the whole bucket no longer apply
+	if lastObject == "" && query.Prefix == "" && query.StartOffset == "" && query.EndOffset == "" && query.MatchGlob == "" {
+		if err := s.failedRepo.Clear(dbCtx, s.bucketId); err != nil {
+			return fmt.Errorf("error clearing failed objects: %w", err)
+		}
+	}
+
+	// Objects staged by an earlier reseed are kept only when resuming it
+	if s.opts.Reseed && lastObject == "" {
+		if err := s.reseedRepo.Clear(dbCtx, s.bucketId); err != nil {
+			return fmt.Errorf("error clearing staged objects: %w", err)
+		}
+	}
+
+	if err := s.insertFromIterator(ctx, sep, objects); err != nil {
+		return err
+	}
+
+	// Folders are recorded once the directories of a reseeded subtree have been replaced
+	if s.opts.Reseed {
+		if err := s.replaceSubtree(dbCtx); err != nil {
+			return err
+		}
+		return s.insertFolders(ctx, sep, query)
+	}
+
+	if err := s.insertFolders(ctx, sep, query); err != nil {
+		return err
+	}
+	return s.checkpointRepo.Delete(dbCtx, s.bucketId)
+}
+
+// insertFolders records the folders listed from the source as directories separated by sep,
+// which exist even when they hold no objects. Listing starts over on transient errors, since
+// recording a folder twice is a no-op.
+func (s *SeedService) insertFolders(ctx context.Context, sep paths.Separator, query source.Query) error {
+	dbCtx := context.WithoutCancel(ctx)
+
+	var folders int
+	err := retry.Do(ctx, retry.DefaultPolicy, "list_folders", func(ctx context.Context) error {
+		folders = 0
+		it := s.source.Folders(ctx, query)
+		for {
+			if ctx.Err() != nil {
+				return ErrInterrupted
+			}
+
+			folder, err := it.Next()
+			if err == iterator.Done {
+				return nil
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return ErrInterrupted
+				}
+				return err
+			}
+
+			if err := s.directoryRepo.UpsertFolder(dbCtx, sep, folder.Bucket, folder.Name); err != nil {
+				return fmt.Errorf("error upserting folder %s: %w", folder.Name, err)
+			}
+			folders++
+		}
+	})
+	if err != nil {
+		if errors.Is(err, ErrInterrupted) {
+			return ErrInterrupted
+		}
+		return fmt.Errorf("error listing folders: %w", err)
+	}
+
+	s.logger.Info("Recorded folders", "folders", folders)
 	return nil
 }
 
-// insertFromIterator traverses iterator while inserting all containing items into db
-func (s *SeedService) insertFromIterator(it objectIterator) error {
+// replaceSubtree replaces the metadata under the prefix with the staged objects and
+// deletes the checkpoint in one transaction, so that a resumed reseed never replaces
+// the subtree with a partial listing
+func (s *SeedService) replaceSubtree(ctx context.Context) error {
+	replace := func(ctx context.Context, repos repo.Repositories) error {
+		if err := repos.Reseed.Replace(ctx, s.bucketId, s.opts.Prefix); err != nil {
+			return fmt.Errorf("error replacing subtree: %w", err)
+		}
+		return repos.Checkpoint.Delete(ctx, s.bucketId)
+	}
+
+	if s.transactor == nil {
+		return replace(ctx, repo.Repositories{
+			Reseed:     s.reseedRepo,
+			Checkpoint: s.checkpointRepo,
+		})
+	}
+
+	return s.transactor.WithinTx(ctx, replace)
+}
+
+// insertFromIterator traverses iterator while inserting all containing items into db,
+// with parent directories separated by sep.
+// It returns ErrInterrupted once ctx is cancelled, and ErrErrorBudgetExceeded once
+// more objects fail to be inserted than the error policy allows.
+func (s *SeedService) insertFromIterator(ctx context.Context, sep paths.Separator, it source.ObjectIterator) error {
+	dbCtx := context.WithoutCancel(ctx)
+	budget := &errorBudget{policy: s.opts.Errors}
+
 	for {
+		if ctx.Err() != nil {
+			return ErrInterrupted
+		}
+
 		obj, err := it.Next()
 		if err != nil {
 			if err == iterator.Done {
 				break
 			}
 
+			if ctx.Err() != nil {
+				return ErrInterrupted
+			}
 			return fmt.Errorf("error retrieving iterator object: %v", err)
 		}
 
-		metadata := newMetadata(obj)
+		if s.opts.DryRun {
+			s.progress.Add(obj.Bucket, obj.StorageClass, obj.Size)
+			continue
+		}
 
-		if err := s.metadataRepo.Insert(metadata); err != nil {
-			log.Printf("Error inserting metadata: %v", err)
+		insertErr := s.insertObject(dbCtx, sep, obj)
+		if insertErr != nil {
+			s.logger.Error("Error inserting object", logging.KeyObject, obj.Name, logging.KeyError, insertErr)
+			metrics.ObjectsSeeded.WithLabelValues(obj.Bucket, "failed").Inc()
+			s.progress.Fail(obj.Bucket)
+			s.recordFailure(dbCtx, obj.Bucket, obj.Name, insertErr)
+		} else {
+			metrics.ObjectsSeeded.WithLabelValues(obj.Bucket, "inserted").Inc()
+			s.progress.Add(obj.Bucket, obj.StorageClass, obj.Size)
 		}
 
-		if err := s.directoryRepo.UpsertParentDirs(repo.StorageClass(metadata.StorageClass), metadata.Bucket, metadata.Name, metadata.Size, 1); err != nil {
-			log.Printf("Error upserting directories: %v", err)
+		if err := budget.add(obj.Name, insertErr); err != nil {
+			return err
 		}
 	}
-	return nil
+	return budget.done()
+}
+
+// recordFailure records an object that could not be inserted so that it can be seeded again
+func (s *SeedService) recordFailure(ctx context.Context, bucket, name string, insertErr error) {
+	if s.failedRepo == nil {
+		return
+	}
+
+	if err := s.failedRepo.Record(ctx, bucket, name, insertErr); err != nil {
+		s.logger.Error("Error recording failed object", logging.KeyObject, name, logging.KeyError, err)
+	}
+}
+
+// insertObject inserts metadata, updates its parent directories separated by sep and
+// advances the bucket checkpoint in one transaction. Objects of a reseed are staged instead.
+func (s *SeedService) insertObject(ctx context.Context, sep paths.Separator, metadata *model.Metadata) error {
+	insert := func(ctx context.Context, repos repo.Repositories) error {
+		if s.opts.Reseed {
+			if err := repos.Reseed.Stage(ctx, metadata); err != nil {
+				return fmt.Errorf("error staging metadata: %w", err)
+			}
+		} else {
+			if err := repos.Metadata.Insert(ctx, sep, metadata); err != nil {
+				return fmt.Errorf("error inserting metadata: %w", err)
+			}
+
+			if err := repos.Directory.UpsertParentDirs(ctx, sep, repo.StorageClass(metadata.StorageClass), metadata.Bucket, metadata.Name, metadata.Size, 1); err != nil {
+				return fmt.Errorf("error upserting directories: %w", err)
+			}
+		}
+
+		// An object failed by an earlier seeding no longer needs to be seeded again
+		if repos.Failed != nil {
+			if err := repos.Failed.Delete(ctx, metadata.Bucket, metadata.Name); err != nil {
+				return fmt.Errorf("error deleting failed object: %w", err)
+			}
+		}
+
+		if repos.Checkpoint != nil {
+			if err := repos.Checkpoint.Set(ctx, metadata.Bucket, metadata.Name); err != nil {
+				return fmt.Errorf("error setting checkpoint: %w", err)
+			}
+		}
+		return nil
+	}
+
+	if s.transactor == nil {
+		return insert(ctx, repo.Repositories{
+			Metadata:   s.metadataRepo,
+			Directory:  s.directoryRepo,
+			Checkpoint: s.checkpointRepo,
+			Reseed:     s.reseedRepo,
+			Failed:     s.failedRepo,
+		})
+	}
+
+	return s.transactor.WithinTx(ctx, insert)
 }
@@ -1,12 +1,20 @@
 package seeder
 
 import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
 	"testing"
 	"time"
 
-	"cloud.google.com/go/storage"
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/retry"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/source"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 )
 
@@ -18,7 +26,7 @@ func TestReadFromIterator(t *testing.T) {
 		{
 			name: "Succeeds iterating through objects",
 			it: &testObjectIterator{
-				items: []*storage.ObjectAttrs{
+				items: []*model.Metadata{
 					{
 						Bucket:       "mock",
 						Name:         "mock",
@@ -41,13 +49,13 @@ func TestReadFromIterator(t *testing.T) {
 		{
 			name: "Succeeds if iterator is empty",
 			it: &testObjectIterator{
-				items: []*storage.ObjectAttrs{},
+				items: []*model.Metadata{},
 			},
 		},
 		{
 			name: "Does not return errors if item data is malformed",
 			it: &testObjectIterator{
-				items: []*storage.ObjectAttrs{
+				items: []*model.Metadata{
 					{
 						Bucket:       "mock",
 						Size:         -1,
@@ -68,7 +76,7 @@ func TestReadFromIterator(t *testing.T) {
 				directoryRepo: mockDirRepo,
 			}
 
-			err := s.insertFromIterator(tc.it)
+			err := s.insertFromIterator(context.Background(), paths.Default, tc.it)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -84,16 +92,497 @@ func TestReadFromIterator(t *testing.T) {
 	}
 }
 
-type testObjectIterator struct {
-	items []*storage.ObjectAttrs
+func TestInsertFromIteratorInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Cancel once the first object has been listed
+	it := &testObjectIterator{
+		items: []*model.Metadata{
+			{Bucket: "mock", Name: "mock-1"},
+			{Bucket: "mock", Name: "mock-2"},
+		},
+		onNext: cancel,
+	}
+
+	mockMetadataRepo := &mockMetadataRepository{}
+	mockCheckpointRepo := &mockCheckpointRepository{}
+
+	s := &SeedService{
+		metadataRepo:   mockMetadataRepo,
+		directoryRepo:  &mockDirectoryRepository{},
+		checkpointRepo: mockCheckpointRepo,
+	}
+
+	if err := s.insertFromIterator(ctx, paths.Default, it); err != ErrInterrupted {
+		t.Fatalf("Error mismatch: got %v, want %v", err, ErrInterrupted)
+	}
+
+	// The object in progress is inserted and checkpointed
+	if mockMetadataRepo.calls != 1 {
+		t.Errorf("Metadata Insert calls mismatch: got %d, want %d", mockMetadataRepo.calls, 1)
+	}
+
+	if mockCheckpointRepo.lastObject != "mock-1" {
+		t.Errorf("Checkpoint mismatch: got %s, want %s", mockCheckpointRepo.lastObject, "mock-1")
+	}
+}
+
+func TestInsertFromIteratorReseed(t *testing.T) {
+	it := &testObjectIterator{
+		items: []*model.Metadata{
+			{Bucket: "mock", Name: "mock-1/file1"},
+			{Bucket: "mock", Name: "mock-1/file2"},
+		},
+	}
+
+	mockMetadataRepo := &mockMetadataRepository{}
+	mockDirRepo := &mockDirectoryRepository{}
+	mockReseedRepo := &mockReseedRepository{}
+
+	s := &SeedService{
+		opts:          Options{Prefix: "mock-1/", Reseed: true},
+		metadataRepo:  mockMetadataRepo,
+		directoryRepo: mockDirRepo,
+		reseedRepo:    mockReseedRepo,
+	}
+
+	if err := s.insertFromIterator(context.Background(), paths.Default, it); err != nil {
+		t.Fatal(err)
+	}
+
+	// Objects are only staged until listing completes
+	if mockReseedRepo.staged != 2 {
+		t.Errorf("Reseed Stage calls mismatch: got %d, want %d", mockReseedRepo.staged, 2)
+	}
+
+	if mockMetadataRepo.calls != 0 || mockDirRepo.calls != 0 {
+		t.Errorf("Insert calls mismatch: got %d metadata and %d directory calls, want none", mockMetadataRepo.calls, mockDirRepo.calls)
+	}
+}
+
+func TestStartDryRun(t *testing.T) {
+	src := &testSource{
+		objects: []*model.Metadata{
+			{Bucket: "mock", Name: "file1", Size: 1, StorageClass: "STANDARD"},
+			{Bucket: "mock", Name: "dir/file2", Size: 2, StorageClass: "NEARLINE"},
+		},
+	}
+
+	// A dry run has no dependencies so that any database access fails
+	progress := NewProgress(true, 0)
+	s := NewSeedService(src, "mock", Options{DryRun: true}, Dependencies{}, progress, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	report := progress.Report()
+	if report.Objects != 2 || report.Bytes != 3 || report.Classes["NEARLINE"].Bytes != 2 {
+		t.Errorf("Report mismatch: got %d objects, %d bytes and classes %v", report.Objects, report.Bytes, report.Classes)
+	}
+}
+
+func TestStartResumeRetriesFailed(t *testing.T) {
+	db := repo.NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	src := &testSource{
+		objects: []*model.Metadata{
+			{Bucket: "mock", Name: "a/file1", Size: 1, StorageClass: "STANDARD"},
+			{Bucket: "mock", Name: "a/file2", Size: 2, StorageClass: "STANDARD"},
+			{Bucket: "mock", Name: "b/file3", Size: 4, StorageClass: "STANDARD"},
+			{Bucket: "mock", Name: "c/file4", Size: 8, StorageClass: "STANDARD"},
+		},
+	}
+
+	// An interrupted seeding inserted a/file1 and b/file3, failed a/file2 and stopped at b/file3
+	ctx := context.Background()
+	deps := Dependencies{Repos: repo.NewRepositories(db), Transactor: repo.NewTransactor(db)}
+	for _, obj := range []*model.Metadata{src.objects[0], src.objects[2]} {
+		if err := deps.Repos.Metadata.Insert(ctx, paths.Default, obj); err != nil {
+			t.Fatal(err)
+		}
+		if err := deps.Repos.Directory.UpsertParentDirs(ctx, paths.Default, repo.StorageStandard, obj.Bucket, obj.Name, obj.Size, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := deps.Repos.Failed.Record(ctx, "mock", "a/file2", errors.New("mock error")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deps.Repos.Checkpoint.Set(ctx, "mock", "b/file3"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSeedService(src, "mock", Options{Resume: true}, deps, NewProgress(false, 0), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := s.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, obj := range src.objects {
+		if _, err := deps.Repos.Metadata.Get(ctx, "mock", obj.Name); err != nil {
+			t.Errorf("Object %s not seeded: %v", obj.Name, err)
+		}
+	}
+
+	root, err := deps.Repos.Directory.Get(ctx, "mock", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Count != 4 || root.SizeStandard != 15 {
+		t.Errorf("Root mismatch: got %d objects of %d bytes, want 4 objects of 15 bytes", root.Count, root.SizeStandard)
+	}
+
+	failed, err := deps.Repos.Failed.List(ctx, "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 0 {
+		t.Errorf("Failed objects mismatch: got %v, want none", failed)
+	}
+}
+
+func TestInsertFromIteratorErrorPolicy(t *testing.T) {
+	testCases := []struct {
+		name         string
+		policy       ErrorPolicy
+		wantErr      bool
+		wantInserts  int
+		wantRecorded []string
+	}{
+		{"Continues on failures by default", ErrorPolicy{}, false, 4, []string{"file2", "file3"}},
+		{"Stops at first failure", ErrorPolicy{FailFast: true}, true, 2, []string{"file2"}},
+		{"Continues within max errors", ErrorPolicy{MaxErrors: 2}, false, 4, []string{"file2", "file3"}},
+		{"Stops beyond max errors", ErrorPolicy{MaxErrors: 1}, true, 3, []string{"file2", "file3"}},
+		{"Fails on ratio once listing completes", ErrorPolicy{MaxErrorRatio: 0.25}, true, 4, []string{"file2", "file3"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			it := &testObjectIterator{
+				items: []*model.Metadata{
+					{Bucket: "mock", Name: "file1"},
+					{Bucket: "mock", Name: "file2"},
+					{Bucket: "mock", Name: "file3"},
+					{Bucket: "mock", Name: "file4"},
+				},
+			}
+
+			mockMetadataRepo := &mockMetadataRepository{fail: map[string]bool{"file2": true, "file3": true}}
+			mockFailedRepo := &mockFailedObjectRepository{}
+			progress := NewProgress(false, 0)
+
+			s := &SeedService{
+				opts:          Options{Errors: tc.policy},
+				metadataRepo:  mockMetadataRepo,
+				directoryRepo: &mockDirectoryRepository{},
+				failedRepo:    mockFailedRepo,
+				progress:      progress,
+				logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+
+			err := s.insertFromIterator(context.Background(), paths.Default, it)
+			if tc.wantErr != errors.Is(err, ErrErrorBudgetExceeded) || (!tc.wantErr && err != nil) {
+				t.Fatalf("Error mismatch: got %v, want budget exceeded %t", err, tc.wantErr)
+			}
+
+			if mockMetadataRepo.calls != tc.wantInserts {
+				t.Errorf("Metadata Insert calls mismatch: got %d, want %d", mockMetadataRepo.calls, tc.wantInserts)
+			}
+
+			if !slices.Equal(mockFailedRepo.recorded, tc.wantRecorded) {
+				t.Errorf("Recorded failures mismatch: got %v, want %v", mockFailedRepo.recorded, tc.wantRecorded)
+			}
+
+			// Objects inserted successfully clear any earlier failure
+			for _, name := range mockFailedRepo.deleted {
+				if mockMetadataRepo.fail[name] {
+					t.Errorf("Failed object %s deleted", name)
+				}
+			}
+
+			if report := progress.Report(); report.Failed != int64(len(tc.wantRecorded)) {
+				t.Errorf("Failed count mismatch: got %d, want %d", report.Failed, len(tc.wantRecorded))
+			}
+		})
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{"Seeds with filters", Options{Prefix: "logs/2024-", StartOffset: "a", EndOffset: "b", MatchGlob: "**.json"}, false},
+		{"Reseeds directory", Options{Prefix: "logs/", Reseed: true}, false},
+		{"Reseeds whole bucket", Options{Reseed: true}, false},
+		{"Reseeds prefix of names", Options{Prefix: "logs/2024-", Reseed: true}, true},
+		{"Reseeds with offset", Options{Prefix: "logs/", StartOffset: "logs/b", Reseed: true}, true},
+		{"Reseeds with glob", Options{Prefix: "logs/", MatchGlob: "**.json", Reseed: true}, true},
+		{"Reseeds directory of delimiter", Options{Prefix: "logs|", Delimiter: "|", Reseed: true}, false},
+		{"Reseeds slash prefix of other delimiter", Options{Prefix: "logs/", Delimiter: "|", Reseed: true}, true},
+		{"Seeds with invalid delimiter", Options{Delimiter: "::"}, true},
+		{"Dry runs reseed", Options{Prefix: "logs/", Reseed: true, DryRun: true}, false},
+		{"Dry runs resume", Options{Resume: true, DryRun: true}, true},
+		{"Limits errors", Options{Errors: ErrorPolicy{MaxErrors: 10, MaxErrorRatio: 0.01}}, false},
+		{"Limits error ratio beyond 1", Options{Errors: ErrorPolicy{MaxErrorRatio: 1.5}}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.opts.Validate()
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Error mismatch: got %v, want error %t", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestStartAfterIterator(t *testing.T) {
+	it := &startAfterIterator{
+		ObjectIterator: &testObjectIterator{
+			items: []*model.Metadata{
+				{Name: "mock-1"},
+				{Name: "mock-2"},
+				{Name: "mock-3"},
+			},
+		},
+		startAfter: "mock-1",
+	}
+
+	var got []string
+	for {
+		obj, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, obj.Name)
+	}
+
+	if len(got) != 2 || got[0] != "mock-2" || got[1] != "mock-3" {
+		t.Errorf("Objects mismatch: got %v, want %v", got, []string{"mock-2", "mock-3"})
+	}
+}
+
+func TestRetryIterator(t *testing.T) {
+	objects := []*model.Metadata{{Name: "file1"}, {Name: "file2"}, {Name: "file3"}}
+	policy := retry.Policy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, Multiplier: 2}
+
+	testCases := []struct {
+		name string
+		// errs is the error of each listing after its first object, nil to list all objects
+		errs        []error
+		wantNames   []string
+		wantListed  []string
+		wantErrCode int
+	}{
+		{
+			name:       "Lists once without errors",
+			errs:       []error{nil},
+			wantNames:  []string{"file1", "file2", "file3"},
+			wantListed: []string{""},
+		},
+		{
+			name:       "Lists again after last object on transient errors",
+			errs:       []error{&googleapi.Error{Code: 503}, &googleapi.Error{Code: 429}, nil},
+			wantNames:  []string{"file1", "file2", "file3"},
+			wantListed: []string{"", "file1", "file2"},
+		},
+		{
+			name:        "Surfaces permanent errors",
+			errs:        []error{&googleapi.Error{Code: 403}},
+			wantNames:   []string{"file1"},
+			wantListed:  []string{""},
+			wantErrCode: 403,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var listed []string
+			it := &retryIterator{
+				ctx:    context.Background(),
+				policy: policy,
+				list: func(startAfter string) source.ObjectIterator {
+					listed = append(listed, startAfter)
+
+					var items []*model.Metadata
+					for _, obj := range objects {
+						if obj.Name > startAfter {
+							items = append(items, obj)
+						}
+					}
+					return &testObjectIterator{items: items, failAfter: 1, err: tc.errs[len(listed)-1]}
+				},
+			}
+
+			var names []string
+			var err error
+			for {
+				var obj *model.Metadata
+				if obj, err = it.Next(); err != nil {
+					break
+				}
+				names = append(names, obj.Name)
+			}
+
+			var apiErr *googleapi.Error
+			if tc.wantErrCode == 0 && err != iterator.Done || tc.wantErrCode != 0 && (!errors.As(err, &apiErr) || apiErr.Code != tc.wantErrCode) {
+				t.Fatalf("Error mismatch: got %v, want code %d", err, tc.wantErrCode)
+			}
+
+			if !slices.Equal(names, tc.wantNames) {
+				t.Errorf("Objects mismatch: got %v, want %v", names, tc.wantNames)
+			}
+
+			if !slices.Equal(listed, tc.wantListed) {
+				t.Errorf("Listings mismatch: got %v, want %v", listed, tc.wantListed)
+			}
+		})
+	}
+}
+
+func TestInsertFolders(t *testing.T) {
+	folders := []*model.Directory{
+		{Bucket: "mock", Name: "a/", Folder: true},
+		{Bucket: "mock", Name: "a/b/", Folder: true},
+	}
+
+	testCases := []struct {
+		name string
+		// errs is the error of each listing after its first folder, nil to list all folders
+		errs         []error
+		wantUpserted []string
+		wantErr      bool
+	}{
+		{
+			name:         "Records listed folders",
+			errs:         []error{nil},
+			wantUpserted: []string{"a/", "a/b/"},
+		},
+		{
+			name:         "Lists again from the start on transient errors",
+			errs:         []error{&googleapi.Error{Code: 503}, nil},
+			wantUpserted: []string{"a/", "a/", "a/b/"},
+		},
+		{
+			name:         "Surfaces permanent errors",
+			errs:         []error{&googleapi.Error{Code: 403}},
+			wantUpserted: []string{"a/"},
+			wantErr:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			src := &testSource{folders: folders, errs: tc.errs}
+			mockDirRepo := &mockDirectoryRepository{}
+
+			s := &SeedService{
+				source:        src,
+				directoryRepo: mockDirRepo,
+				logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+
+			if err := s.insertFolders(context.Background(), paths.Default, source.Query{}); (err != nil) != tc.wantErr {
+				t.Fatalf("Error mismatch: got %v, want error %t", err, tc.wantErr)
+			}
+
+			if !slices.Equal(mockDirRepo.folders, tc.wantUpserted) {
+				t.Errorf("Folders mismatch: got %v, want %v", mockDirRepo.folders, tc.wantUpserted)
+			}
+		})
+	}
+}
+
+// testSource lists objects and folders, failing each folder listing after its first folder
+// with the next of errs, if any
+type testSource struct {
+	objects  []*model.Metadata
+	folders  []*model.Directory
+	errs     []error
+	listings int
+}
+
+func (s *testSource) Attrs(ctx context.Context) (*model.Bucket, error) {
+	return &model.Bucket{Name: "mock"}, nil
+}
+
+func (s *testSource) Objects(ctx context.Context, query source.Query) source.ObjectIterator {
+	var objects []*model.Metadata
+	for _, obj := range s.objects {
+		if obj.Name >= query.StartOffset && (query.EndOffset == "" || obj.Name < query.EndOffset) {
+			objects = append(objects, obj)
+		}
+	}
+	return &testObjectIterator{items: objects}
+}
+
+func (s *testSource) Folders(ctx context.Context, query source.Query) source.FolderIterator {
+	var err error
+	if s.listings < len(s.errs) {
+		err = s.errs[s.listings]
+	}
+	s.listings++
+	return &testFolderIterator{items: s.folders, err: err}
+}
+
+type testFolderIterator struct {
+	items []*model.Directory
 	index int
+	err   error
 }
 
-func (t *testObjectIterator) Next() (*storage.ObjectAttrs, error) {
+func (t *testFolderIterator) Next() (*model.Directory, error) {
+	if t.err != nil && t.index >= 1 {
+		return nil, t.err
+	}
+
 	if t.index >= len(t.items) {
 		return nil, iterator.Done
 	}
 
+	folder := t.items[t.index]
+	t.index++
+	return folder, nil
+}
+
+type testObjectIterator struct {
+	items  []*model.Metadata
+	index  int
+	onNext func()
+	// err is returned once failAfter objects have been listed, if set
+	err       error
+	failAfter int
+}
+
+func (t *testObjectIterator) Next() (*model.Metadata, error) {
+	if t.err != nil && t.index >= t.failAfter {
+		return nil, t.err
+	}
+
+	if t.index >= len(t.items) {
+		return nil, iterator.Done
+	}
+
+	if t.onNext != nil {
+		t.onNext()
+	}
+
 	obj := t.items[t.index]
 	t.index++
 	return obj, nil
@@ -102,19 +591,66 @@ func (t *testObjectIterator) Next() (*storage.ObjectAttrs, error) {
 type mockMetadataRepository struct {
 	repo.MetadataRepository
 	calls int
+	// fail lists the names of objects whose insertion fails
+	fail map[string]bool
 }
 
-func (m *mockMetadataRepository) Insert(metadata *model.Metadata) error {
+func (m *mockMetadataRepository) Insert(ctx context.Context, sep paths.Separator, metadata *model.Metadata) error {
 	m.calls++
+	if m.fail[metadata.Name] {
+		return errors.New("mock error")
+	}
 	return nil
 }
 
 type mockDirectoryRepository struct {
 	repo.DirectoryRepository
-	calls int
+	calls   int
+	folders []string
 }
 
-func (d *mockDirectoryRepository) UpsertParentDirs(storageClass repo.StorageClass, bucket string, objName string, newSize int64, newCount int64) error {
+func (d *mockDirectoryRepository) UpsertParentDirs(ctx context.Context, sep paths.Separator, storageClass repo.StorageClass, bucket string, objName string, newSize int64, newCount int64) error {
 	d.calls++
 	return nil
 }
+
+func (d *mockDirectoryRepository) UpsertFolder(ctx context.Context, sep paths.Separator, bucket string, name string) error {
+	d.folders = append(d.folders, name)
+	return nil
+}
+
+type mockCheckpointRepository struct {
+	repo.CheckpointRepository
+	lastObject string
+}
+
+func (c *mockCheckpointRepository) Set(ctx context.Context, bucket, lastObject string) error {
+	c.lastObject = lastObject
+	return nil
+}
+
+type mockFailedObjectRepository struct {
+	repo.FailedObjectRepository
+	recorded []string
+	deleted  []string
+}
+
+func (f *mockFailedObjectRepository) Record(ctx context.Context, bucket, name string, seedErr error) error {
+	f.recorded = append(f.recorded, name)
+	return nil
+}
+
+func (f *mockFailedObjectRepository) Delete(ctx context.Context, bucket, name string) error {
+	f.deleted = append(f.deleted, name)
+	return nil
+}
+
+type mockReseedRepository struct {
+	repo.ReseedRepository
+	staged int
+}
+
+func (r *mockReseedRepository) Stage(ctx context.Context, obj *model.Metadata) error {
+	r.staged++
+	return nil
+}
@@ -0,0 +1,197 @@
+package source
+
+import (
+	"context"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"google.golang.org/api/iterator"
+	storagev1 "google.golang.org/api/storage/v1"
+)
+
+// gcsSource lists the objects and folders of a Cloud Storage bucket
+type gcsSource struct {
+	bucket  *storage.BucketHandle
+	service *storagev1.Service
+	name    string
+}
+
+// NewGCS returns a source listing the objects of a Cloud Storage bucket. Folders of buckets
+// with hierarchical namespace and managed folders are listed with service, none if it is nil.
+func NewGCS(client *storage.Client, service *storagev1.Service, bucket string) Source {
+	return &gcsSource{bucket: client.Bucket(bucket), service: service, name: bucket}
+}
+
+func (s *gcsSource) Attrs(ctx context.Context) (*model.Bucket, error) {
+	attrs, err := s.bucket.Attrs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newBucket(attrs), nil
+}
+
+func (s *gcsSource) Objects(ctx context.Context, query Query) ObjectIterator {
+	return &gcsIterator{s.bucket.Objects(ctx, &storage.Query{
+		Prefix:      query.Prefix,
+		StartOffset: query.StartOffset,
+		EndOffset:   query.EndOffset,
+		MatchGlob:   query.MatchGlob,
+	})}
+}
+
+func (s *gcsSource) Folders(ctx context.Context, query Query) FolderIterator {
+	return &gcsFolderIterator{ctx: ctx, source: s, query: query}
+}
+
+// folderPage lists a page of folder names from a page token, returning the token of the next page
+type folderPage func(token string) (names []string, next string, err error)
+
+// gcsFolderIterator lists the folders of a bucket with hierarchical namespace, and then
+// its managed folders, a page at a time. Only folders can be listed between offsets,
+// so offsets and globs are applied to listed names.
+type gcsFolderIterator struct {
+	ctx     context.Context
+	source  *gcsSource
+	query   Query
+	match   func(name string) bool
+	lists   []folderPage
+	token   string
+	folders []*model.Directory
+	started bool
+}
+
+func (it *gcsFolderIterator) Next() (*model.Directory, error) {
+	for len(it.folders) == 0 {
+		if !it.started {
+			if err := it.start(); err != nil {
+				return nil, err
+			}
+			it.started = true
+		}
+
+		if len(it.lists) == 0 {
+			return nil, iterator.Done
+		}
+
+		names, next, err := it.lists[0](it.token)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			if it.match(name) {
+				it.folders = append(it.folders, &model.Directory{Bucket: it.source.name, Name: name, Folder: true})
+			}
+		}
+
+		it.token = next
+		if next == "" {
+			it.lists = it.lists[1:]
+		}
+	}
+
+	folder := it.folders[0]
+	it.folders = it.folders[1:]
+	return folder, nil
+}
+
+// start selects the folder listings of the bucket
+func (it *gcsFolderIterator) start() error {
+	match, err := it.query.matcher()
+	if err != nil {
+		return err
+	}
+	it.match = match
+
+	if it.source.service == nil {
+		return nil
+	}
+
+	// Only buckets with hierarchical namespace have folders
+	attrs, err := it.source.bucket.Attrs(it.ctx)
+	if err != nil {
+		return err
+	}
+	if attrs.HierarchicalNamespace != nil && attrs.HierarchicalNamespace.Enabled {
+		it.lists = append(it.lists, it.listFolders)
+	}
+
+	it.lists = append(it.lists, it.listManagedFolders)
+	return nil
+}
+
+func (it *gcsFolderIterator) listFolders(token string) ([]string, string, error) {
+	call := it.source.service.Folders.List(it.source.name).Context(it.ctx).Prefix(it.query.Prefix)
+	if it.query.StartOffset != "" {
+		call.StartOffset(it.query.StartOffset)
+	}
+	if it.query.EndOffset != "" {
+		call.EndOffset(it.query.EndOffset)
+	}
+	if token != "" {
+		call.PageToken(token)
+	}
+
+	resp, err := call.Do()
+	if err != nil {
+		return nil, "", err
+	}
+
+	names := make([]string, len(resp.Items))
+	for i, folder := range resp.Items {
+		names[i] = folder.Name
+	}
+	return names, resp.NextPageToken, nil
+}
+
+func (it *gcsFolderIterator) listManagedFolders(token string) ([]string, string, error) {
+	call := it.source.service.ManagedFolders.List(it.source.name).Context(it.ctx).Prefix(it.query.Prefix)
+	if token != "" {
+		call.PageToken(token)
+	}
+
+	resp, err := call.Do()
+	if err != nil {
+		return nil, "", err
+	}
+
+	names := make([]string, len(resp.Items))
+	for i, folder := range resp.Items {
+		names[i] = folder.Name
+	}
+	return names, resp.NextPageToken, nil
+}
+
+// gcsIterator converts the attributes of listed objects to metadata
+type gcsIterator struct {
+	it *storage.ObjectIterator
+}
+
+func (it *gcsIterator) Next() (*model.Metadata, error) {
+	obj, err := it.it.Next()
+	if err != nil {
+		return nil, err
+	}
+	return newMetadata(obj), nil
+}
+
+func newMetadata(obj *storage.ObjectAttrs) *model.Metadata {
+	return &model.Metadata{
+		Bucket:       obj.Bucket,
+		Name:         obj.Name,
+		Size:         obj.Size,
+		StorageClass: obj.StorageClass,
+		Created:      obj.Created,
+		Updated:      obj.Updated,
+	}
+}
+
+func newBucket(attrs *storage.BucketAttrs) *model.Bucket {
+	return &model.Bucket{
+		Name:         attrs.Name,
+		Location:     attrs.Location,
+		StorageClass: attrs.StorageClass,
+		Versioning:   attrs.VersioningEnabled,
+		Autoclass:    attrs.Autoclass != nil && attrs.Autoclass.Enabled,
+	}
+}
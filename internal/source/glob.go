@@ -0,0 +1,84 @@
+package source
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// compileGlob converts a glob pattern with the syntax of Cloud Storage match globs
+// to a regular expression matching whole object names:
+//   - * matches any sequence of characters except /
+//   - ** matches any sequence of characters including /
+//   - ? matches one character except /
+//   - [abc], [a-z] and [!abc] match one character of, or not of, a set
+//   - {a,b} matches any of the comma separated alternatives
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+
+	var braces int
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid glob %q: unterminated [", pattern)
+			}
+			set := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(set, "!") {
+				set = "^" + set[1:]
+			}
+			b.WriteString("[" + set + "]")
+			i += end + 1
+		case c == '{':
+			braces++
+			b.WriteString("(?:")
+		case c == '}' && braces > 0:
+			braces--
+			b.WriteString(")")
+		case c == ',' && braces > 0:
+			b.WriteString("|")
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+
+	if braces > 0 {
+		return nil, fmt.Errorf("invalid glob %q: unterminated {", pattern)
+	}
+
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+	}
+	return re, nil
+}
+
+// matcher returns a function reporting whether a name matches query,
+// filtering names by glob for sources that cannot filter them when listing
+func (q Query) matcher() (func(name string) bool, error) {
+	if q.MatchGlob == "" {
+		return q.inRange, nil
+	}
+
+	re, err := compileGlob(q.MatchGlob)
+	if err != nil {
+		return nil, err
+	}
+	return func(name string) bool {
+		return q.inRange(name) && re.MatchString(name)
+	}, nil
+}
@@ -0,0 +1,82 @@
+package source
+
+import "testing"
+
+func TestCompileGlob(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.json", "file.json", true},
+		{"*.json", "dir/file.json", false},
+		{"**.json", "dir/file.json", true},
+		{"**/*.json", "a/b/file.json", true},
+		{"logs/*", "logs/file", true},
+		{"logs/*", "logs/dir/file", false},
+		{"file?.txt", "file1.txt", true},
+		{"file?.txt", "file10.txt", false},
+		{"file?", "file/", false},
+		{"file[0-9]", "file5", true},
+		{"file[!0-9]", "file5", false},
+		{"file[!0-9]", "filea", true},
+		{"*.{json,csv}", "file.csv", true},
+		{"*.{json,csv}", "file.txt", false},
+		{"a.b", "axb", false},
+		{"a+b", "a+b", true},
+		{"a\\*b", "a*b", true},
+		{"a\\*b", "axb", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern+" "+tc.name, func(t *testing.T) {
+			re, err := compileGlob(tc.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := re.MatchString(tc.name); got != tc.want {
+				t.Errorf("Match mismatch: got %t, want %t (%s)", got, tc.want, re)
+			}
+		})
+	}
+}
+
+func TestCompileGlobInvalid(t *testing.T) {
+	for _, pattern := range []string{"file[0-9", "*.{json,csv", "file[z-a]"} {
+		t.Run(pattern, func(t *testing.T) {
+			if _, err := compileGlob(pattern); err == nil {
+				t.Errorf("Error mismatch: got nil, want error for %q", pattern)
+			}
+		})
+	}
+}
+
+func TestQueryMatcher(t *testing.T) {
+	query := Query{Prefix: "logs/", StartOffset: "logs/b", EndOffset: "logs/d", MatchGlob: "**.json"}
+
+	testCases := []struct {
+		name string
+		want bool
+	}{
+		{"logs/a.json", false},
+		{"logs/b.json", true},
+		{"logs/c/x.json", true},
+		{"logs/c.txt", false},
+		{"logs/d.json", false},
+		{"other/c.json", false},
+	}
+
+	match, err := query.matcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := match(tc.name); got != tc.want {
+				t.Errorf("Match mismatch: got %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
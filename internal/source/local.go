@@ -0,0 +1,198 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"google.golang.org/api/iterator"
+)
+
+// LocalLocation is the location recorded for buckets of local directories
+const LocalLocation = "LOCAL"
+
+// localSource lists the regular files under a directory as the objects of a bucket,
+// named by their slash separated paths relative to the directory
+type localSource struct {
+	root   string
+	bucket string
+}
+
+// NewLocal returns a source listing the files under root as the objects of bucket.
+// Files are listed as STANDARD objects created and updated at their modification time,
+// and directories below root as folders.
+func NewLocal(root, bucket string) Source {
+	return &localSource{root: root, bucket: bucket}
+}
+
+func (s *localSource) Attrs(ctx context.Context) (*model.Bucket, error) {
+	info, err := os.Stat(s.root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", s.root)
+	}
+
+	return &model.Bucket{
+		Name:         s.bucket,
+		Location:     LocalLocation,
+		StorageClass: "STANDARD",
+	}, nil
+}
+
+func (s *localSource) Objects(ctx context.Context, query Query) ObjectIterator {
+	return &localIterator{ctx: ctx, source: s, query: query}
+}
+
+// localIterator walks the directory on the first call to Next, since walking
+// does not list names in the lexicographic order of object names
+type localIterator struct {
+	ctx     context.Context
+	source  *localSource
+	query   Query
+	objects []*model.Metadata
+	err     error
+	walked  bool
+}
+
+func (it *localIterator) Next() (*model.Metadata, error) {
+	if !it.walked {
+		it.objects, it.err = it.source.walk(it.ctx, it.query)
+		it.walked = true
+	}
+
+	if it.err != nil {
+		return nil, it.err
+	}
+
+	if len(it.objects) == 0 {
+		return nil, iterator.Done
+	}
+
+	obj := it.objects[0]
+	it.objects = it.objects[1:]
+	return obj, nil
+}
+
+func (s *localSource) Folders(ctx context.Context, query Query) FolderIterator {
+	folders, err := s.walkFolders(ctx, query)
+	return &folderList{folders: folders, err: err}
+}
+
+// walkRoot returns the directory containing the prefix of query, the only one walked
+func (s *localSource) walkRoot(query Query) string {
+	if i := strings.LastIndexByte(query.Prefix, '/'); i >= 0 {
+		return filepath.Join(s.root, filepath.FromSlash(path.Clean(query.Prefix[:i+1])))
+	}
+	return s.root
+}
+
+// walkFolders returns the directories below root whose names, with a trailing slash, match query
+func (s *localSource) walkFolders(ctx context.Context, query Query) ([]*model.Directory, error) {
+	match, err := query.matcher()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := s.walkRoot(query)
+
+	var folders []*model.Directory
+	err = filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !d.IsDir() || name == s.root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, name)
+		if err != nil {
+			return err
+		}
+
+		folderName := filepath.ToSlash(rel) + "/"
+		if match(folderName) {
+			folders = append(folders, &model.Directory{Bucket: s.bucket, Name: folderName, Folder: true})
+		}
+		return nil
+	})
+
+	// A prefix of a missing directory matches no folders
+	if errors.Is(err, fs.ErrNotExist) && dir != s.root {
+		return nil, nil
+	}
+	return folders, err
+}
+
+// walk returns the files matching query sorted by name. Only the
+// directory containing the prefix of query is walked.
+func (s *localSource) walk(ctx context.Context, query Query) ([]*model.Metadata, error) {
+	match, err := query.matcher()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := s.walkRoot(query)
+
+	var objects []*model.Metadata
+	err = filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, name)
+		if err != nil {
+			return err
+		}
+
+		objName := filepath.ToSlash(rel)
+		if !match(objName) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, &model.Metadata{
+			Bucket:       s.bucket,
+			Name:         objName,
+			Size:         info.Size(),
+			StorageClass: "STANDARD",
+			Created:      info.ModTime().UTC(),
+			Updated:      info.ModTime().UTC(),
+		})
+		return nil
+	})
+
+	// A prefix of a missing directory matches no objects
+	if errors.Is(err, fs.ErrNotExist) && dir != s.root {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(objects, func(a, b *model.Metadata) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return objects, nil
+}
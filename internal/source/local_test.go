@@ -0,0 +1,164 @@
+package source
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"google.golang.org/api/iterator"
+)
+
+// listNames returns the names of all objects of it
+func listNames(t *testing.T, it ObjectIterator) []string {
+	t.Helper()
+
+	names := []string{}
+	for {
+		obj, err := it.Next()
+		if err == iterator.Done {
+			return names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, obj.Name)
+	}
+}
+
+func TestLocalObjects(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.txt", "a/b.json", "a/c/d.json", "logs/2024.json", "logs/2025.json", "logs/2025.csv"} {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Empty directories are not objects
+	if err := os.Mkdir(filepath.Join(root, "empty"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"Lists all files in name order", Query{}, []string{"a.txt", "a/b.json", "a/c/d.json", "logs/2024.json", "logs/2025.csv", "logs/2025.json"}},
+		{"Lists directory prefix", Query{Prefix: "a/"}, []string{"a/b.json", "a/c/d.json"}},
+		{"Lists name prefix", Query{Prefix: "logs/2025"}, []string{"logs/2025.csv", "logs/2025.json"}},
+		{"Lists prefix of missing directory", Query{Prefix: "missing/"}, []string{}},
+		{"Lists between offsets", Query{StartOffset: "a/b.json", EndOffset: "logs/2025"}, []string{"a/b.json", "a/c/d.json", "logs/2024.json"}},
+		{"Lists matching glob", Query{MatchGlob: "**.json"}, []string{"a/b.json", "a/c/d.json", "logs/2024.json", "logs/2025.json"}},
+	}
+
+	source := NewLocal(root, "mock")
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := listNames(t, source.Objects(context.Background(), tc.query))
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("Objects mismatch: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	it := source.Objects(context.Background(), Query{Prefix: "a/b"})
+	obj, err := it.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if obj.Bucket != "mock" || obj.Size != int64(len("a/b.json")) || obj.StorageClass != "STANDARD" || obj.Updated.IsZero() {
+		t.Errorf("Metadata mismatch: got %+v", obj)
+	}
+}
+
+// listFolderNames returns the names of all folders of it in name order
+func listFolderNames(t *testing.T, it FolderIterator) []string {
+	t.Helper()
+
+	names := []string{}
+	for {
+		folder, err := it.Next()
+		if err == iterator.Done {
+			slices.Sort(names)
+			return names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !folder.Folder {
+			t.Errorf("Directory %s is not a folder", folder.Name)
+		}
+		names = append(names, folder.Name)
+	}
+}
+
+func TestLocalFolders(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a/c", "empty", "logs/2025"} {
+		if err := os.MkdirAll(filepath.Join(root, filepath.FromSlash(dir)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"Lists all directories", Query{}, []string{"a/", "a/c/", "empty/", "logs/", "logs/2025/"}},
+		{"Lists directory prefix", Query{Prefix: "a/"}, []string{"a/", "a/c/"}},
+		{"Lists name prefix", Query{Prefix: "log"}, []string{"logs/", "logs/2025/"}},
+		{"Lists prefix of missing directory", Query{Prefix: "missing/"}, []string{}},
+		{"Lists matching glob", Query{MatchGlob: "*/"}, []string{"a/", "empty/", "logs/"}},
+	}
+
+	source := NewLocal(root, "mock")
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := listFolderNames(t, source.Folders(context.Background(), tc.query))
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("Folders mismatch: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLocalAttrs(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		root    string
+		wantErr bool
+	}{
+		{"Returns attributes of directory", root, false},
+		{"Fails on file", file, true},
+		{"Fails on missing directory", filepath.Join(root, "missing"), true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			attrs, err := NewLocal(tc.root, "mock").Attrs(context.Background())
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Error mismatch: got %v, want error %t", err, tc.wantErr)
+			}
+
+			if err == nil && (attrs.Name != "mock" || attrs.Location != LocalLocation) {
+				t.Errorf("Attributes mismatch: got %+v", attrs)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package source
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"google.golang.org/api/iterator"
+)
+
+// S3Config configures the connection to an S3-compatible object store
+type S3Config struct {
+	// Endpoint is the URL of the store, such as https://s3.us-east-1.amazonaws.com or http://localhost:9000.
+	// Buckets are addressed by path, as supported by S3-compatible stores.
+	Endpoint string
+	// Region signs requests, us-east-1 if empty
+	Region string
+	// AccessKey and SecretKey sign requests, which are anonymous if AccessKey is empty
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// Client sends requests, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// S3Error is an error response of an S3-compatible store
+type S3Error struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("s3: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// HTTPStatus returns the status code of the response, classifying the error for retries
+func (e *S3Error) HTTPStatus() int {
+	return e.StatusCode
+}
+
+// s3Source lists the objects of a bucket of an S3-compatible store with ListObjectsV2
+type s3Source struct {
+	config S3Config
+	bucket string
+}
+
+// NewS3 returns a source listing the objects of a bucket of an S3-compatible store.
+// Storage classes are mapped to the closest Cloud Storage class.
+func NewS3(config S3Config, bucket string) Source {
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+
+	return &s3Source{config: config, bucket: bucket}
+}
+
+// get sends a signed GET request for the bucket with query and decodes the XML response into v
+func (s *s3Source) get(ctx context.Context, query url.Values, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.config.Endpoint+"/"+s.bucket+"/?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	if s.config.AccessKey != "" {
+		signV4(req, s.config.AccessKey, s.config.SecretKey, s.config.SessionToken, s.config.Region, time.Now())
+	}
+
+	resp, err := s.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		s3Err := &S3Error{StatusCode: resp.StatusCode}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		if err := xml.Unmarshal(body, s3Err); err != nil {
+			s3Err.Code = http.StatusText(resp.StatusCode)
+		}
+		return s3Err
+	}
+
+	return xml.NewDecoder(resp.Body).Decode(v)
+}
+
+func (s *s3Source) Attrs(ctx context.Context) (*model.Bucket, error) {
+	var location struct {
+		Region string `xml:",chardata"`
+	}
+	if err := s.get(ctx, url.Values{"location": {""}}, &location); err != nil {
+		return nil, fmt.Errorf("error getting bucket location: %w", err)
+	}
+
+	var versioning struct {
+		Status string `xml:"Status"`
+	}
+	if err := s.get(ctx, url.Values{"versioning": {""}}, &versioning); err != nil {
+		return nil, fmt.Errorf("error getting bucket versioning: %w", err)
+	}
+
+	// Buckets without a location constraint are in us-east-1
+	region := location.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &model.Bucket{
+		Name:         s.bucket,
+		Location:     strings.ToUpper(region),
+		StorageClass: "STANDARD",
+		Versioning:   versioning.Status == "Enabled",
+	}, nil
+}
+
+func (s *s3Source) Objects(ctx context.Context, query Query) ObjectIterator {
+	return &s3Iterator{ctx: ctx, source: s, query: query}
+}
+
+// Folders lists no folders, since S3 has none. Keys ending with a slash are listed as objects.
+func (s *s3Source) Folders(ctx context.Context, query Query) FolderIterator {
+	return &folderList{}
+}
+
+// listObjectsResult is a page of a ListObjectsV2 response
+type listObjectsResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		Size         int64     `xml:"Size"`
+		StorageClass string    `xml:"StorageClass"`
+	} `xml:"Contents"`
+}
+
+// s3Iterator lists objects a page at a time. Offsets and globs are applied to
+// listed names, since ListObjectsV2 only supports an exclusive start.
+type s3Iterator struct {
+	ctx     context.Context
+	source  *s3Source
+	query   Query
+	match   func(name string) bool
+	token   string
+	objects []*model.Metadata
+	started bool
+	done    bool
+}
+
+func (it *s3Iterator) Next() (*model.Metadata, error) {
+	for len(it.objects) == 0 {
+		if it.done {
+			return nil, iterator.Done
+		}
+		if err := it.nextPage(); err != nil {
+			return nil, err
+		}
+	}
+
+	obj := it.objects[0]
+	it.objects = it.objects[1:]
+	return obj, nil
+}
+
+// nextPage lists the next page of objects matching the query
+func (it *s3Iterator) nextPage() error {
+	params := url.Values{"list-type": {"2"}}
+	if it.query.Prefix != "" {
+		params.Set("prefix", it.query.Prefix)
+	}
+
+	// Names after the offset without its last byte include all names from the offset
+	if offset := it.query.StartOffset; offset != "" {
+		params.Set("start-after", offset[:len(offset)-1])
+	}
+
+	if !it.started {
+		match, err := it.query.matcher()
+		if err != nil {
+			return err
+		}
+		it.match = match
+		it.started = true
+	} else {
+		params.Set("continuation-token", it.token)
+	}
+
+	var result listObjectsResult
+	if err := it.source.get(it.ctx, params, &result); err != nil {
+		return err
+	}
+
+	for _, c := range result.Contents {
+		if it.query.EndOffset != "" && c.Key >= it.query.EndOffset {
+			it.done = true
+			return nil
+		}
+		if !it.match(c.Key) {
+			continue
+		}
+
+		it.objects = append(it.objects, &model.Metadata{
+			Bucket:       it.source.bucket,
+			Name:         c.Key,
+			Size:         c.Size,
+			StorageClass: s3StorageClass(c.StorageClass),
+			Created:      c.LastModified,
+			Updated:      c.LastModified,
+		})
+	}
+
+	it.token = result.NextContinuationToken
+	it.done = !result.IsTruncated
+	return nil
+}
+
+// s3StorageClass returns the Cloud Storage class closest to an S3 storage class
+func s3StorageClass(class string) string {
+	switch class {
+	case "STANDARD_IA", "ONEZONE_IA", "INTELLIGENT_TIERING":
+		return "NEARLINE"
+	case "GLACIER_IR":
+		return "COLDLINE"
+	case "GLACIER", "DEEP_ARCHIVE":
+		return "ARCHIVE"
+	default:
+		return "STANDARD"
+	}
+}
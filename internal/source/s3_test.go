@@ -0,0 +1,186 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeS3 serves ListObjectsV2 for the keys of one bucket, two keys per page
+type fakeS3 struct {
+	bucket string
+	keys   []string
+	// status fails all requests if set
+	status int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=mock/") {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`)
+		return
+	}
+
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		fmt.Fprint(w, `<Error><Code>SlowDown</Code><Message>Reduce your request rate</Message></Error>`)
+		return
+	}
+
+	if r.URL.Path != "/"+f.bucket+"/" {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<Error><Code>NoSuchBucket</Code><Message>The specified bucket does not exist</Message></Error>`)
+		return
+	}
+
+	query := r.URL.Query()
+	switch {
+	case query.Has("location"):
+		fmt.Fprint(w, `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">eu-west-1</LocationConstraint>`)
+		return
+	case query.Has("versioning"):
+		fmt.Fprint(w, `<VersioningConfiguration><Status>Enabled</Status></VersioningConfiguration>`)
+		return
+	}
+
+	// Continuation tokens are the last key of the previous page
+	after := max(query.Get("start-after"), query.Get("continuation-token"))
+
+	var keys []string
+	for _, key := range f.keys {
+		if strings.HasPrefix(key, query.Get("prefix")) && key > after {
+			keys = append(keys, key)
+		}
+	}
+
+	end := min(2, len(keys))
+
+	fmt.Fprint(w, `<ListBucketResult>`)
+	if end < len(keys) {
+		fmt.Fprintf(w, `<IsTruncated>true</IsTruncated><NextContinuationToken>%s</NextContinuationToken>`, keys[end-1])
+	} else {
+		fmt.Fprint(w, `<IsTruncated>false</IsTruncated>`)
+	}
+	for i, key := range keys[:end] {
+		class := []string{"STANDARD", "GLACIER"}[i%2]
+		fmt.Fprintf(w, `<Contents><Key>%s</Key><LastModified>2024-01-02T03:04:05.000Z</LastModified><Size>%d</Size><StorageClass>%s</StorageClass></Contents>`, key, len(key), class)
+	}
+	fmt.Fprint(w, `</ListBucketResult>`)
+}
+
+func newTestS3(t *testing.T, fake *fakeS3, bucket string) Source {
+	t.Helper()
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	return NewS3(S3Config{Endpoint: server.URL + "/", AccessKey: "mock", SecretKey: "mock"}, bucket)
+}
+
+func TestS3Objects(t *testing.T) {
+	keys := []string{"a.txt", "a/b.json", "a/c/d.json", "logs/2024.json", "logs/2025.csv", "logs/2025.json"}
+
+	testCases := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"Lists all pages", Query{}, keys},
+		{"Lists prefix", Query{Prefix: "a/"}, []string{"a/b.json", "a/c/d.json"}},
+		{"Lists from inclusive start offset", Query{StartOffset: "a/b.json"}, keys[1:]},
+		{"Lists until exclusive end offset", Query{EndOffset: "logs/2025"}, keys[:4]},
+		{"Lists matching glob", Query{Prefix: "logs/", MatchGlob: "**.json"}, []string{"logs/2024.json", "logs/2025.json"}},
+		{"Lists nothing", Query{Prefix: "missing/"}, []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			source := newTestS3(t, &fakeS3{bucket: "mock", keys: keys}, "mock")
+
+			got := listNames(t, source.Objects(context.Background(), tc.query))
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("Objects mismatch: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestS3Metadata(t *testing.T) {
+	source := newTestS3(t, &fakeS3{bucket: "mock", keys: []string{"file1", "file2"}}, "mock")
+	it := source.Objects(context.Background(), Query{})
+
+	for _, wantClass := range []string{"STANDARD", "ARCHIVE"} {
+		obj, err := it.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if obj.Bucket != "mock" || obj.Size != 5 || obj.StorageClass != wantClass || obj.Updated.Year() != 2024 || !obj.Created.Equal(obj.Updated) {
+			t.Errorf("Metadata mismatch: got %+v", obj)
+		}
+	}
+}
+
+func TestS3Attrs(t *testing.T) {
+	source := newTestS3(t, &fakeS3{bucket: "mock"}, "mock")
+
+	attrs, err := source.Attrs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attrs.Name != "mock" || attrs.Location != "EU-WEST-1" || !attrs.Versioning {
+		t.Errorf("Attributes mismatch: got %+v", attrs)
+	}
+}
+
+func TestS3Errors(t *testing.T) {
+	testCases := []struct {
+		name       string
+		fake       *fakeS3
+		bucket     string
+		wantStatus int
+		wantCode   string
+	}{
+		{"Returns missing bucket", &fakeS3{bucket: "mock"}, "other", http.StatusNotFound, "NoSuchBucket"},
+		{"Returns unavailable store", &fakeS3{bucket: "mock", status: http.StatusServiceUnavailable}, "mock", http.StatusServiceUnavailable, "SlowDown"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			source := newTestS3(t, tc.fake, tc.bucket)
+
+			_, err := source.Objects(context.Background(), Query{}).Next()
+
+			var s3Err *S3Error
+			if !errors.As(err, &s3Err) || s3Err.HTTPStatus() != tc.wantStatus || s3Err.Code != tc.wantCode {
+				t.Errorf("Error mismatch: got %v, want %d %s", err, tc.wantStatus, tc.wantCode)
+			}
+		})
+	}
+}
+
+func TestS3StorageClass(t *testing.T) {
+	testCases := map[string]string{
+		"":                    "STANDARD",
+		"STANDARD":            "STANDARD",
+		"REDUCED_REDUNDANCY":  "STANDARD",
+		"STANDARD_IA":         "NEARLINE",
+		"ONEZONE_IA":          "NEARLINE",
+		"INTELLIGENT_TIERING": "NEARLINE",
+		"GLACIER_IR":          "COLDLINE",
+		"GLACIER":             "ARCHIVE",
+		"DEEP_ARCHIVE":        "ARCHIVE",
+	}
+
+	for class, want := range testCases {
+		if got := s3StorageClass(class); got != want {
+			t.Errorf("Storage class mismatch for %q: got %s, want %s", class, got, want)
+		}
+	}
+}
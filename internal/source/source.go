@@ -0,0 +1,82 @@
+// Package source lists the objects and folders of a bucket from Cloud Storage,
+// a local directory or an S3-compatible object store.
+package source
+
+import (
+	"context"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"google.golang.org/api/iterator"
+)
+
+// Query limits the objects listed from a source, with the semantics of storage.Query
+type Query struct {
+	// Prefix lists only objects whose names start with it
+	Prefix string
+	// StartOffset lists only objects whose names are equal to or after it
+	StartOffset string
+	// EndOffset lists only objects whose names are before it
+	EndOffset string
+	// MatchGlob lists only objects whose names match the glob pattern
+	MatchGlob string
+}
+
+// ObjectIterator returns the objects of a listing one at a time.
+// Next returns iterator.Done once all objects have been returned.
+type ObjectIterator interface {
+	Next() (*model.Metadata, error)
+}
+
+// FolderIterator returns the folders of a listing one at a time.
+// Next returns iterator.Done once all folders have been returned.
+type FolderIterator interface {
+	Next() (*model.Directory, error)
+}
+
+// Source lists the objects and folders of a bucket
+type Source interface {
+	// Attrs returns the attributes of the bucket
+	Attrs(ctx context.Context) (*model.Bucket, error)
+	// Objects returns the objects matching query in lexicographic order of their names
+	Objects(ctx context.Context, query Query) ObjectIterator
+	// Folders returns the folders whose names match query, in no particular order.
+	// Folders exist even when empty, unlike directories implied by object names.
+	Folders(ctx context.Context, query Query) FolderIterator
+}
+
+// Kind names the implementations of Source
+type Kind string
+
+const (
+	KindGCS   Kind = "gcs"
+	KindLocal Kind = "local"
+	KindS3    Kind = "s3"
+)
+
+// inRange reports whether name matches the prefix and offsets of query
+func (q Query) inRange(name string) bool {
+	return strings.HasPrefix(name, q.Prefix) &&
+		name >= q.StartOffset &&
+		(q.EndOffset == "" || name < q.EndOffset)
+}
+
+// folderList returns folders listed at once
+type folderList struct {
+	folders []*model.Directory
+	err     error
+}
+
+func (it *folderList) Next() (*model.Directory, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+
+	if len(it.folders) == 0 {
+		return nil, iterator.Done
+	}
+
+	folder := it.folders[0]
+	it.folders = it.folders[1:]
+	return folder, nil
+}
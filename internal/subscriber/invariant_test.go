@@ -0,0 +1,210 @@
+package subscriber
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+)
+
+// testNames are the objects of generated events, sharing directories at several depths
+var testNames = []string{"file1", "file2", "a/file1", "a/file2", "a/b/file1", "a/b/c/file1", "a//file1", "d/file1", "a/", "a/b/", "/file1", "/a/file1"}
+
+var testStorageClasses = []string{"STANDARD", "NEARLINE", "COLDLINE", "ARCHIVE"}
+
+// testEvent is a notification of an event on an object
+type testEvent struct {
+	eventType   string
+	obj         model.Metadata
+	overwritten bool
+}
+
+func (e testEvent) message() *pubsub.Message {
+	data, _ := json.Marshal(map[string]string{
+		"bucket":       e.obj.Bucket,
+		"name":         e.obj.Name,
+		"size":         strconv.FormatInt(e.obj.Size, 10),
+		"storageClass": e.obj.StorageClass,
+		"updated":      e.obj.Updated.Format(time.RFC3339Nano),
+		"timeCreated":  e.obj.Created.Format(time.RFC3339Nano),
+	})
+
+	attributes := map[string]string{"eventType": e.eventType}
+	if e.overwritten {
+		attributes["overwrittenByGeneration"] = "2"
+	}
+	return &pubsub.Message{Data: data, Attributes: attributes}
+}
+
+// generateEvents returns the notifications of random object histories in the order they
+// occur, and the objects existing once all have occurred by name
+func generateEvents(r *rand.Rand) ([]testEvent, map[string]model.Metadata) {
+	var events []testEvent
+	existing := map[string]model.Metadata{}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 40; i++ {
+		now = now.Add(time.Second)
+		bucket := []string{"mock-1", "mock-2"}[r.IntN(2)]
+		name := testNames[r.IntN(len(testNames))]
+		key := bucket + "/" + name
+		obj, exists := existing[key]
+
+		switch op := r.IntN(3); {
+		case !exists || op == 0:
+			// Writing an object replaces the current one, notified as overwritten
+			if exists {
+				events = append(events, testEvent{storage.ObjectDeleteEvent, obj, true})
+			}
+			obj = model.Metadata{
+				Bucket:       bucket,
+				Name:         name,
+				Size:         r.Int64N(1000),
+				StorageClass: testStorageClasses[r.IntN(len(testStorageClasses))],
+				Created:      now,
+				Updated:      now,
+			}
+			existing[key] = obj
+			events = append(events, testEvent{storage.ObjectFinalizeEvent, obj, false})
+		case op == 1:
+			// Changing the storage class of an object rewrites it
+			obj.StorageClass = testStorageClasses[(slices.Index(testStorageClasses, obj.StorageClass)+1+r.IntN(3))%len(testStorageClasses)]
+			obj.Updated = now
+			existing[key] = obj
+			events = append(events, testEvent{storage.ObjectArchiveEvent, obj, false})
+		default:
+			delete(existing, key)
+			events = append(events, testEvent{storage.ObjectDeleteEvent, obj, false})
+		}
+	}
+	return events, existing
+}
+
+// deliver processes events as Pub/Sub delivers them, redelivering events that are not
+// acknowledged after the others until none succeeds. It returns the events never acknowledged.
+func deliver(t *testing.T, s *SubscriberService, events []testEvent) []testEvent {
+	t.Helper()
+
+	for len(events) > 0 {
+		var nacked []testEvent
+		for _, e := range events {
+			if err := processMessage(context.Background(), s, e.message()); err != nil {
+				nacked = append(nacked, e)
+			}
+		}
+
+		if len(nacked) == len(events) {
+			return nacked
+		}
+		events = nacked
+	}
+	return nil
+}
+
+// newInvariantTestService returns a subscriber of a new database and the invariants of its directories
+func newInvariantTestService(t *testing.T) (*SubscriberService, repo.InvariantRepository, repo.MetadataRepository) {
+	t.Helper()
+
+	db := repo.NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	metadataRepo := repo.NewMetadataRepository(db)
+	s := &SubscriberService{
+		directoryRepo: repo.NewDirectoryRepository(db),
+		metadataRepo:  metadataRepo,
+		statusRepo:    repo.NewStatusRepository(db),
+		transactor:    repo.NewTransactor(db),
+	}
+	return s, repo.NewInvariantRepository(db), metadataRepo
+}
+
+// checkInvariants fails the test if any directory breaks an invariant
+func checkInvariants(t *testing.T, invariantRepo repo.InvariantRepository) {
+	t.Helper()
+
+	violations, err := invariantRepo.Check(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range violations {
+		t.Errorf("Invariant violated: %s", v)
+	}
+}
+
+func TestEventsInOrderKeepInvariants(t *testing.T) {
+	for seed := uint64(0); seed < 50; seed++ {
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			r := rand.New(rand.NewPCG(seed, seed))
+			events, existing := generateEvents(r)
+
+			// Pub/Sub delivers events at least once
+			var delivered []testEvent
+			for _, e := range events {
+				delivered = append(delivered, e)
+				if r.IntN(4) == 0 {
+					delivered = append(delivered, e)
+				}
+			}
+
+			s, invariantRepo, metadataRepo := newInvariantTestService(t)
+			deliver(t, s, delivered)
+			checkInvariants(t, invariantRepo)
+
+			// Events delivered in order leave the objects existing after the last one
+			for _, testName := range testNames {
+				for _, bucket := range []string{"mock-1", "mock-2"} {
+					want, wantExists := existing[bucket+"/"+testName]
+
+					got, err := metadataRepo.Get(context.Background(), bucket, testName)
+					if exists := err == nil; exists != wantExists {
+						t.Fatalf("Existence mismatch for %s/%s: got %t, want %t (%v)", bucket, testName, exists, wantExists, err)
+					}
+
+					if wantExists && (got.Size != want.Size || got.StorageClass != want.StorageClass) {
+						t.Errorf("Metadata mismatch for %s/%s: got %d %s, want %d %s", bucket, testName, got.Size, got.StorageClass, want.Size, want.StorageClass)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestShuffledEventsKeepInvariants(t *testing.T) {
+	for seed := uint64(0); seed < 100; seed++ {
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			r := rand.New(rand.NewPCG(seed, seed))
+			events, _ := generateEvents(r)
+
+			// Pub/Sub delivers events at least once and in any order
+			for _, e := range events[:len(events)/3] {
+				events = append(events, e)
+			}
+			r.Shuffle(len(events), func(i, j int) {
+				events[i], events[j] = events[j], events[i]
+			})
+
+			s, invariantRepo, _ := newInvariantTestService(t)
+			deliver(t, s, events)
+			checkInvariants(t, invariantRepo)
+		})
+	}
+}
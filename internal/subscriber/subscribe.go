@@ -4,15 +4,38 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"strconv"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/pubsub"
 	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/logging"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/metrics"
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Cloud Storage notifications only notify events on objects. Folders of buckets with
+// hierarchical namespace and managed folders are created, deleted and renamed through the
+// Storage Control API, whose calls are recorded in the Admin Activity audit logs of Cloud
+// Storage (https://cloud.google.com/storage/docs/audit-logging). A log sink routing these
+// entries to the topic of the subscription publishes each of them as a LogEntry in JSON
+// without the attributes of notifications (https://cloud.google.com/logging/docs/export/pubsub),
+// whose protoPayload is an AuditLog naming the called method and the folder resource.
+// Renaming a folder moves all objects and folders under it without notifying them.
+const (
+	FolderCreateMethod        = "google.storage.control.v2.StorageControl.CreateFolder"
+	FolderDeleteMethod        = "google.storage.control.v2.StorageControl.DeleteFolder"
+	FolderRenameMethod        = "google.storage.control.v2.StorageControl.RenameFolder"
+	ManagedFolderCreateMethod = "google.storage.control.v2.StorageControl.CreateManagedFolder"
+	ManagedFolderDeleteMethod = "google.storage.control.v2.StorageControl.DeleteManagedFolder"
 )
 
 type payload struct {
@@ -24,12 +47,100 @@ type payload struct {
 	Created      time.Time
 }
 
+// auditLogEntry is a LogEntry of an audit log, of which only the fields of folder methods are read.
+// See https://cloud.google.com/logging/docs/reference/audit/auditlog/rest/Shared.Types/AuditLog
+type auditLogEntry struct {
+	Timestamp    time.Time `json:"timestamp"`
+	ProtoPayload struct {
+		MethodName string `json:"methodName"`
+		// ResourceName is projects/_/buckets/BUCKET/folders/NAME, or managedFolders/NAME
+		ResourceName string `json:"resourceName"`
+		// Status is the error of a failed call, whose code is 0 on success
+		Status struct {
+			Code int `json:"code"`
+		} `json:"status"`
+		// Request holds the folder a folder is renamed to
+		Request struct {
+			DestinationFolderId string `json:"destinationFolderId"`
+		} `json:"request"`
+	} `json:"protoPayload"`
+}
+
+// folderEvent is a folder created, deleted or renamed by a folder method
+type folderEvent struct {
+	Method string
+	Bucket string
+	Name   string
+	// Source is the folder renamed to Name
+	Source string
+	Time   time.Time
+}
+
+// isFolderMethod reports whether method is a folder method
+func isFolderMethod(method string) bool {
+	switch method {
+	case FolderCreateMethod, FolderDeleteMethod, FolderRenameMethod, ManagedFolderCreateMethod, ManagedFolderDeleteMethod:
+		return true
+	}
+	return false
+}
+
+// newFolderEvent returns the folder event of an audit log entry of a folder method.
+// A renamed folder is named by the resource and renamed to the destination of the request.
+func newFolderEvent(entry auditLogEntry) (*folderEvent, error) {
+	method := entry.ProtoPayload.MethodName
+	if !isFolderMethod(method) {
+		return nil, fmt.Errorf("unknown method: %s", method)
+	}
+
+	resource := entry.ProtoPayload.ResourceName
+	_, rest, _ := strings.Cut(resource, "/buckets/")
+	bucket, rest, _ := strings.Cut(rest, "/")
+	collection, name, _ := strings.Cut(rest, "/")
+	if bucket == "" || name == "" || collection != "folders" && collection != "managedFolders" {
+		return nil, fmt.Errorf("invalid folder resource name %q", resource)
+	}
+
+	event := &folderEvent{Method: method, Bucket: bucket, Name: folderName(name), Time: entry.Timestamp}
+	if method == FolderRenameMethod {
+		destination := entry.ProtoPayload.Request.DestinationFolderId
+		if destination == "" {
+			return nil, errors.New("renamed folder without destination folder")
+		}
+		event.Source, event.Name = event.Name, folderName(destination)
+	}
+	return event, nil
+}
+
+// folderName returns the name of a folder ending with a slash as directories do
+func folderName(name string) string {
+	if strings.HasSuffix(name, "/") {
+		return name
+	}
+	return name + "/"
+}
+
+// messageEventType returns the type of event notified by msg, or the method of a
+// folder event routed from the audit logs
+func messageEventType(msg *pubsub.Message) string {
+	if eventType, ok := msg.Attributes["eventType"]; ok {
+		return eventType
+	}
+
+	var entry auditLogEntry
+	if err := json.Unmarshal(msg.Data, &entry); err != nil || !isFolderMethod(entry.ProtoPayload.MethodName) {
+		return ""
+	}
+	return entry.ProtoPayload.MethodName
+}
+
 type Susbcriber interface {
 	Start(ctx context.Context) error
 	consumeMessage(ctx context.Context, msg *pubsub.Message)
-	handleFinalize(inMetadata *model.Metadata) error
-	handleArchive(inMetadata *model.Metadata) error
-	handleDelete(inMetadata *model.Metadata) error
+	handleFinalize(ctx context.Context, sep paths.Separator, inMetadata *model.Metadata) error
+	handleArchive(ctx context.Context, sep paths.Separator, inMetadata *model.Metadata) error
+	handleDelete(ctx context.Context, sep paths.Separator, inMetadata *model.Metadata) error
+	handleFolder(ctx context.Context, sep paths.Separator, event *folderEvent) error
 }
 
 type SubscriberService struct {
@@ -37,14 +148,24 @@ type SubscriberService struct {
 	subscriptionId string
 	directoryRepo  repo.DirectoryRepository
 	metadataRepo   repo.MetadataRepository
+	statusRepo     repo.StatusRepository
+	moveRepo       repo.MoveRepository
+	bucketRepo     repo.BucketRepository
+	transactor     repo.Transactor
+	logger         *slog.Logger
 }
 
-func NewSubscriberService(client *pubsub.Client, subscriptionId string, directoryRepo repo.DirectoryRepository, metadataRepo repo.MetadataRepository) *SubscriberService {
+func NewSubscriberService(client *pubsub.Client, subscriptionId string, directoryRepo repo.DirectoryRepository, metadataRepo repo.MetadataRepository, statusRepo repo.StatusRepository, moveRepo repo.MoveRepository, bucketRepo repo.BucketRepository, transactor repo.Transactor, logger *slog.Logger) *SubscriberService {
 	return &SubscriberService{
 		client,
 		subscriptionId,
 		directoryRepo,
 		metadataRepo,
+		statusRepo,
+		moveRepo,
+		bucketRepo,
+		transactor,
+		logger,
 	}
 }
 
@@ -65,6 +186,9 @@ func newMetadata(p payload) (*model.Metadata, error) {
 }
 
 // Start initiates subscription process by listening to all messages at subscriptionId
+//
+// Once ctx is cancelled, Start stops receiving messages and returns after all
+// outstanding messages have been handled.
 func (s *SubscriberService) Start(ctx context.Context) error {
 	sub := s.client.SubscriptionInProject(s.subscriptionId, s.client.Project())
 
@@ -78,61 +202,151 @@ func (s *SubscriberService) Start(ctx context.Context) error {
 //
 // Messages are expected to be unordered. The handling of incoming metadata has to
 // be based on its update time and gracefully Nack()'d when necessary
-func processMessage(s *SubscriberService, msg *pubsub.Message) error {
-	// parse payload
-	var p payload
-	if err := json.Unmarshal(msg.Data, &p); err != nil {
-		return err
-	}
+func processMessage(ctx context.Context, s *SubscriberService, msg *pubsub.Message) (err error) {
+	eventType := messageEventType(msg)
+	ctx, span := tracing.Start(ctx, "processMessage",
+		attribute.String("messaging.message.id", msg.ID),
+		attribute.String("gcs.event_type", eventType))
+	defer tracing.End(span, &err)
+
+	var (
+		bucket string
+		handle func(ctx context.Context, s *SubscriberService, sep paths.Separator) error
+	)
+
+	// Folder events are audit log entries, which have no attributes
+	if _, ok := msg.Attributes["eventType"]; !ok {
+		var entry auditLogEntry
+		if err := json.Unmarshal(msg.Data, &entry); err != nil {
+			return err
+		}
 
-	inMetadata, err := newMetadata(p)
-	if err != nil {
-		return err
-	}
+		// Failed calls and other methods change no folder
+		if entry.ProtoPayload.Status.Code != 0 || !isFolderMethod(entry.ProtoPayload.MethodName) {
+			return nil
+		}
 
-	_, isReplaced := msg.Attributes["overwrittenByGeneration"]
-	eventType := msg.Attributes["eventType"]
+		event, err := newFolderEvent(entry)
+		if err != nil {
+			return err
+		}
 
-	// Ignore replacement messages
-	if isReplaced {
-		return nil
-	}
+		span.SetAttributes(tracing.Object(event.Bucket, event.Name)...)
+		metrics.EventLag.WithLabelValues(eventType).Observe(time.Since(event.Time).Seconds())
 
-	switch eventType {
-	case storage.ObjectFinalizeEvent:
-		if err = s.handleFinalize(inMetadata); err != nil {
+		bucket = event.Bucket
+		handle = func(ctx context.Context, s *SubscriberService, sep paths.Separator) error {
+			return s.handleFolder(ctx, sep, event)
+		}
+	} else {
+		// parse payload
+		var p payload
+		if err := json.Unmarshal(msg.Data, &p); err != nil {
 			return err
 		}
-	case storage.ObjectDeleteEvent:
-		if err := s.handleDelete(inMetadata); err != nil {
+
+		span.SetAttributes(tracing.Object(p.Bucket, p.Name)...)
+
+		inMetadata, err := newMetadata(p)
+		if err != nil {
 			return err
 		}
-	case storage.ObjectArchiveEvent:
-		if err := s.handleArchive(inMetadata); err != nil {
+
+		_, isReplaced := msg.Attributes["overwrittenByGeneration"]
+
+		// Ignore replacement messages
+		if isReplaced {
+			return nil
+		}
+
+		metrics.EventLag.WithLabelValues(eventType).Observe(time.Since(inMetadata.Updated).Seconds())
+
+		bucket = p.Bucket
+		handle = func(ctx context.Context, s *SubscriberService, sep paths.Separator) error {
+			switch eventType {
+			case storage.ObjectFinalizeEvent:
+				return s.handleFinalize(ctx, sep, inMetadata)
+			case storage.ObjectDeleteEvent:
+				return s.handleDelete(ctx, sep, inMetadata)
+			case storage.ObjectArchiveEvent:
+				return s.handleArchive(ctx, sep, inMetadata)
+			default:
+				return fmt.Errorf("unknown event type: %s", eventType)
+			}
+		}
+	}
+
+	return s.withinTx(ctx, func(ctx context.Context, s *SubscriberService) error {
+		// Names of the event are split at the delimiter recorded for the bucket
+		sep, err := s.bucketRepo.Separator(ctx, bucket)
+		if err != nil {
+			return fmt.Errorf("error getting bucket separator: %w", err)
+		}
+
+		if err := handle(ctx, s, sep); err != nil {
 			return err
 		}
-	default:
-		return fmt.Errorf("unknown event type: %s", eventType)
+
+		// Record progress for readiness checks
+		if s.statusRepo != nil {
+			return s.statusRepo.SetLastEvent(ctx, time.Now())
+		}
+		return nil
+	})
+}
+
+// withinTx runs fn with a copy of s whose repositories share one transaction,
+// so all database changes of an event are applied all-or-nothing.
+// fn runs directly on s if no transactor is configured.
+func (s *SubscriberService) withinTx(ctx context.Context, fn func(ctx context.Context, s *SubscriberService) error) error {
+	if s.transactor == nil {
+		return fn(ctx, s)
 	}
 
-	return nil
+	return s.transactor.WithinTx(ctx, func(ctx context.Context, repos repo.Repositories) error {
+		txService := *s
+		txService.metadataRepo = repos.Metadata
+		txService.directoryRepo = repos.Directory
+		txService.statusRepo = repos.Status
+		txService.moveRepo = repos.Move
+		txService.bucketRepo = repos.Bucket
+		return fn(ctx, &txService)
+	})
 }
 
 // consumeMessage is a callback function for pubsub.Receive() which handles
 // the acknowledgment of messages based on processMessage() results
 func (s *SubscriberService) consumeMessage(ctx context.Context, msg *pubsub.Message) {
-	if err := processMessage(s, msg); err != nil {
-		log.Printf("message not acknowledged: %v\n", err)
+	eventType := messageEventType(msg)
+	start := time.Now()
+	defer func() {
+		metrics.HandlerDuration.WithLabelValues(eventType).Observe(time.Since(start).Seconds())
+	}()
+
+	// Notification attributes identify the object without parsing the payload
+	logger := s.logger.With(
+		logging.KeyMessageId, msg.ID,
+		logging.KeyEventType, eventType,
+		logging.KeyBucket, msg.Attributes["bucketId"],
+		logging.KeyObject, msg.Attributes["objectId"],
+	)
+
+	// Outstanding messages are handled to completion when receiving is stopped
+	if err := processMessage(context.WithoutCancel(ctx), s, msg); err != nil {
+		logger.Warn("Message not acknowledged", logging.KeyError, err)
+		metrics.MessagesProcessed.WithLabelValues(eventType, "nack").Inc()
 		msg.Nack()
 		return
 	}
+	logger.Debug("Message acknowledged")
+	metrics.MessagesProcessed.WithLabelValues(eventType, "ack").Inc()
 	msg.Ack()
 }
 
 // handleFinalize takes incoming metadata and determines to insert or update
 // based on if metadata already exists and is newer
-func (s *SubscriberService) handleFinalize(inMetadata *model.Metadata) error {
-	existingMetadata, err := s.metadataRepo.Get(inMetadata.Bucket, inMetadata.Name)
+func (s *SubscriberService) handleFinalize(ctx context.Context, sep paths.Separator, inMetadata *model.Metadata) error {
+	existingMetadata, err := s.metadataRepo.Get(ctx, inMetadata.Bucket, inMetadata.Name)
 	if err != nil && err != sql.ErrNoRows {
 		return fmt.Errorf("error getting existing metadata: %w", err)
 	}
@@ -144,26 +358,26 @@ func (s *SubscriberService) handleFinalize(inMetadata *model.Metadata) error {
 		}
 
 		if existingMetadata.StorageClass != inMetadata.StorageClass {
-			return s.handleArchive(inMetadata)
+			return s.handleArchive(ctx, sep, inMetadata)
 		}
 	}
 
 	// Insert if metadata does not exist
 	if existingMetadata == nil {
-		if err := s.metadataRepo.Insert(inMetadata); err != nil {
+		if err := s.metadataRepo.Insert(ctx, sep, inMetadata); err != nil {
 			return fmt.Errorf("error inserting metadata: %w", err)
 		}
-		if err := s.directoryRepo.UpsertParentDirs(repo.StorageClass(inMetadata.StorageClass), inMetadata.Bucket, inMetadata.Name, inMetadata.Size, 1); err != nil {
+		if err := s.directoryRepo.UpsertParentDirs(ctx, sep, repo.StorageClass(inMetadata.StorageClass), inMetadata.Bucket, inMetadata.Name, inMetadata.Size, 1); err != nil {
 			return fmt.Errorf("error upserting parent directories: %w", err)
 		}
 	} else {
 		// Otherwise, update metadata
-		if err := s.metadataRepo.Update(inMetadata.Bucket, inMetadata.Name, inMetadata.StorageClass, inMetadata.Size, inMetadata.Updated); err != nil {
+		if err := s.metadataRepo.Update(ctx, inMetadata.Bucket, inMetadata.Name, inMetadata.StorageClass, inMetadata.Size, inMetadata.Updated); err != nil {
 			return fmt.Errorf("error updating metadata: %w", err)
 		}
 
 		sizeDiff := inMetadata.Size - existingMetadata.Size
-		if err := s.directoryRepo.UpsertParentDirs(repo.StorageClass(inMetadata.StorageClass), inMetadata.Bucket, inMetadata.Name, sizeDiff, 0); err != nil {
+		if err := s.directoryRepo.UpsertParentDirs(ctx, sep, repo.StorageClass(inMetadata.StorageClass), inMetadata.Bucket, inMetadata.Name, sizeDiff, 0); err != nil {
 			return fmt.Errorf("error upserting parent directories: %w", err)
 		}
 	}
@@ -171,8 +385,8 @@ func (s *SubscriberService) handleFinalize(inMetadata *model.Metadata) error {
 }
 
 // handleArchive takes incoming metadata and updates parent directories to new storage class
-func (s *SubscriberService) handleArchive(inMetadata *model.Metadata) error {
-	existingMetadata, err := s.metadataRepo.Get(inMetadata.Bucket, inMetadata.Name)
+func (s *SubscriberService) handleArchive(ctx context.Context, sep paths.Separator, inMetadata *model.Metadata) error {
+	existingMetadata, err := s.metadataRepo.Get(ctx, inMetadata.Bucket, inMetadata.Name)
 	if err != nil && err != sql.ErrNoRows {
 		return fmt.Errorf("error getting existing metadata: %w", err)
 	}
@@ -188,27 +402,34 @@ func (s *SubscriberService) handleArchive(inMetadata *model.Metadata) error {
 		}
 	} else {
 		// if metadata does not exist, it is a normal insert
-		return s.handleFinalize(inMetadata)
+		return s.handleFinalize(ctx, sep, inMetadata)
 	}
 
-	if err := s.metadataRepo.Update(inMetadata.Bucket, inMetadata.Name, inMetadata.StorageClass,
+	if err := s.metadataRepo.Update(ctx, inMetadata.Bucket, inMetadata.Name, inMetadata.StorageClass,
 		inMetadata.Size, inMetadata.Updated); err != nil {
 		return fmt.Errorf("error updating metadata: %w", err)
 	}
 
-	if err := s.directoryRepo.UpsertArchiveParentDirs(repo.StorageClass(existingMetadata.StorageClass),
-		repo.StorageClass(inMetadata.StorageClass), inMetadata.Bucket, inMetadata.Name, inMetadata.Size); err != nil {
+	// Move the size counted in parent directories, then count a size change of an overwrite
+	if err := s.directoryRepo.UpsertArchiveParentDirs(ctx, sep, repo.StorageClass(existingMetadata.StorageClass),
+		repo.StorageClass(inMetadata.StorageClass), inMetadata.Bucket, inMetadata.Name, existingMetadata.Size); err != nil {
 		return fmt.Errorf("error upserting parent directories: %w", err)
 	}
 
+	if sizeDiff := inMetadata.Size - existingMetadata.Size; sizeDiff != 0 {
+		if err := s.directoryRepo.UpsertParentDirs(ctx, sep, repo.StorageClass(inMetadata.StorageClass), inMetadata.Bucket, inMetadata.Name, sizeDiff, 0); err != nil {
+			return fmt.Errorf("error upserting parent directories: %w", err)
+		}
+	}
+
 	return nil
 }
 
 // handleDelete tries to delete incoming metadata inMetadata.
 // Returns error if metadata does not exist
-func (s *SubscriberService) handleDelete(inMetadata *model.Metadata) error {
+func (s *SubscriberService) handleDelete(ctx context.Context, sep paths.Separator, inMetadata *model.Metadata) error {
 	// Check if metadata exists
-	existingMetadata, err := s.metadataRepo.Get(inMetadata.Bucket, inMetadata.Name)
+	existingMetadata, err := s.metadataRepo.Get(ctx, inMetadata.Bucket, inMetadata.Name)
 	if err != nil {
 		return err
 	}
@@ -218,10 +439,47 @@ func (s *SubscriberService) handleDelete(inMetadata *model.Metadata) error {
 		return nil
 	}
 
-	if err := s.metadataRepo.Delete(inMetadata.Bucket, inMetadata.Name); err != nil {
+	if err := s.metadataRepo.Delete(ctx, inMetadata.Bucket, inMetadata.Name); err != nil {
 		return err
 	}
 
-	return s.directoryRepo.UpsertParentDirs(repo.StorageClass(inMetadata.StorageClass), inMetadata.Bucket,
-		inMetadata.Name, -inMetadata.Size, -1)
+	// Subtract what parent directories counted, which may differ from a reordered event
+	return s.directoryRepo.UpsertParentDirs(ctx, sep, repo.StorageClass(existingMetadata.StorageClass), inMetadata.Bucket,
+		inMetadata.Name, -existingMetadata.Size, -1)
+}
+
+// handleFolder records a folder created, deleted or renamed as a directory, which exists
+// even when it holds no objects. Deleting or renaming a folder that is not recorded returns
+// an error, so that an event notified before the creation is handled once the creation is.
+func (s *SubscriberService) handleFolder(ctx context.Context, sep paths.Separator, event *folderEvent) error {
+	switch event.Method {
+	case FolderCreateMethod, ManagedFolderCreateMethod:
+		return s.directoryRepo.UpsertFolder(ctx, sep, event.Bucket, event.Name)
+	case FolderDeleteMethod, ManagedFolderDeleteMethod:
+		return s.directoryRepo.DeleteFolder(ctx, event.Bucket, event.Name)
+	case FolderRenameMethod:
+		return s.handleRename(ctx, sep, event)
+	default:
+		return fmt.Errorf("unknown method: %s", event.Method)
+	}
+}
+
+// handleRename moves the subtree of the renamed folder to the destination folder
+func (s *SubscriberService) handleRename(ctx context.Context, sep paths.Separator, event *folderEvent) error {
+	if _, err := s.moveRepo.Move(ctx, event.Bucket, event.Source, event.Name); err != nil {
+		if err != sql.ErrNoRows {
+			return fmt.Errorf("error moving folder: %w", err)
+		}
+
+		// A redelivered rename has already moved the source folder
+		dir, getErr := s.directoryRepo.Get(ctx, event.Bucket, event.Name)
+		if getErr != nil {
+			return fmt.Errorf("error getting destination folder: %w", getErr)
+		}
+		if dir == nil || !dir.Folder {
+			return err
+		}
+		return nil
+	}
+	return s.directoryRepo.UpsertFolder(ctx, sep, event.Bucket, event.Name)
 }
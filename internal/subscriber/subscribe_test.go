@@ -2,10 +2,15 @@ package subscriber
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/storage"
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/model"
+	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/paths"
 	"github.com/GoogleCloudPlatform/gcs-metadata-server/internal/repo"
 )
 
@@ -120,7 +125,7 @@ func TestHandleFinalize(t *testing.T) {
 
 			// Insert existing metadata if available
 			if tc.existingMetadata != nil {
-				if err := metadataRepo.Insert(tc.existingMetadata); err != nil {
+				if err := metadataRepo.Insert(context.Background(), paths.Default, tc.existingMetadata); err != nil {
 					t.Fatal(err)
 				}
 			}
@@ -139,7 +144,7 @@ func TestHandleFinalize(t *testing.T) {
 			}
 
 			// Call handleFinalize
-			if err := s.handleFinalize(tc.inMetadata); err != nil {
+			if err := s.handleFinalize(context.Background(), paths.Default, tc.inMetadata); err != nil {
 				if tc.wantErr {
 					return
 				}
@@ -256,7 +261,7 @@ func TestHandleArchive(t *testing.T) {
 
 			// Insert existing metadata if available
 			if tc.existingMetadata != nil {
-				if err := metadataRepo.Insert(tc.existingMetadata); err != nil {
+				if err := metadataRepo.Insert(context.Background(), paths.Default, tc.existingMetadata); err != nil {
 					t.Fatal(err)
 				}
 			}
@@ -275,7 +280,7 @@ func TestHandleArchive(t *testing.T) {
 			}
 
 			// Call handleArchive
-			if err := s.handleArchive(tc.inMetadata); err != nil {
+			if err := s.handleArchive(context.Background(), paths.Default, tc.inMetadata); err != nil {
 				if tc.wantErr {
 					return
 				}
@@ -389,7 +394,7 @@ func TestHandleDelete(t *testing.T) {
 
 			// Insert existing metadata if available
 			if tc.existingMetadata != nil {
-				if err := metadataRepo.Insert(tc.existingMetadata); err != nil {
+				if err := metadataRepo.Insert(context.Background(), paths.Default, tc.existingMetadata); err != nil {
 					t.Fatal(err)
 				}
 			}
@@ -408,7 +413,7 @@ func TestHandleDelete(t *testing.T) {
 			}
 
 			// Call handleDelete
-			if err := s.handleDelete(tc.inMetadata); err != nil {
+			if err := s.handleDelete(context.Background(), paths.Default, tc.inMetadata); err != nil {
 				if tc.wantErr {
 					return
 				}
@@ -437,23 +442,23 @@ type mockMetadataRepository struct {
 	deleteCalls int
 }
 
-func (m *mockMetadataRepository) Get(bucket, name string) (*model.Metadata, error) {
-	return m.MetadataRepository.Get(bucket, name)
+func (m *mockMetadataRepository) Get(ctx context.Context, bucket, name string) (*model.Metadata, error) {
+	return m.MetadataRepository.Get(ctx, bucket, name)
 }
 
-func (m *mockMetadataRepository) Insert(obj *model.Metadata) error {
+func (m *mockMetadataRepository) Insert(ctx context.Context, sep paths.Separator, obj *model.Metadata) error {
 	m.insertCalls++
-	return m.MetadataRepository.Insert(obj)
+	return m.MetadataRepository.Insert(ctx, sep, obj)
 }
 
-func (m *mockMetadataRepository) Update(bucket, name, storageClass string, size int64, updated time.Time) error {
+func (m *mockMetadataRepository) Update(ctx context.Context, bucket, name, storageClass string, size int64, updated time.Time) error {
 	m.updateCalls++
-	return m.MetadataRepository.Update(bucket, name, storageClass, size, updated)
+	return m.MetadataRepository.Update(ctx, bucket, name, storageClass, size, updated)
 }
 
-func (m *mockMetadataRepository) Delete(bucket, name string) error {
+func (m *mockMetadataRepository) Delete(ctx context.Context, bucket, name string) error {
 	m.deleteCalls++
-	return m.MetadataRepository.Delete(bucket, name)
+	return m.MetadataRepository.Delete(ctx, bucket, name)
 }
 
 type mockDirectoryRepository struct {
@@ -462,20 +467,318 @@ type mockDirectoryRepository struct {
 	upsertArchiveCalls int
 }
 
-func (m *mockDirectoryRepository) Insert(dir model.Directory) error {
-	return m.DirectoryRepository.Insert(dir)
+func (m *mockDirectoryRepository) Insert(ctx context.Context, sep paths.Separator, dir model.Directory) error {
+	return m.DirectoryRepository.Insert(ctx, sep, dir)
 }
 
-func (m *mockDirectoryRepository) Delete(bucket, name string) error {
-	return m.DirectoryRepository.Delete(bucket, name)
+func (m *mockDirectoryRepository) Delete(ctx context.Context, bucket, name string) error {
+	return m.DirectoryRepository.Delete(ctx, bucket, name)
 }
 
-func (m *mockDirectoryRepository) UpsertParentDirs(storageClass repo.StorageClass, bucket string, objName string, newSize int64, newCount int64) error {
+func (m *mockDirectoryRepository) UpsertParentDirs(ctx context.Context, sep paths.Separator, storageClass repo.StorageClass, bucket string, objName string, newSize int64, newCount int64) error {
 	m.upsertCalls++
-	return m.DirectoryRepository.UpsertParentDirs(storageClass, bucket, objName, newSize, newCount)
+	return m.DirectoryRepository.UpsertParentDirs(ctx, sep, storageClass, bucket, objName, newSize, newCount)
 }
 
-func (m *mockDirectoryRepository) UpsertArchiveParentDirs(oldStorageClass repo.StorageClass, newStorageClass repo.StorageClass, bucket, objName string, size int64) error {
+func (m *mockDirectoryRepository) UpsertArchiveParentDirs(ctx context.Context, sep paths.Separator, oldStorageClass repo.StorageClass, newStorageClass repo.StorageClass, bucket, objName string, size int64) error {
 	m.upsertArchiveCalls++
-	return m.DirectoryRepository.UpsertArchiveParentDirs(oldStorageClass, newStorageClass, bucket, objName, size)
+	return m.DirectoryRepository.UpsertArchiveParentDirs(ctx, sep, oldStorageClass, newStorageClass, bucket, objName, size)
+}
+
+func TestProcessMessageAtomic(t *testing.T) {
+	db := repo.NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fail upserting directories on first delivery only
+	transactor := &failingTransactor{Transactor: repo.NewTransactor(db), failures: 1}
+	s := &SubscriberService{
+		directoryRepo: repo.NewDirectoryRepository(db),
+		metadataRepo:  repo.NewMetadataRepository(db),
+		transactor:    transactor,
+	}
+
+	msg := &pubsub.Message{
+		Data:       []byte(`{"bucket":"mock-bucket","name":"mock-1/mock-object","size":"1024","storageClass":"STANDARD","updated":"2024-01-01T00:00:00Z","created":"2024-01-01T00:00:00Z"}`),
+		Attributes: map[string]string{"eventType": storage.ObjectFinalizeEvent},
+	}
+
+	if err := processMessage(context.Background(), s, msg); err == nil {
+		t.Fatal("Expected error on first delivery but did pass")
+	}
+
+	// Redelivery must insert the object instead of updating it with a size diff of zero
+	if err := processMessage(context.Background(), s, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dirName := range []string{"/", "mock-1/"} {
+		var gotDir model.Directory
+		if err := db.QueryRowx(`SELECT count, size_standard FROM directory WHERE name = ?`, dirName).StructScan(&gotDir); err != nil {
+			t.Fatal(err)
+		}
+
+		if gotDir.Count != 1 {
+			t.Errorf("Directory %s count mismatch: got %d, want %d", dirName, gotDir.Count, 1)
+		}
+
+		if gotDir.SizeStandard != 1024 {
+			t.Errorf("Directory %s size standard mismatch: got %d, want %d", dirName, gotDir.SizeStandard, 1024)
+		}
+	}
+}
+
+func TestProcessMessageDelimiter(t *testing.T) {
+	db := repo.NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.NewBucketRepository(db).Upsert(context.Background(), &model.Bucket{Name: "piped", Delimiter: "|"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dirRepo := repo.NewDirectoryRepository(db)
+	s := &SubscriberService{
+		directoryRepo: dirRepo,
+		metadataRepo:  repo.NewMetadataRepository(db),
+		transactor:    repo.NewTransactor(db),
+	}
+
+	msg := &pubsub.Message{
+		Data:       []byte(`{"bucket":"piped","name":"a|b/c","size":"1024","storageClass":"STANDARD","updated":"2024-01-01T00:00:00Z","created":"2024-01-01T00:00:00Z"}`),
+		Attributes: map[string]string{"eventType": storage.ObjectFinalizeEvent},
+	}
+
+	if err := processMessage(context.Background(), s, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// Names are split at the delimiter recorded for the bucket
+	for name, wantExists := range map[string]bool{"a|": true, "a|b/": false} {
+		dir, err := dirRepo.Get(context.Background(), "piped", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if (dir != nil) != wantExists {
+			t.Errorf("Directory %s existence mismatch: got %t, want %t", name, dir != nil, wantExists)
+		}
+	}
+}
+
+func TestHandleFolder(t *testing.T) {
+	db := repo.NewDatabase(":memory:", 1)
+	db.Connect(context.Background())
+	defer db.Close()
+
+	if err := db.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	dirRepo := repo.NewDirectoryRepository(db)
+	s := &SubscriberService{
+		directoryRepo: dirRepo,
+		metadataRepo:  repo.NewMetadataRepository(db),
+		transactor:    repo.NewTransactor(db),
+	}
+
+	// Each event applies to the directories left by the previous ones
+	testCases := []struct {
+		name string
+		// attributes are those of object notifications, nil for audit log entries
+		attributes map[string]string
+		data       string
+		wantErr    bool
+		// wantDirs maps directory names to whether they are folders, nil if they do not exist
+		wantDirs map[string]*bool
+	}{
+		{
+			"Creates folder",
+			nil,
+			auditLog(FolderCreateMethod, "projects/_/buckets/mock/folders/a/b/", ""),
+			false,
+			map[string]*bool{"/": ptr(false), "a/": ptr(false), "a/b/": ptr(true)},
+		},
+		{
+			"Creates managed folder",
+			nil,
+			auditLog(ManagedFolderCreateMethod, "projects/_/buckets/mock/managedFolders/managed", ""),
+			false,
+			map[string]*bool{"managed/": ptr(true)},
+		},
+		{
+			"Fails deleting folder not created yet",
+			nil,
+			auditLog(FolderDeleteMethod, "projects/_/buckets/mock/folders/other/", ""),
+			true,
+			map[string]*bool{"other/": nil},
+		},
+		{
+			"Renames folder",
+			nil,
+			auditLog(FolderRenameMethod, "projects/_/buckets/mock/folders/a/b/", `,"request":{"destinationFolderId":"c/"}`),
+			false,
+			map[string]*bool{"a/": ptr(false), "a/b/": nil, "c/": ptr(true)},
+		},
+		{
+			"Creates object in folder",
+			map[string]string{"eventType": storage.ObjectFinalizeEvent},
+			`{"bucket":"mock","name":"c/file1","size":"5","storageClass":"STANDARD","updated":"2024-01-01T00:00:00Z"}`,
+			false,
+			map[string]*bool{"c/": ptr(true)},
+		},
+		{
+			"Renames folder holding objects",
+			nil,
+			auditLog(FolderRenameMethod, "projects/_/buckets/mock/folders/c/", `,"request":{"destinationFolderId":"e/f/"}`),
+			false,
+			map[string]*bool{"c/": nil, "e/": ptr(false), "e/f/": ptr(true)},
+		},
+		{
+			"Acknowledges redelivered rename",
+			nil,
+			auditLog(FolderRenameMethod, "projects/_/buckets/mock/folders/c/", `,"request":{"destinationFolderId":"e/f/"}`),
+			false,
+			map[string]*bool{"c/": nil, "e/f/": ptr(true)},
+		},
+		{
+			"Fails renaming folder not created yet",
+			nil,
+			auditLog(FolderRenameMethod, "projects/_/buckets/mock/folders/g/", `,"request":{"destinationFolderId":"h/"}`),
+			true,
+			map[string]*bool{"g/": nil, "h/": nil},
+		},
+		{
+			"Fails renaming folder without destination",
+			nil,
+			auditLog(FolderRenameMethod, "projects/_/buckets/mock/folders/e/f/", ""),
+			true,
+			map[string]*bool{"e/f/": ptr(true)},
+		},
+		{
+			"Fails on resource other than a folder",
+			nil,
+			auditLog(FolderCreateMethod, "projects/_/buckets/mock/objects/d/", ""),
+			true,
+			map[string]*bool{"d/": nil},
+		},
+		{
+			"Ignores failed call",
+			nil,
+			auditLog(FolderDeleteMethod, "projects/_/buckets/mock/folders/e/f/", `,"status":{"code":9,"message":"folder not empty"}`),
+			false,
+			map[string]*bool{"e/f/": ptr(true)},
+		},
+		{
+			"Ignores other methods",
+			nil,
+			auditLog("google.storage.control.v2.StorageControl.GetFolder", "projects/_/buckets/mock/folders/d/", ""),
+			false,
+			map[string]*bool{"d/": nil},
+		},
+		{
+			"Deletes managed folder",
+			nil,
+			auditLog(ManagedFolderDeleteMethod, "projects/_/buckets/mock/managedFolders/managed/", ""),
+			false,
+			map[string]*bool{"managed/": nil},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &pubsub.Message{
+				Data:       []byte(tc.data),
+				Attributes: tc.attributes,
+			}
+
+			if err := processMessage(context.Background(), s, msg); (err != nil) != tc.wantErr {
+				t.Fatalf("Error mismatch: got %v, want error %t", err, tc.wantErr)
+			}
+
+			for name, wantFolder := range tc.wantDirs {
+				got, err := dirRepo.Get(context.Background(), "mock", name)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if (got == nil) != (wantFolder == nil) || got != nil && got.Folder != *wantFolder {
+					t.Errorf("Directory %s mismatch: got %+v, want folder %v", name, got, wantFolder)
+				}
+			}
+		})
+	}
+
+	// Objects of renamed folders are moved with them
+	moved, err := s.metadataRepo.Get(context.Background(), "mock", "e/f/file1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if moved.Size != 5 {
+		t.Errorf("Moved object size mismatch: got %d, want %d", moved.Size, 5)
+	}
+
+	violations, err := repo.NewInvariantRepository(db).Check(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range violations {
+		t.Errorf("Invariant violated: %s", v)
+	}
+}
+
+// auditLog returns the entry of the audit log of a call of method on resource, with the
+// additional fields of the AuditLog, as routed to Pub/Sub by a log sink
+func auditLog(method, resource, fields string) string {
+	return fmt.Sprintf(`{"logName":"projects/mock/logs/cloudaudit.googleapis.com%%2Factivity","timestamp":"2024-01-01T00:00:00Z",`+
+		`"protoPayload":{"@type":"type.googleapis.com/google.cloud.audit.AuditLog","serviceName":"storage.googleapis.com",`+
+		`"methodName":%q,"resourceName":%q%s}}`, method, resource, fields)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+type failingTransactor struct {
+	repo.Transactor
+	failures int
+}
+
+func (f *failingTransactor) WithinTx(ctx context.Context, fn func(ctx context.Context, repos repo.Repositories) error) error {
+	return f.Transactor.WithinTx(ctx, func(ctx context.Context, repos repo.Repositories) error {
+		if f.failures > 0 {
+			f.failures--
+			repos.Directory = &failingDirectoryRepository{repos.Directory}
+		}
+		return fn(ctx, repos)
+	})
+}
+
+type failingDirectoryRepository struct {
+	repo.DirectoryRepository
+}
+
+func (f *failingDirectoryRepository) UpsertParentDirs(ctx context.Context, sep paths.Separator, storageClass repo.StorageClass, bucket string, objName string, newSize int64, newCount int64) error {
+	return errors.New("mock error")
 }
@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestInstrumentHandler(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /mock/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		// Repository spans are children of the request span
+		_, span := Start(r.Context(), "child")
+		span.End()
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/mock/a/b", nil)
+	InstrumentHandler(mux).ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Span count mismatch: got %d, want %d", len(spans), 2)
+	}
+
+	child, server := spans[0], spans[1]
+	if server.Name() != "GET /mock/{path...}" {
+		t.Errorf("Span name mismatch: got %s, want %s", server.Name(), "GET /mock/{path...}")
+	}
+
+	if server.Status().Code != codes.Error {
+		t.Errorf("Span status mismatch: got %v, want %v", server.Status().Code, codes.Error)
+	}
+
+	if child.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("Child span is not parented by request span")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build embedui
+
+package ui
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+func embedded() (fs.FS, error) {
+	return fs.Sub(dist, "dist")
+}
@@ -0,0 +1,178 @@
+package ui
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const indexFile = "index.html"
+
+// contentSecurityPolicy allows the UI its own scripts and the Google Fonts stylesheets it links
+const contentSecurityPolicy = "default-src 'self'; " +
+	"style-src 'self' 'unsafe-inline' https://fonts.googleapis.com; " +
+	"font-src 'self' https://fonts.gstatic.com; " +
+	"img-src 'self' data:; " +
+	"frame-ancestors 'none'"
+
+// hashedAsset matches file names with a content hash added by the Angular build,
+// which can be cached forever since their content never changes
+var hashedAsset = regexp.MustCompile(`-[A-Z0-9]{8,}\.(js|css)$`)
+
+// compressibleTypes are content types worth compressing with gzip
+var compressibleTypes = []string{"text/", "application/javascript", "application/json", "image/svg+xml"}
+
+// asset is a file read into memory with its optional gzip encoding
+type asset struct {
+	content     []byte
+	gzipped     []byte
+	etag        string
+	contentType string
+}
+
+type handler struct {
+	fsys   fs.FS
+	assets sync.Map // name -> *asset
+}
+
+// Handler serves the files of fsys, falling back to index.html for paths which
+// are not files so that client-side routes can be loaded directly
+func Handler(fsys fs.FS) (http.Handler, error) {
+	if _, err := fs.Stat(fsys, indexFile); err != nil {
+		return nil, fmt.Errorf("UI assets have no %s: %w", indexFile, err)
+	}
+	return &handler{fsys: fsys}, nil
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = indexFile
+	}
+
+	if !fs.ValidPath(name) {
+		http.NotFound(w, r)
+		return
+	}
+
+	a, err := h.load(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Missing assets are not routes of the application
+		if path.Ext(name) != "" {
+			http.NotFound(w, r)
+			return
+		}
+		name = indexFile
+		a, err = h.load(name)
+	}
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", a.contentType)
+	header.Set("Content-Security-Policy", contentSecurityPolicy)
+	header.Set("Cache-Control", cacheControl(name))
+	header.Add("Vary", "Accept-Encoding")
+
+	content, etag := a.content, a.etag
+	if a.gzipped != nil && acceptsGzip(r) {
+		content, etag = a.gzipped, a.etag+"-gzip"
+		header.Set("Content-Encoding", "gzip")
+	}
+	header.Set("ETag", `"`+etag+`"`)
+
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+}
+
+// load reads a file of fsys, caching it and its gzip encoding
+func (h *handler) load(name string) (*asset, error) {
+	if a, ok := h.assets.Load(name); ok {
+		return a.(*asset), nil
+	}
+
+	// Directories are treated as missing files
+	info, err := fs.Stat(h.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fs.ErrNotExist
+	}
+
+	content, err := fs.ReadFile(h.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(content)
+	a := &asset{
+		content:     content,
+		etag:        hex.EncodeToString(sum[:16]),
+		contentType: mime.TypeByExtension(path.Ext(name)),
+	}
+	if a.contentType == "" {
+		a.contentType = http.DetectContentType(content)
+	}
+
+	if compressible(a.contentType) {
+		var buf bytes.Buffer
+		zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		zw.Write(content)
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+
+		// Only keep the encoding if it is smaller
+		if buf.Len() < len(content) {
+			a.gzipped = buf.Bytes()
+		}
+	}
+
+	actual, _ := h.assets.LoadOrStore(name, a)
+	return actual.(*asset), nil
+}
+
+// cacheControl lets browsers cache hashed assets forever and revalidate everything else,
+// so that a new deployment is picked up on the next load of index.html
+func cacheControl(name string) string {
+	switch {
+	case hashedAsset.MatchString(name):
+		return "public, max-age=31536000, immutable"
+	case name == indexFile:
+		return "no-cache"
+	default:
+		return "public, max-age=3600"
+	}
+}
+
+func compressible(contentType string) bool {
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.TrimSpace(name) == "gzip" && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package ui
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestHandler(t *testing.T) {
+	index := "<html>" + strings.Repeat("index ", 100) + "</html>"
+	fsys := fstest.MapFS{
+		"index.html":       {Data: []byte(index)},
+		"main-ABCD1234.js": {Data: []byte(strings.Repeat("console.log(1);", 100))},
+		"favicon.ico":      {Data: []byte{0, 0, 1, 0}},
+		"media/font.woff2": {Data: []byte("font")},
+	}
+
+	h, err := Handler(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name         string
+		target       string
+		gzip         bool
+		wantStatus   int
+		wantBody     string
+		wantCache    string
+		wantType     string
+		wantEncoding string
+	}{
+		{"Serves index at root", "/", false, http.StatusOK, index, "no-cache", "text/html; charset=utf-8", ""},
+		{"Falls back to index for routes", "/explore/mock", false, http.StatusOK, index, "no-cache", "text/html; charset=utf-8", ""},
+		{"Falls back to index for directories", "/media", false, http.StatusOK, index, "no-cache", "text/html; charset=utf-8", ""},
+		{"Caches hashed assets forever", "/main-ABCD1234.js", false, http.StatusOK, strings.Repeat("console.log(1);", 100), "public, max-age=31536000, immutable", "text/javascript; charset=utf-8", ""},
+		{"Revalidates unhashed assets", "/favicon.ico", false, http.StatusOK, "\x00\x00\x01\x00", "public, max-age=3600", "image/vnd.microsoft.icon", ""},
+		{"Compresses with gzip", "/main-ABCD1234.js", true, http.StatusOK, strings.Repeat("console.log(1);", 100), "public, max-age=31536000, immutable", "text/javascript; charset=utf-8", "gzip"},
+		{"Does not compress binary assets", "/favicon.ico", true, http.StatusOK, "\x00\x00\x01\x00", "public, max-age=3600", "image/vnd.microsoft.icon", ""},
+		{"Returns not found for missing assets", "/missing.js", false, http.StatusNotFound, "", "", "", ""},
+		{"Does not escape root", "/../../etc/passwd", false, http.StatusOK, index, "no-cache", "text/html; charset=utf-8", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.target, nil)
+			if tc.gzip {
+				req.Header.Set("Accept-Encoding", "br, gzip")
+			}
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("Status code mismatch: got %d, want %d", rr.Code, tc.wantStatus)
+			}
+
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			if got := rr.Header().Get("Cache-Control"); got != tc.wantCache {
+				t.Errorf("Cache-Control mismatch: got %q, want %q", got, tc.wantCache)
+			}
+
+			if got := rr.Header().Get("Content-Type"); got != tc.wantType {
+				t.Errorf("Content-Type mismatch: got %q, want %q", got, tc.wantType)
+			}
+
+			if got := rr.Header().Get("Content-Encoding"); got != tc.wantEncoding {
+				t.Fatalf("Content-Encoding mismatch: got %q, want %q", got, tc.wantEncoding)
+			}
+
+			var body io.Reader = rr.Body
+			if tc.wantEncoding == "gzip" {
+				if body, err = gzip.NewReader(rr.Body); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(got, []byte(tc.wantBody)) {
+				t.Errorf("Body mismatch: got %q, want %q", got, tc.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandlerNotModified(t *testing.T) {
+	h, err := Handler(fstest.MapFS{"index.html": {Data: []byte("<html></html>")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("Status code mismatch: got %d, want %d", rr.Code, http.StatusNotModified)
+	}
+}
+
+func TestHandlerWithoutIndex(t *testing.T) {
+	if _, err := Handler(fstest.MapFS{}); err == nil {
+		t.Error("Expected error but did pass")
+	}
+}
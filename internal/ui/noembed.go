@@ -0,0 +1,9 @@
+//go:build !embedui
+
+package ui
+
+import "io/fs"
+
+func embedded() (fs.FS, error) {
+	return nil, ErrNotEmbedded
+}
@@ -0,0 +1,22 @@
+// Package ui serves the built Angular explorer.
+//
+// Assets are only embedded in binaries built with the embedui tag after
+// copying the UI build into dist/, which go generate does:
+//
+//	go generate ./internal/ui && go build -tags embedui ./cmd/api
+package ui
+
+//go:generate sh -c "cd ../../ui && npm ci && npm run build && rm -rf ../internal/ui/dist && cp -r dist/gcs-metadata-ui/browser ../internal/ui/dist"
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// ErrNotEmbedded is returned by Assets in binaries built without the embedui tag
+var ErrNotEmbedded = errors.New("UI assets are not embedded, build with -tags embedui")
+
+// Assets returns the embedded UI build rooted at index.html
+func Assets() (fs.FS, error) {
+	return embedded()
+}
@@ -1,3 +1,4 @@
 export const environment = {
-  apiBaseUrl: 'https://example.com',
+  // Production builds are served by the API on the same origin
+  apiBaseUrl: '',
 };